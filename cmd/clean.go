@@ -3,22 +3,41 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"imagedupfinder/internal/audit"
 	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/hash"
 	"imagedupfinder/internal/models"
-	"imagedupfinder/internal/storage"
+	"imagedupfinder/internal/report"
 )
 
 var (
 	dryRun    bool
 	moveTo    string
+	keepTo    string
+	preserve  bool
+	nameTmpl  string
 	permanent bool
 	noConfirm bool
 	groupIDs  []int
+	keepCount int
+
+	chmodForce  bool
+	verifyBytes bool
+
+	cleanFolder string
+	minReclaim  string
+	backupTo    string
+
+	respectSidecars bool
+	showDiff        bool
+	pruneEmpty      bool
 )
 
 var cleanCmd = &cobra.Command{
@@ -27,22 +46,66 @@ var cleanCmd = &cobra.Command{
 	Long: `Remove duplicate images, keeping the highest quality version of each.
 
 The clean command will:
-1. Keep the image with the highest quality score in each group
+1. Keep the image with the highest quality score in each group (or the best
+   --keep-count images)
 2. Move lower quality duplicates to trash (default) or delete permanently
 
 Options:
   --dry-run     Preview what would be removed without actually removing
   --permanent   Delete files permanently instead of moving to trash
   --move-to     Move duplicates to a specific folder
+  --name-template  With --move-to, name each moved file from placeholders:
+                {group}, {orig} (name without extension), {ext} (appended
+                if absent), {date} (modification date, YYYYMMDD) and
+                {counter} (counts up on name collisions)
+  --keep-to     After removing a group's duplicates, move the kept image
+                into this folder (e.g. an organized archive) and update its
+                stored path
+  --preserve-tree  With --move-to or --keep-to, recreate each file's path
+                relative to its scanned folder instead of moving everything
+                flat
   --yes         Skip confirmation prompt
   --group       Specify group IDs to clean (can be used multiple times)
+  --folder      Only remove duplicates located under this folder
+  --keep-count  Keep this many of the best images in each group and remove
+                only the rest; --keep-to still moves only the best one
+  --min-reclaim Only clean groups whose duplicates add up to at least this
+                size (e.g. 5MB), as reported by list
+  --show-diff   Before confirming, print each group's kept image and its
+                first removal side by side (resolution, size, format,
+                score), marking where the removal is bigger
+  --verify-bytes  Re-read each file and the one kept in its group right
+                before removing it; skip it unless they still match
+  --chmod-force If a file can't be removed for lack of permission, make
+                it writable (on Linux and macOS, its folder) and retry
+  --backup      Before removing anything, write every file to be removed
+                into this new .tar.gz, under its absolute path; nothing is
+                removed if that fails
+  --respect-sidecars  Treat a RAW+JPEG pair shot together (IMG_1234.CR2 and
+                IMG_1234.JPG) as a unit: a removed file's sidecar is
+                removed the same way, and --keep-to moves a kept file's
+                sidecar along with it
+  --prune-empty-dirs  Afterwards remove the folders left empty by the
+                removed or moved files, and their parents that became empty
+                in turn, up to but not including the scanned folder; a
+                folder holding any other file, even a hidden one, is kept
 
 Example:
   imagedupfinder clean                     # Move to trash (default)
   imagedupfinder clean --permanent         # Delete permanently
   imagedupfinder clean --move-to=./backup  # Move to specific folder
+  imagedupfinder clean --move-to=./backup --preserve-tree  # Keep folder layout
+  imagedupfinder clean --move-to=./backup --name-template='g{group}_{orig}_{date}'
+  imagedupfinder clean --keep-to=./archive --preserve-tree  # Gather the kept images
   imagedupfinder clean --dry-run           # Preview only
-  imagedupfinder clean --group=1 --group=3 # Clean only groups 1 and 3`,
+  imagedupfinder clean --show-diff         # Compare keep and removal per group first
+  imagedupfinder clean --group=1 --group=3 # Clean only groups 1 and 3
+  imagedupfinder clean --folder=./vacation2023  # Only remove files in this folder
+  imagedupfinder clean --min-reclaim=5MB   # Skip groups freeing less than 5 MB
+  imagedupfinder clean --keep-count=2      # Thin groups out to their best two
+  imagedupfinder clean --permanent --backup=dups.tar.gz  # Keep a copy first
+  imagedupfinder clean --respect-sidecars  # Trash each duplicate's RAW or JPEG too
+  imagedupfinder clean --move-to=./backup --prune-empty-dirs  # Drop emptied folders`,
 	RunE: runClean,
 }
 
@@ -50,25 +113,77 @@ func init() {
 	cleanCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview without removing")
 	cleanCmd.Flags().BoolVar(&permanent, "permanent", false, "Delete permanently instead of moving to trash")
 	cleanCmd.Flags().StringVar(&moveTo, "move-to", "", "Move duplicates to this folder")
+	cleanCmd.Flags().StringVar(&nameTmpl, "name-template", "", "With --move-to, name moved files from {group}, {orig}, {ext}, {date} and {counter}, e.g. g{group}_{orig}_{date}")
+	cleanCmd.Flags().StringVar(&keepTo, "keep-to", "", "After removing a group's duplicates, move the kept image into this folder")
+	cleanCmd.Flags().BoolVar(&preserve, "preserve-tree", false, "With --move-to or --keep-to, keep each file's path relative to its scanned folder")
 	cleanCmd.Flags().BoolVarP(&noConfirm, "yes", "y", false, "Skip confirmation prompt")
+	cleanCmd.Flags().StringVar(&cleanFolder, "folder", "", "Only remove duplicates located under this folder")
+	cleanCmd.Flags().IntVar(&keepCount, "keep-count", 1, "Keep this many of the highest-scoring images in each group")
+	cleanCmd.Flags().StringVar(&minReclaim, "min-reclaim", "", "Only clean groups whose duplicates total at least this size (e.g. 5MB)")
+	cleanCmd.Flags().BoolVar(&showDiff, "show-diff", false, "Print each group's kept image and first removal side by side before confirming")
+	cleanCmd.Flags().BoolVar(&verifyBytes, "verify-bytes", false, "Re-read each file and its group's kept image before removing it, and skip it unless they still match")
+	cleanCmd.Flags().StringVar(&backupTo, "backup", "", "Write the files to be removed into this new .tar.gz first, and remove nothing if that fails")
+	cleanCmd.Flags().BoolVar(&respectSidecars, "respect-sidecars", false, "Remove each removed file's RAW or JPEG sidecar with it, and with --keep-to move the kept file's along")
+	cleanCmd.Flags().BoolVar(&pruneEmpty, "prune-empty-dirs", false, "Remove folders under the scanned folders that the cleaned files left empty")
+	cleanCmd.Flags().BoolVar(&chmodForce, "chmod-force", false, "Clear read-only permissions and retry when removal is denied (like rm -f)")
 	cleanCmd.Flags().IntSliceVarP(&groupIDs, "group", "g", nil, "Group IDs to clean (can be specified multiple times)")
 	rootCmd.AddCommand(cleanCmd)
 }
 
 func runClean(cmd *cobra.Command, args []string) error {
-	store, err := storage.NewStorage(dbPath)
+	if preserve && moveTo == "" && keepTo == "" {
+		return fmt.Errorf("--preserve-tree requires --move-to or --keep-to")
+	}
+	var template fileutil.NameTemplate
+	if nameTmpl != "" {
+		if moveTo == "" || preserve {
+			return fmt.Errorf("--name-template requires --move-to without --preserve-tree")
+		}
+		var err error
+		if template, err = fileutil.ParseNameTemplate(nameTmpl); err != nil {
+			return fmt.Errorf("invalid --name-template: %w", err)
+		}
+	}
+	// Stored paths are absolute, and so must the kept images' new ones be
+	if keepTo != "" {
+		var err error
+		if keepTo, err = filepath.Abs(keepTo); err != nil {
+			return fmt.Errorf("failed to resolve --keep-to: %w", err)
+		}
+	}
+	if keepCount < 1 {
+		return fmt.Errorf("invalid --keep-count %d (want at least 1)", keepCount)
+	}
+	var minBytes int64
+	if minReclaim != "" {
+		var err error
+		if minBytes, err = fileutil.ParseSize(minReclaim); err != nil {
+			return fmt.Errorf("invalid --min-reclaim: %w", err)
+		}
+	}
+
+	// A dry run only reads, so it can run while another command writes
+	open := openWriteStorage
+	if dryRun {
+		open = openStorage
+	}
+	store, err := open()
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer store.Close()
 
-	groups, err := store.GetDuplicateGroups()
+	folder, err := absFolder(cleanFolder)
+	if err != nil {
+		return err
+	}
+	groups, err := loadGroups(store, folder)
 	if err != nil {
 		return fmt.Errorf("failed to get groups: %w", err)
 	}
 
 	if len(groups) == 0 {
-		fmt.Println("No duplicate groups found.")
+		logger.Printf("No duplicate groups found.\n")
 		return nil
 	}
 
@@ -87,68 +202,190 @@ func runClean(cmd *cobra.Command, args []string) error {
 		}
 
 		if len(filtered) == 0 {
-			fmt.Printf("No matching groups found for IDs: %v\n", groupIDs)
-			fmt.Println("Run 'imagedupfinder list' to see available group IDs.")
+			logger.Printf("No matching groups found for IDs: %v\n", groupIDs)
+			logger.Infof("Run 'imagedupfinder list' to see available group IDs.\n")
 			return nil
 		}
 
 		groups = filtered
-		fmt.Printf("Processing %d selected group(s): %v\n\n", len(groups), groupIDs)
+		logger.Infof("Processing %d selected group(s): %v\n\n", len(groups), groupIDs)
+	}
+
+	// Kept images aren't reclaimable, so this comes before --min-reclaim
+	if keepCount > 1 {
+		for _, group := range groups {
+			group.KeepTop(keepCount)
+		}
+		logger.Infof("Keeping the best %d images of each group\n\n", keepCount)
 	}
 
-	// Collect files to remove
-	var toRemove []string
+	if minBytes > 0 {
+		large := models.FilterByReclaimable(groups, minBytes)
+		if len(large) == 0 {
+			logger.Printf("No groups reclaim at least %s.\n", fileutil.FormatSize(minBytes))
+			return nil
+		}
+		logger.Infof("Processing %d group(s) reclaiming at least %s (%d skipped)\n\n",
+			len(large), fileutil.FormatSize(minBytes), len(groups)-len(large))
+		groups = large
+	}
+
+	scanned, err := store.GetAllImages()
+	if err != nil {
+		return fmt.Errorf("failed to load images: %w", err)
+	}
+	byPath := make(map[string]*models.ImageInfo, len(scanned))
+	for _, img := range scanned {
+		byPath[img.Path] = img
+	}
+
+	// Collect files to remove. With --folder, the kept image may live
+	// elsewhere, but only files under the folder are touched.
+	// Images inside zip archives are read-only: they can be kept, but never
+	// removed. A removal that is the kept file under another path (a hard
+	// link, or a folder scanned through overlapping roots) is skipped, as
+	// removing it would take the kept image with it.
+	var toRemove []*models.ImageInfo
 	var totalSize int64
+	archived, sameAsKept := 0, 0
+	groupOf := make(map[*models.ImageInfo]*models.DuplicateGroup)
+	folderKey := store.CanonicalPath(folder)
 	for _, group := range groups {
 		for _, img := range group.Remove {
+			if folder != "" && !isUnder(store.CanonicalPath(img.Path), folderKey) {
+				continue
+			}
+			if hash.IsArchiveEntry(img.Path) {
+				archived++
+				continue
+			}
+			if kept := sameFileKept(img, group); kept != nil {
+				logger.Debugf("Skipped (same file as kept): %s is %s\n", img.Path, kept.Path)
+				sameAsKept++
+				continue
+			}
 			// Verify file still exists
 			if _, err := os.Stat(img.Path); err == nil {
-				toRemove = append(toRemove, img.Path)
+				toRemove = append(toRemove, img)
 				totalSize += img.FileSize
+				groupOf[img] = group
 			}
 		}
 	}
 
+	if archived > 0 {
+		logger.Printf("Skipping %d file(s) inside zip archives (read-only)\n", archived)
+	}
+	if sameAsKept > 0 {
+		logger.Printf("Skipped (same file as kept): %d file(s) that are hard links to or other paths of a kept image (-v to list them)\n", sameAsKept)
+	}
+
 	if len(toRemove) == 0 {
-		fmt.Println("No files to remove (files may have been already deleted).")
+		logger.Printf("No files to remove (files may have been already deleted).\n")
 		return nil
 	}
 
+	// With --respect-sidecars, the other file of a RAW+JPEG pair goes
+	// wherever its duplicate goes
+	sidecars := make(map[*models.ImageInfo]*models.ImageInfo)
+	if respectSidecars {
+		for _, img := range toRemove {
+			sidecar := models.Sidecar(img, byPath)
+			if sidecar == nil || fileutil.SameFile(sidecar.Path, groupOf[img].Keep.Path) {
+				continue
+			}
+			if _, err := os.Stat(sidecar.Path); err == nil {
+				sidecars[img] = sidecar
+				totalSize += sidecar.FileSize
+			}
+		}
+	}
+	removals := withSidecars(toRemove, sidecars)
+
 	// Determine action
-	var action string
+	var action, op string
 	if moveTo != "" {
-		action = fmt.Sprintf("move to %s", moveTo)
+		action, op = fmt.Sprintf("move to %s", moveTo), audit.OpMove
 	} else if permanent {
-		action = "permanently delete"
+		action, op = "permanently delete", audit.OpDelete
 	} else {
-		action = "move to trash"
+		action, op = "move to trash", audit.OpTrash
+	}
+
+	logger.Infof("Will %s %d files (%s)\n", action, len(removals), fileutil.FormatSize(totalSize))
+	if len(sidecars) > 0 {
+		logger.Infof("  including %d RAW+JPEG sidecars of duplicates\n", len(sidecars))
+	}
+	kept := keptToMove(toRemove, groupOf)
+	if backupTo != "" {
+		logger.Infof("Backing them up to %s first\n", backupTo)
+	}
+	if len(kept) > 0 {
+		logger.Infof("Then move %d kept files to %s\n", len(kept), keepTo)
+	}
+	if pruneEmpty {
+		logger.Infof("Then remove the folders left empty\n")
 	}
+	logger.Infof("\n")
 
-	fmt.Printf("Will %s %d files (%s)\n\n", action, len(toRemove), formatSize(totalSize))
+	printRemovalsByDir(models.RemovalsByDir(removals, scanned))
+
+	if showDiff {
+		if err := printComparisons(cmd.OutOrStdout(), toRemove, groupOf); err != nil {
+			return err
+		}
+	}
 
 	if dryRun {
-		fmt.Println("Files to be removed:")
-		for _, path := range toRemove {
-			fmt.Printf("  %s\n", path)
+		logger.Printf("Files to be removed:\n")
+		for _, img := range removals {
+			logger.Printf("  %s\n", img.Path)
+		}
+		logger.Printf("\n")
+		if len(kept) > 0 {
+			logger.Printf("Kept files to be moved to %s:\n", keepTo)
+			for _, group := range kept {
+				logger.Printf("  %s\n", group.Keep.Path)
+				if sidecar := keptSidecar(group, byPath); sidecar != nil {
+					logger.Printf("  %s\n", sidecar.Path)
+				}
+			}
+			logger.Printf("\n")
 		}
-		fmt.Println()
-		fmt.Println("(Dry run - no files were modified)")
-		fmt.Println("Run without --dry-run to actually remove files.")
+		logger.Printf("(Dry run - no files were modified)\n")
+		logger.Infof("Run without --dry-run to actually remove files.\n")
 		return nil
 	}
 
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+
 	// Confirm unless --yes flag is set
 	if !noConfirm {
-		fmt.Printf("Are you sure you want to %s %d files? [y/N]: ", action, len(toRemove))
+		logger.Printf("Are you sure you want to %s %d files? [y/N]: ", action, len(removals))
 		reader := bufio.NewReader(os.Stdin)
 		response, _ := reader.ReadString('\n')
 		response = strings.TrimSpace(strings.ToLower(response))
 		if response != "y" && response != "yes" {
-			fmt.Println("Aborted.")
+			logger.Printf("Aborted.\n")
 			return nil
 		}
 	}
 
+	if backupTo != "" {
+		paths := make([]string, len(removals))
+		for i, img := range removals {
+			paths[i] = img.Path
+		}
+		logger.Infof("Backing up %d files to %s...\n", len(paths), backupTo)
+		if err := fileutil.WriteBackup(backupTo, paths); err != nil {
+			return fmt.Errorf("%w (nothing was removed)", err)
+		}
+	}
+
 	// Create move-to directory if needed
 	if moveTo != "" {
 		if err := os.MkdirAll(moveTo, 0755); err != nil {
@@ -156,40 +393,360 @@ func runClean(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Relative paths are taken from the folder each file was scanned under,
+	// and empty folders are only pruned below one
+	var scanRoots []string
+	if preserve || pruneEmpty {
+		scanRoots, err = store.GetScannedFolders()
+		if err != nil {
+			return fmt.Errorf("failed to get scanned folders: %w", err)
+		}
+	}
+
 	// Process files
-	var processed, failed int
-	for _, path := range toRemove {
+	var processed, unverified int
+	var vacated []string // folders that lost a file, for --prune-empty-dirs
+	cleaned := make(map[*models.DuplicateGroup]bool)
+	var reclaimed int64
+	failures := make(map[fileutil.Failure]int)
+	verifier := hash.NewVerifier()
+	for _, img := range toRemove {
+		path := img.Path
+		if verifyBytes {
+			// A chained perceptual group can be wider than the threshold;
+			// its spread when formed is as far apart as members may be
+			group := groupOf[img]
+			if err := verifier.Verify(group.Keep, img, group.MatchMethod, max(threshold, group.Distance)); err != nil {
+				logger.Errorf("Skipped %s: verification failed: %v\n", path, err)
+				unverified++
+				continue
+			}
+		}
+		var dest string
+		remove := func() error {
+			var err error
+			if moveTo != "" && preserve {
+				dest, err = fileutil.MoveFilePreservingTree(path, scanRoot(path, scanRoots), moveTo)
+			} else if moveTo != "" && nameTmpl != "" {
+				fields := fileutil.NameFields{Group: groupOf[img].ID, Date: img.ModTime}
+				dest, err = fileutil.MoveFileTemplated(path, moveTo, template, fields)
+			} else if moveTo != "" {
+				dest, err = fileutil.MoveFile(path, moveTo)
+			} else if permanent {
+				err = os.Remove(path)
+			} else {
+				err = fileutil.MoveToTrash(path)
+			}
+			return err
+		}
+		if err := withRetry(path, remove); err != nil {
+			logger.Errorf("Failed to process %s: %v\n", path, err)
+			failures[fileutil.ClassifyFailure(err)]++
+			continue
+		}
+		processed++
+		reclaimed += img.FileSize
+		cleaned[groupOf[img]] = true
+		vacated = append(vacated, filepath.Dir(path))
+		// Remove from database
+		store.DeleteImage(path)
+		// Stop rather than go on removing files that are not recorded
+		group := groupOf[img]
+		if err := auditLog.Record(audit.Entry{
+			Operation: op, Path: path, Destination: dest,
+			GroupID: group.ID, Size: img.FileSize, KeepPath: group.Keep.Path,
+		}); err != nil {
+			return err
+		}
+
+		// The sidecar only follows a file that was removed, and the same way
+		sidecar := sidecars[img]
+		if sidecar == nil {
+			continue
+		}
+		var sidecarDest string
+		err := withRetry(sidecar.Path, func() error {
+			var err error
+			if moveTo != "" {
+				sidecarDest, err = fileutil.MoveSidecar(sidecar.Path, dest)
+			} else if permanent {
+				err = os.Remove(sidecar.Path)
+			} else {
+				err = fileutil.MoveToTrash(sidecar.Path)
+			}
+			return err
+		})
+		if err != nil {
+			logger.Errorf("Failed to process sidecar %s: %v\n", sidecar.Path, err)
+			failures[fileutil.ClassifyFailure(err)]++
+			continue
+		}
+		processed++
+		reclaimed += sidecar.FileSize
+		vacated = append(vacated, filepath.Dir(sidecar.Path))
+		store.DeleteImage(sidecar.Path)
+		if err := auditLog.Record(audit.Entry{
+			Operation: op, Path: sidecar.Path, Destination: sidecarDest,
+			GroupID: group.ID, Size: sidecar.FileSize, KeepPath: group.Keep.Path,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Only groups that lost a duplicate have their kept image moved, so a
+	// group whose removals all failed stays as it was
+	var relocated int
+	for _, group := range kept {
+		if !cleaned[group] {
+			continue
+		}
+		path := group.Keep.Path
+		var dest string
 		var err error
-		if moveTo != "" {
-			err = fileutil.MoveFile(path, moveTo)
-		} else if permanent {
-			err = os.Remove(path)
+		if preserve {
+			dest, err = fileutil.MoveFilePreservingTree(path, scanRoot(path, scanRoots), keepTo)
 		} else {
-			err = fileutil.MoveToTrash(path)
+			dest, err = fileutil.MoveFile(path, keepTo)
+		}
+		if err != nil {
+			logger.Errorf("Failed to move kept %s: %v\n", path, err)
+			failures[fileutil.ClassifyFailure(err)]++
+			continue
+		}
+		relocated++
+		vacated = append(vacated, filepath.Dir(path))
+		logger.Debugf("Moved kept %s to %s\n", path, dest)
+		if err := auditLog.Record(audit.Entry{
+			Operation: audit.OpKeepMove, Path: path, Destination: dest,
+			GroupID: group.ID, Size: group.Keep.FileSize, KeepPath: dest,
+		}); err != nil {
+			return err
+		}
+		// The stored path follows the file, or later commands would no
+		// longer find it
+		if _, err := store.RemapPaths(path, dest); err != nil {
+			logger.Errorf("Moved %s to %s but failed to update the database: %v\n", path, dest, err)
+			logger.Errorf("Run 'imagedupfinder rename --from %s --to %s' to fix it.\n", path, dest)
 		}
 
+		sidecar := keptSidecar(group, byPath)
+		if sidecar == nil {
+			continue
+		}
+		sidecarDest, err := fileutil.MoveSidecar(sidecar.Path, dest)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process %s: %v\n", path, err)
-			failed++
-		} else {
-			processed++
-			// Remove from database
-			store.DeleteImage(path)
+			logger.Errorf("Failed to move sidecar %s: %v\n", sidecar.Path, err)
+			failures[fileutil.ClassifyFailure(err)]++
+			continue
+		}
+		relocated++
+		vacated = append(vacated, filepath.Dir(sidecar.Path))
+		logger.Debugf("Moved sidecar %s to %s\n", sidecar.Path, sidecarDest)
+		if err := auditLog.Record(audit.Entry{
+			Operation: audit.OpKeepMove, Path: sidecar.Path, Destination: sidecarDest,
+			GroupID: group.ID, Size: sidecar.FileSize, KeepPath: dest,
+		}); err != nil {
+			return err
+		}
+		if _, err := store.RemapPaths(sidecar.Path, sidecarDest); err != nil {
+			logger.Errorf("Moved %s to %s but failed to update the database: %v\n", sidecar.Path, sidecarDest, err)
+			logger.Errorf("Run 'imagedupfinder rename --from %s --to %s' to fix it.\n", sidecar.Path, sidecarDest)
 		}
 	}
 
-	fmt.Println()
+	var pruned []string
+	if pruneEmpty {
+		pruned, err = fileutil.PruneEmptyDirs(vacated, scanRoots)
+		if err != nil {
+			logger.Errorf("Failed to remove empty folders: %v\n", err)
+		}
+		for _, dir := range pruned {
+			logger.Debugf("Removed empty folder %s\n", dir)
+		}
+	}
+
+	logger.Infof("\n")
 	if moveTo != "" {
-		fmt.Printf("Moved %d files to %s\n", processed, moveTo)
+		logger.Infof("Moved %d files to %s\n", processed, moveTo)
 	} else if permanent {
-		fmt.Printf("Permanently deleted %d files\n", processed)
+		logger.Infof("Permanently deleted %d files\n", processed)
 	} else {
-		fmt.Printf("Moved %d files to trash\n", processed)
+		logger.Infof("Moved %d files to trash\n", processed)
+	}
+	if keepTo != "" {
+		logger.Infof("Moved %d kept files to %s\n", relocated, keepTo)
+	}
+	if pruneEmpty {
+		logger.Infof("Removed %d empty folders\n", len(pruned))
 	}
-	if failed > 0 {
-		fmt.Printf("Failed: %d files\n", failed)
+	if unverified > 0 {
+		logger.Infof("Skipped: %d files that no longer match the kept image\n", unverified)
 	}
-	fmt.Printf("Space reclaimed: %s\n", formatSize(totalSize))
+	printFailures(failures)
+	logger.Infof("Space reclaimed: %s\n", fileutil.FormatSize(reclaimed))
 
 	return nil
 }
+
+// withRetry runs remove, and with --chmod-force retries it on files made
+// writable
+func withRetry(path string, remove func() error) error {
+	if chmodForce {
+		return fileutil.RetryWritable(path, remove)
+	}
+	return remove()
+}
+
+// printComparisons writes report.WriteComparison for each group with files
+// in toRemove, against the first of them: the best-ranked removal actually
+// being removed
+func printComparisons(w io.Writer, toRemove []*models.ImageInfo, groupOf map[*models.ImageInfo]*models.DuplicateGroup) error {
+	shown := make(map[*models.DuplicateGroup]bool)
+	for _, img := range toRemove {
+		group := groupOf[img]
+		if shown[group] {
+			continue
+		}
+		shown[group] = true
+		if err := report.WriteComparison(w, group, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameFileKept returns the image kept in group (Keep or one of Keeps) that
+// img is another path of, or nil
+func sameFileKept(img *models.ImageInfo, group *models.DuplicateGroup) *models.ImageInfo {
+	if fileutil.SameFile(img.Path, group.Keep.Path) {
+		return group.Keep
+	}
+	for _, kept := range group.Keeps {
+		if fileutil.SameFile(img.Path, kept.Path) {
+			return kept
+		}
+	}
+	return nil
+}
+
+// withSidecars returns toRemove with each image's sidecar, if it has one in
+// sidecars, right after it
+func withSidecars(toRemove []*models.ImageInfo, sidecars map[*models.ImageInfo]*models.ImageInfo) []*models.ImageInfo {
+	if len(sidecars) == 0 {
+		return toRemove
+	}
+	removals := make([]*models.ImageInfo, 0, len(toRemove)+len(sidecars))
+	for _, img := range toRemove {
+		removals = append(removals, img)
+		if sidecar := sidecars[img]; sidecar != nil {
+			removals = append(removals, sidecar)
+		}
+	}
+	return removals
+}
+
+// keptSidecar returns the sidecar that --respect-sidecars moves along with
+// group's kept image, or nil
+func keptSidecar(group *models.DuplicateGroup, byPath map[string]*models.ImageInfo) *models.ImageInfo {
+	if !respectSidecars {
+		return nil
+	}
+	sidecar := models.Sidecar(group.Keep, byPath)
+	if sidecar == nil {
+		return nil
+	}
+	if _, err := os.Stat(sidecar.Path); err != nil {
+		return nil
+	}
+	return sidecar
+}
+
+// keptToMove returns the groups, in order, whose kept image --keep-to moves
+// once their duplicates in toRemove are gone. Images inside zip archives
+// can't be moved, and those already in the folder stay where they are.
+func keptToMove(toRemove []*models.ImageInfo, groupOf map[*models.ImageInfo]*models.DuplicateGroup) []*models.DuplicateGroup {
+	if keepTo == "" {
+		return nil
+	}
+	var groups []*models.DuplicateGroup
+	seen := make(map[*models.DuplicateGroup]bool)
+	for _, img := range toRemove {
+		group := groupOf[img]
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+		if hash.IsArchiveEntry(group.Keep.Path) || isUnder(group.Keep.Path, keepTo) {
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// printFailures prints the failed removals by cause. Permission problems
+// get a hint, as they are the kind --chmod-force can fix.
+func printFailures(failures map[fileutil.Failure]int) {
+	total := 0
+	var parts []string
+	for _, f := range []fileutil.Failure{fileutil.FailurePermission, fileutil.FailureNotFound, fileutil.FailureOther} {
+		if n := failures[f]; n > 0 {
+			total += n
+			parts = append(parts, fmt.Sprintf("%d %s", n, f))
+		}
+	}
+	if total == 0 {
+		return
+	}
+	logger.Infof("Failed: %d files (%s)\n", total, strings.Join(parts, ", "))
+	if failures[fileutil.FailurePermission] > 0 && !chmodForce {
+		logger.Infof("Re-run with --chmod-force to clear read-only permissions and retry.\n")
+	}
+}
+
+// printRemovalsByDir prints how many files and bytes leave each directory,
+// then warns about directories that would lose every scanned image, which
+// is easy to miss in a long run across many groups.
+func printRemovalsByDir(removals []models.DirRemoval) {
+	logger.Infof("By folder:\n")
+	var emptied []string
+	for _, r := range removals {
+		mark := ""
+		if r.Emptied {
+			mark = "  (all scanned images)"
+			emptied = append(emptied, r.Dir)
+		}
+		logger.Infof("  %-50s %6d files  %10s%s\n", r.Dir, r.Count, fileutil.FormatSize(r.Size), mark)
+	}
+	logger.Infof("\n")
+
+	if len(emptied) > 0 {
+		logger.Printf("Warning: every scanned image would be removed from %d folder(s):\n", len(emptied))
+		for _, dir := range emptied {
+			logger.Printf("  %s\n", dir)
+		}
+		logger.Printf("\n")
+	}
+}
+
+// scanRoot returns the deepest scanned folder containing path. Files under no
+// known folder (e.g. scanned before history was kept) fall back to their own
+// directory, which moves them flat.
+func scanRoot(path string, folders []string) string {
+	root := ""
+	for _, folder := range folders {
+		if isUnder(path, folder) && len(folder) > len(root) {
+			root = folder
+		}
+	}
+	if root == "" {
+		return filepath.Dir(path)
+	}
+	return root
+}
+
+// isUnder reports whether path is inside folder (at any depth)
+func isUnder(path, folder string) bool {
+	prefix := strings.TrimSuffix(folder, string(os.PathSeparator)) + string(os.PathSeparator)
+	return strings.HasPrefix(path, prefix)
+}
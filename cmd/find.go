@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/match"
+)
+
+var findCmd = &cobra.Command{
+	Use:   "find <image>",
+	Short: "Find scanned images similar to one image",
+	Long: `Hash one image and list the images in the database within --threshold
+of it, closest first. The image itself need not have been scanned.
+
+Hashes from scan --normalize-luma are only comparable with each other; pass
+--normalize-luma here to search those.
+
+Example:
+  imagedupfinder find ./photo.jpg
+  imagedupfinder find ./photo.jpg --threshold 5
+  imagedupfinder find ./scan.png --normalize-luma`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFind,
+}
+
+func init() {
+	findCmd.Flags().BoolVar(&normLuma, "normalize-luma", false, "Hash normalized luminance, to search images scanned with --normalize-luma")
+	findCmd.Flags().BoolVar(&fastDecode, "fast-decode", false, "Hash a downscaled copy, to search images scanned with --fast-decode")
+	findCmd.Flags().Float64Var(&centerCrop, "center-crop", 1, "Hash only the middle fraction, to search images scanned with the same --center-crop")
+	rootCmd.AddCommand(findCmd)
+}
+
+func runFind(cmd *cobra.Command, args []string) error {
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if !hash.IsSupportedImage(path) {
+		return fmt.Errorf("not a supported image: %s", path)
+	}
+
+	if err := checkCenterCrop(); err != nil {
+		return err
+	}
+
+	opts := []hash.Option{hash.WithCenterCrop(centerCrop)}
+	if normLuma {
+		opts = append(opts, hash.WithNormalizeLuma())
+	}
+	if fastDecode {
+		opts = append(opts, hash.WithFastDecode())
+	}
+	query, err := hash.NewHasher(opts...).HashImage(path)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	images, err := store.GetAllImages()
+	if err != nil {
+		return fmt.Errorf("failed to load images: %w", err)
+	}
+
+	found := match.FindSimilar(query, images, threshold)
+	if len(found) == 0 {
+		logger.Printf("No similar images found (threshold %d).\n", threshold)
+		return nil
+	}
+
+	logger.Printf("Found %d similar images (threshold %d)\n\n", len(found), threshold)
+	logger.Printf("%-4s  %-11s  %-4s  %8s  %s\n", "Dist", "Resolution", "Fmt", "Size", "Path")
+	logger.Printf("%s\n", strings.Repeat("-", 60))
+	for _, n := range found {
+		logger.Printf("%4d  %-11s  %-4s  %8s  %s\n", n.Distance,
+			fmt.Sprintf("%dx%d", n.Image.Width, n.Image.Height),
+			strings.ToUpper(n.Image.Format), fileutil.FormatSize(n.Image.FileSize), n.Image.Path)
+	}
+	return nil
+}
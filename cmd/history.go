@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/models"
+)
+
+var historyLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past scans with the settings they used",
+	Long: `List recorded scans, regroups and imports, newest first, with the matcher
+and threshold each used and what it found. Regroups and imports cover the
+whole database and are shown as "(all)". Scans recorded by older versions
+have no matcher or threshold.
+
+Example:
+  imagedupfinder history            # The last 20 entries
+  imagedupfinder history --limit 0  # All of them`,
+	Args: cobra.NoArgs,
+	RunE: runHistory,
+}
+
+func init() {
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 20, "Number of entries to show (0 = all)")
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	history, err := store.GetScanHistory(historyLimit)
+	if err != nil {
+		return fmt.Errorf("failed to read scan history: %w", err)
+	}
+	if len(history) == 0 {
+		logger.Printf("No scans recorded.\n")
+		return nil
+	}
+
+	logger.Printf("%-16s  %-10s  %9s  %7s  %7s  %10s  %s\n",
+		"Scanned (UTC)", "Matcher", "Threshold", "Images", "Groups", "Duplicates", "Folder")
+	for _, rec := range history {
+		matcher, threshold := "-", "-"
+		if rec.Matcher != "" {
+			matcher = rec.Matcher
+		}
+		if rec.Matcher == models.MatchPerceptual {
+			threshold = fmt.Sprint(rec.Threshold)
+		}
+		folder := rec.Folder
+		if folder == "" {
+			folder = "(all)"
+		}
+		logger.Printf("%-16s  %-10s  %9s  %7d  %7d  %10d  %s\n",
+			rec.ScannedAt.Format("2006-01-02 15:04"), matcher, threshold,
+			rec.TotalImages, rec.TotalGroups, rec.TotalDuplicates, folder)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var ignoreClear bool
+
+var ignoreCmd = &cobra.Command{
+	Use:   "ignore <path>...",
+	Short: "Never report the given images as duplicates",
+	Long: `Add images to the ignore list. Ignored images are left out of duplicate
+groups, so list, clean and serve never show or remove them. A group that is
+left with a single image disappears.
+
+Use --clear to remove paths from the ignore list, or with no paths to empty it.
+Run 'imagedupfinder list --show-ignored' to see what is ignored.
+
+Example:
+  imagedupfinder ignore ./mockups/logo.png          # Ignore an image
+  imagedupfinder ignore --clear ./mockups/logo.png  # Stop ignoring it
+  imagedupfinder ignore --clear                     # Empty the ignore list`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if !ignoreClear && len(args) == 0 {
+			return fmt.Errorf("requires at least 1 path (or --clear)")
+		}
+		return nil
+	},
+	RunE: runIgnore,
+}
+
+func init() {
+	ignoreCmd.Flags().BoolVar(&ignoreClear, "clear", false, "Remove paths from the ignore list (all if none given)")
+	rootCmd.AddCommand(ignoreCmd)
+}
+
+func runIgnore(cmd *cobra.Command, args []string) error {
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if ignoreClear && len(args) == 0 {
+		if err := store.ClearIgnored(); err != nil {
+			return fmt.Errorf("failed to clear ignore list: %w", err)
+		}
+		logger.Infof("Ignore list cleared.\n")
+		return nil
+	}
+
+	for _, arg := range args {
+		// Stored paths are absolute, as recorded by scan
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		if ignoreClear {
+			if err := store.UnignorePath(path); err != nil {
+				return fmt.Errorf("failed to unignore %s: %w", path, err)
+			}
+			logger.Infof("Unignored: %s\n", path)
+			continue
+		}
+
+		if err := store.IgnorePath(path); err != nil {
+			return fmt.Errorf("failed to ignore %s: %w", path, err)
+		}
+		logger.Infof("Ignored: %s\n", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/importer"
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+)
+
+var importFormat string
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import perceptual hashes computed by another tool",
+	Long: `Load images hashed by another program into the database and group them,
+without decoding them again.
+
+The CSV needs a header row with a path and a hash (or phash) column. Hashes
+are read as hexadecimal when prefixed with 0x or 16 digits long, and as
+decimal otherwise. Size (size), modification time (mtime, RFC 3339 or Unix
+seconds) and dimensions (width, height) are taken from the CSV when present
+and from the file otherwise; only the image header is read. Relative paths
+are resolved against the folder of the CSV. Rows whose file is missing are
+skipped with a warning.
+
+Imported hashes are kept by later scans while the files are unchanged; run
+scan --full to replace them with hashes of this tool.
+
+Example:
+  imagedupfinder import --format csv hashes.csv
+  imagedupfinder import hashes.csv --threshold 6`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", importer.FormatCSV, "Format of the file to import (csv)")
+	importCmd.Flags().IntVar(&maxSpread, "max-spread", 0, "Maximum distance between any two images in a group (0 = no limit)")
+	importCmd.Flags().StringVar(&fmtThresh, "threshold-per-format", "", "Thresholds for some formats instead of --threshold, e.g. jpg=12,png=6; two images match within the larger of their formats' thresholds")
+	importCmd.Flags().StringVar(&clustering, "cluster", clusterSingle, "Clustering of similar images: single (any chain of matches) or average (split clusters whose members are far apart on average)")
+	importCmd.Flags().IntVar(&clusterCut, "cluster-cutoff", 0, "Largest average distance within a group with --cluster average (0 = --threshold)")
+	importCmd.Flags().IntVar(&maxGroup, "max-group-size", 0, "Leave clusters of more than this many images out of the groups, with a warning (0 = no limit)")
+	importCmd.Flags().BoolVar(&noSameDir, "ignore-same-dir", false, "Never match two images in the same folder, e.g. burst shots in an album")
+	rootCmd.AddCommand(importCmd)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	if importFormat != importer.FormatCSV {
+		return fmt.Errorf("unsupported --format %q (supported: %s)", importFormat, importer.FormatCSV)
+	}
+	if err := checkMatchFlags(cmd); err != nil {
+		return err
+	}
+
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", args[0], err)
+	}
+	defer f.Close()
+
+	images, skips, err := importer.ReadCSV(f, filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", args[0], err)
+	}
+	for _, skip := range skips {
+		logger.Errorf("Warning: line %d: skipping %s: %v\n", skip.Line, skip.Path, skip.Err)
+	}
+
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	logger.Infof("Grouping (threshold: %d)...\n", threshold)
+	matcher := match.NewAutoMatcher(threshold, perceptualOptions()...)
+	groups, matched, err := importer.Import(store, matcher, images)
+	if err != nil {
+		return err
+	}
+	warnOversized(matcher)
+
+	totalDuplicates := 0
+	for _, group := range groups {
+		totalDuplicates += len(group.Remove)
+	}
+	store.RecordScan(models.ScanRecord{
+		Matcher:         models.MatchPerceptual,
+		Threshold:       threshold,
+		TotalImages:     matched,
+		TotalGroups:     len(groups),
+		TotalDuplicates: totalDuplicates,
+	})
+
+	logger.Infof("Imported:         %d\n", len(images))
+	if len(skips) > 0 {
+		logger.Infof("Skipped:          %d\n", len(skips))
+	}
+	logger.Infof("Duplicate groups: %d\n", len(groups))
+	logger.Infof("Duplicates found: %d\n", totalDuplicates)
+	if len(groups) > 0 {
+		logger.Infof("\nRun 'imagedupfinder list' to see duplicate groups\n")
+	}
+	return nil
+}
@@ -1,22 +1,33 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/match"
 	"imagedupfinder/internal/models"
 	"imagedupfinder/internal/storage"
 )
 
 var (
 	listJSON    bool
-	listVerbose bool
+	listJSONL   bool
 	listSummary bool
 	listLimit   int
 	listOffset  int
+	listIgnored bool
+	listPairs   bool
+	listFolder  string
+	listSort    string
+	listDesc    bool
+	listUnrev   bool
+	listCanon   bool
 )
 
 var listCmd = &cobra.Command{
@@ -27,125 +38,332 @@ var listCmd = &cobra.Command{
 Each group shows:
 - Group ID
 - Images in the group with their quality scores
-- Which image will be kept (highest score) marked with ✓
+- Which image will be kept (highest score, or earliest capture date with
+  --keep-oldest-capture) marked with ✓
 - Which images will be removed marked with ✗
 
 Example:
   imagedupfinder list              # Show first 10 groups (default)
   imagedupfinder list -n 0         # Show all groups
   imagedupfinder list -s           # Summary view (compact)
-  imagedupfinder list --offset 10  # Groups 11-20`,
+  imagedupfinder list -v           # Detailed image info
+  imagedupfinder list --offset 10  # Groups 11-20
+  imagedupfinder list --show-ignored  # Also list ignored images
+  imagedupfinder list --pairs      # Show distances between images in each group
+  imagedupfinder list --folder ./vacation2023  # Only groups touching this folder
+  imagedupfinder list --sort reclaimable --desc  # Biggest wins first
+  imagedupfinder list --unreviewed  # Only groups not marked with 'review'
+  imagedupfinder list --json       # All groups as one JSON array
+  imagedupfinder list --jsonl | jq .id  # One JSON group per line, streamed
+  imagedupfinder list --canonical  # One path per unique image in the library
+
+--json and --jsonl print every group unless --limit is given.
+
+--canonical prints, instead of the groups, one image per unique image: the
+kept image of each group (by the keep flags) and every image in no group,
+one path per line in path order, or with --json/--jsonl as image objects.
+It is the set a deduplicated copy of the library would hold.`,
 	RunE: runList,
 }
 
 func init() {
 	listCmd.Flags().BoolVar(&listJSON, "json", false, "Output in JSON format")
-	listCmd.Flags().BoolVarP(&listVerbose, "verbose", "v", false, "Show detailed image info")
+	listCmd.Flags().BoolVar(&listJSONL, "jsonl", false, "Output one JSON group per line (newline-delimited JSON)")
 	listCmd.Flags().BoolVarP(&listSummary, "summary", "s", false, "Show summary only (group counts and sizes)")
 	listCmd.Flags().IntVarP(&listLimit, "limit", "n", 10, "Limit number of groups to display (0 = all)")
 	listCmd.Flags().IntVar(&listOffset, "offset", 0, "Skip first N groups (for pagination)")
+	listCmd.Flags().StringVar(&listFolder, "folder", "", "Only show groups with at least one image under this folder")
+	listCmd.Flags().BoolVar(&listPairs, "pairs", false, "Show the hash distance between every pair of images in each group")
+	listCmd.Flags().StringVar(&listSort, "sort", "id", "Sort groups by: id, reclaimable, images")
+	listCmd.Flags().BoolVar(&listDesc, "desc", false, "Sort in descending order")
+	listCmd.Flags().BoolVar(&listUnrev, "unreviewed", false, "Only show groups not marked reviewed (see 'review')")
+	listCmd.Flags().BoolVar(&listCanon, "canonical", false, "List one image per unique image instead of the groups: each group's kept image and every ungrouped one")
+	listCmd.Flags().BoolVar(&listIgnored, "show-ignored", false, "Also list images excluded with 'ignore'")
 	rootCmd.AddCommand(listCmd)
 }
 
 func runList(cmd *cobra.Command, args []string) error {
-	store, err := storage.NewStorage(dbPath)
+	if listCanon {
+		return listCanonical(cmd)
+	}
+	order, ok := models.GroupOrders[listSort]
+	if !ok {
+		return fmt.Errorf("invalid --sort %q: want id, reclaimable or images", listSort)
+	}
+	asJSON := listJSON || listJSONL
+	if asJSON {
+		switch {
+		case listJSON && listJSONL:
+			return fmt.Errorf("--json and --jsonl cannot be used together")
+		case listSummary || listIgnored:
+			return fmt.Errorf("--summary and --show-ignored cannot be used with --json or --jsonl")
+		}
+		// Machine output is rarely paged, so the default limit doesn't apply
+		if !cmd.Flags().Changed("limit") {
+			listLimit = 0
+		}
+	}
+
+	store, err := openStorage()
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer store.Close()
 
-	groups, err := store.GetDuplicateGroups()
+	folder, err := absFolder(listFolder)
+	if err != nil {
+		return err
+	}
+	groups, totals, err := loadPage(store, folder, order)
 	if err != nil {
 		return fmt.Errorf("failed to get groups: %w", err)
 	}
 
-	if len(groups) == 0 {
-		fmt.Println("No duplicate groups found.")
-		fmt.Println("Run 'imagedupfinder scan <folder>' to scan for duplicates.")
-		return nil
+	var ignored []string
+	if listIgnored {
+		ignored, err = store.GetIgnoredPaths()
+		if err != nil {
+			return fmt.Errorf("failed to get ignored paths: %w", err)
+		}
 	}
 
-	// Calculate totals
-	totalDuplicates := 0
-	var totalSavings int64
-	for _, group := range groups {
-		for _, img := range group.Remove {
-			totalDuplicates++
-			totalSavings += img.FileSize
+	if totals.groups == 0 && !asJSON {
+		if listUnrev {
+			logger.Printf("No unreviewed duplicate groups.\n")
+		} else {
+			logger.Printf("No duplicate groups found.\n")
+			logger.Infof("Run 'imagedupfinder scan <folder>' to scan for duplicates.\n")
 		}
+		if listIgnored {
+			logger.Printf("\n")
+			printIgnored(ignored)
+		}
+		return nil
 	}
 
-	fmt.Printf("Found %d duplicate groups (%d duplicates, %s reclaimable)\n\n",
-		len(groups), totalDuplicates, formatSize(totalSavings))
-
-	// Apply pagination
-	totalGroups := len(groups)
-	startIdx := listOffset
-	if startIdx > len(groups) {
-		startIdx = len(groups)
+	if !asJSON {
+		logger.Printf("Found %d duplicate groups (%d duplicates, %s reclaimable)\n\n",
+			totals.groups, totals.duplicates, fileutil.FormatSize(totals.reclaimable))
 	}
-	groups = groups[startIdx:]
 
-	if listLimit > 0 && listLimit < len(groups) {
-		groups = groups[:listLimit]
+	totalGroups := totals.groups
+	startIdx := min(listOffset, totalGroups)
+
+	if asJSON {
+		if listPairs {
+			for _, group := range groups {
+				group.Pairs = match.PairwiseDistances(group.Images)
+			}
+		}
+		if listJSONL {
+			return models.WriteGroupsJSONL(cmd.OutOrStdout(), groups)
+		}
+		return models.WriteGroupsJSON(cmd.OutOrStdout(), groups)
 	}
 
 	// Display groups
 	if len(groups) == 0 {
-		fmt.Printf("No groups in range (offset %d exceeds total %d)\n", listOffset, totalGroups)
+		logger.Printf("No groups in range (offset %d exceeds total %d)\n", listOffset, totalGroups)
 	} else if listSummary {
 		printSummaryTable(groups)
 	} else {
 		for _, group := range groups {
-			printGroup(group, listVerbose)
+			if listPairs {
+				group.Pairs = match.PairwiseDistances(group.Images)
+			}
+			printGroup(group, verbose)
 		}
 	}
 
 	// Show pagination info
 	endIdx := startIdx + len(groups)
 	if len(groups) > 0 {
-		fmt.Printf("Showing groups %d-%d of %d\n", startIdx+1, endIdx, totalGroups)
+		logger.Infof("Showing groups %d-%d of %d\n", startIdx+1, endIdx, totalGroups)
 		if endIdx < totalGroups {
 			nextOffset := endIdx
 			limitArg := ""
 			if listLimit > 0 {
 				limitArg = fmt.Sprintf(" -n %d", listLimit)
 			}
-			fmt.Printf("Next page: imagedupfinder list%s --offset %d\n", limitArg, nextOffset)
+			logger.Infof("Next page: imagedupfinder list%s --offset %d\n", limitArg, nextOffset)
 		}
 	}
 
-	fmt.Println()
-	fmt.Println("Run 'imagedupfinder clean --dry-run' to preview deletions")
-	fmt.Println("Run 'imagedupfinder clean' to remove duplicates")
+	if listIgnored {
+		logger.Printf("\n")
+		printIgnored(ignored)
+	}
+
+	logger.Infof("\n")
+	logger.Infof("Run 'imagedupfinder clean --dry-run' to preview deletions\n")
+	logger.Infof("Run 'imagedupfinder clean' to remove duplicates\n")
 
 	return nil
 }
 
+// listCanonical prints the images of GetCanonicalImages, under --folder if
+// set
+func listCanonical(cmd *cobra.Command) error {
+	switch {
+	case listJSON && listJSONL:
+		return fmt.Errorf("--json and --jsonl cannot be used together")
+	case listSummary || listPairs || listIgnored || listUnrev || listDesc || cmd.Flags().Changed("sort"):
+		return fmt.Errorf("--canonical cannot be used with --summary, --pairs, --show-ignored, --unreviewed, --sort or --desc")
+	}
+
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	folder, err := absFolder(listFolder)
+	if err != nil {
+		return err
+	}
+	images, err := store.GetCanonicalImages(keepPolicies()...)
+	if err != nil {
+		return fmt.Errorf("failed to get images: %w", err)
+	}
+	if folder != "" {
+		folder = store.CanonicalPath(folder)
+		images = slices.DeleteFunc(images, func(img *models.ImageInfo) bool {
+			return !isUnder(store.CanonicalPath(img.Path), folder)
+		})
+	}
+	if images == nil {
+		images = []*models.ImageInfo{} // [] rather than null in JSON
+	}
+
+	out := cmd.OutOrStdout()
+	switch {
+	case listJSON:
+		return json.NewEncoder(out).Encode(images)
+	case listJSONL:
+		enc := json.NewEncoder(out)
+		for _, img := range images {
+			if err := enc.Encode(img); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, img := range images {
+		fmt.Fprintln(out, img.Path)
+	}
+	return nil
+}
+
+// absFolder resolves a --folder flag value; empty stays empty
+func absFolder(folder string) (string, error) {
+	if folder == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	return abs, nil
+}
+
+// groupTotals summarizes every group list covers, not just the page shown
+type groupTotals struct {
+	groups, duplicates int
+	reclaimable        int64
+}
+
+// loadPage returns the groups selected by --offset and --limit, in order,
+// with totals over all groups. In the database's own order (ascending ID,
+// no --folder or --unreviewed) and without keep policies, which would change
+// what is reclaimable, only the page is loaded and the totals are aggregated
+// in SQL. Otherwise every group is loaded, filtered, sorted and sliced.
+func loadPage(store *storage.Storage, folder string, order models.GroupOrder) ([]*models.DuplicateGroup, groupTotals, error) {
+	var totals groupTotals
+	if listSort == "id" && !listDesc && folder == "" && !listUnrev && len(keepPolicies()) == 0 {
+		var err error
+		if totals.groups, totals.duplicates, err = store.CountDuplicateGroups(); err != nil {
+			return nil, totals, err
+		}
+		if totals.reclaimable, err = store.SumReclaimableBytes(); err != nil {
+			return nil, totals, err
+		}
+		groups, err := store.GetDuplicateGroupsPage(listLimit, listOffset)
+		return groups, totals, err
+	}
+
+	groups, err := loadGroups(store, folder)
+	if err != nil {
+		return nil, totals, err
+	}
+	if listUnrev {
+		groups = models.FilterUnreviewed(groups)
+	}
+	totals.groups = len(groups)
+	for _, group := range groups {
+		totals.duplicates += len(group.Remove)
+		totals.reclaimable += group.Reclaimable()
+	}
+
+	// Sort before paginating so pages follow the chosen order
+	models.SortGroups(groups, order, listDesc)
+	groups = groups[min(listOffset, len(groups)):]
+	if listLimit > 0 && listLimit < len(groups) {
+		groups = groups[:listLimit]
+	}
+	return groups, totals, nil
+}
+
+// loadGroups returns the duplicate groups to act on: all of them, or only
+// those with an image under folder if it is set.
+func loadGroups(store *storage.Storage, folder string) ([]*models.DuplicateGroup, error) {
+	if folder == "" {
+		return store.GetDuplicateGroups(keepPolicies()...)
+	}
+	return store.GetDuplicateGroupsByFolder(folder, keepPolicies()...)
+}
+
 func printSummaryTable(groups []*models.DuplicateGroup) {
-	fmt.Printf("%-8s  %-8s  %-12s  %s\n", "Group", "Images", "Reclaimable", "Keep (best quality)")
-	fmt.Println(strings.Repeat("-", 70))
+	logger.Printf("%-11s  %-8s  %-22s  %-12s  %s\n", "Group", "Images", "Match", "Reclaimable", "Keep (best quality)")
+	logger.Printf("%s\n", strings.Repeat("-", 97))
 
 	for _, group := range groups {
-		var reclaimable int64
-		for _, img := range group.Remove {
-			reclaimable += img.FileSize
-		}
+		reclaimable := group.Reclaimable()
 
 		keepName := filepath.Base(group.Keep.Path)
 		if len(keepName) > 35 {
 			keepName = keepName[:32] + "..."
 		}
 
-		fmt.Printf("#%-7d  %-8d  %-12s  %s\n",
-			group.ID, len(group.Images), formatSize(reclaimable), keepName)
+		logger.Printf("#%-10d  %-8d  %-22s  %-12s  %s\n",
+			group.ID, len(group.Images), matchLabel(group), fileutil.FormatSize(reclaimable), keepName)
+	}
+	logger.Printf("\n")
+}
+
+// matchLabel describes how a group was matched, e.g. "perceptual, distance 4".
+// Groups stored before the method was recorded get "-".
+func matchLabel(group *models.DuplicateGroup) string {
+	switch group.MatchMethod {
+	case "":
+		return "-"
+	case models.MatchPerceptual:
+		return fmt.Sprintf("%s, distance %d", group.MatchMethod, group.Distance)
+	default:
+		return group.MatchMethod
 	}
-	fmt.Println()
 }
 
 func printGroup(group *models.DuplicateGroup, verbose bool) {
-	fmt.Printf("Group #%d (%d images)\n", group.ID, len(group.Images))
-	fmt.Println(strings.Repeat("-", 60))
+	reviewed := ""
+	if group.Reviewed() {
+		reviewed = " [reviewed]"
+	}
+	if group.MatchMethod == "" {
+		logger.Printf("Group #%d (%d images)%s\n", group.ID, len(group.Images), reviewed)
+	} else {
+		logger.Printf("Group #%d (%d images, %s)%s\n", group.ID, len(group.Images), matchLabel(group), reviewed)
+	}
+	logger.Printf("%s\n", strings.Repeat("-", 60))
 
 	for _, img := range group.Images {
 		isKeep := img.Path == group.Keep.Path
@@ -157,17 +375,47 @@ func printGroup(group *models.DuplicateGroup, verbose bool) {
 		shortPath := shortenPath(img.Path, 40)
 
 		if verbose {
-			fmt.Printf("  %s %s\n", marker, img.Path)
-			fmt.Printf("      Resolution: %dx%d  Format: %s  Size: %s\n",
-				img.Width, img.Height, strings.ToUpper(img.Format), formatSize(img.FileSize))
-			fmt.Printf("      Score: %.0f\n", img.Score)
+			logger.Printf("  %s %s\n", marker, img.Path)
+			logger.Printf("      Resolution: %dx%d  Format: %s  Size: %s\n",
+				img.Width, img.Height, strings.ToUpper(img.Format), fileutil.FormatSize(img.FileSize))
+			logger.Printf("      Score: %.0f\n", img.Score)
+			if !img.CaptureTime.IsZero() {
+				logger.Printf("      Captured: %s\n", img.CaptureTime.Format("2006-01-02 15:04:05"))
+			}
 		} else {
-			fmt.Printf("  %s %-40s  %dx%d  %-4s  %8s  Score: %.0f\n",
+			logger.Printf("  %s %-40s  %dx%d  %-4s  %8s  Score: %.0f\n",
 				marker, shortPath, img.Width, img.Height,
-				strings.ToUpper(img.Format), formatSize(img.FileSize), img.Score)
+				strings.ToUpper(img.Format), fileutil.FormatSize(img.FileSize), img.Score)
 		}
 	}
-	fmt.Println()
+	if len(group.Pairs) > 0 {
+		printPairs(group)
+	}
+	logger.Printf("\n")
+}
+
+func printPairs(group *models.DuplicateGroup) {
+	spread := 0
+	for _, p := range group.Pairs {
+		spread = max(spread, p.Dist)
+	}
+	logger.Printf("  Distances (spread %d):\n", spread)
+	for _, p := range group.Pairs {
+		logger.Printf("    %3d  %s ↔ %s\n", p.Dist,
+			filepath.Base(group.Images[p.A].Path), filepath.Base(group.Images[p.B].Path))
+	}
+}
+
+func printIgnored(paths []string) {
+	if len(paths) == 0 {
+		logger.Printf("No ignored images.\n")
+		return
+	}
+	logger.Printf("Ignored images (%d)\n", len(paths))
+	logger.Printf("%s\n", strings.Repeat("-", 60))
+	for _, path := range paths {
+		logger.Printf("  - %s\n", path)
+	}
 }
 
 func shortenPath(path string, maxLen int) string {
@@ -187,22 +435,3 @@ func shortenPath(path string, maxLen int) string {
 	}
 	return "..." + dir + file
 }
-
-func formatSize(bytes int64) string {
-	const (
-		KB = 1024
-		MB = KB * 1024
-		GB = MB * 1024
-	)
-
-	switch {
-	case bytes >= GB:
-		return fmt.Sprintf("%.1f GB", float64(bytes)/GB)
-	case bytes >= MB:
-		return fmt.Sprintf("%.1f MB", float64(bytes)/MB)
-	case bytes >= KB:
-		return fmt.Sprintf("%.1f KB", float64(bytes)/KB)
-	default:
-		return fmt.Sprintf("%d B", bytes)
-	}
-}
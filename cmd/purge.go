@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeAll     bool
+	purgeFolder  string
+	purgeHistory bool
+	purgeYes     bool
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge (--all | --folder <path>)",
+	Short: "Remove stored entries from the database",
+	Long: `Delete stored images, duplicate groups, ignored paths and interrupted-scan
+progress, either all of them (--all) or only those under a folder
+(--folder). Files on disk are never touched; rescan to store them again.
+
+Scan history is kept unless --history is given. The hash cache, which is
+keyed by file content rather than path, is always kept.
+
+Example:
+  imagedupfinder purge --folder /mnt/old-drive
+  imagedupfinder purge --all --history --yes`,
+	Args: cobra.NoArgs,
+	RunE: runPurge,
+}
+
+func init() {
+	purgeCmd.Flags().BoolVar(&purgeAll, "all", false, "Remove every stored entry")
+	purgeCmd.Flags().StringVar(&purgeFolder, "folder", "", "Remove only entries under this folder")
+	purgeCmd.Flags().BoolVar(&purgeHistory, "history", false, "Also remove scan history")
+	purgeCmd.Flags().BoolVarP(&purgeYes, "yes", "y", false, "Skip confirmation prompt")
+	purgeCmd.MarkFlagsOneRequired("all", "folder")
+	purgeCmd.MarkFlagsMutuallyExclusive("all", "folder")
+	rootCmd.AddCommand(purgeCmd)
+}
+
+func runPurge(cmd *cobra.Command, args []string) error {
+	var folder string
+	if purgeFolder != "" {
+		var err error
+		folder, err = filepath.Abs(purgeFolder)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+	}
+
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	scope := "all stored entries"
+	if folder != "" {
+		scope = "stored entries under " + folder
+	}
+	if purgeHistory {
+		scope += " and their scan history"
+	}
+
+	if !purgeYes {
+		logger.Printf("Are you sure you want to remove %s? [y/N]: ", scope)
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "y" && response != "yes" {
+			logger.Printf("Aborted.\n")
+			return nil
+		}
+	}
+
+	var n int
+	if folder != "" {
+		n, err = store.PurgeByFolder(folder, purgeHistory)
+	} else {
+		n, err = store.PurgeAll(purgeHistory)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to purge: %w", err)
+	}
+	logger.Infof("Removed %d images from the database\n", n)
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+)
+
+var regroupCmd = &cobra.Command{
+	Use:   "regroup",
+	Short: "Re-run grouping on stored hashes without rescanning",
+	Long: `Group every image in the database again from its stored hash, e.g. to try
+another --threshold. No files are read, so this takes seconds even for large
+libraries. Ignored images stay out of the groups.
+
+Grouping is always perceptual; re-run scan --exact for exact matching.
+--match-both and --match-either use the dHashes stored by a scan with one of
+them; images scanned without match on their pHash alone.
+
+Example:
+  imagedupfinder regroup --threshold 6
+  imagedupfinder regroup --threshold 12 --max-spread 16
+  imagedupfinder regroup --ignore-same-dir
+  imagedupfinder regroup --match-both --dhash-threshold 8`,
+	Args: cobra.NoArgs,
+	RunE: runRegroup,
+}
+
+func init() {
+	regroupCmd.Flags().IntVar(&maxSpread, "max-spread", 0, "Maximum distance between any two images in a group (0 = no limit)")
+	regroupCmd.Flags().StringVar(&fmtThresh, "threshold-per-format", "", "Thresholds for some formats instead of --threshold, e.g. jpg=12,png=6; two images match within the larger of their formats' thresholds")
+	regroupCmd.Flags().StringVar(&clustering, "cluster", clusterSingle, "Clustering of similar images: single (any chain of matches) or average (split clusters whose members are far apart on average)")
+	regroupCmd.Flags().IntVar(&clusterCut, "cluster-cutoff", 0, "Largest average distance within a group with --cluster average (0 = --threshold)")
+	regroupCmd.Flags().IntVar(&maxGroup, "max-group-size", 0, "Leave clusters of more than this many images out of the groups, with a warning (0 = no limit)")
+	regroupCmd.Flags().BoolVar(&noSameDir, "ignore-same-dir", false, "Never match two images in the same folder, e.g. burst shots in an album")
+	addDHashFlags(regroupCmd)
+	regroupCmd.Flags().BoolVar(&detectRot, "detect-rotations", false, "Also match rotated or mirrored copies, for images scanned with --detect-rotations")
+	rootCmd.AddCommand(regroupCmd)
+}
+
+func runRegroup(cmd *cobra.Command, args []string) error {
+	if err := checkMatchFlags(cmd); err != nil {
+		return err
+	}
+
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	logger.Infof("Regrouping (threshold: %d)...\n", threshold)
+	matcher := match.NewAutoMatcher(threshold, perceptualOptions()...)
+	groups, matched, err := match.Regroup(store, matcher)
+	if err != nil {
+		return err
+	}
+	warnOversized(matcher)
+
+	totalDuplicates := 0
+	for _, group := range groups {
+		totalDuplicates += len(group.Remove)
+	}
+	store.RecordScan(models.ScanRecord{
+		Matcher:         models.MatchPerceptual,
+		Threshold:       threshold,
+		TotalImages:     matched,
+		TotalGroups:     len(groups),
+		TotalDuplicates: totalDuplicates,
+	})
+
+	logger.Infof("Images:           %d\n", matched)
+	logger.Infof("Duplicate groups: %d\n", len(groups))
+	logger.Infof("Duplicates found: %d\n", totalDuplicates)
+	if len(groups) > 0 {
+		logger.Infof("\nRun 'imagedupfinder list' to see duplicate groups\n")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/fileutil"
+)
+
+var (
+	renameFrom  string
+	renameTo    string
+	renameForce bool
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename --from <old> --to <new>",
+	Short: "Update stored paths after moving a folder",
+	Long: `Rewrite every stored path under --from to the same path under --to, so a
+moved library doesn't need to be rescanned. Hashes, duplicate groups, the
+ignore list and scan history are kept.
+
+The images are checked to exist at their new paths first; use --force to
+remap anyway (e.g. when the new location isn't mounted yet).
+
+Example:
+  imagedupfinder rename --from /mnt/old --to /mnt/new
+  imagedupfinder rename --from /mnt/old --to /mnt/new --force`,
+	Args: cobra.NoArgs,
+	RunE: runRename,
+}
+
+func init() {
+	renameCmd.Flags().StringVar(&renameFrom, "from", "", "Folder the images were moved from")
+	renameCmd.Flags().StringVar(&renameTo, "to", "", "Folder the images were moved to")
+	renameCmd.Flags().BoolVar(&renameForce, "force", false, "Remap even if images are missing at the new paths")
+	renameCmd.MarkFlagRequired("from")
+	renameCmd.MarkFlagRequired("to")
+	rootCmd.AddCommand(renameCmd)
+}
+
+func runRename(cmd *cobra.Command, args []string) error {
+	from, err := filepath.Abs(renameFrom)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	to, err := filepath.Abs(renameTo)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if from == to {
+		return fmt.Errorf("--from and --to are the same folder")
+	}
+
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if !renameForce {
+		images, err := store.GetImagesByFolder(from)
+		if err != nil {
+			return fmt.Errorf("failed to load images: %w", err)
+		}
+		newPaths := make([]string, len(images))
+		for i, img := range images {
+			newPaths[i] = to + strings.TrimPrefix(img.Path, from)
+		}
+		if missing := fileutil.MissingFiles(newPaths); len(missing) > 0 {
+			for _, path := range missing {
+				logger.Debugf("missing: %s\n", path)
+			}
+			return fmt.Errorf("%d of %d images not found under %s (e.g. %s); use --force to remap anyway",
+				len(missing), len(images), to, missing[0])
+		}
+	}
+
+	n, err := store.RemapPaths(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to remap paths: %w", err)
+	}
+	if n == 0 {
+		logger.Infof("No images stored under %s.\n", from)
+		return nil
+	}
+	logger.Infof("Remapped %d images from %s to %s\n", n, from, to)
+	return nil
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/report"
+	"imagedupfinder/internal/scan"
+)
+
+var (
+	reportOut   string
+	reportThumb int
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report <folder>",
+	Short: "Write an HTML report of similar images without storing or removing anything",
+	Long: `Scan a folder, group similar images and write the groups to a single
+self-contained HTML file: a thumbnail of every image (embedded, so the report
+can be moved or shared on its own), its path, resolution, format, size, dates
+and camera, and the hash distance between every pair of a group.
+
+Nothing is read from or written to the database, and no file is ever
+touched, so the report is safe for evidence or read-only media. Grouping
+uses the same flags as scan; the ignore list, which lives in the database,
+does not apply.
+
+Example:
+  imagedupfinder report ./photos --out report.html
+  imagedupfinder report ./photos --out report.html --threshold 5
+  imagedupfinder report ./photos --exact --out identical.html
+  imagedupfinder report ./seized --thumbnail-size 0  # Metadata only, a much smaller file`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReport,
+}
+
+func init() {
+	reportCmd.Flags().StringVarP(&reportOut, "out", "o", "report.html", "File to write the report to")
+	reportCmd.Flags().IntVar(&reportThumb, "thumbnail-size", report.DefaultThumbnailSize, "Longest side of embedded thumbnails in pixels (0 = no thumbnails)")
+	reportCmd.Flags().BoolVar(&exactMode, "exact", false, "Group only byte-identical files (SHA256) instead of perceptual hashing (also --threshold 0)")
+	reportCmd.Flags().IntVar(&maxSpread, "max-spread", 0, "Maximum distance between any two images in a group (0 = no limit)")
+	reportCmd.Flags().StringVar(&fmtThresh, "threshold-per-format", "", "Thresholds for some formats instead of --threshold, e.g. jpg=12,png=6; two images match within the larger of their formats' thresholds")
+	reportCmd.Flags().StringVar(&clustering, "cluster", clusterSingle, "Clustering of similar images: single (any chain of matches) or average (split clusters whose members are far apart on average)")
+	reportCmd.Flags().IntVar(&clusterCut, "cluster-cutoff", 0, "Largest average distance within a group with --cluster average (0 = --threshold)")
+	reportCmd.Flags().IntVar(&maxGroup, "max-group-size", 0, "Leave clusters of more than this many images out of the groups, with a warning (0 = no limit)")
+	reportCmd.Flags().BoolVar(&noSameDir, "ignore-same-dir", false, "Never match two images in the same folder, e.g. burst shots in an album")
+	reportCmd.Flags().StringVar(&formatList, "formats", "", "Only scan these comma-separated formats, e.g. jpg,png,webp (default: all)")
+	reportCmd.Flags().BoolVar(&inclHidden, "include-hidden", false, "Also scan hidden files and folders (dotfiles such as .git or .thumbnails, and on Windows the hidden attribute)")
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReport(cmd *cobra.Command, args []string) error {
+	if err := checkExactFlags(zeroThresholdExact()); err != nil {
+		return err
+	}
+	if err := checkMatchFlags(cmd); err != nil {
+		return err
+	}
+	if formatList != "" {
+		var err error
+		if formats, err = hash.ParseFormats(formatList); err != nil {
+			return fmt.Errorf("invalid --formats: %w", err)
+		}
+	}
+
+	absFolder, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	info, err := os.Stat(absFolder)
+	if err != nil {
+		return fmt.Errorf("folder not found: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", absFolder)
+	}
+
+	logger.Infof("Scanning: %s\n", absFolder)
+	hooks := progressHooks()
+	opts := []scan.Option{
+		scan.WithWorkers(workers),
+		scan.WithFormats(formats),
+		scan.WithIncludeHidden(inclHidden),
+		scan.WithHeaderOnly(headerOnly()),
+		scan.WithLogf(logger.Debugf),
+	}
+	if hooks.progress != nil {
+		opts = append(opts, scan.WithProgressInfo(hooks.progress))
+	}
+	s := scan.NewScanner(opts...)
+	images, err := s.ScanFolder(absFolder)
+	if hooks.scanned != nil {
+		hooks.scanned()
+	}
+	if err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+	logger.Infof("Scanned: %d images\n", len(images))
+	warnWalkErrors(s.WalkErrors())
+
+	rep := report.Report{
+		Folder:      absFolder,
+		Matcher:     models.MatchPerceptual,
+		Threshold:   threshold,
+		TotalImages: len(images),
+		CreatedAt:   time.Now(),
+	}
+	var matcher match.Matcher
+	if exactMode {
+		hash.HashSizeCollisions(images, hash.ComputeFileHash)
+		matcher = match.NewExactMatcher()
+		rep.Matcher = models.MatchExact
+	} else {
+		matcher = match.NewAutoMatcher(threshold, perceptualOptions()...)
+	}
+	rep.Groups = matcher.FindGroups(images)
+	if perceptual, ok := matcher.(*match.PerceptualMatcher); ok {
+		warnOversized(perceptual)
+	}
+
+	out, err := os.Create(reportOut)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := report.WriteHTML(out, rep, report.WithThumbnailSize(reportThumb)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	logger.Infof("Duplicate groups: %d\n", len(rep.Groups))
+	logger.Infof("Report written to %s\n", reportOut)
+	return nil
+}
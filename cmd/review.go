@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var reviewClear bool
+
+var reviewCmd = &cobra.Command{
+	Use:   "review <group-id>...",
+	Short: "Mark duplicate groups as reviewed",
+	Long: `Mark groups you have already handled, so 'list --unreviewed' and the web UI
+can leave them out when you pick up where you left off.
+
+Later scans keep the mark while a group's images stay the same; a group
+that gains or loses an image needs reviewing again. Use --clear to remove
+the mark.
+
+Example:
+  imagedupfinder review 12 15        # Mark groups #12 and #15 reviewed
+  imagedupfinder review --clear 12   # Unmark group #12
+  imagedupfinder list --unreviewed   # Show what is left`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runReview,
+}
+
+func init() {
+	reviewCmd.Flags().BoolVar(&reviewClear, "clear", false, "Remove the reviewed mark instead")
+	rootCmd.AddCommand(reviewCmd)
+}
+
+func runReview(cmd *cobra.Command, args []string) error {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid group ID %q", arg)
+		}
+		ids[i] = id
+	}
+
+	store, err := openWriteStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, id := range ids {
+		if err := store.SetGroupReviewed(id, !reviewClear); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		if reviewClear {
+			logger.Infof("Unreviewed: group #%d\n", id)
+		} else {
+			logger.Infof("Reviewed: group #%d\n", id)
+		}
+	}
+	return nil
+}
@@ -2,18 +2,49 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/audit"
+	"imagedupfinder/internal/config"
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/logging"
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/storage"
 )
 
 var (
-	dbPath    string
-	threshold int
-	workers   int
+	dbPath     string
+	threshold  int
+	similarity string
+	workers    int
+	quiet      bool
+	verbose    bool
+
+	keepOldestCapture bool
+	keepOriginal      bool
+	keepSharpest      bool
+	keepRichestExif   bool
+	keepFormatOrder   string
+	busyTimeout       time.Duration
+	noWAL             bool
+	noBackup          bool
+	dbReadOnly        bool
+	foldCase          bool
+	auditPath         string
+	configPath        string
 )
 
+// logger is shared by all commands. Its level is set from --quiet/--verbose
+// before any command runs.
+var logger = logging.New(os.Stdout, os.Stderr, logging.LevelNormal)
+
 var rootCmd = &cobra.Command{
 	Use:   "imagedupfinder",
 	Short: "Find and manage duplicate images",
@@ -28,6 +59,139 @@ Example usage:
   imagedupfinder list                   # List all duplicate groups
   imagedupfinder clean --dry-run        # Preview what would be deleted
   imagedupfinder clean                  # Delete lower quality duplicates`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+		switch {
+		case quiet:
+			logger.SetLevel(logging.LevelQuiet)
+		case verbose:
+			logger.SetLevel(logging.LevelVerbose)
+		}
+		if similarity != "" {
+			var err error
+			if threshold, err = match.ThresholdForSimilarity(similarity, hash.HashBits); err != nil {
+				return fmt.Errorf("invalid --similarity: %w", err)
+			}
+			logger.Infof("Similarity %s%%: Hamming distance threshold %d of %d bits\n", strings.TrimSuffix(similarity, "%"), threshold, hash.HashBits)
+		}
+		if keepFormatOrder != "" {
+			if _, err := hash.ParseFormats(keepFormatOrder); err != nil {
+				return fmt.Errorf("invalid --keep-format-order: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+// exclusiveFlags are the flags that are mutually exclusive with each other;
+// a configured value yields to any of its group given on the command line
+var exclusiveFlags = [][]string{{"quiet", "verbose"}, {"threshold", "similarity"}}
+
+// applyConfig fills the flags of cmd not given on the command line from the
+// config file: --config, or the first imagedupfinder.yaml in the working
+// directory or ~/.config/imagedupfinder. Top-level keys must be global
+// flags; a command's own flags go under its name.
+func applyConfig(cmd *cobra.Command) error {
+	path := configPath
+	if path == "" {
+		homeDir, _ := os.UserHomeDir()
+		if path = config.Find(".", filepath.Join(homeDir, ".config", "imagedupfinder")); path == "" {
+			return nil
+		}
+	}
+	f, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	root := cmd.Root()
+	for name := range f.Global {
+		if root.PersistentFlags().Lookup(name) == nil {
+			return fmt.Errorf("config %s: %q is not a global flag (put a command's flags under its name)", path, name)
+		}
+	}
+	for name := range f.Commands {
+		if found, _, err := root.Find(strings.Fields(name)); err != nil || found == root {
+			return fmt.Errorf("config %s: unknown command %q", path, name)
+		}
+	}
+
+	values := maps.Clone(f.Global)
+	maps.Copy(values, f.Commands[strings.TrimPrefix(cmd.CommandPath(), root.Name()+" ")])
+	if err := config.Apply(cmd.Flags(), values, exclusiveFlags...); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// keepPolicies returns the keep policies selected by flags, for list, clean
+// and serve, most decisive first. No policies means highest quality wins.
+func keepPolicies() []models.KeepPolicy {
+	var policies []models.KeepPolicy
+	if keepFormatOrder != "" {
+		policies = append(policies, models.KeepFormatOrder(strings.Split(keepFormatOrder, ",")))
+	}
+	if keepOriginal {
+		policies = append(policies, models.KeepOriginalCamera)
+	}
+	if keepSharpest {
+		policies = append(policies, models.KeepSharpest)
+	}
+	if keepRichestExif {
+		policies = append(policies, models.KeepRichestExif)
+	}
+	if keepOldestCapture {
+		policies = append(policies, models.KeepOldestCapture)
+	}
+	return policies
+}
+
+// storageOptions returns the database options selected by flags
+func storageOptions() []storage.Option {
+	opts := []storage.Option{
+		storage.WithBusyTimeout(busyTimeout),
+		storage.WithWAL(!noWAL),
+		storage.WithMigrationBackup(!noBackup),
+		storage.WithCaseFolding(foldCase),
+	}
+	if dbReadOnly {
+		opts = append(opts, storage.WithReadOnly())
+	}
+	return opts
+}
+
+// openStorage opens the database at --db with the options selected by flags,
+// for reading. Commands that change it use openWriteStorage.
+func openStorage() (*storage.Storage, error) {
+	return newStorage(storageOptions()...)
+}
+
+// openWriteStorage is openStorage plus the writer lock, which fails if
+// another command is already writing the same database
+func openWriteStorage() (*storage.Storage, error) {
+	if dbReadOnly {
+		return nil, fmt.Errorf("this command writes the database and can't be used with --db-readonly")
+	}
+	return newStorage(append(storageOptions(), storage.WithWriterLock())...)
+}
+
+// openAuditLog opens --audit-log for appending. Without the flag it returns
+// a nil log, which records nothing.
+func openAuditLog() (*audit.Log, error) {
+	if auditPath == "" {
+		return nil, nil
+	}
+	return audit.Open(auditPath)
+}
+
+func newStorage(opts ...storage.Option) (*storage.Storage, error) {
+	store, err := storage.NewStorage(dbPath, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return store, nil
 }
 
 func Execute() {
@@ -42,7 +206,24 @@ func init() {
 	homeDir, _ := os.UserHomeDir()
 	defaultDB := filepath.Join(homeDir, ".imagedupfinder", "images.db")
 
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file with flag defaults (default: ./"+config.FileName+", then ~/.config/imagedupfinder/"+config.FileName+")")
 	rootCmd.PersistentFlags().StringVar(&dbPath, "db", defaultDB, "Path to SQLite database")
-	rootCmd.PersistentFlags().IntVar(&threshold, "threshold", 10, "Hamming distance threshold (0-64, lower = stricter)")
-	rootCmd.PersistentFlags().IntVar(&workers, "workers", 8, "Number of parallel workers for scanning")
+	rootCmd.PersistentFlags().DurationVar(&busyTimeout, "busy-timeout", 5*time.Second, "How long to wait for a database locked by another command")
+	rootCmd.PersistentFlags().BoolVar(&noWAL, "no-wal", false, "Disable write-ahead logging (for databases on network filesystems)")
+	rootCmd.PersistentFlags().BoolVar(&noBackup, "no-backup", false, "Don't back up the database before applying schema migrations")
+	rootCmd.PersistentFlags().BoolVar(&dbReadOnly, "db-readonly", false, "Open the database read-only and immutable, e.g. on a read-only mount (list, find, serve, doctor, clean --dry-run)")
+	rootCmd.PersistentFlags().BoolVar(&foldCase, "case-insensitive-paths", false, "Match paths regardless of case so one file reached under differently cased paths is one image (case-insensitive filesystems only)")
+	rootCmd.PersistentFlags().IntVar(&threshold, "threshold", match.DefaultThreshold, "Hamming distance threshold (0-64, lower = stricter)")
+	rootCmd.PersistentFlags().StringVar(&similarity, "similarity", "", "Minimum share of matching hash bits, e.g. 90% (sets --threshold from the hash width)")
+	rootCmd.PersistentFlags().IntVar(&workers, "workers", 8, "Number of parallel workers for scanning and for matching perceptual hashes")
+	rootCmd.PersistentFlags().BoolVar(&keepOldestCapture, "keep-oldest-capture", false, "Keep the image with the earliest EXIF capture date (mod time if absent) instead of the highest quality")
+	rootCmd.PersistentFlags().StringVar(&keepFormatOrder, "keep-format-order", "", "Keep the image whose format comes first in this comma-separated list, e.g. png,tiff,webp,jpg,gif, before comparing quality")
+	rootCmd.PersistentFlags().BoolVar(&keepOriginal, "keep-original-camera", false, "Keep the image with camera EXIF rather than an edited export, before comparing quality")
+	rootCmd.PersistentFlags().BoolVar(&keepSharpest, "keep-sharpest", false, "Keep the sharpest image (e.g. the best frame of a burst) before comparing quality")
+	rootCmd.PersistentFlags().BoolVar(&keepRichestExif, "keep-richest-exif", false, "Keep the image with the most EXIF fields (GPS, lens, camera settings) rather than a stripped copy, before comparing quality")
+	rootCmd.PersistentFlags().StringVar(&auditPath, "audit-log", "", "Append a JSON line for every file removed or moved to this file (clean, serve)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress progress and summaries (errors are still shown)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show detailed output")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.MarkFlagsMutuallyExclusive("threshold", "similarity")
 }
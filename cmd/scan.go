@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"imagedupfinder/internal/fileutil"
 	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/logging"
 	"imagedupfinder/internal/match"
 	"imagedupfinder/internal/models"
 	"imagedupfinder/internal/scan"
@@ -18,8 +22,51 @@ import (
 var (
 	exactMode  bool
 	fullRescan bool
+	resumeScan bool
+	maxOpen    int
+	maxSpread  int
+	maxGroup   int
+	clustering string
+	clusterCut int
+	fmtThresh  string
+	fmtLimits  map[string]int
+	noSameDir  bool
+	hashCache  bool
+	autoThresh bool
+	normLuma   bool
+	fastDecode bool
+	centerCrop float64
+	retries    int
+	retryDelay time.Duration
+	blurHash   bool
+	minRes     string
+	minWidth   int
+	minHeight  int
+	sinceFlag  string
+	since      time.Time
+	formatList string
+	formats    hash.FormatSet
+	byContent  bool
+	scanZip    bool
+	inclHidden bool
+	exactFirst bool
+	jsonProg   bool
+	detectRot  bool
+	ioWorkers  int
+	cpuWorkers int
+	estimate   bool
+	matchBoth  bool
+	matchAny   bool
+	dHashLimit int
 )
 
+// estimateSample is how many files scan --estimate hashes to time the rest
+const estimateSample = 20
+
+// saveBatchSize is how many freshly scanned images are written to the
+// database at a time, bounding the work lost if a scan is interrupted.
+const saveBatchSize = 500
+
 var scanCmd = &cobra.Command{
 	Use:   "scan <folder>",
 	Short: "Scan a folder for duplicate images",
@@ -31,29 +78,153 @@ The scan will:
 3. Group similar images based on hash distance (or exact match with --exact)
 4. Store results in the database for later use
 
+--threshold 0 is a shortcut for --exact: only byte-identical files (same
+SHA256) are grouped, and two visually identical files with different bytes,
+e.g. the same picture saved twice, are not. It stays perceptual, matching
+pHashes at distance 0, with --threshold-auto, --threshold-per-format,
+--detect-rotations, --normalize-luma or --center-crop. With --exact, images
+are not decoded (only their headers are read, for the dimensions) unless
+--blurhash or one of those pHash flags needs the pixels, so the database holds
+no perceptual hashes for them and 'regroup' leaves them out.
+
+--match-both and --match-either also store a difference hash (dHash) per
+image. Both fingerprints come from the same image but react differently to
+edits, so with --match-both two images match only when their pHashes are
+within --threshold and their dHashes within --dhash-threshold, dropping pairs
+that only look alike to one of them; --match-either matches on either, to
+find more. Images without a dHash, e.g. from an earlier scan that is not
+re-hashed, match on their pHash alone.
+
 Files already in the database whose size and modification time are unchanged
 are not re-hashed, so re-scanning a large folder is fast. Use --full to force
-re-hashing everything. Database entries for files that no longer exist under
-the scanned folder are removed automatically.
+re-hashing everything. With --hash-cache, files are also matched by content
+(size, modification time and a sample of their bytes), so a file first seen
+under another path, e.g. after a move, is not decoded again. Database entries
+for files that no longer exist under the scanned folder are removed
+automatically.
+
+Results are saved as the scan progresses. If a scan is interrupted, re-run it
+with --resume to skip the files that were already processed.
+
+A file whose read fails with a transient I/O error (EIO, a timeout), as is
+common on SMB/NFS mounts, is read again up to --retries times, waiting
+--retry-backoff and then twice as long each time. Files that still fail are
+listed at the end; they are not marked processed, so --resume or the next
+scan tries them again. Broken or unsupported images are not retried.
+
+With --estimate, nothing is hashed or stored: the folder is walked with the
+same filters, the supported images and their total size are counted (those
+unchanged since the last scan apart, as they won't be re-hashed) and a few of
+the others are hashed to estimate how long the scan would take.
+
+With --progress-json, progress is written to stderr as one JSON object per
+file, {"scanned":n,"total":t,"path":"..."}, instead of the progress line, for
+programs that run the scan; the summary stays on stdout.
 
 Example:
   imagedupfinder scan ./photos
   imagedupfinder scan /path/to/images --threshold 5
+  imagedupfinder scan ./photos --threshold-auto # Pick the threshold from the hashes
+  imagedupfinder scan ./photos --max-spread 12  # Don't chain distant images together
+  imagedupfinder scan ./scans --max-group-size 50  # Set aside runaway clusters of near-blank pages
+  imagedupfinder scan ./albums --ignore-same-dir  # Only match across folders (keep bursts)
   imagedupfinder scan ./photos --exact  # Find only byte-identical duplicates
-  imagedupfinder scan ./photos --full   # Re-hash all files, ignore cache`,
+  imagedupfinder scan ./photos --dedupe-exact-first  # Decode one file per set of byte-identical copies
+  imagedupfinder scan ./scans --normalize-luma  # Match color and grayscale copies
+  imagedupfinder scan ./photos --match-both  # Require the dHash to agree too
+  imagedupfinder scan ./photos --full   # Re-hash all files, ignore cache
+  imagedupfinder scan ./moved --hash-cache  # Reuse hashes of files seen under other paths
+  imagedupfinder scan ./photos --resume # Continue an interrupted scan
+  imagedupfinder scan /mnt/archive --estimate  # Count files and estimate the time first
+  imagedupfinder scan ./site --min-resolution 200x200  # Don't group icons and sprites
+  imagedupfinder scan ./photos --since 24h        # Only hash files modified in the last day
+  imagedupfinder scan ./photos --since 2024-01-01 # ... or since a date
+  imagedupfinder scan ./photos --formats jpg,png,webp  # Skip TIFF, BMP, etc.
+  imagedupfinder scan /mnt/nas --workers-io 2 --workers-cpu 16  # Few reads, many decodes
+  imagedupfinder scan ./photos --progress-json 2>progress.jsonl  # Progress for a GUI`,
 	Args: cobra.ExactArgs(1),
 	RunE: runScan,
 }
 
 func init() {
 	rootCmd.AddCommand(scanCmd)
-	scanCmd.Flags().BoolVar(&exactMode, "exact", false, "Use exact file hash matching instead of perceptual hashing")
+	scanCmd.Flags().BoolVar(&exactMode, "exact", false, "Group only byte-identical files (SHA256) instead of perceptual hashing; images aren't decoded (also --threshold 0)")
 	scanCmd.Flags().BoolVar(&fullRescan, "full", false, "Re-hash all files instead of skipping unchanged ones")
+	scanCmd.Flags().BoolVar(&exactFirst, "dedupe-exact-first", false, "Decode and hash only one of each set of byte-identical files (found by size and SHA256); the others copy its hash")
+	scanCmd.Flags().BoolVar(&jsonProg, "progress-json", false, "Write progress to stderr as one JSON object per file instead of the progress line")
+	scanCmd.Flags().BoolVar(&hashCache, "hash-cache", false, "Reuse hashes of identical files seen before, even under other paths")
+	scanCmd.Flags().IntVar(&maxOpen, "max-open-files", 64, "Maximum number of image files open at once (0 = no limit)")
+	scanCmd.Flags().IntVar(&retries, "retries", 2, "Read a file again up to this many times after a transient I/O error, e.g. on a network mount")
+	scanCmd.Flags().DurationVar(&retryDelay, "retry-backoff", 500*time.Millisecond, "Wait before the first retry of a file; doubled for each next one")
+	scanCmd.Flags().BoolVar(&autoThresh, "threshold-auto", false, "Choose the threshold from the distribution of hash distances")
+	scanCmd.Flags().BoolVar(&blurHash, "blurhash", false, "Store a BlurHash per image so the web UI can show blurred placeholders while thumbnails load")
+	scanCmd.Flags().BoolVar(&normLuma, "normalize-luma", false, "Hash normalized luminance so color, grayscale and inverted copies match")
+	scanCmd.Flags().BoolVar(&fastDecode, "fast-decode", false, "Hash a downscaled copy of each image; about twice as fast on large photos, slightly less precise")
+	scanCmd.Flags().Float64Var(&centerCrop, "center-crop", 1, "Hash only this middle fraction of each image, e.g. 0.8, so borders and watermarks at the edges matter less (1 = whole image)")
+	scanCmd.Flags().BoolVar(&detectRot, "detect-rotations", false, "Also match copies rotated by 90/180/270 degrees or mirrored (stores four extra hashes per image)")
+	scanCmd.Flags().IntVar(&maxSpread, "max-spread", 0, "Maximum distance between any two images in a group (0 = no limit)")
+	scanCmd.Flags().StringVar(&fmtThresh, "threshold-per-format", "", "Thresholds for some formats instead of --threshold, e.g. jpg=12,png=6; two images match within the larger of their formats' thresholds")
+	scanCmd.Flags().StringVar(&clustering, "cluster", clusterSingle, "Clustering of similar images: single (any chain of matches) or average (split clusters whose members are far apart on average)")
+	scanCmd.Flags().IntVar(&clusterCut, "cluster-cutoff", 0, "Largest average distance within a group with --cluster average (0 = --threshold)")
+	scanCmd.Flags().IntVar(&maxGroup, "max-group-size", 0, "Leave clusters of more than this many images out of the groups, with a warning (0 = no limit)")
+	scanCmd.Flags().BoolVar(&noSameDir, "ignore-same-dir", false, "Never match two images in the same folder, e.g. burst shots in an album")
+	addDHashFlags(scanCmd)
+	scanCmd.Flags().BoolVar(&estimate, "estimate", false, "Only count the images to scan and estimate the time from a small sample; nothing is stored")
+	scanCmd.Flags().BoolVar(&resumeScan, "resume", false, "Resume an interrupted scan, skipping files already processed")
+	scanCmd.Flags().StringVar(&sinceFlag, "since", "", "Only hash files modified within a duration (24h) or since a date (2024-01-01); older ones are grouped from the database")
+	scanCmd.Flags().IntVar(&ioWorkers, "workers-io", 0, "Read files with this many workers, separately from decoding (0 = --workers, unless --workers-cpu is set)")
+	scanCmd.Flags().IntVar(&cpuWorkers, "workers-cpu", 0, "Decode and hash with this many workers, separately from reading (0 = --workers, unless --workers-io is set)")
+	scanCmd.Flags().StringVar(&formatList, "formats", "", "Only scan these comma-separated formats, e.g. jpg,png,webp (default: all)")
+	scanCmd.Flags().BoolVar(&byContent, "detect-by-content", false, "Also scan files with another extension or none when their first bytes are those of an image (opens every file)")
+	scanCmd.Flags().BoolVar(&scanZip, "zip", false, "Also scan images inside .zip archives, without extracting them (they are reported but never cleaned)")
+	scanCmd.Flags().BoolVar(&inclHidden, "include-hidden", false, "Also scan hidden files and folders (dotfiles such as .git or .thumbnails, and on Windows the hidden attribute)")
+	scanCmd.Flags().StringVar(&minRes, "min-resolution", "", "Leave images smaller than WIDTHxHEIGHT out of grouping (they are still stored)")
 }
 
 func runScan(cmd *cobra.Command, args []string) error {
 	folder := args[0]
 
+	viaZero := zeroThresholdExact()
+	if err := checkExactFlags(viaZero); err != nil {
+		return err
+	}
+	if err := checkMatchFlags(cmd); err != nil {
+		return err
+	}
+
+	if autoThresh {
+		if exactMode {
+			return fmt.Errorf("--threshold-auto cannot be used with --exact")
+		}
+		if cmd.Flags().Changed("threshold") || cmd.Flags().Changed("similarity") {
+			return fmt.Errorf("--threshold/--similarity and --threshold-auto cannot be used together")
+		}
+	}
+
+	if err := checkCenterCrop(); err != nil {
+		return err
+	}
+
+	if minRes != "" {
+		if _, err := fmt.Sscanf(minRes, "%dx%d", &minWidth, &minHeight); err != nil || minWidth < 0 || minHeight < 0 {
+			return fmt.Errorf("invalid --min-resolution %q: want WIDTHxHEIGHT, e.g. 200x200", minRes)
+		}
+	}
+
+	if formatList != "" {
+		var err error
+		if formats, err = hash.ParseFormats(formatList); err != nil {
+			return fmt.Errorf("invalid --formats: %w", err)
+		}
+	}
+
+	if sinceFlag != "" {
+		var err error
+		if since, err = parseSince(sinceFlag, time.Now()); err != nil {
+			return err
+		}
+	}
+
 	// Resolve absolute path
 	absFolder, err := filepath.Abs(folder)
 	if err != nil {
@@ -69,137 +240,372 @@ func runScan(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("not a directory: %s", absFolder)
 	}
 
-	fmt.Printf("Scanning: %s\n", absFolder)
-	if exactMode {
-		fmt.Println("Mode: Exact matching (SHA256)")
+	if estimate {
+		logger.Infof("Estimating: %s\n", absFolder)
+	} else {
+		logger.Infof("Scanning: %s\n", absFolder)
+	}
+	if viaZero {
+		logger.Infof("Mode: Exact matching (SHA256; --threshold 0)\n")
+	} else if exactMode {
+		logger.Infof("Mode: Exact matching (SHA256)\n")
 	} else {
-		fmt.Printf("Mode: Perceptual hashing (threshold: %d)\n", threshold)
+		if autoThresh {
+			logger.Infof("Mode: Perceptual hashing (threshold: auto)\n")
+		} else {
+			logger.Infof("Mode: Perceptual hashing (threshold: %d)\n", threshold)
+		}
+	}
+	if ioWorkers > 0 || cpuWorkers > 0 {
+		logger.Infof("Workers: %d reading, %d hashing\n\n", cmp.Or(ioWorkers, workers), cmp.Or(cpuWorkers, workers))
+	} else {
+		logger.Infof("Workers: %d\n\n", workers)
+	}
+
+	if estimate {
+		return runEstimate(absFolder)
 	}
-	fmt.Printf("Workers: %d\n\n", workers)
 
 	// Initialize storage
-	store, err := storage.NewStorage(dbPath)
+	store, err := openWriteStorage()
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer store.Close()
 
-	// Load previous results so unchanged files can skip re-hashing and stale
-	// entries for deleted files can be pruned.
-	knownImages, err := store.GetAllImages()
+	result, err := scanAndGroup(store, absFolder, progressHooks())
 	if err != nil {
-		return fmt.Errorf("failed to load previous scan results: %w", err)
+		return err
 	}
-	knownByPath := make(map[string]*models.ImageInfo, len(knownImages))
-	for _, img := range knownImages {
-		knownByPath[img.Path] = img
+	if result.TotalScanned == 0 {
+		return nil
 	}
 
-	// Create scanner with progress reporting
-	lastLine := ""
+	// Print summary
+	logger.Infof("\n")
+	logger.Infof("=== Scan Complete ===\n")
+	logger.Infof("Total images:     %d\n", result.TotalScanned)
+	logger.Infof("Duplicate groups: %d\n", result.TotalGroups)
+	logger.Infof("Duplicates found: %d\n", result.TotalDuplicates)
+
+	if result.TotalGroups > 0 {
+		logger.Infof("\n")
+		logger.Infof("Run 'imagedupfinder list' to see duplicate groups\n")
+		logger.Infof("Run 'imagedupfinder clean --dry-run' to preview deletions\n")
+	}
+
+	return nil
+}
+
+// scannerOptions returns the scanner options set by the scan flags that
+// decide which files are scanned and how they are hashed
+func scannerOptions() []scan.Option {
 	opts := []scan.Option{
 		scan.WithWorkers(workers),
-		scan.WithProgress(func(scanned, total int, current string) {
+		scan.WithReadWorkers(ioWorkers),
+		scan.WithHashWorkers(cpuWorkers),
+		scan.WithMaxOpenFiles(maxOpen),
+		scan.WithNormalizeLuma(normLuma),
+		scan.WithFastDecode(fastDecode),
+		scan.WithCenterCrop(centerCrop),
+		scan.WithRetries(retries, retryDelay),
+		scan.WithBlurHash(blurHash),
+		scan.WithOrientations(detectRot),
+		scan.WithHeaderOnly(headerOnly()),
+		scan.WithDHash(matchBoth || matchAny),
+		scan.WithFormats(formats),
+		scan.WithDetectByContent(byContent),
+		scan.WithArchives(scanZip),
+		scan.WithIncludeHidden(inclHidden),
+		scan.WithLogf(logger.Debugf),
+	}
+	if !since.IsZero() {
+		opts = append(opts, scan.WithModifiedSince(since))
+	}
+	return opts
+}
+
+// runEstimate is scan --estimate: it counts the files a scan of absFolder
+// would hash and times a sample of them, reading the database only for the
+// known images (and with --resume the processed paths)
+func runEstimate(absFolder string) error {
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	opts := scannerOptions()
+	if !fullRescan {
+		known, err := store.GetAllImages()
+		if err != nil {
+			return fmt.Errorf("failed to load previous scan results: %w", err)
+		}
+		byPath := make(map[string]*models.ImageInfo, len(known))
+		for _, img := range known {
+			byPath[store.CanonicalPath(img.Path)] = img
+		}
+		opts = append(opts, scan.WithKnownImages(byPath), scan.WithKnownKey(store.CanonicalPath))
+	}
+	if resumeScan {
+		processed, err := store.GetProcessedPaths(absFolder)
+		if err != nil {
+			return fmt.Errorf("failed to load scan progress: %w", err)
+		}
+		opts = append(opts, scan.WithSkipPaths(processed))
+	}
+	s := scan.NewScanner(opts...)
+
+	est, err := s.Estimate(absFolder, estimateSample)
+	if err != nil {
+		return fmt.Errorf("estimate failed: %w", err)
+	}
+	warnWalkErrors(s.WalkErrors())
+
+	logger.Infof("=== Scan Estimate ===\n")
+	logger.Infof("Images:         %d (%s)\n", est.Files, fileutil.FormatSize(est.Bytes))
+	if est.Cached > 0 {
+		logger.Infof("Unchanged:      %d (not re-hashed)\n", est.Cached)
+	}
+	switch {
+	case est.Files == est.Cached:
+		logger.Infof("Nothing to hash.\n")
+	case est.Sampled == 0:
+		logger.Infof("Estimated time: unknown (no sampled file could be hashed)\n")
+	case est.Duration < time.Second:
+		logger.Infof("Estimated time: under a second (from %d sample files)\n", est.Sampled)
+	default:
+		logger.Infof("Estimated time: %s (from %d sample files)\n", est.Duration.Round(time.Second), est.Sampled)
+	}
+	return nil
+}
+
+// progressHooks returns the hooks that show scan progress as selected by
+// the flags. The progress line is rewritten in place, which only makes sense
+// when nothing else is being printed per file. JSON progress goes to stderr,
+// so nothing on stdout gets in its way.
+func progressHooks() scanHooks {
+	var hooks scanHooks
+	if jsonProg {
+		hooks.progress = scan.JSONProgress(os.Stderr)
+	} else if logger.Level() == logging.LevelNormal {
+		lastLine := ""
+		hooks.progress = func(p scan.ProgressInfo) {
 			// Clear previous line
 			if lastLine != "" {
-				fmt.Print("\r" + strings.Repeat(" ", len(lastLine)) + "\r")
+				logger.Infof("%s", "\r"+strings.Repeat(" ", len(lastLine))+"\r")
 			}
-			shortPath := current
+			shortPath := p.Current
 			if len(shortPath) > 50 {
 				shortPath = "..." + shortPath[len(shortPath)-47:]
 			}
-			lastLine = fmt.Sprintf("Progress: %d/%d  %s", scanned, total, shortPath)
-			fmt.Print(lastLine)
+			lastLine = fmt.Sprintf("Progress: %d/%d (%s)  %s", p.Scanned, p.Total, formatRate(p), shortPath)
+			logger.Infof("%s", lastLine)
+		}
+		hooks.scanned = func() {
+			if lastLine != "" {
+				logger.Infof("%s", "\r"+strings.Repeat(" ", len(lastLine))+"\r")
+			}
+		}
+	}
+	return hooks
+}
+
+// scanHooks lets a caller of scanAndGroup follow the scan. Either may be nil.
+type scanHooks struct {
+	progress func(scan.ProgressInfo) // per file, serialized
+	scanned  func()                  // once hashing is over, before anything else is logged
+}
+
+// scanAndGroup runs one scan of absFolder as configured by the scan flags:
+// hashes new and changed images, prunes missing ones, finds duplicate groups
+// and stores it all. Used by scan and by the web UI's rescan.
+func scanAndGroup(store *storage.Storage, absFolder string, hooks scanHooks) (*models.ScanResult, error) {
+	// Load previous results so unchanged files can skip re-hashing and stale
+	// entries for deleted files can be pruned.
+	knownImages, err := store.GetAllImages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load previous scan results: %w", err)
+	}
+	knownByPath := make(map[string]*models.ImageInfo, len(knownImages))
+	for _, img := range knownImages {
+		knownByPath[store.CanonicalPath(img.Path)] = img
+	}
+
+	// An interrupted scan leaves its processed paths behind; resuming skips
+	// them, a fresh scan starts over.
+	var processed map[string]bool
+	if resumeScan {
+		processed, err = store.GetProcessedPaths(absFolder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load scan progress: %w", err)
+		}
+		if len(processed) > 0 {
+			logger.Infof("Resuming: %d files already processed\n\n", len(processed))
+		}
+	} else if err := store.ClearProcessed(absFolder); err != nil {
+		return nil, fmt.Errorf("failed to reset scan progress: %w", err)
+	}
+
+	opts := append(scannerOptions(),
+		scan.WithSkipPaths(processed),
+		scan.WithDedupeExactFirst(exactFirst),
+		scan.WithBatchSink(saveBatchSize, func(batch []*models.ImageInfo) error {
+			if err := store.SaveImages(batch); err != nil {
+				return err
+			}
+			paths := make([]string, len(batch))
+			for i, img := range batch {
+				paths[i] = img.Path
+			}
+			return store.MarkProcessed(absFolder, paths)
 		}),
+	)
+	if hooks.progress != nil {
+		opts = append(opts, scan.WithProgressInfo(hooks.progress))
 	}
 	if !fullRescan {
-		opts = append(opts, scan.WithKnownImages(knownByPath))
+		opts = append(opts, scan.WithKnownImages(knownByPath), scan.WithKnownKey(store.CanonicalPath))
+	}
+	if hashCache && !fullRescan {
+		opts = append(opts, scan.WithHashCache(store))
 	}
 	s := scan.NewScanner(opts...)
 
 	// Scan folder
 	images, err := s.ScanFolder(absFolder)
+	if hooks.scanned != nil {
+		hooks.scanned()
+	}
 	if err != nil {
-		return fmt.Errorf("scan failed: %w", err)
+		return nil, fmt.Errorf("scan failed: %w (re-run with --resume to continue)", err)
 	}
 
-	// Clear progress line
-	if lastLine != "" {
-		fmt.Print("\r" + strings.Repeat(" ", len(lastLine)) + "\r")
+	// Files processed before the interruption were skipped; their results
+	// are already in the database. Progress keeps the paths as walked, so
+	// they are looked up in canonical form like any other known path.
+	for path := range processed {
+		if img, ok := knownByPath[store.CanonicalPath(path)]; ok {
+			if _, err := hash.Stat(path); err == nil {
+				images = append(images, img)
+			}
+		}
 	}
 
 	// Reused entries are the exact pointers handed to the scanner via the
-	// known-images map; anything else was freshly hashed.
+	// known-images map; anything else was freshly hashed. Paths are compared
+	// in canonical form, as the database matches them.
 	reused := 0
 	scannedPaths := make(map[string]bool, len(images))
 	for _, img := range images {
-		scannedPaths[img.Path] = true
-		if knownByPath[img.Path] == img {
+		scannedPaths[store.CanonicalPath(img.Path)] = true
+		if knownByPath[store.CanonicalPath(img.Path)] == img {
 			reused++
 		}
 	}
 
-	fmt.Printf("Scanned: %d images", len(images))
+	logger.Infof("Scanned: %d images", len(images))
 	if reused > 0 {
-		fmt.Printf(" (%d unchanged, skipped re-hashing)", reused)
+		logger.Infof(" (%d unchanged, skipped re-hashing)", reused)
+	}
+	summary := s.Summary()
+	if summary.Skipped > 0 {
+		logger.Infof(", skipped %d (unsupported or excluded)", summary.Skipped)
+	}
+	if summary.Failed > 0 {
+		logger.Infof(", failed %d (unreadable or timed out; -v for details)", summary.Failed)
 	}
-	fmt.Println()
+	logger.Infof("\n")
+	warnWalkErrors(s.WalkErrors())
+	warnIOErrors(s.IOErrors())
 
 	// Prune entries for files under this folder that no longer exist on disk,
-	// so deleted files don't linger in list/serve output.
-	pruned := 0
-	prefix := absFolder + string(os.PathSeparator)
+	// so deleted files don't linger in list/serve output. With --since, the
+	// stored entries of older files that still exist are grouped along with
+	// the new arrivals.
+	pruned, older := 0, 0
+	prefix := store.CanonicalPath(absFolder) + string(os.PathSeparator)
 	for _, img := range knownImages {
-		if scannedPaths[img.Path] || !strings.HasPrefix(img.Path, prefix) {
+		if key := store.CanonicalPath(img.Path); scannedPaths[key] || !strings.HasPrefix(key, prefix) {
 			continue
 		}
-		if _, err := os.Stat(img.Path); os.IsNotExist(err) {
+		_, err := hash.Stat(img.Path)
+		switch {
+		case os.IsNotExist(err):
 			if store.DeleteImage(img.Path) == nil {
 				pruned++
 			}
+		case err == nil && !since.IsZero():
+			images = append(images, img)
+			older++
 		}
 	}
 	if pruned > 0 {
-		fmt.Printf("Pruned: %d missing files removed from database\n", pruned)
+		logger.Infof("Pruned: %d missing files removed from database\n", pruned)
+	}
+	if older > 0 {
+		logger.Infof("Older: %d files modified before %s taken from the database\n", older, since.Format("2006-01-02 15:04"))
 	}
 
 	if len(images) == 0 {
-		fmt.Println("No images found.")
-		return nil
+		logger.Infof("No images found.\n")
+		return &models.ScanResult{}, nil
+	}
+
+	// RAW+JPEG pairs are linked so clean --respect-sidecars can handle a
+	// file's sidecar along with it
+	if n := scan.LinkSidecars(images); n > 0 {
+		logger.Debugf("Linked %d RAW+JPEG sidecar pairs\n", n)
 	}
 
-	// Compute file hashes if in exact mode (reused entries may already have one)
+	// Compute file hashes if in exact mode, only for files whose size
+	// matches another's (reused entries may already have one)
 	if exactMode {
-		fmt.Println("Computing file hashes...")
-		for _, img := range images {
-			if img.FileHash != "" {
-				continue
-			}
-			fileHash, err := hash.ComputeFileHash(img.Path)
-			if err == nil {
-				img.FileHash = fileHash
-			}
-		}
+		logger.Infof("Computing file hashes...\n")
+		n := hash.HashSizeCollisions(images, hash.ComputeFileHash)
+		logger.Debugf("Hashed %d of %d files (the rest have unique sizes)\n", n, len(images))
 	}
 
 	// Save images to database
 	if err := store.SaveImages(images); err != nil {
-		return fmt.Errorf("failed to save images: %w", err)
+		return nil, fmt.Errorf("failed to save images: %w", err)
+	}
+
+	// Find duplicate groups, leaving out ignored images
+	ignored, err := store.GetIgnoredPaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore list: %w", err)
+	}
+	candidates := match.WithoutPaths(images, ignored, store.CanonicalPath)
+	if minWidth > 0 || minHeight > 0 {
+		n := len(candidates)
+		candidates = match.MinResolution(candidates, minWidth, minHeight)
+		logger.Infof("Excluded from grouping: %d images below %dx%d\n", n-len(candidates), minWidth, minHeight)
 	}
 
-	// Find duplicate groups
-	fmt.Println("Finding duplicates...")
+	logger.Infof("Finding duplicates...\n")
 	var matcher match.Matcher
 	if exactMode {
 		matcher = match.NewExactMatcher()
 	} else {
-		matcher = match.NewPerceptualMatcher(threshold)
+		if autoThresh {
+			hashes := make([]uint64, len(candidates))
+			for i, img := range candidates {
+				hashes[i] = img.Hash
+			}
+			threshold = match.SuggestThreshold(hashes)
+			logger.Infof("Auto threshold: %d\n", threshold)
+		}
+		matcher = match.NewAutoMatcher(threshold, perceptualOptions()...)
+	}
+	groups := matcher.FindGroups(candidates)
+	if perceptual, ok := matcher.(*match.PerceptualMatcher); ok {
+		warnOversized(perceptual)
 	}
-	groups := matcher.FindGroups(images)
 
 	// Update groups in database
 	if err := store.UpdateGroups(groups); err != nil {
-		return fmt.Errorf("failed to update groups: %w", err)
+		return nil, fmt.Errorf("failed to update groups: %w", err)
 	}
 
 	// Record scan history
@@ -207,20 +613,231 @@ func runScan(cmd *cobra.Command, args []string) error {
 	for _, group := range groups {
 		totalDuplicates += len(group.Remove)
 	}
-	store.RecordScan(absFolder, len(images), len(groups), totalDuplicates)
+	method := models.MatchPerceptual
+	if exactMode {
+		method = models.MatchExact
+	}
+	store.RecordScan(models.ScanRecord{
+		Folder:          absFolder,
+		Matcher:         method,
+		Threshold:       threshold,
+		TotalImages:     len(images),
+		TotalGroups:     len(groups),
+		TotalDuplicates: totalDuplicates,
+	})
+	store.ClearProcessed(absFolder)
 
-	// Print summary
-	fmt.Println()
-	fmt.Println("=== Scan Complete ===")
-	fmt.Printf("Total images:     %d\n", len(images))
-	fmt.Printf("Duplicate groups: %d\n", len(groups))
-	fmt.Printf("Duplicates found: %d\n", totalDuplicates)
+	return &models.ScanResult{
+		TotalScanned:    len(images),
+		TotalGroups:     len(groups),
+		TotalDuplicates: totalDuplicates,
+		Groups:          groups,
+	}, nil
+}
+
+// perceptualOptions returns the matcher options selected by the scan flags
+// shared with regroup
+func perceptualOptions() []match.PerceptualOption {
+	opts := []match.PerceptualOption{match.WithMaxSpread(maxSpread), match.WithConcurrency(workers)}
+	if noSameDir {
+		opts = append(opts, match.WithIgnoreSameDir())
+	}
+	if detectRot {
+		opts = append(opts, match.WithOrientations())
+	}
+	if maxGroup > 0 {
+		opts = append(opts, match.WithMaxGroupSize(maxGroup))
+	}
+	if fmtLimits != nil {
+		opts = append(opts, match.WithFormatThresholds(fmtLimits))
+	}
+	if matchBoth || matchAny {
+		mode := match.CombineBoth
+		if matchAny {
+			mode = match.CombineEither
+		}
+		opts = append(opts, match.WithDHash(cmp.Or(dHashLimit, threshold), mode))
+	}
+	if clustering == clusterAverage {
+		c := clusterCut
+		if c <= 0 {
+			c = threshold
+		}
+		opts = append(opts, match.WithAverageLinkage(c))
+	}
+	return opts
+}
 
-	if len(groups) > 0 {
-		fmt.Println()
-		fmt.Println("Run 'imagedupfinder list' to see duplicate groups")
-		fmt.Println("Run 'imagedupfinder clean --dry-run' to preview deletions")
+// Values of --cluster
+const (
+	clusterSingle  = "single"
+	clusterAverage = "average"
+)
+
+// zeroThresholdExact switches to --exact when --threshold is 0, so only
+// byte-identical files are grouped, unless another flag asks for perceptual
+// matching: --threshold-auto and --threshold-per-format replace the threshold,
+// and rotations, luma normalization and cropping only change pHashes. It
+// reports whether it did.
+func zeroThresholdExact() bool {
+	if exactMode || threshold != 0 || autoThresh || fmtThresh != "" || matchBoth || matchAny ||
+		detectRot || normLuma || (centerCrop > 0 && centerCrop < 1) {
+		return false
 	}
+	exactMode = true
+	return true
+}
 
+// checkExactFlags rejects perceptual matching flags combined with --exact;
+// viaZero names --threshold 0 as the cause when zeroThresholdExact set it
+func checkExactFlags(viaZero bool) error {
+	if !exactMode {
+		return nil
+	}
+	exact := "--exact"
+	if viaZero {
+		exact = "--threshold 0 (which scans with --exact)"
+	}
+	switch {
+	case noSameDir:
+		return fmt.Errorf("--ignore-same-dir cannot be used with %s", exact)
+	case maxGroup > 0:
+		return fmt.Errorf("--max-group-size cannot be used with %s", exact)
+	case clustering != clusterSingle:
+		return fmt.Errorf("--cluster cannot be used with %s", exact)
+	case fmtThresh != "":
+		return fmt.Errorf("--threshold-per-format cannot be used with %s", exact)
+	case matchBoth || matchAny:
+		return fmt.Errorf("--match-both and --match-either cannot be used with %s", exact)
+	}
+	return nil
+}
+
+// addDHashFlags registers --match-both, --match-either and --dhash-threshold
+// on cmd
+func addDHashFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&matchBoth, "match-both", false, "Also store a dHash per image and match two images only when both their pHashes and dHashes are close")
+	cmd.Flags().BoolVar(&matchAny, "match-either", false, "Also store a dHash per image and match two images when their pHashes or their dHashes are close")
+	cmd.Flags().IntVar(&dHashLimit, "dhash-threshold", 0, "Largest dHash distance for --match-both/--match-either (0 = --threshold)")
+	cmd.MarkFlagsMutuallyExclusive("match-both", "match-either")
+}
+
+// headerOnly reports whether an --exact scan can skip decoding pixels: no
+// flag asks for anything computed from them
+func headerOnly() bool {
+	return exactMode && !blurHash && !detectRot && !normLuma && !fastDecode && !(centerCrop > 0 && centerCrop < 1)
+}
+
+// checkCenterCrop validates --center-crop
+func checkCenterCrop() error {
+	if centerCrop <= 0 || centerCrop > 1 {
+		return fmt.Errorf("invalid --center-crop %g (want a fraction above 0 and at most 1)", centerCrop)
+	}
+	return nil
+}
+
+// checkMatchFlags validates --cluster and --cluster-cutoff, and parses
+// --threshold-per-format
+func checkMatchFlags(cmd *cobra.Command) error {
+	switch clustering {
+	case clusterSingle, clusterAverage:
+	default:
+		return fmt.Errorf("invalid --cluster %q (want %s or %s)", clustering, clusterSingle, clusterAverage)
+	}
+	if cmd.Flags().Changed("cluster-cutoff") && clustering != clusterAverage {
+		return fmt.Errorf("--cluster-cutoff requires --cluster %s", clusterAverage)
+	}
+	if fmtThresh != "" {
+		var err error
+		if fmtLimits, err = match.ParseFormatThresholds(fmtThresh); err != nil {
+			return fmt.Errorf("invalid --threshold-per-format: %w", err)
+		}
+	}
 	return nil
 }
+
+// warnOversized reports the clusters m left out for exceeding
+// --max-group-size
+func warnOversized(m *match.PerceptualMatcher) {
+	oversized := m.Oversized()
+	if len(oversized) == 0 {
+		return
+	}
+	images := 0
+	for _, cluster := range oversized {
+		images += len(cluster)
+	}
+	logger.Errorf("Warning: %d cluster(s) of %d images in total exceed --max-group-size %d and were left out of the groups; try a lower --threshold or --max-spread\n",
+		len(oversized), images, maxGroup)
+	for _, cluster := range oversized {
+		logger.Debugf("  %d images, e.g. %s\n", len(cluster), cluster[0].Path)
+	}
+}
+
+// maxWalkErrorsShown bounds how many unreadable paths warnWalkErrors lists
+const maxWalkErrorsShown = 10
+
+// warnWalkErrors reports the paths the scan could not walk into, whose
+// contents are missing from the results
+func warnWalkErrors(walkErrs []scan.WalkError) {
+	if len(walkErrs) == 0 {
+		return
+	}
+	denied := 0
+	for _, we := range walkErrs {
+		if fileutil.ClassifyFailure(we.Err) == fileutil.FailurePermission {
+			denied++
+		}
+	}
+	logger.Errorf("Warning: skipped %d unreadable path(s) and everything under them (%d due to permission errors):\n", len(walkErrs), denied)
+	for i, we := range walkErrs {
+		if i == maxWalkErrorsShown {
+			logger.Errorf("  ... and %d more\n", len(walkErrs)-i)
+			break
+		}
+		logger.Errorf("  %s: %v\n", we.Path, we.Err)
+	}
+}
+
+// warnIOErrors reports the files still failing with transient I/O errors
+// after their retries
+func warnIOErrors(ioErrs []scan.WalkError) {
+	if len(ioErrs) == 0 {
+		return
+	}
+	logger.Errorf("Warning: %d file(s) kept failing with I/O errors; re-run the scan (or use --resume) to try them again:\n", len(ioErrs))
+	for i, e := range ioErrs {
+		if i == maxWalkErrorsShown {
+			logger.Errorf("  ... and %d more\n", len(ioErrs)-i)
+			break
+		}
+		logger.Errorf("  %s: %v\n", e.Path, e.Err)
+	}
+}
+
+// parseSince parses --since: a duration back from now ("24h") or a local
+// date ("2024-01-01") or time ("2024-01-01T15:04").
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want a duration (24h) or a date (2024-01-01)", value)
+}
+
+// formatRate renders the rate and ETA part of the progress line, e.g.
+// "240/s, ETA 3m20s".
+func formatRate(p scan.ProgressInfo) string {
+	rate := fmt.Sprintf("%.0f/s", p.Rate)
+	if p.Rate < 10 {
+		rate = fmt.Sprintf("%.1f/s", p.Rate)
+	}
+	if p.ETA <= 0 {
+		return rate
+	}
+	return fmt.Sprintf("%s, ETA %s", rate, p.ETA.Round(time.Second))
+}
@@ -8,13 +8,18 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/scan"
 	"imagedupfinder/internal/server"
+	"imagedupfinder/internal/storage"
 )
 
 var (
 	servePort      int
 	serveTimeout   time.Duration
 	serveNoBrowser bool
+	serveNoWebP    bool
+	serveReadOnly  bool
 )
 
 var serveCmd = &cobra.Command{
@@ -27,12 +32,16 @@ The server will:
 - Display duplicate groups with image previews
 - Allow selecting which images to keep
 - Execute clean operations from the browser
+- Rescan a folder from the browser (same as 'scan' with default options)
 - Auto-shutdown after idle timeout (when tab is inactive)
+- Expose Prometheus metrics at /metrics (scrapes don't count as activity;
+  use --timeout 0 to run as a service)
 
 Example:
   imagedupfinder serve              # Start on default port 8080
   imagedupfinder serve -p 3000      # Use custom port
-  imagedupfinder serve --timeout 10m  # 10 minute idle timeout`,
+  imagedupfinder serve --timeout 10m  # 10 minute idle timeout
+  imagedupfinder serve --read-only    # Browse only, cleaning disabled`,
 	RunE: runServe,
 }
 
@@ -40,20 +49,42 @@ func init() {
 	serveCmd.Flags().IntVarP(&servePort, "port", "p", 8080, "Port to listen on")
 	serveCmd.Flags().DurationVar(&serveTimeout, "timeout", 5*time.Minute, "Idle timeout (0 to disable)")
 	serveCmd.Flags().BoolVar(&serveNoBrowser, "no-browser", false, "Don't open browser automatically")
+	serveCmd.Flags().BoolVar(&serveNoWebP, "no-webp", false, "Serve thumbnails as JPEG/PNG even to browsers that accept WebP")
+	serveCmd.Flags().BoolVar(&serveReadOnly, "read-only", false, "Disable cleaning: browse groups without delete controls")
 	rootCmd.AddCommand(serveCmd)
 }
 
 func runServe(cmd *cobra.Command, args []string) error {
-	srv, err := server.New(dbPath, servePort, serveTimeout)
+	// Cleaning and rescanning can't write a read-only database
+	if dbReadOnly {
+		serveReadOnly = true
+	}
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+
+	srv, err := server.New(dbPath, servePort, serveTimeout,
+		server.WithKeepPolicies(keepPolicies()...),
+		server.WithWebPThumbnails(!serveNoWebP),
+		server.WithReadOnly(serveReadOnly),
+		server.WithRescan(rescanFolder),
+		server.WithStorageOptions(serveStorageOptions()...),
+		server.WithAuditLog(auditLog),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
 	url := fmt.Sprintf("http://localhost:%d", servePort)
-	fmt.Printf("Starting server at %s\n", url)
-	fmt.Printf("Idle timeout: %v (resets on activity, pauses when tab is active)\n", serveTimeout)
-	fmt.Println("Press Ctrl+C to stop")
-	fmt.Println()
+	logger.Infof("Starting server at %s\n", url)
+	if serveReadOnly {
+		logger.Infof("Read-only mode: cleaning is disabled\n")
+	}
+	logger.Infof("Idle timeout: %v (resets on activity, pauses when tab is active)\n", serveTimeout)
+	logger.Infof("Press Ctrl+C to stop\n")
+	logger.Infof("\n")
 
 	// Open browser
 	if !serveNoBrowser {
@@ -66,6 +97,23 @@ func runServe(cmd *cobra.Command, args []string) error {
 	return srv.Start()
 }
 
+// serveStorageOptions takes the writer lock unless the UI is read-only, since
+// cleaning and rescanning write the database
+func serveStorageOptions() []storage.Option {
+	if serveReadOnly {
+		return storageOptions()
+	}
+	return append(storageOptions(), storage.WithWriterLock())
+}
+
+// rescanFolder runs a scan for the web UI, reporting progress to it
+func rescanFolder(store *storage.Storage, folder string, progress func(scanned, total int)) (*models.ScanResult, error) {
+	logger.Infof("Rescanning: %s\n", folder)
+	return scanAndGroup(store, folder, scanHooks{
+		progress: func(p scan.ProgressInfo) { progress(p.Scanned, p.Total) },
+	})
+}
+
 func openBrowser(url string) {
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/fileutil"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List and restore files in the Linux trash",
+	Long: `List and restore files in the freedesktop.org home trash
+(~/.local/share/Trash), where clean moves duplicates by default. Files
+trashed by file managers are listed too. Linux only.
+
+Example:
+  imagedupfinder trash list             # Show trashed files
+  imagedupfinder trash restore a.jpg    # Move a.jpg back where it was`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show trashed files with their original paths",
+	Args:  cobra.NoArgs,
+	RunE:  runTrashList,
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <name>...",
+	Short: "Move trashed files back to their original paths",
+	Long: `Move trashed files back to the paths they were deleted from. <name> is
+the name shown by 'imagedupfinder trash list'. A missing parent folder is
+recreated; if another file now has the original name, a counter is appended
+(e.g. photo_1.jpg).
+
+Restored images come back into list and serve after the next scan.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTrashRestore,
+}
+
+func init() {
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd)
+	rootCmd.AddCommand(trashCmd)
+}
+
+func runTrashList(cmd *cobra.Command, args []string) error {
+	files, err := fileutil.ListTrash()
+	if err != nil {
+		return fmt.Errorf("failed to read trash: %w", err)
+	}
+	if len(files) == 0 {
+		logger.Printf("Trash is empty.\n")
+		return nil
+	}
+
+	logger.Printf("%-19s  %-30s  %s\n", "Deleted", "Name", "Original path")
+	for _, f := range files {
+		deleted := "-"
+		if !f.DeletionDate.IsZero() {
+			deleted = f.DeletionDate.Format("2006-01-02 15:04:05")
+		}
+		logger.Printf("%-19s  %-30s  %s\n", deleted, f.Name, f.OriginalPath)
+	}
+	return nil
+}
+
+func runTrashRestore(cmd *cobra.Command, args []string) error {
+	// A bad name is not a usage error
+	cmd.SilenceUsage = true
+	for _, name := range args {
+		dest, err := fileutil.RestoreFromTrash(name)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		logger.Infof("Restored: %s\n", dest)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/scan"
+	"imagedupfinder/internal/storage"
+)
+
+var verifyFix bool
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Re-hash stored images to find stored hashes that are wrong",
+	Long: `Re-read every stored image whose file still has the size and modification
+time recorded by the scan, recompute its perceptual hash and compare it with
+the stored one. Such a file hasn't changed, so a different hash means the
+stored one is wrong, e.g. after an interrupted scan. Files changed since the
+scan are only counted: their hash is expected to differ, and the next scan
+updates them.
+
+With --rehash-on-mismatch the wrong hashes are replaced and the images are
+grouped again as by 'regroup' with --threshold (skipped if the last scan used
+--exact, whose groups don't depend on these hashes). Without it, mismatches
+are reported and verify exits with an error.
+
+Example:
+  imagedupfinder verify
+  imagedupfinder verify -v                    # Also list changed and missing files
+  imagedupfinder verify --rehash-on-mismatch`,
+	Args: cobra.NoArgs,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyFix, "rehash-on-mismatch", false, "Store the recomputed hash of each mismatched image and regroup")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	open := openStorage
+	if verifyFix {
+		open = openWriteStorage
+	}
+	store, err := open()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	logger.Infof("Verifying stored hashes...\n")
+	res, err := scan.VerifyHashes(store, verifyFix, logger.Debugf)
+	if err != nil {
+		return err
+	}
+	for _, m := range res.Mismatches {
+		logger.Printf("hash mismatch: %s (stored %016x, file %016x)\n", m.Path, m.Stored, m.Actual)
+	}
+
+	logger.Infof("Checked:            %d\n", res.Checked)
+	logger.Infof("Changed since scan: %d\n", res.Changed)
+	logger.Infof("Missing:            %d\n", res.Missing)
+	if res.Failed > 0 {
+		logger.Infof("Unreadable:         %d\n", res.Failed)
+	}
+	logger.Infof("Hash mismatches:    %d\n", len(res.Mismatches))
+
+	if len(res.Mismatches) == 0 {
+		return nil
+	}
+	if !verifyFix {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d stored hashes don't match their unchanged files; run with --rehash-on-mismatch to fix them", len(res.Mismatches))
+	}
+	logger.Infof("Fixed:              %d\n", res.Fixed)
+	return regroupAfterVerify(store)
+}
+
+// regroupAfterVerify groups the images again with the corrected hashes,
+// unless the last scan grouped by file content
+func regroupAfterVerify(store *storage.Storage) error {
+	history, err := store.GetScanHistory(1)
+	if err != nil {
+		return fmt.Errorf("failed to read scan history: %w", err)
+	}
+	if len(history) > 0 && history[0].Matcher == models.MatchExact {
+		logger.Infof("\nThe last scan used --exact; groups are unchanged.\n")
+		return nil
+	}
+
+	logger.Infof("\nRegrouping (threshold: %d)...\n", threshold)
+	matcher := match.NewAutoMatcher(threshold, perceptualOptions()...)
+	groups, matched, err := match.Regroup(store, matcher)
+	if err != nil {
+		return err
+	}
+	totalDuplicates := 0
+	for _, group := range groups {
+		totalDuplicates += len(group.Remove)
+	}
+	store.RecordScan(models.ScanRecord{
+		Matcher:         models.MatchPerceptual,
+		Threshold:       threshold,
+		TotalImages:     matched,
+		TotalGroups:     len(groups),
+		TotalDuplicates: totalDuplicates,
+	})
+	logger.Infof("Duplicate groups: %d\n", len(groups))
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package audit keeps an append-only record of the files the tool removes or
+// moves, one JSON object per line. It is written for people, not read back.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Operations recorded in Entry.Operation
+const (
+	OpTrash    = "trash"     // moved to the system trash
+	OpDelete   = "delete"    // deleted permanently
+	OpMove     = "move"      // moved to a folder (clean --move-to)
+	OpKeepMove = "keep-move" // kept image moved to an archive (clean --keep-to)
+)
+
+// Entry is one audited operation on one file. Every field is written, even
+// when empty, so each line has the same shape.
+type Entry struct {
+	Time        time.Time `json:"timestamp"`
+	Operation   string    `json:"operation"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination"` // new path for moves; empty for trash and delete
+	GroupID     int       `json:"group_id"`
+	Size        int64     `json:"size"`
+	KeepPath    string    `json:"keep_path"` // the image kept in place of Path
+}
+
+// Log appends entries to an audit file. A nil *Log records nothing, so
+// callers need not check whether auditing is on. It is safe for concurrent
+// use.
+type Log struct {
+	mu  sync.Mutex
+	f   *os.File
+	now func() time.Time
+}
+
+// Open opens the audit file at path for appending, creating it if needed
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{f: f, now: time.Now}, nil
+}
+
+// Record appends e, stamped with the current time unless e.Time is set, and
+// syncs it to disk before returning, so an entry is never lost to a crash
+// after the operation it describes. Relative paths are made absolute, as the
+// record outlives the working directory.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = l.now()
+	}
+	for _, p := range []*string{&e.Path, &e.Destination, &e.KeepPath} {
+		if *p != "" {
+			if abs, err := filepath.Abs(*p); err == nil {
+				*p = abs
+			}
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// readEntries returns each line of the audit file at path as a map, so the
+// test sees the field names actually written
+func readEntries(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []map[string]any
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q is not JSON: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestLog_AppendsAcrossOpens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	for _, e := range []Entry{
+		{Operation: OpTrash, Path: "/photos/b.jpg", GroupID: 3, Size: 1200, KeepPath: "/photos/a.jpg"},
+		{Operation: OpMove, Path: "/photos/c.jpg", Destination: "dupes/c.jpg", GroupID: 3, Size: 900, KeepPath: "/photos/a.jpg"},
+	} {
+		log, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		log.now = func() time.Time { return at }
+		if err := log.Record(e); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		log.Close()
+	}
+
+	entries := readEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (the second open must append)", len(entries))
+	}
+	want := []string{"destination", "group_id", "keep_path", "operation", "path", "size", "timestamp"}
+	for i, e := range entries {
+		var keys []string
+		for k := range e {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, want) {
+			t.Errorf("entry %d has fields %v, want %v", i, keys, want)
+		}
+		if e["timestamp"] != "2024-05-06T07:08:09Z" {
+			t.Errorf("entry %d timestamp = %v", i, e["timestamp"])
+		}
+	}
+	wd, _ := os.Getwd()
+	if e := entries[1]; e["operation"] != "move" || e["destination"] != filepath.Join(wd, "dupes", "c.jpg") ||
+		e["group_id"] != 3.0 || e["size"] != 900.0 {
+		t.Errorf("move entry = %v, want the destination made absolute", e)
+	}
+}
+
+func TestLog_NilRecordsNothing(t *testing.T) {
+	var log *Log
+	if err := log.Record(Entry{Operation: OpDelete, Path: "/a.jpg"}); err != nil {
+		t.Errorf("Record on nil log = %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("Close on nil log = %v", err)
+	}
+}
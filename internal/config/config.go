@@ -0,0 +1,142 @@
+// Package config reads flag defaults from a YAML file, so settings used on
+// every run (the database, a threshold, the worker count) need not be typed
+// each time. Flags given on the command line always win.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"go.yaml.in/yaml/v3"
+)
+
+// FileName is the name Find looks for
+const FileName = "imagedupfinder.yaml"
+
+// tomlFileName is the TOML config Find also looks for, so that Load can
+// reject it rather than have it silently ignored
+const tomlFileName = "imagedupfinder.toml"
+
+// File is a parsed config file. Keys are flag names without the dashes;
+// top-level scalars are global flags, and a top-level mapping holds the
+// flags of the command it is named after ("scan", "trash restore"):
+//
+//	db: /data/images.db
+//	threshold: 6
+//	scan:
+//	  max-spread: 12
+//	  formats: [jpg, png]
+type File struct {
+	Path     string
+	Global   map[string]any
+	Commands map[string]map[string]any
+}
+
+// Find returns the path of the first FileName in dirs, or "" if there is
+// none. A directory with an imagedupfinder.toml instead is found too, for
+// Load to report.
+func Find(dirs ...string) string {
+	for _, dir := range dirs {
+		for _, name := range []string{FileName, tomlFileName} {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Load reads and parses the config file at path. TOML is not supported: a
+// .toml file is an error.
+func Load(path string) (*File, error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return nil, fmt.Errorf("config %s: TOML is not supported; write the settings as YAML in %s", path, FileName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	f := &File{Path: path, Global: make(map[string]any), Commands: make(map[string]map[string]any)}
+	for key, value := range raw {
+		if section, ok := value.(map[string]any); ok {
+			f.Commands[key] = section
+		} else {
+			f.Global[key] = value
+		}
+	}
+	return f, nil
+}
+
+// Apply sets every flag in values that was not given on the command line,
+// as if it had been given. A flag left alone keeps its default, and a flag
+// set here is not marked Changed, so checks on what the user typed still see
+// only that. A flag sharing one of the exclusive groups with a given flag is
+// skipped too, so e.g. a configured threshold doesn't undo --similarity.
+// Lists are passed as comma-separated values.
+func Apply(flags *pflag.FlagSet, values map[string]any, exclusive ...[]string) error {
+	given := make(map[string]bool)
+	for _, group := range exclusive {
+		for _, name := range group {
+			if f := flags.Lookup(name); f != nil && f.Changed {
+				for _, other := range group {
+					given[other] = true
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		value := values[name]
+		f := flags.Lookup(name)
+		if f == nil {
+			errs = append(errs, fmt.Errorf("unknown flag %q", name))
+			continue
+		}
+		if f.Changed || given[name] {
+			continue
+		}
+		s, err := flagValue(value)
+		if err == nil {
+			err = f.Value.Set(s)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flagValue renders a YAML value as a flag argument
+func flagValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := flagValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", fmt.Errorf("want a value, not a mapping")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
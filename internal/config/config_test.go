@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// flagSet mirrors a few of the CLI's flags, parsed from args
+func flagSet(t *testing.T, args ...string) (*pflag.FlagSet, *int, *string, *[]string) {
+	t.Helper()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	threshold := flags.Int("threshold", 10, "")
+	similarity := flags.String("similarity", "", "")
+	formats := flags.StringSlice("formats", nil, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags, threshold, similarity, formats
+}
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApply_ThresholdFromConfigUnlessGiven(t *testing.T) {
+	f, err := Load(writeConfig(t, t.TempDir(), "threshold: 6\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags, threshold, _, _ := flagSet(t)
+	if err := Apply(flags, f.Global); err != nil {
+		t.Fatal(err)
+	}
+	if *threshold != 6 {
+		t.Errorf("without --threshold: threshold = %d, want 6 from the config", *threshold)
+	}
+	if flags.Changed("threshold") {
+		t.Error("a configured flag should not be marked as given")
+	}
+
+	flags, threshold, _, _ = flagSet(t, "--threshold", "3")
+	if err := Apply(flags, f.Global); err != nil {
+		t.Fatal(err)
+	}
+	if *threshold != 3 {
+		t.Errorf("with --threshold 3: threshold = %d, want 3", *threshold)
+	}
+}
+
+func TestApply_ExclusiveFlags(t *testing.T) {
+	values := map[string]any{"threshold": 6}
+
+	flags, threshold, similarity, _ := flagSet(t, "--similarity", "90%")
+	if err := Apply(flags, values, []string{"threshold", "similarity"}); err != nil {
+		t.Fatal(err)
+	}
+	if *threshold != 10 || *similarity != "90%" {
+		t.Errorf("threshold = %d, similarity = %q; the configured threshold should yield to --similarity", *threshold, *similarity)
+	}
+}
+
+func TestApply_Values(t *testing.T) {
+	flags, _, _, formats := flagSet(t)
+	if err := Apply(flags, map[string]any{"formats": []any{"jpg", "png"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(*formats, ",") != "jpg,png" {
+		t.Errorf("formats = %v, want [jpg png]", *formats)
+	}
+
+	flags, _, _, _ = flagSet(t)
+	err := Apply(flags, map[string]any{"treshold": 6, "threshold": "six"})
+	if err == nil || !strings.Contains(err.Error(), `unknown flag "treshold"`) || !strings.Contains(err.Error(), "invalid threshold") {
+		t.Errorf("want errors for the unknown and the invalid flag, got %v", err)
+	}
+}
+
+func TestLoadAndFind(t *testing.T) {
+	home, cwd := t.TempDir(), t.TempDir()
+	if got := Find(cwd, home); got != "" {
+		t.Errorf("Find with no config = %q, want none", got)
+	}
+	path := writeConfig(t, home, `
+db: /data/images.db
+workers: 16
+scan:
+  max-spread: 12
+trash restore:
+  all: true
+`)
+	if got := Find(cwd, home); got != path {
+		t.Errorf("Find = %q, want %q", got, path)
+	}
+	local := writeConfig(t, cwd, "workers: 2\n")
+	if got := Find(cwd, home); got != local {
+		t.Errorf("Find = %q, want the first directory's %q", got, local)
+	}
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Global) != 2 || f.Global["db"] != "/data/images.db" || f.Global["workers"] != 16 {
+		t.Errorf("Global = %v", f.Global)
+	}
+	if len(f.Commands) != 2 || f.Commands["scan"]["max-spread"] != 12 || f.Commands["trash restore"]["all"] != true {
+		t.Errorf("Commands = %v", f.Commands)
+	}
+
+	if _, err := Load(writeConfig(t, t.TempDir(), "threshold: [6\n")); err == nil {
+		t.Error("Load of malformed YAML should fail")
+	}
+}
+
+func TestLoad_RejectsTOML(t *testing.T) {
+	home, cwd := t.TempDir(), t.TempDir()
+	writeConfig(t, home, "workers: 16\n")
+	path := filepath.Join(cwd, "imagedupfinder.toml")
+	if err := os.WriteFile(path, []byte("workers = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TOML file takes the place of the YAML one further down
+	if got := Find(cwd, home); got != path {
+		t.Fatalf("Find = %q, want the TOML file %q", got, path)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "TOML is not supported") {
+		t.Errorf("Load(%s) = %v, want a TOML error", path, err)
+	}
+}
@@ -0,0 +1,91 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteBackup streams the files at paths into a new gzip-compressed tar at
+// dest, each with its mode and modification time under its absolute path
+// without the leading separator, so that 'tar -xzf dest -C /' puts them
+// back. The archive is synced before WriteBackup returns; on any error,
+// including an existing dest, no archive is left behind.
+func WriteBackup(dest string, paths []string) (err error) {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(dest)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, path := range paths {
+		if err := addToBackup(tw, path); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return f.Close()
+}
+
+// addToBackup writes the file at path to tw under BackupName(path)
+func addToBackup(tw *tar.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = BackupName(path)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// tar.Writer fails rather than archive a file that changed size since
+	// the header was written
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// BackupName returns the name WriteBackup stores path under: the absolute
+// path with slashes and without its leading separator. On Windows the
+// volume leads the name (C:\a\b.jpg -> C/a/b.jpg).
+func BackupName(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	vol := filepath.VolumeName(path)
+	name := strings.TrimLeft(filepath.ToSlash(path[len(vol):]), "/")
+	if vol != "" {
+		name = strings.Trim(filepath.ToSlash(vol), "/:") + "/" + name
+	}
+	return name
+}
@@ -0,0 +1,109 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteBackup(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(dir, "a.jpg"):              "first",
+		filepath.Join(dir, "album", "b.jpg"):     "second",
+		filepath.Join(dir, "album", "2019", "c"): "third",
+	}
+	mtime := time.Date(2019, 7, 1, 12, 30, 0, 0, time.UTC)
+	var paths []string
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	// Not everything in the folder is backed up
+	if err := os.WriteFile(filepath.Join(dir, "kept.jpg"), []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := WriteBackup(dest, paths); err != nil {
+		t.Fatalf("WriteBackup failed: %v", err)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(data)
+		if !hdr.ModTime.Equal(mtime) {
+			t.Errorf("%s has mod time %v, want %v", hdr.Name, hdr.ModTime, mtime)
+		}
+	}
+	if len(got) != len(files) {
+		t.Errorf("backup holds %d files, want %d: %v", len(got), len(files), got)
+	}
+	for path, data := range files {
+		name := BackupName(path)
+		if filepath.IsAbs(name) || got[name] != data {
+			t.Errorf("%s = %q, want %q", name, got[name], data)
+		}
+	}
+}
+
+func TestWriteBackup_Failures(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unreadable file leaves no partial archive
+	dest := filepath.Join(dir, "backup.tar.gz")
+	if err := WriteBackup(dest, []string{src, filepath.Join(dir, "missing.jpg")}); err == nil {
+		t.Fatal("WriteBackup succeeded with a missing file")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("partial backup left behind: %v", err)
+	}
+
+	// An existing archive is never overwritten
+	if err := os.WriteFile(dest, []byte("older backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBackup(dest, []string{src}); err == nil {
+		t.Error("WriteBackup overwrote an existing file")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "older backup" {
+		t.Errorf("existing file changed to %q", data)
+	}
+}
@@ -0,0 +1,54 @@
+package fileutil
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Failure is why removing or moving a file failed, for summaries that tell
+// permission problems apart from files that are already gone
+type Failure int
+
+const (
+	FailureOther Failure = iota
+	FailurePermission
+	FailureNotFound
+)
+
+func (f Failure) String() string {
+	switch f {
+	case FailurePermission:
+		return "permission denied"
+	case FailureNotFound:
+		return "not found"
+	default:
+		return "other error"
+	}
+}
+
+// ClassifyFailure reports which Failure err is
+func ClassifyFailure(err error) Failure {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return FailurePermission
+	case errors.Is(err, fs.ErrNotExist):
+		return FailureNotFound
+	default:
+		return FailureOther
+	}
+}
+
+// RetryWritable runs op, which removes or moves path. If op is denied
+// permission, the read-only bits that can block it are cleared (see
+// clearReadOnly) and op runs once more, like rm -f. If they can't be
+// cleared, the original error is returned.
+func RetryWritable(path string, op func() error) error {
+	err := op()
+	if ClassifyFailure(err) != FailurePermission {
+		return err
+	}
+	if clearReadOnly(path) != nil {
+		return err
+	}
+	return op()
+}
@@ -0,0 +1,101 @@
+package fileutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	_, notFound := os.Stat(filepath.Join(t.TempDir(), "missing.jpg"))
+	tests := []struct {
+		err  error
+		want Failure
+	}{
+		{&fs.PathError{Op: "remove", Path: "/a.jpg", Err: fs.ErrPermission}, FailurePermission},
+		{&os.LinkError{Op: "rename", Old: "/a.jpg", New: "/b.jpg", Err: fs.ErrPermission}, FailurePermission},
+		{notFound, FailureNotFound},
+		{errors.New("disk full"), FailureOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyFailure(tt.err); got != tt.want {
+			t.Errorf("ClassifyFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// readOnlyFolder returns a file inside a folder without write permission
+func readOnlyFolder(t *testing.T) (dir, path string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("folder permissions don't block deletion on Windows")
+	}
+	dir = filepath.Join(t.TempDir(), "shared")
+	path = filepath.Join(dir, "a.jpg")
+	writeFile(t, path, "image")
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	return dir, path
+}
+
+func TestRetryWritable_ReadOnlyFolder(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores file permissions")
+	}
+	_, path := readOnlyFolder(t)
+
+	err := os.Remove(path)
+	if got := ClassifyFailure(err); got != FailurePermission {
+		t.Fatalf("removing from a read-only folder: %v classified as %v, want %v", err, got, FailurePermission)
+	}
+	if err := RetryWritable(path, func() error { return os.Remove(path) }); err != nil {
+		t.Fatalf("RetryWritable failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after RetryWritable", path)
+	}
+}
+
+func TestRetryWritable_ClearsReadOnlyBit(t *testing.T) {
+	dir, path := readOnlyFolder(t)
+
+	// Deny like the OS would for an unprivileged user, so this also runs as
+	// root
+	attempts := 0
+	remove := func() error {
+		attempts++
+		if info, err := os.Stat(dir); err != nil || info.Mode()&0200 == 0 {
+			return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrPermission}
+		}
+		return os.Remove(path)
+	}
+
+	if err := remove(); ClassifyFailure(err) != FailurePermission {
+		t.Fatalf("expected permission denied before forcing, got %v", err)
+	}
+	attempts = 0
+	if err := RetryWritable(path, remove); err != nil {
+		t.Fatalf("RetryWritable failed: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("remove ran %d times, want 2 (denied, then retried)", attempts)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after RetryWritable", path)
+	}
+
+	// Other failures are not retried
+	attempts = 0
+	err := RetryWritable(path, func() error {
+		attempts++
+		return os.Remove(path)
+	})
+	if ClassifyFailure(err) != FailureNotFound || attempts != 1 {
+		t.Errorf("missing file: got %v after %d attempts, want not found after 1", err, attempts)
+	}
+}
@@ -4,19 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
-// MoveFile moves a file to the destination directory.
-// If a file with the same name exists, it appends a counter (e.g., file_1.jpg).
-func MoveFile(src, destDir string) error {
+// MoveFile moves a file to the destination directory and returns its new
+// path. If a file with the same name exists, it appends a counter (e.g.,
+// file_1.jpg).
+func MoveFile(src, destDir string) (string, error) {
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return err
+		return "", err
 	}
 
 	filename := filepath.Base(src)
@@ -25,7 +28,97 @@ func MoveFile(src, destDir string) error {
 		return os.IsNotExist(err)
 	})
 
-	return moveFileAcrossFS(src, filepath.Join(destDir, destName))
+	dest := filepath.Join(destDir, destName)
+	if err := moveFileAcrossFS(src, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// LinkFile creates a symbolic link to target named name in dir and returns
+// its path, or with asCopy a copy of target instead. A name already taken is
+// resolved as in MoveFile. Symbolic links need Developer Mode or admin rights
+// on Windows, so there a failed symlink falls back to a hard link, which
+// only works on the same volume.
+func LinkFile(target, dir, name string, asCopy bool) (string, error) {
+	linkName := findUniqueName(name, func(name string) bool {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		return os.IsNotExist(err)
+	})
+	link := filepath.Join(dir, linkName)
+	if asCopy {
+		return link, CopyFile(target, link)
+	}
+	err := os.Symlink(target, link)
+	if err != nil && runtime.GOOS == "windows" && os.Link(target, link) == nil {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// MoveFilePreservingTree moves src under destDir at its path relative to
+// root, creating intermediate directories (root/a/b.jpg -> destDir/a/b.jpg),
+// and returns its new path. Name collisions are resolved as in MoveFile. src
+// must be inside root.
+func MoveFilePreservingTree(src, root, destDir string) (string, error) {
+	rel, err := filepath.Rel(root, src)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s relative to %s: %w", src, root, err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not under %s", src, root)
+	}
+
+	return MoveFile(src, filepath.Join(destDir, filepath.Dir(rel)))
+}
+
+// MoveSidecar moves src, the sidecar of a file already moved to dest (the
+// JPEG of a RAW, or the other way around), next to it under the same name
+// but for its own extension (IMG_1.JPG follows IMG_1_1.CR2 as IMG_1_1.JPG),
+// and returns its new path. Name collisions are resolved as in MoveFile.
+func MoveSidecar(src, dest string) (string, error) {
+	destDir := filepath.Dir(dest)
+	filename := strings.TrimSuffix(filepath.Base(dest), filepath.Ext(dest)) + filepath.Ext(src)
+	destName := findUniqueName(filename, func(name string) bool {
+		_, err := os.Stat(filepath.Join(destDir, name))
+		return os.IsNotExist(err)
+	})
+
+	sidecarDest := filepath.Join(destDir, destName)
+	if err := moveFileAcrossFS(src, sidecarDest); err != nil {
+		return "", err
+	}
+	return sidecarDest, nil
+}
+
+// MissingFiles returns the paths that do not exist on disk, in order
+func MissingFiles(paths []string) []string {
+	var missing []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
+
+// SameFile reports whether paths a and b both exist and are the same file:
+// one path, hard links to one inode, or paths through symbolic links or
+// overlapping mounts that resolve to it. Removing either would then remove
+// (or, for a hard link, unlink) the other's content too.
+func SameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
 }
 
 // findUniqueName finds a unique filename by appending a counter if needed.
@@ -56,8 +149,9 @@ func moveFileAcrossFS(src, dest string) error {
 	var linkErr *os.LinkError
 	if errors.As(err, &linkErr) {
 		if errors.Is(linkErr.Err, syscall.EXDEV) {
-			// Cross-filesystem: copy then delete
-			if err := copyFile(src, dest); err != nil {
+			// Cross-filesystem: copy, then delete only once the copy is
+			// in place
+			if err := CopyFile(src, dest); err != nil {
 				return err
 			}
 			return os.Remove(src)
@@ -67,8 +161,16 @@ func moveFileAcrossFS(src, dest string) error {
 	return err
 }
 
-// copyFile copies a file from src to dest.
-func copyFile(src, dest string) error {
+// CopyFile copies a file from src to dest, replacing dest only once the copy
+// is complete.
+func CopyFile(src, dest string) error {
+	return copyFileWith(src, dest, io.Copy)
+}
+
+// copyFileWith copies src to dest through copyData. The data goes to a
+// temporary file in dest's folder, which is synced and then renamed onto
+// dest, so an interrupted copy never leaves a partial dest behind.
+func copyFileWith(src, dest string, copyData func(io.Writer, io.Reader) (int64, error)) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return err
@@ -80,44 +182,112 @@ func copyFile(src, dest string) error {
 		return err
 	}
 
-	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode())
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
-
-	if _, err := io.Copy(destFile, srcFile); err != nil {
-		os.Remove(dest) // Clean up on failure
+	tmpPath := tmp.Name()
+	if err := writeTemp(tmp, srcFile, srcInfo.Mode(), copyData); err != nil {
+		os.Remove(tmpPath) // Clean up on failure
 		return err
 	}
-
+	if err := os.Rename(tmpPath, dest); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(dest))
 	return nil
 }
 
+// writeTemp fills tmp from src, gives it mode and flushes it to disk, closing
+// it in any case
+func writeTemp(tmp *os.File, src io.Reader, mode os.FileMode, copyData func(io.Writer, io.Reader) (int64, error)) error {
+	if _, err := copyData(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	return tmp.Close()
+}
+
 // MoveToTrash moves a file to the system trash/recycle bin.
 // - macOS: ~/.Trash
-// - Linux: ~/.local/share/Trash (freedesktop.org spec)
+// - Linux: ~/.local/share/Trash or the volume's .Trash-$UID (freedesktop.org spec)
 // - Windows: Recycle Bin (via shell32.dll)
 func MoveToTrash(src string) error {
 	switch runtime.GOOS {
 	case "windows":
 		return moveToWindowsTrash(src)
 	case "linux":
-		trashDir, err := getTrashDir()
+		homeTrash, err := linuxHomeTrash()
 		if err != nil {
 			return err
 		}
-		return moveToLinuxTrash(src, trashDir)
+		trashDir, topdir := linuxTrashDir(src, homeTrash, os.Getuid(), deviceID)
+		return moveToLinuxTrash(src, trashDir, topdir)
 	default: // darwin, etc.
 		trashDir, err := getTrashDir()
 		if err != nil {
 			return err
 		}
-		return MoveFile(src, trashDir)
+		_, err = MoveFile(src, trashDir)
+		return err
+	}
+}
+
+// CheckTrash reports the trash directory MoveToTrash uses for files on the
+// home volume and checks that it is writable by creating and removing a
+// probe file. The Windows Recycle Bin can't be probed this way and is
+// reported without a check.
+func CheckTrash() (string, error) {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		return "Recycle Bin", nil
+	case "linux":
+		homeTrash, err := linuxHomeTrash()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(homeTrash, "files")
+	default:
+		var err error
+		if dir, err = getTrashDir(); err != nil {
+			return "", err
+		}
 	}
+
+	f, err := os.CreateTemp(dir, ".imagedupfinder-check-*")
+	if err != nil {
+		return dir, fmt.Errorf("trash directory is not writable: %w", err)
+	}
+	f.Close()
+	return dir, os.Remove(f.Name())
+}
+
+// linuxHomeTrash returns the freedesktop.org home trash, creating it if
+// needed
+func linuxHomeTrash() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	homeTrash := filepath.Join(homeDir, ".local", "share", "Trash")
+	if err := makeTrashDirs(homeTrash, 0755); err != nil {
+		return "", fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	return homeTrash, nil
 }
 
-// getTrashDir returns the path to the system trash directory.
+// getTrashDir returns the path to the system trash directory on platforms
+// without a trash spec of their own.
 func getTrashDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -128,8 +298,6 @@ func getTrashDir() (string, error) {
 	switch runtime.GOOS {
 	case "darwin":
 		trashDir = filepath.Join(homeDir, ".Trash")
-	case "linux":
-		trashDir = filepath.Join(homeDir, ".local", "share", "Trash", "files")
 	default:
 		// Windows and others: use a fallback folder
 		trashDir = filepath.Join(homeDir, "imagedupfinder_trash")
@@ -142,12 +310,77 @@ func getTrashDir() (string, error) {
 	return trashDir, nil
 }
 
-// moveToLinuxTrash moves a file to Linux trash with proper .trashinfo metadata.
-func moveToLinuxTrash(src, trashFilesDir string) error {
-	homeDir, _ := os.UserHomeDir()
-	trashInfoDir := filepath.Join(homeDir, ".local", "share", "Trash", "info")
+// linuxTrashDir picks the trash directory (holding files/ and info/) for src
+// per the freedesktop.org trash spec. Files on the same device as homeTrash
+// go there. Files on another volume go to that volume's trash, so they are
+// not copied across filesystems and file managers can restore them:
+// $topdir/.Trash/$uid if the administrator has set up a sticky $topdir/.Trash,
+// otherwise $topdir/.Trash-$uid. topdir is the volume's mount point, or "" for
+// the home trash. If no volume trash can be created, the home trash is used.
+func linuxTrashDir(src, homeTrash string, uid int, device func(path string) (uint64, error)) (dir, topdir string) {
+	srcDev, err := device(src)
+	if err != nil {
+		return homeTrash, ""
+	}
+	homeDev, err := device(homeTrash)
+	if err != nil || homeDev == srcDev {
+		return homeTrash, ""
+	}
+
+	topdir = mountPoint(src, srcDev, device)
+	if shared := filepath.Join(topdir, ".Trash"); isAdminTrash(shared) {
+		dir := filepath.Join(shared, strconv.Itoa(uid))
+		if makeTrashDirs(dir, 0700) == nil {
+			return dir, topdir
+		}
+	}
+	dir = filepath.Join(topdir, fmt.Sprintf(".Trash-%d", uid))
+	if makeTrashDirs(dir, 0700) == nil {
+		return dir, topdir
+	}
+	return homeTrash, ""
+}
+
+// mountPoint returns the topmost ancestor directory of path that is still on
+// device dev.
+func mountPoint(path string, dev uint64, device func(path string) (uint64, error)) string {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if d, err := device(parent); err != nil || d != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// isAdminTrash reports whether path is a usable shared $topdir/.Trash: a real
+// directory (not a symlink) with the sticky bit set.
+func isAdminTrash(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.IsDir() && fi.Mode()&os.ModeSticky != 0
+}
+
+// makeTrashDirs creates the files/ and info/ directories of a trash.
+func makeTrashDirs(dir string, perm os.FileMode) error {
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if err := os.MkdirAll(trashInfoDir, 0755); err != nil {
+// moveToLinuxTrash moves a file into trashDir with proper .trashinfo metadata.
+// For a volume trash (topdir set) the recorded path is relative to topdir, so
+// it stays valid wherever the volume is mounted.
+func moveToLinuxTrash(src, trashDir, topdir string) error {
+	trashFilesDir := filepath.Join(trashDir, "files")
+	trashInfoDir := filepath.Join(trashDir, "info")
+	if err := makeTrashDirs(trashDir, 0700); err != nil {
 		return err
 	}
 
@@ -156,6 +389,12 @@ func moveToLinuxTrash(src, trashFilesDir string) error {
 	if err != nil {
 		return err
 	}
+	origPath := absPath
+	if topdir != "" {
+		if origPath, err = filepath.Rel(topdir, absPath); err != nil {
+			return err
+		}
+	}
 
 	// Find unique name (must check both files dir and info dir)
 	destName := findUniqueName(filename, func(name string) bool {
@@ -167,10 +406,10 @@ func moveToLinuxTrash(src, trashFilesDir string) error {
 	dest := filepath.Join(trashFilesDir, destName)
 	infoPath := filepath.Join(trashInfoDir, destName+".trashinfo")
 
-	// Create .trashinfo file
+	// Create .trashinfo file. The spec requires Path to be URI-escaped.
 	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
-		absPath,
-		time.Now().Format("2006-01-02T15:04:05"))
+		(&url.URL{Path: origPath}).EscapedPath(),
+		time.Now().Format(trashInfoDate))
 
 	if err := os.WriteFile(infoPath, []byte(info), 0644); err != nil {
 		return err
@@ -2,10 +2,50 @@
 
 package fileutil
 
-import "errors"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
 
 // moveToWindowsTrash is a stub for non-Windows platforms.
 // This function should never be called on non-Windows systems.
 func moveToWindowsTrash(path string) error {
 	return errors.New("Windows Recycle Bin is not available on this platform")
 }
+
+// deviceID returns the ID of the device holding path.
+func deviceID(path string) (uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("device ID not available")
+	}
+	return uint64(st.Dev), nil
+}
+
+// clearReadOnly gives the owner write permission on the directory holding
+// path. Unlinking or renaming a file is governed by its directory here, so
+// the file's own mode doesn't matter.
+func clearReadOnly(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dir, info.Mode()|0200)
+}
+
+// syncDir flushes the directory entry of a file just renamed into dir, so
+// the rename survives a crash. It is best effort: the file itself is already
+// synced.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,379 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected %s to exist: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestMoveFile_Collision(t *testing.T) {
+	tmpDir := t.TempDir()
+	dest := filepath.Join(tmpDir, "dest")
+	writeFile(t, filepath.Join(tmpDir, "a", "img.jpg"), "a")
+	writeFile(t, filepath.Join(tmpDir, "b", "img.jpg"), "b")
+
+	if _, err := MoveFile(filepath.Join(tmpDir, "a", "img.jpg"), dest); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	moved, err := MoveFile(filepath.Join(tmpDir, "b", "img.jpg"), dest)
+	if err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if moved != filepath.Join(dest, "img_1.jpg") {
+		t.Errorf("MoveFile returned %s, want the renamed img_1.jpg", moved)
+	}
+
+	if got := readFile(t, filepath.Join(dest, "img.jpg")); got != "a" {
+		t.Errorf("img.jpg = %q, want a", got)
+	}
+	if got := readFile(t, filepath.Join(dest, "img_1.jpg")); got != "b" {
+		t.Errorf("img_1.jpg = %q, want b", got)
+	}
+}
+
+func TestMoveSidecar_FollowsRenamedRaw(t *testing.T) {
+	tmpDir := t.TempDir()
+	dest := filepath.Join(tmpDir, "dest")
+	raw, jpg := filepath.Join(tmpDir, "shoot", "IMG_1234.CR2"), filepath.Join(tmpDir, "shoot", "IMG_1234.JPG")
+	writeFile(t, raw, "raw")
+	writeFile(t, jpg, "jpeg")
+	writeFile(t, filepath.Join(dest, "IMG_1234.CR2"), "another shot")
+
+	rawDest, err := MoveFile(raw, dest)
+	if err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	jpgDest, err := MoveSidecar(jpg, rawDest)
+	if err != nil {
+		t.Fatalf("MoveSidecar failed: %v", err)
+	}
+	if want := filepath.Join(dest, "IMG_1234_1.JPG"); jpgDest != want {
+		t.Errorf("MoveSidecar returned %s, want %s next to %s", jpgDest, want, rawDest)
+	}
+	if got := readFile(t, jpgDest); got != "jpeg" {
+		t.Errorf("%s = %q, want the JPEG", jpgDest, got)
+	}
+	for _, path := range []string{raw, jpg} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after the pair moved", path)
+		}
+	}
+}
+
+// failingWriter accepts limit bytes, then fails like a full or vanished disk
+type failingWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n, _ := f.w.Write(p[:f.limit])
+		f.limit = 0
+		return n, errors.New("device went away")
+	}
+	f.limit -= len(p)
+	return f.w.Write(p)
+}
+
+func TestCopyFile_InterruptedLeavesNoPartialDest(t *testing.T) {
+	srcDir, destDir := t.TempDir(), t.TempDir()
+	src := filepath.Join(srcDir, "a.jpg")
+	dest := filepath.Join(destDir, "a.jpg")
+	content := strings.Repeat("image data ", 1000)
+	writeFile(t, src, content)
+
+	interrupted := func(w io.Writer, r io.Reader) (int64, error) {
+		return io.Copy(&failingWriter{w: w, limit: 100}, r)
+	}
+	if err := copyFileWith(src, dest, interrupted); err == nil {
+		t.Fatal("copyFileWith should fail when the write fails")
+	}
+	if entries, _ := os.ReadDir(destDir); len(entries) != 0 {
+		t.Errorf("destination folder holds %v after the failed copy, want nothing", entries)
+	}
+	if got := readFile(t, src); got != content {
+		t.Error("source changed by the failed copy")
+	}
+
+	if err := CopyFile(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != content {
+		t.Error("copied file differs from the source")
+	}
+	if entries, _ := os.ReadDir(destDir); len(entries) != 1 {
+		t.Errorf("destination folder holds %v, want only the copy", entries)
+	}
+}
+
+func TestMoveFilePreservingTree_Nested(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "photos")
+	dest := filepath.Join(tmpDir, "dupes")
+	src := filepath.Join(root, "2024", "trip", "img.jpg")
+	writeFile(t, src, "nested")
+
+	moved, err := MoveFilePreservingTree(src, root, dest)
+	if err != nil {
+		t.Fatalf("MoveFilePreservingTree failed: %v", err)
+	}
+	if moved != filepath.Join(dest, "2024", "trip", "img.jpg") {
+		t.Errorf("MoveFilePreservingTree returned %s", moved)
+	}
+
+	if got := readFile(t, filepath.Join(dest, "2024", "trip", "img.jpg")); got != "nested" {
+		t.Errorf("moved content = %q, want nested", got)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source should no longer exist")
+	}
+}
+
+func TestMoveFilePreservingTree_SameNameDifferentSubtrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "photos")
+	dest := filepath.Join(tmpDir, "dupes")
+	writeFile(t, filepath.Join(root, "a", "img.jpg"), "a")
+	writeFile(t, filepath.Join(root, "b", "img.jpg"), "b")
+
+	for _, sub := range []string{"a", "b"} {
+		if _, err := MoveFilePreservingTree(filepath.Join(root, sub, "img.jpg"), root, dest); err != nil {
+			t.Fatalf("MoveFilePreservingTree failed: %v", err)
+		}
+	}
+
+	// Each keeps its own name in its own subtree; no counter needed
+	if got := readFile(t, filepath.Join(dest, "a", "img.jpg")); got != "a" {
+		t.Errorf("a/img.jpg = %q, want a", got)
+	}
+	if got := readFile(t, filepath.Join(dest, "b", "img.jpg")); got != "b" {
+		t.Errorf("b/img.jpg = %q, want b", got)
+	}
+}
+
+func TestMoveFilePreservingTree_ExistingDestination(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "photos")
+	dest := filepath.Join(tmpDir, "dupes")
+	writeFile(t, filepath.Join(root, "a", "img.jpg"), "new")
+	writeFile(t, filepath.Join(dest, "a", "img.jpg"), "old")
+
+	if _, err := MoveFilePreservingTree(filepath.Join(root, "a", "img.jpg"), root, dest); err != nil {
+		t.Fatalf("MoveFilePreservingTree failed: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dest, "a", "img.jpg")); got != "old" {
+		t.Errorf("existing file was overwritten: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dest, "a", "img_1.jpg")); got != "new" {
+		t.Errorf("a/img_1.jpg = %q, want new", got)
+	}
+}
+
+func TestMoveFilePreservingTree_OutsideRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "elsewhere", "img.jpg")
+	writeFile(t, src, "x")
+
+	_, err := MoveFilePreservingTree(src, filepath.Join(tmpDir, "photos"), filepath.Join(tmpDir, "dupes"))
+	if err == nil {
+		t.Fatal("expected error for file outside root")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Error("source should be left in place")
+	}
+}
+
+// fakeDevices simulates mounts: a path is on the device of the longest
+// mount prefix it falls under, or device 1 (the root volume) otherwise.
+func fakeDevices(mounts map[string]uint64) func(string) (uint64, error) {
+	return func(path string) (uint64, error) {
+		best, dev := "", uint64(1)
+		for mount, d := range mounts {
+			if (path == mount || strings.HasPrefix(path, mount+string(filepath.Separator))) && len(mount) > len(best) {
+				best, dev = mount, d
+			}
+		}
+		return dev, nil
+	}
+}
+
+func TestLinuxTrashDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, vol string)
+		sameDevice bool
+		want       string // relative to vol; "" means the home trash
+	}{
+		{name: "same device uses home trash", sameDevice: true},
+		{name: "other device uses .Trash-uid", want: ".Trash-1000"},
+		{
+			name: "sticky .Trash is shared",
+			setup: func(t *testing.T, vol string) {
+				if err := os.Mkdir(filepath.Join(vol, ".Trash"), 0777|os.ModeSticky); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(filepath.Join(vol, ".Trash"), 0777|os.ModeSticky); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: filepath.Join(".Trash", "1000"),
+		},
+		{
+			name: "non-sticky .Trash is ignored",
+			setup: func(t *testing.T, vol string) {
+				if err := os.Mkdir(filepath.Join(vol, ".Trash"), 0777); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: ".Trash-1000",
+		},
+		{
+			name: "unusable volume trash falls back to home",
+			setup: func(t *testing.T, vol string) {
+				writeFile(t, filepath.Join(vol, ".Trash-1000"), "not a directory")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			home := filepath.Join(tmpDir, "home", ".local", "share", "Trash")
+			vol := filepath.Join(tmpDir, "media", "usb")
+			src := filepath.Join(vol, "photos", "2024", "a.jpg")
+			writeFile(t, src, "image")
+			if tt.setup != nil {
+				tt.setup(t, vol)
+			}
+
+			mounts := map[string]uint64{vol: 2}
+			if tt.sameDevice {
+				mounts[vol] = 1
+			}
+			dir, topdir := linuxTrashDir(src, home, 1000, fakeDevices(mounts))
+
+			if tt.want == "" {
+				if dir != home || topdir != "" {
+					t.Errorf("got (%s, %q), want home trash", dir, topdir)
+				}
+				return
+			}
+			if want := filepath.Join(vol, tt.want); dir != want {
+				t.Errorf("trash dir = %s, want %s", dir, want)
+			}
+			if topdir != vol {
+				t.Errorf("topdir = %s, want %s", topdir, vol)
+			}
+			for _, sub := range []string{"files", "info"} {
+				if fi, err := os.Stat(filepath.Join(dir, sub)); err != nil || !fi.IsDir() {
+					t.Errorf("expected %s/%s to be created", dir, sub)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveToLinuxTrash_VolumeRelativePath(t *testing.T) {
+	vol := t.TempDir()
+	src := filepath.Join(vol, "my photos", "a.jpg")
+	writeFile(t, src, "image")
+	trash := filepath.Join(vol, ".Trash-1000")
+
+	if err := moveToLinuxTrash(src, trash, vol); err != nil {
+		t.Fatalf("moveToLinuxTrash failed: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(trash, "files", "a.jpg")); got != "image" {
+		t.Errorf("trashed content = %q, want %q", got, "image")
+	}
+	info := readFile(t, filepath.Join(trash, "info", "a.jpg.trashinfo"))
+	if !strings.Contains(info, "\nPath=my%20photos/a.jpg\n") {
+		t.Errorf("trashinfo should record the escaped path relative to the volume, got:\n%s", info)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source should be gone")
+	}
+}
+
+func TestMissingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	present := filepath.Join(tmpDir, "new", "a.jpg")
+	writeFile(t, present, "image")
+	absent := filepath.Join(tmpDir, "new", "b.jpg")
+
+	missing := MissingFiles([]string{present, absent})
+	if len(missing) != 1 || missing[0] != absent {
+		t.Errorf("MissingFiles = %v, want [%s]", missing, absent)
+	}
+	if missing := MissingFiles([]string{present}); len(missing) != 0 {
+		t.Errorf("MissingFiles = %v, want none", missing)
+	}
+}
+
+func TestSameFile_HardLinkedDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+	keep := filepath.Join(tmpDir, "a", "photo.jpg")
+	writeFile(t, keep, "image")
+	linked := filepath.Join(tmpDir, "b", "photo.jpg")
+	if err := os.MkdirAll(filepath.Dir(linked), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(keep, linked); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+	copied := filepath.Join(tmpDir, "c", "photo.jpg")
+	writeFile(t, copied, "image")
+
+	if !SameFile(keep, linked) {
+		t.Error("a hard link should be the same file as its target")
+	}
+	if SameFile(keep, copied) {
+		t.Error("a copy should not be the same file")
+	}
+	if !SameFile(keep, keep) {
+		t.Error("a path should be the same file as itself")
+	}
+	if SameFile(keep, filepath.Join(tmpDir, "missing.jpg")) {
+		t.Error("a missing file should not be the same file")
+	}
+
+	// What clean does with a group keeping keep: only the copy is removed
+	for _, path := range []string{linked, copied} {
+		if SameFile(path, keep) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := os.ReadFile(keep); err != nil || string(data) != "image" {
+		t.Errorf("kept file was affected: %q, %v", data, err)
+	}
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Error("the copy should have been removed")
+	}
+}
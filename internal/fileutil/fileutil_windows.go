@@ -3,7 +3,9 @@
 package fileutil
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"syscall"
 	"unsafe"
@@ -63,3 +65,23 @@ func moveToWindowsTrash(path string) error {
 
 	return nil
 }
+
+// deviceID is a stub for Windows, which has no freedesktop.org trash.
+// This function should never be called on Windows.
+func deviceID(path string) (uint64, error) {
+	return 0, errors.New("device IDs are not available on this platform")
+}
+
+// clearReadOnly clears the read-only attribute of path, which is what
+// blocks deleting it on Windows.
+func clearReadOnly(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, info.Mode()|0200)
+}
+
+// syncDir is a no-op on Windows, where directories can't be synced and a
+// rename is flushed with the file.
+func syncDir(dir string) {}
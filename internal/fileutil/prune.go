@@ -0,0 +1,72 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PruneEmptyDirs removes each of dirs that is empty, then its parents as
+// long as they are empty in turn, and returns the directories removed,
+// deepest first. Only directories strictly inside one of roots are removed,
+// never a root itself, and none reached through a symbolic link, so pruning
+// never leaves the roots. A directory holding anything at all, even a
+// hidden or non-image file, is kept. Directories that could not be removed
+// are joined into the error; the others are still pruned.
+func PruneEmptyDirs(dirs, roots []string) ([]string, error) {
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			resolved = append(resolved, r)
+		}
+	}
+
+	var removed []string
+	var errs []error
+	for _, dir := range dirs {
+		for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+			info, err := os.Lstat(dir)
+			if errors.Is(err, os.ErrNotExist) {
+				// Pruned from an earlier dir, which also tried its parents
+				break
+			}
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if !info.IsDir() {
+				break
+			}
+			resolvedDir, err := filepath.EvalSymlinks(dir)
+			if err != nil || !insideAny(resolvedDir, resolved) {
+				break
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if len(entries) > 0 {
+				break
+			}
+			if err := os.Remove(dir); err != nil {
+				errs = append(errs, err)
+				break
+			}
+			removed = append(removed, dir)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// insideAny reports whether path is strictly inside one of roots
+func insideAny(path string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPruneEmptyDirs(t *testing.T) {
+	root := t.TempDir()
+	emptied := filepath.Join(root, "2023", "trip")
+	withNote := filepath.Join(root, "2024")
+	writeFile(t, filepath.Join(emptied, "img.jpg"), "a")
+	writeFile(t, filepath.Join(withNote, "img.jpg"), "b")
+	writeFile(t, filepath.Join(withNote, "notes.txt"), "keep me")
+	// Outside the root: never pruned, even when empty
+	outside := filepath.Join(t.TempDir(), "empty")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A link inside the root to an empty folder outside it
+	target := filepath.Join(t.TempDir(), "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	for _, path := range []string{filepath.Join(emptied, "img.jpg"), filepath.Join(withNote, "img.jpg")} {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := PruneEmptyDirs([]string{emptied, withNote, outside, link, target, root}, []string{root})
+	if err != nil {
+		t.Fatalf("PruneEmptyDirs failed: %v", err)
+	}
+
+	want := []string{emptied, filepath.Join(root, "2023")}
+	if !slices.Equal(removed, want) {
+		t.Errorf("removed %v, want %v (bottom-up)", removed, want)
+	}
+	for _, dir := range []string{withNote, outside, link, target, root} {
+		if _, err := os.Lstat(dir); err != nil {
+			t.Errorf("%s should be kept: %v", dir, err)
+		}
+	}
+}
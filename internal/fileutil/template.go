@@ -0,0 +1,112 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NameTemplate builds the names of moved files from placeholders:
+//
+//	{group}    the duplicate group ID
+//	{orig}     the original name without its extension
+//	{ext}      the original extension without the dot
+//	{date}     the file's modification date, YYYYMMDD
+//	{counter}  1, 2, ... until the name is free
+//
+// Without {ext}, the original extension is appended. Without {counter}, a
+// name already taken gets _1, _2, ... as in MoveFile.
+type NameTemplate struct {
+	tmpl string
+}
+
+// NameFields are the values a NameTemplate fills in besides the file's name
+type NameFields struct {
+	Group int
+	Date  time.Time
+}
+
+var (
+	namePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+	namePlaceholders = map[string]bool{
+		"{group}": true, "{orig}": true, "{ext}": true, "{date}": true, "{counter}": true,
+	}
+)
+
+// ParseNameTemplate checks that s only uses known placeholders and names a
+// file rather than a path
+func ParseNameTemplate(s string) (NameTemplate, error) {
+	if strings.TrimSpace(s) == "" {
+		return NameTemplate{}, fmt.Errorf("empty name template")
+	}
+	if strings.ContainsAny(s, `/\`) {
+		return NameTemplate{}, fmt.Errorf("name template %q must not contain path separators", s)
+	}
+	for _, p := range namePlaceholder.FindAllString(s, -1) {
+		if !namePlaceholders[p] {
+			return NameTemplate{}, fmt.Errorf("unknown placeholder %s in name template %q (want {group}, {orig}, {ext}, {date} or {counter})", p, s)
+		}
+	}
+	return NameTemplate{tmpl: s}, nil
+}
+
+// render expands t for src, with counter for {counter}
+func (t NameTemplate) render(src string, f NameFields, counter int) string {
+	base := filepath.Base(src)
+	ext := filepath.Ext(base)
+	name := strings.NewReplacer(
+		"{group}", strconv.Itoa(f.Group),
+		"{orig}", strings.TrimSuffix(base, ext),
+		"{ext}", strings.TrimPrefix(ext, "."),
+		"{date}", f.Date.Format("20060102"),
+		"{counter}", strconv.Itoa(counter),
+	).Replace(t.tmpl)
+	if !strings.Contains(t.tmpl, "{ext}") {
+		name += ext
+	}
+	return name
+}
+
+// name returns the first name t gives src that isAvailable accepts
+func (t NameTemplate) name(src string, f NameFields, isAvailable func(string) bool) (string, error) {
+	// Only {ext} and {orig} can expand to nothing, e.g. "{ext}" for a file
+	// without an extension
+	if first := t.render(src, f, 1); first == "" || first == "." || first == ".." {
+		return "", fmt.Errorf("name template %q gives no file name for %s", t.tmpl, src)
+	}
+	if !strings.Contains(t.tmpl, "{counter}") {
+		return findUniqueName(t.render(src, f, 0), isAvailable), nil
+	}
+	for counter := 1; ; counter++ {
+		if candidate := t.render(src, f, counter); isAvailable(candidate) {
+			return candidate, nil
+		}
+	}
+}
+
+// MoveFileTemplated moves a file to the destination directory under the
+// name t gives it and returns its new path
+func MoveFileTemplated(src, destDir string, t NameTemplate, f NameFields) (string, error) {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+
+	destName, err := t.name(src, f, func(name string) bool {
+		_, err := os.Stat(filepath.Join(destDir, name))
+		return os.IsNotExist(err)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(destDir, destName)
+	if err := moveFileAcrossFS(src, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
@@ -0,0 +1,98 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNameTemplate_Render(t *testing.T) {
+	fields := NameFields{Group: 12, Date: time.Date(2023, 7, 4, 18, 30, 0, 0, time.Local)}
+	tests := []struct {
+		tmpl, src, want string
+	}{
+		{"g{group}_{orig}_{date}", "/photos/IMG_0001.JPG", "g12_IMG_0001_20230704.JPG"},
+		{"{orig}-dup{counter}.{ext}", "/photos/beach.png", "beach-dup1.png"},
+		{"{date}_{group}", "/photos/archive.tar.gz", "20230704_12.gz"},
+		{"{orig}", "/photos/README", "README"},
+		{"{orig}.{ext}.bak", "/photos/a.webp", "a.webp.bak"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseNameTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("ParseNameTemplate(%q) failed: %v", tt.tmpl, err)
+		}
+		got, err := tmpl.name(tt.src, fields, func(string) bool { return true })
+		if err != nil || got != tt.want {
+			t.Errorf("%q for %s = %q, %v; want %q", tt.tmpl, tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestNameTemplate_Collisions(t *testing.T) {
+	fields := NameFields{Group: 3, Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)}
+	taken := map[string]bool{"g3_a.jpg": true, "g3_a_1.jpg": true, "a-1.jpg": true, "a-2.jpg": true}
+	isAvailable := func(name string) bool { return !taken[name] }
+
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"g{group}_{orig}", "g3_a_2.jpg"}, // no {counter}: suffixed as in MoveFile
+		{"{orig}-{counter}", "a-3.jpg"},   // {counter} counts up instead
+		{"{orig}_{date}", "a_20240102.jpg"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseNameTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("ParseNameTemplate(%q) failed: %v", tt.tmpl, err)
+		}
+		if got, err := tmpl.name("/src/a.jpg", fields, isAvailable); err != nil || got != tt.want {
+			t.Errorf("%q = %q, %v; want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseNameTemplate_Invalid(t *testing.T) {
+	for _, bad := range []string{"", "  ", "sub/{orig}", `..\{orig}`, "{orig}_{hash}", "{Group}"} {
+		if _, err := ParseNameTemplate(bad); err == nil {
+			t.Errorf("ParseNameTemplate(%q) succeeded, want error", bad)
+		}
+	}
+
+	// Parses, but leaves nothing for a file without an extension
+	tmpl, err := ParseNameTemplate("{ext}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate failed: %v", err)
+	}
+	if _, err := tmpl.name("/src/README", NameFields{}, func(string) bool { return true }); err == nil {
+		t.Error("an empty name should be rejected")
+	}
+}
+
+func TestMoveFileTemplated(t *testing.T) {
+	tmpDir := t.TempDir()
+	dest := filepath.Join(tmpDir, "dupes")
+	tmpl, err := ParseNameTemplate("g{group}_{orig}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := NameFields{Group: 7}
+
+	writeFile(t, filepath.Join(tmpDir, "a", "img.jpg"), "a")
+	writeFile(t, filepath.Join(tmpDir, "b", "img.jpg"), "b")
+	first, err := MoveFileTemplated(filepath.Join(tmpDir, "a", "img.jpg"), dest, tmpl, fields)
+	if err != nil {
+		t.Fatalf("MoveFileTemplated failed: %v", err)
+	}
+	second, err := MoveFileTemplated(filepath.Join(tmpDir, "b", "img.jpg"), dest, tmpl, fields)
+	if err != nil {
+		t.Fatalf("MoveFileTemplated failed: %v", err)
+	}
+
+	if first != filepath.Join(dest, "g7_img.jpg") || readFile(t, first) != "a" {
+		t.Errorf("first move = %s", first)
+	}
+	if second != filepath.Join(dest, "g7_img_1.jpg") || readFile(t, second) != "b" {
+		t.Errorf("second move = %s, want g7_img_1.jpg", second)
+	}
+}
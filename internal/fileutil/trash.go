@@ -0,0 +1,167 @@
+package fileutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trashInfoDate is the DeletionDate layout of the freedesktop.org trash spec
+// (local time, no zone)
+const trashInfoDate = "2006-01-02T15:04:05"
+
+// TrashedFile is a file in the Linux home trash
+type TrashedFile struct {
+	Name         string    // name under the trash's files/ directory
+	OriginalPath string    // where it was deleted from
+	DeletionDate time.Time // zero if the .trashinfo has none
+}
+
+// ListTrash returns the files in the Linux home trash (~/.local/share/Trash),
+// whichever program trashed them, oldest first. Only Linux is supported.
+func ListTrash() ([]TrashedFile, error) {
+	trashDir, err := homeTrashForRestore()
+	if err != nil {
+		return nil, err
+	}
+	return listTrash(trashDir)
+}
+
+// RestoreFromTrash moves the trashed file name (as reported by ListTrash)
+// back to its original path and returns the path it was restored to. If a
+// file now exists there, a counter is appended as in MoveFile.
+func RestoreFromTrash(name string) (string, error) {
+	trashDir, err := homeTrashForRestore()
+	if err != nil {
+		return "", err
+	}
+	return restoreFromTrash(trashDir, name)
+}
+
+func homeTrashForRestore() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("listing and restoring trash is only supported on Linux")
+	}
+	return linuxHomeTrash()
+}
+
+// listTrash reads every .trashinfo under trashDir/info. Entries whose
+// metadata is unreadable or whose file is gone are skipped.
+func listTrash(trashDir string) ([]TrashedFile, error) {
+	infos, err := filepath.Glob(filepath.Join(trashDir, "info", "*.trashinfo"))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []TrashedFile
+	for _, infoPath := range infos {
+		name := strings.TrimSuffix(filepath.Base(infoPath), ".trashinfo")
+		if _, err := os.Lstat(filepath.Join(trashDir, "files", name)); err != nil {
+			continue
+		}
+		f, err := readTrashInfo(infoPath)
+		if err != nil {
+			continue
+		}
+		f.Name = name
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].DeletionDate.Equal(files[j].DeletionDate) {
+			return files[i].DeletionDate.Before(files[j].DeletionDate)
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// readTrashInfo parses a .trashinfo file. Path is URI-escaped per the spec.
+func readTrashInfo(path string) (TrashedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return TrashedFile{}, err
+	}
+	defer f.Close()
+
+	var info TrashedFile
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inSection = line == "[Trash Info]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inSection || !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			if info.OriginalPath, err = url.PathUnescape(value); err != nil {
+				return TrashedFile{}, fmt.Errorf("invalid Path in %s: %w", path, err)
+			}
+		case "DeletionDate":
+			if t, err := time.ParseInLocation(trashInfoDate, value, time.Local); err == nil {
+				info.DeletionDate = t
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return TrashedFile{}, err
+	}
+	if info.OriginalPath == "" {
+		return TrashedFile{}, fmt.Errorf("no Path in %s", path)
+	}
+	return info, nil
+}
+
+// restoreFromTrash moves trashDir/files/name back to the path recorded in
+// its .trashinfo, recreating the parent directory if needed, then removes
+// the .trashinfo.
+func restoreFromTrash(trashDir, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid trash entry name %q", name)
+	}
+	src := filepath.Join(trashDir, "files", name)
+	infoPath := filepath.Join(trashDir, "info", name+".trashinfo")
+
+	info, err := readTrashInfo(infoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s is not in the trash", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(info.OriginalPath) {
+		return "", fmt.Errorf("%s has a relative original path %q", name, info.OriginalPath)
+	}
+	if _, err := os.Lstat(src); err != nil {
+		return "", fmt.Errorf("%s is not in the trash: %w", name, err)
+	}
+
+	destDir := filepath.Dir(info.OriginalPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+	destName := findUniqueName(filepath.Base(info.OriginalPath), func(name string) bool {
+		_, err := os.Lstat(filepath.Join(destDir, name))
+		return os.IsNotExist(err)
+	})
+	dest := filepath.Join(destDir, destName)
+	if err := moveFileAcrossFS(src, dest); err != nil {
+		return "", err
+	}
+	if err := os.Remove(infoPath); err != nil {
+		return dest, fmt.Errorf("restored to %s but failed to remove %s: %w", dest, infoPath, err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,78 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashRestore_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	trash := filepath.Join(tmpDir, "Trash")
+	src := filepath.Join(tmpDir, "my photos", "a.jpg")
+	writeFile(t, src, "image")
+
+	before := time.Now().Add(-time.Second)
+	if err := moveToLinuxTrash(src, trash, ""); err != nil {
+		t.Fatalf("moveToLinuxTrash failed: %v", err)
+	}
+
+	files, err := listTrash(trash)
+	if err != nil {
+		t.Fatalf("listTrash failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("listTrash returned %d entries, want 1", len(files))
+	}
+	if f := files[0]; f.Name != "a.jpg" || f.OriginalPath != src || f.DeletionDate.Before(before) {
+		t.Errorf("entry = %+v, want a.jpg from %s deleted after %s", f, src, before)
+	}
+
+	// The folder was removed after trashing; restore recreates it
+	if err := os.Remove(filepath.Dir(src)); err != nil {
+		t.Fatal(err)
+	}
+	dest, err := restoreFromTrash(trash, "a.jpg")
+	if err != nil {
+		t.Fatalf("restoreFromTrash failed: %v", err)
+	}
+	if dest != src {
+		t.Errorf("restored to %s, want %s", dest, src)
+	}
+	if got := readFile(t, src); got != "image" {
+		t.Errorf("restored content = %q, want image", got)
+	}
+	if files, _ := listTrash(trash); len(files) != 0 {
+		t.Errorf("trash still lists %v after restore", files)
+	}
+	if _, err := restoreFromTrash(trash, "a.jpg"); err == nil {
+		t.Error("restoring a file no longer in the trash should fail")
+	}
+}
+
+func TestTrashRestore_ConflictingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	trash := filepath.Join(tmpDir, "Trash")
+	src := filepath.Join(tmpDir, "photos", "a.jpg")
+	writeFile(t, src, "old")
+
+	if err := moveToLinuxTrash(src, trash, ""); err != nil {
+		t.Fatalf("moveToLinuxTrash failed: %v", err)
+	}
+	writeFile(t, src, "new")
+
+	dest, err := restoreFromTrash(trash, "a.jpg")
+	if err != nil {
+		t.Fatalf("restoreFromTrash failed: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "photos", "a_1.jpg"); dest != want {
+		t.Errorf("restored to %s, want %s", dest, want)
+	}
+	if got := readFile(t, dest); got != "old" {
+		t.Errorf("restored content = %q, want old", got)
+	}
+	if got := readFile(t, src); got != "new" {
+		t.Errorf("existing file was overwritten: %q", got)
+	}
+}
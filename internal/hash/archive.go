@@ -0,0 +1,119 @@
+package hash
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveSeparator joins a zip archive's path and the name of an entry in it
+// into the path the entry is recorded under, e.g. "album.zip!photo.jpg"
+const ArchiveSeparator = "!"
+
+// IsArchive reports whether path names a zip archive, by extension
+func IsArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// ArchivePath returns the path an entry of archive is recorded under
+func ArchivePath(archive, entry string) string {
+	return archive + ArchiveSeparator + entry
+}
+
+// SplitArchivePath splits a path made by ArchivePath into the archive and
+// the entry name. ok is false for paths of ordinary files.
+func SplitArchivePath(path string) (archive, entry string, ok bool) {
+	marker := ".zip" + ArchiveSeparator
+	i := strings.Index(strings.ToLower(path), marker)
+	if i < 0 {
+		return "", "", false
+	}
+	return path[:i+len(".zip")], path[i+len(marker):], true
+}
+
+// IsArchiveEntry reports whether path names an entry inside a zip archive.
+// Such files can be read but not moved or deleted.
+func IsArchiveEntry(path string) bool {
+	_, _, ok := SplitArchivePath(path)
+	return ok
+}
+
+// ArchiveImages lists the entries of the zip archive at path that set
+// supports, in archive order. Directories and nested archives are left out.
+// The archive is closed on return, so only the entries' headers can be used.
+func ArchiveImages(path string, set FormatSet) ([]*zip.File, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer r.Close()
+
+	var files []*zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !set.Supports(f.Name) {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Stat is os.Stat, except that for a path made by ArchivePath it describes
+// the entry: its uncompressed size and modification time
+func Stat(path string) (os.FileInfo, error) {
+	archive, entry, ok := SplitArchivePath(path)
+	if !ok {
+		return os.Stat(path)
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := findEntry(r, archive, entry)
+	if err != nil {
+		return nil, err
+	}
+	return f.FileInfo(), nil
+}
+
+// openArchiveEntry reads an archive entry into memory, as zip entries can't
+// be seeked and decoders need to rewind
+func openArchiveEntry(archive, entry string) (File, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := findEntry(r, archive, entry)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	buf.Grow(int(f.UncompressedSize64))
+	if _, err := io.Copy(&buf, rc); err != nil {
+		return nil, err
+	}
+	return memFile{bytes.NewReader(buf.Bytes()), f.FileInfo()}, nil
+}
+
+// findEntry returns the entry named entry, or an error satisfying
+// os.IsNotExist if the archive has none
+func findEntry(r *zip.ReadCloser, archive, entry string) (*zip.File, error) {
+	for _, f := range r.File {
+		if f.Name == entry {
+			return f, nil
+		}
+	}
+	return nil, &os.PathError{Op: "open", Path: ArchivePath(archive, entry), Err: os.ErrNotExist}
+}
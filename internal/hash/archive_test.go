@@ -0,0 +1,63 @@
+package hash
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		path, archive, entry string
+		ok                   bool
+	}{
+		{"/photos/album.zip!photo.jpg", "/photos/album.zip", "photo.jpg", true},
+		{"/photos/Album.ZIP!2019/photo.jpg", "/photos/Album.ZIP", "2019/photo.jpg", true},
+		{"/photos/wow!.jpg", "", "", false},
+		{"/photos/album.zip", "", "", false},
+	}
+	for _, tt := range tests {
+		archive, entry, ok := SplitArchivePath(tt.path)
+		if archive != tt.archive || entry != tt.entry || ok != tt.ok {
+			t.Errorf("SplitArchivePath(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.path, archive, entry, ok, tt.archive, tt.entry, tt.ok)
+		}
+	}
+}
+
+func TestOpenFile_ArchiveEntry(t *testing.T) {
+	album := filepath.Join(t.TempDir(), "album.zip")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("2019/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("jpeg bytes"))
+	zw.Close()
+	if err := os.WriteFile(album, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := ArchivePath(album, "2019/photo.jpg")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "jpeg bytes" {
+		t.Errorf("read %q, want the entry's content", data)
+	}
+
+	stat, err := Stat(path)
+	if err != nil || stat.Size() != int64(len("jpeg bytes")) {
+		t.Errorf("Stat = %v, %v; want the entry's uncompressed size", stat, err)
+	}
+	if _, err := Stat(ArchivePath(album, "missing.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Stat of a missing entry: got %v, want not-exist", err)
+	}
+}
@@ -0,0 +1,146 @@
+package hash
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// BlurHash component counts: 4x3 is a good fit for photos in a landscape
+// grid cell and gives a 28-character string
+const (
+	blurHashX = 4
+	blurHashY = 3
+
+	// blurHashSample is the grid the image is reduced to first. The hash
+	// only keeps low frequencies, so sampling loses nothing visible and keeps
+	// the cost independent of image size.
+	blurHashSample = 32
+)
+
+// WithBlurHash also computes a BlurHash for each decoded image (ImageInfo
+// BlurHash). A hash cache entry without one is decoded again.
+func WithBlurHash() Option {
+	return func(h *Hasher) {
+		h.blurHash = true
+	}
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes img as a BlurHash (https://blurha.sh), a short string
+// the web UI decodes into a blurred placeholder while the thumbnail loads
+func BlurHash(img image.Image) string {
+	pixels, w, h := sampleLinear(img)
+	if w == 0 || h == 0 {
+		return ""
+	}
+
+	// DCT-style factors: the average color first, then the AC components
+	factors := make([][3]float64, 0, blurHashX*blurHashY)
+	for j := 0; j < blurHashY; j++ {
+		for i := 0; i < blurHashX; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := pixels[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := norm / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	writeBase83(&b, (blurHashX-1)+(blurHashY-1)*9, 1)
+
+	maxAC := 0.0
+	for _, f := range factors[1:] {
+		maxAC = max(maxAC, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+	}
+	quantMax := int(max(0, min(82, math.Floor(maxAC*166-0.5))))
+	acScale := float64(quantMax+1) / 166
+	writeBase83(&b, quantMax, 1)
+
+	dc := factors[0]
+	writeBase83(&b, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range factors[1:] {
+		q := func(v float64) int {
+			return int(max(0, min(18, math.Floor(signPow(v/acScale, 0.5)*9+9.5))))
+		}
+		writeBase83(&b, q(f[0])*19*19+q(f[1])*19+q(f[2]), 2)
+	}
+	return b.String()
+}
+
+// sampleLinear averages img onto a grid of at most blurHashSample cells per
+// side, in linear RGB. Large images are read with a stride, about 4x4 pixels
+// per cell, so the cost stays flat however big they are.
+func sampleLinear(img image.Image) ([][3]float64, int, int) {
+	bounds := img.Bounds()
+	iw, ih := bounds.Dx(), bounds.Dy()
+	if iw <= 0 || ih <= 0 {
+		return nil, 0, 0
+	}
+	w, h := min(iw, blurHashSample), min(ih, blurHashSample)
+	sx, sy := max(1, iw/(w*4)), max(1, ih/(h*4))
+
+	pixels := make([][3]float64, w*h)
+	counts := make([]int, w*h)
+	for y := 0; y < ih; y += sy {
+		row := y * h / ih * w
+		for x := 0; x < iw; x += sx {
+			r, g, bl, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := row + x*w/iw
+			pixels[i][0] += srgbToLinear(r >> 8)
+			pixels[i][1] += srgbToLinear(g >> 8)
+			pixels[i][2] += srgbToLinear(bl >> 8)
+			counts[i]++
+		}
+	}
+	for i, n := range counts {
+		if n > 0 {
+			pixels[i][0] /= float64(n)
+			pixels[i][1] /= float64(n)
+			pixels[i][2] /= float64(n)
+		}
+	}
+	return pixels, w, h
+}
+
+func srgbToLinear(v uint32) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = max(0, min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// writeBase83 appends value as length base-83 digits
+func writeBase83(b *strings.Builder, value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		digit := value / int(math.Pow(83, float64(i))) % 83
+		b.WriteByte(base83Chars[digit])
+	}
+}
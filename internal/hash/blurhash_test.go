@@ -0,0 +1,61 @@
+package hash
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlurHash_KnownValues(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	// A uniform image has no AC components: DC black, every AC at zero
+	if got, want := BlurHash(black), "L00000fQfQfQfQfQfQfQfQfQfQfQ"; got != want {
+		t.Errorf("BlurHash(black) = %q, want %q", got, want)
+	}
+
+	gradient := image.NewRGBA(image.Rect(0, 0, 2000, 1000))
+	for y := 0; y < 1000; y++ {
+		for x := 0; x < 2000; x++ {
+			gradient.Set(x, y, color.RGBA{uint8(x * 255 / 2000), uint8(y * 255 / 1000), 128, 255})
+		}
+	}
+	got := BlurHash(gradient)
+	if len(got) != 4+2*blurHashX*blurHashY {
+		t.Fatalf("BlurHash length = %d, want %d", len(got), 4+2*blurHashX*blurHashY)
+	}
+	if again := BlurHash(gradient); again != got {
+		t.Errorf("BlurHash not deterministic: %q != %q", got, again)
+	}
+	if got == BlurHash(black) {
+		t.Error("a gradient and a uniform image should not share a BlurHash")
+	}
+
+	if got := BlurHash(image.NewRGBA(image.Rectangle{})); got != "" {
+		t.Errorf("BlurHash of an empty image = %q, want empty", got)
+	}
+}
+
+func TestHashImage_BlurHashOnlyWhenEnabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.png")
+	writePNG(t, path, colorDocument())
+
+	info, err := NewHasher().HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if info.BlurHash != "" {
+		t.Errorf("BlurHash = %q without WithBlurHash, want empty", info.BlurHash)
+	}
+
+	info, err = NewHasher(WithBlurHash()).HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if info.BlurHash != BlurHash(colorDocument()) {
+		t.Errorf("BlurHash = %q, want %q", info.BlurHash, BlurHash(colorDocument()))
+	}
+}
@@ -0,0 +1,66 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"imagedupfinder/internal/models"
+)
+
+// Cache memoizes decode results by file content, so a file seen before under
+// another path (or before a move) is not decoded again. GetCachedHash returns
+// nil on a miss. The cache only saves work: lookup errors count as misses and
+// failed stores are ignored.
+type Cache interface {
+	GetCachedHash(key models.ContentKey) (*models.ImageInfo, error)
+	PutCachedHash(key models.ContentKey, info *models.ImageInfo) error
+}
+
+// WithCache makes the hasher consult c before decoding and fill it after
+func WithCache(c Cache) Option {
+	return func(h *Hasher) {
+		h.cache = c
+	}
+}
+
+// sampleSize is how much of each end of a file goes into its ContentKey
+const sampleSize = 64 << 10
+
+// contentKey computes the cache key of file for hashes of the given variant
+// and rewinds it. The variant is part of the digest so differently computed
+// hashes of the same file don't collide.
+func contentKey(file File, stat os.FileInfo, variant string) (models.ContentKey, error) {
+	size := stat.Size()
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, size)
+	io.WriteString(h, variant)
+
+	if _, err := io.CopyN(h, file, min(size, sampleSize)); err != nil {
+		return models.ContentKey{}, fmt.Errorf("failed to sample file: %w", err)
+	}
+	if tail := size - sampleSize; tail > sampleSize {
+		if _, err := file.Seek(-sampleSize, io.SeekEnd); err != nil {
+			return models.ContentKey{}, fmt.Errorf("failed to sample file: %w", err)
+		}
+		if _, err := io.CopyN(h, file, sampleSize); err != nil {
+			return models.ContentKey{}, fmt.Errorf("failed to sample file: %w", err)
+		}
+	} else if tail > 0 {
+		if _, err := io.Copy(h, file); err != nil {
+			return models.ContentKey{}, fmt.Errorf("failed to sample file: %w", err)
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return models.ContentKey{}, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	return models.ContentKey{
+		Size:    size,
+		ModTime: stat.ModTime(),
+		Sample:  hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,164 @@
+package hash
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"imagedupfinder/internal/models"
+)
+
+// memCache is an in-memory Cache
+type memCache struct {
+	mu      sync.Mutex
+	entries map[models.ContentKey]models.ImageInfo
+}
+
+func newMemCache() *memCache {
+	return &memCache{entries: make(map[models.ContentKey]models.ImageInfo)}
+}
+
+func (c *memCache) GetCachedHash(key models.ContentKey) (*models.ImageInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Normalize so keys compare by instant, as a stored key would
+	key.ModTime = key.ModTime.UTC()
+	info, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+func (c *memCache) PutCachedHash(key models.ContentKey, info *models.ImageInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key.ModTime = key.ModTime.UTC()
+	c.entries[key] = *info
+	return nil
+}
+
+// countDecodes wraps h's decoder and returns a pointer to the call count
+func countDecodes(h *Hasher) *int {
+	n := 0
+	decode := h.decode
+	h.decode = func(path string, r io.ReadSeeker) (image.Image, string, error) {
+		n++
+		return decode(path, r)
+	}
+	return &n
+}
+
+func TestHashImage_CacheSkipsDecode(t *testing.T) {
+	dir := t.TempDir()
+	data := jpegWithCaptureTime(t, "2019:06:01 08:30:00")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	h := NewHasher(WithCache(newMemCache()))
+	decodes := countDecodes(h)
+
+	first, err := h.HashImage(write("a.jpg"))
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+
+	// Same content and mod time under another path: served from the cache
+	moved := write("moved.jpg")
+	second, err := h.HashImage(moved)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if *decodes != 1 {
+		t.Errorf("expected 1 decode, got %d", *decodes)
+	}
+	if second.Path != moved {
+		t.Errorf("cached result has path %s, want %s", second.Path, moved)
+	}
+	if second.Hash != first.Hash || second.Width != first.Width || second.Score != first.Score {
+		t.Errorf("cached result %+v differs from original %+v", second, first)
+	}
+	if !second.CaptureTime.Equal(first.CaptureTime) {
+		t.Errorf("cached capture time %v, want %v", second.CaptureTime, first.CaptureTime)
+	}
+
+	// A different mod time is a miss
+	touched := write("touched.jpg")
+	later := mtime.Add(time.Hour)
+	if err := os.Chtimes(touched, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.HashImage(touched); err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if *decodes != 2 {
+		t.Errorf("expected a decode after the mod time changed, got %d decodes", *decodes)
+	}
+}
+
+func TestContentKey_SamplesHeadAndTail(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Now()
+	key := func(data []byte) models.ContentKey {
+		t.Helper()
+		path := filepath.Join(dir, "f")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		stat, _ := f.Stat()
+		k, err := contentKey(f, stat, "")
+		if err != nil {
+			t.Fatalf("contentKey failed: %v", err)
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != 0 {
+			t.Errorf("file left at offset %d, want 0", pos)
+		}
+		return k
+	}
+
+	size := 3 * sampleSize
+	base := key(bytes.Repeat([]byte{1}, size))
+	for _, tt := range []struct {
+		name   string
+		offset int
+		same   bool
+	}{
+		{"head", 10, false},
+		{"tail", size - 10, false},
+		{"middle, not sampled", size / 2, true},
+	} {
+		data := bytes.Repeat([]byte{1}, size)
+		data[tt.offset] = 2
+		if got := key(data); (got == base) != tt.same {
+			t.Errorf("%s: key equal = %v, want %v", tt.name, got == base, tt.same)
+		}
+	}
+
+	// Small files are sampled whole
+	small := key([]byte("abc"))
+	if small == key([]byte("abd")) {
+		t.Error("small files with different content share a key")
+	}
+}
@@ -0,0 +1,63 @@
+package hash
+
+import (
+	"image"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// VariantCenter prefixes the HashVariant part of hashes computed on a center
+// crop (see WithCenterCrop), followed by the fraction kept: "center0.8"
+const VariantCenter = "center"
+
+// WithCenterCrop computes the pHash on the middle fraction of each image's
+// width and height (0.8 drops a tenth on every side), so a border or a
+// watermark near the edges moves the hash less. Everything else (sharpness,
+// BlurHash, dimensions) still covers the whole image. Hashes of different
+// crops aren't comparable, so the fraction is part of the HashVariant. A
+// fraction outside (0, 1) hashes the full frame.
+func WithCenterCrop(fraction float64) Option {
+	return func(h *Hasher) {
+		if fraction > 0 && fraction < 1 {
+			h.centerCrop = fraction
+		} else {
+			h.centerCrop = 0
+		}
+	}
+}
+
+// centerVariant returns the HashVariant part for a crop fraction
+func centerVariant(fraction float64) string {
+	return VariantCenter + strconv.FormatFloat(fraction, 'g', -1, 64)
+}
+
+// parseCenterVariant returns the crop fraction of a HashVariant part made by
+// centerVariant
+func parseCenterVariant(part string) (float64, bool) {
+	s, ok := strings.CutPrefix(part, VariantCenter)
+	if !ok {
+		return 0, false
+	}
+	fraction, err := strconv.ParseFloat(s, 64)
+	return fraction, err == nil
+}
+
+// cropCenter returns the middle fraction of img, shared with img where the
+// image type allows it
+func cropCenter(img image.Image, fraction float64) image.Image {
+	b := img.Bounds()
+	w := max(1, int(float64(b.Dx())*fraction+0.5))
+	h := max(1, int(float64(b.Dy())*fraction+0.5))
+	x, y := b.Min.X+(b.Dx()-w)/2, b.Min.Y+(b.Dy()-h)/2
+	r := image.Rect(x, y, x+w, y+h)
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	crop := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(crop, crop.Bounds(), img, r.Min, draw.Src)
+	return crop
+}
@@ -0,0 +1,92 @@
+package hash
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/corona10/goimagehash"
+)
+
+// framed copies img with a white border of a twelfth of each side and a
+// dark watermark bar in the bottom border, like a stock photo preview
+func framed(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	copy(out.Pix, img.Pix)
+	bx, by := b.Dx()/12, b.Dy()/12
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			switch {
+			case y >= b.Dy()-by && x > b.Dx()/2 && x < b.Dx()-bx && y < b.Dy()-by/3:
+				out.Set(x, y, color.RGBA{30, 30, 30, 255})
+			case x < bx || x >= b.Dx()-bx || y < by || y >= b.Dy()-by:
+				out.Set(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return out
+}
+
+func TestCenterCrop_IgnoresBorderAndWatermark(t *testing.T) {
+	dir := t.TempDir()
+	photo := largePhoto(480, 360)
+	plain, marked := filepath.Join(dir, "plain.png"), filepath.Join(dir, "marked.png")
+	writePNG(t, plain, photo)
+	writePNG(t, marked, framed(photo))
+
+	// The default --threshold
+	const threshold = 10
+	distance := func(h *Hasher) int {
+		a, err := h.HashImage(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := h.HashImage(marked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return HammingDistance(a.Hash, b.Hash)
+	}
+	if d := distance(NewHasher()); d <= threshold {
+		t.Errorf("full-frame distance = %d, want the border to push it above %d", d, threshold)
+	}
+	if d := distance(NewHasher(WithCenterCrop(0.8))); d > threshold {
+		t.Errorf("center-crop distance = %d, want at most %d", d, threshold)
+	}
+}
+
+func TestCenterCrop_Variant(t *testing.T) {
+	h := NewHasher(WithFastDecode(), WithCenterCrop(0.8))
+	if got := h.Variant(); got != "fast+center0.8" {
+		t.Errorf("Variant() = %q, want fast+center0.8", got)
+	}
+	if got := NewHasher(VariantOptions(h.Variant())...).Variant(); got != h.Variant() {
+		t.Errorf("VariantOptions round trip gives %q, want %q", got, h.Variant())
+	}
+	if got := NewHasher(WithCenterCrop(1)).Variant(); got != "" {
+		t.Errorf("a crop of 1 should hash the full frame, got variant %q", got)
+	}
+}
+
+func TestCropCenter_SubImageMatchesCopy(t *testing.T) {
+	img := largePhoto(300, 200)
+	sub := cropCenter(img, 0.8)
+	if b := sub.Bounds(); b.Dx() != 240 || b.Dy() != 160 {
+		t.Fatalf("crop is %v, want 240x160", b)
+	}
+	// A type without SubImage is copied; both must hash alike
+	copied := cropCenter(struct{ image.Image }{img}, 0.8)
+	a, err := goimagehash.PerceptionHash(hashable(sub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := goimagehash.PerceptionHash(hashable(copied))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetHash() != b.GetHash() {
+		t.Errorf("hash of the sub-image %016x differs from the copy's %016x", a.GetHash(), b.GetHash())
+	}
+}
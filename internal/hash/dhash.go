@@ -0,0 +1,26 @@
+package hash
+
+import (
+	"image"
+
+	"github.com/corona10/goimagehash"
+)
+
+// WithDHash also computes a 64-bit difference hash (ImageInfo DHash) from the
+// same image as the pHash, so a matcher can require both fingerprints to
+// agree, or accept either. A hash cache entry without one is decoded again.
+func WithDHash() Option {
+	return func(h *Hasher) {
+		h.dHash = true
+	}
+}
+
+// differenceHash returns the dHash of img, which comes from hashable (or
+// normalizeLuma) like the pHash
+func differenceHash(img image.Image) (uint64, error) {
+	d, err := goimagehash.DifferenceHash(img)
+	if err != nil {
+		return 0, err
+	}
+	return d.GetHash(), nil
+}
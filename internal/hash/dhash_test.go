@@ -0,0 +1,38 @@
+package hash
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/corona10/goimagehash"
+)
+
+func TestWithDHash_StoresDifferenceHash(t *testing.T) {
+	dir := t.TempDir()
+	photo := largePhoto(320, 240)
+	path := filepath.Join(dir, "photo.png")
+	writePNG(t, path, photo)
+
+	info, err := NewHasher().HashImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DHash != 0 {
+		t.Errorf("DHash = %016x without WithDHash, want 0", info.DHash)
+	}
+
+	info, err = NewHasher(WithDHash()).HashImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := goimagehash.DifferenceHash(hashable(photo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DHash != want.GetHash() {
+		t.Errorf("DHash = %016x, want %016x", info.DHash, want.GetHash())
+	}
+	if h := NewHasher(WithDHash()).Variant(); h != "" {
+		t.Errorf("WithDHash changed the variant to %q; the pHash is the same", h)
+	}
+}
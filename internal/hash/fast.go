@@ -0,0 +1,46 @@
+package hash
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// VariantFast is the HashVariant part of hashes computed from a downscaled
+// copy of the image (see WithFastDecode)
+const VariantFast = "fast"
+
+// fastDecodeSize is the longest side WithFastDecode shrinks images to. pHash
+// works on 64x64 and Sharpness on a 256x256 sample, so 512 keeps enough
+// detail for both.
+const fastDecodeSize = 512
+
+// WithFastDecode shrinks each decoded image to at most fastDecodeSize pixels
+// with a fast approximate filter before hashing, instead of letting pHash
+// resample the full-size image, which on large photos costs more than
+// decoding it. Hashes differ slightly from full-size ones, so they carry
+// VariantFast and are not mixed with them. Dimensions are still those of the
+// full image.
+func WithFastDecode() Option {
+	return func(h *Hasher) {
+		h.fastDecode = true
+	}
+}
+
+// downscale returns img shrunk so that its longest side is fastDecodeSize,
+// or img itself if it is no larger
+func downscale(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if max(w, h) <= fastDecodeSize {
+		return img
+	}
+	if w >= h {
+		w, h = fastDecodeSize, max(1, h*fastDecodeSize/w)
+	} else {
+		w, h = max(1, w*fastDecodeSize/h), fastDecodeSize
+	}
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, b, draw.Src, nil)
+	return small
+}
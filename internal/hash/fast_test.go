@@ -0,0 +1,120 @@
+package hash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// largePhoto scales colorDocument up to w x h and adds a gradient, standing
+// in for a camera image
+func largePhoto(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(img, img.Bounds(), colorDocument(), colorDocument().Bounds(), draw.Src, nil)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(x, y)
+			c.R = uint8(int(c.R) * (w + x) / (2 * w))
+			img.SetRGBA(x, y, color.RGBA{c.R, c.G, c.B, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t testing.TB, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFastDecode_CloseToFullHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, encodeJPEG(t, largePhoto(2400, 1600), 90), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := NewHasher().HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	fast, err := NewHasher(WithFastDecode()).HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage (fast) failed: %v", err)
+	}
+
+	if fast.HashVariant != VariantFast || full.HashVariant != "" {
+		t.Errorf("variants = %q (fast), %q (full)", fast.HashVariant, full.HashVariant)
+	}
+	if fast.Width != 2400 || fast.Height != 1600 {
+		t.Errorf("fast decode reports %dx%d, want the full 2400x1600", fast.Width, fast.Height)
+	}
+	if d := HammingDistance(full.Hash, fast.Hash); d > 4 {
+		t.Errorf("fast hash is %d bits from the full one, want a small difference", d)
+	}
+}
+
+func TestVariantOptions_RoundTrip(t *testing.T) {
+	for _, h := range []*Hasher{
+		NewHasher(),
+		NewHasher(WithNormalizeLuma()),
+		NewHasher(WithFastDecode()),
+		NewHasher(WithNormalizeLuma(), WithFastDecode()),
+	} {
+		if got := NewHasher(VariantOptions(h.Variant())...).Variant(); got != h.Variant() {
+			t.Errorf("VariantOptions(%q) builds a hasher of variant %q", h.Variant(), got)
+		}
+	}
+	if v := NewHasher(WithNormalizeLuma(), WithFastDecode()).Variant(); v != "luma+fast" {
+		t.Errorf("combined variant = %q, want luma+fast", v)
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	tests := []struct {
+		w, h, wantW, wantH int
+	}{
+		{4000, 3000, 512, 384},
+		{1000, 4000, 128, 512},
+		{512, 100, 512, 100}, // small enough already
+		{300, 200, 300, 200},
+	}
+	for _, tt := range tests {
+		got := downscale(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("downscale(%dx%d) = %dx%d, want %dx%d", tt.w, tt.h, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+// BenchmarkHashImage_FastDecode compares hashing a 12 MP JPEG with and
+// without WithFastDecode
+func BenchmarkHashImage_FastDecode(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, encodeJPEG(b, largePhoto(4000, 3000), 90), 0644); err != nil {
+		b.Fatal(err)
+	}
+	for _, bench := range []struct {
+		name string
+		h    *Hasher
+	}{
+		{"full", NewHasher()},
+		{"fast", NewHasher(WithFastDecode())},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bench.h.HashImage(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -12,80 +12,351 @@ import (
 	"math/bits"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/corona10/goimagehash"
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
 	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 
 	"imagedupfinder/internal/models"
 )
 
+// File is the subset of *os.File the hasher reads images from
+type File interface {
+	io.ReadSeekCloser
+	Stat() (os.FileInfo, error)
+}
+
+// Opener opens a file for reading
+type Opener func(path string) (File, error)
+
+// OpenFile is the default Opener, backed by os.Open. An entry inside a zip
+// archive (see ArchivePath) is read into memory and served from there.
+func OpenFile(path string) (File, error) {
+	if archive, entry, ok := SplitArchivePath(path); ok {
+		return openArchiveEntry(archive, entry)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
 // Hasher computes perceptual hashes for images
-type Hasher struct{}
+type Hasher struct {
+	open          Opener
+	cache         Cache
+	normalizeLuma bool
+	blurHash      bool
+	orientations  bool
+	dHash         bool
+	fastDecode    bool
+	centerCrop    float64 // 0 = full frame
+	headerOnly    bool
+	decode        func(path string, r io.ReadSeeker) (image.Image, string, error)
+}
+
+// Option configures a Hasher
+type Option func(*Hasher)
+
+// WithOpener sets how image files are opened (default os.Open)
+func WithOpener(open Opener) Option {
+	return func(h *Hasher) {
+		h.open = open
+	}
+}
 
 // NewHasher creates a new Hasher
-func NewHasher() *Hasher {
-	return &Hasher{}
+func NewHasher(opts ...Option) *Hasher {
+	h := &Hasher{open: OpenFile, decode: DecodeImage}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Variant returns the HashVariant of the hashes this hasher computes: the
+// parts for its options (VariantLuma, VariantFast, the center crop) joined
+// by "+", or "" for the standard pHash. WithHeaderOnly makes it
+// VariantHeader.
+func (h *Hasher) Variant() string {
+	if h.headerOnly {
+		return VariantHeader
+	}
+	var parts []string
+	if h.normalizeLuma {
+		parts = append(parts, VariantLuma)
+	}
+	if h.fastDecode {
+		parts = append(parts, VariantFast)
+	}
+	if h.centerCrop > 0 {
+		parts = append(parts, centerVariant(h.centerCrop))
+	}
+	return strings.Join(parts, "+")
+}
+
+// VariantOptions returns the options of a Hasher whose Variant is variant
+func VariantOptions(variant string) []Option {
+	var opts []Option
+	for _, part := range strings.Split(variant, "+") {
+		switch part {
+		case VariantLuma:
+			opts = append(opts, WithNormalizeLuma())
+		case VariantFast:
+			opts = append(opts, WithFastDecode())
+		case VariantHeader:
+			opts = append(opts, WithHeaderOnly())
+		default:
+			if fraction, ok := parseCenterVariant(part); ok {
+				opts = append(opts, WithCenterCrop(fraction))
+			}
+		}
+	}
+	return opts
 }
 
 // HashImage computes the perceptual hash and extracts metadata for an image
 func (h *Hasher) HashImage(path string) (*models.ImageInfo, error) {
-	file, err := os.Open(path)
+	file, err := h.open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
+	return h.hashFile(path, file)
+}
+
+// hashFile computes the perceptual hash and metadata from an open file
+func (h *Hasher) hashFile(path string, file File) (*models.ImageInfo, error) {
 	// Get file info
 	stat, err := file.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
+	var key models.ContentKey
+	if h.cache != nil {
+		if key, err = contentKey(file, stat, h.Variant()); err != nil {
+			return nil, err
+		}
+		if cached, _ := h.cache.GetCachedHash(key); cached != nil && (!h.blurHash || cached.BlurHash != "") &&
+			(!h.orientations || len(cached.OrientationHashes) > 0) && (!h.dHash || cached.DHash != 0) {
+			info := *cached
+			info.Path = path
+			info.HashVariant = h.Variant()
+			info.FileSize = stat.Size()
+			info.ModTime = stat.ModTime()
+			info.Score = h.CalculateScore(&info)
+			return &info, nil
+		}
+	}
+
 	// Check for EXIF data first (Decode consumes the reader), then rewind so
 	// the same open file handle can be reused for decoding. This avoids a
 	// second os.Open + read of the file just to inspect EXIF.
-	_, exifErr := exif.Decode(file)
+	reads := &readErrFile{File: file}
+	file = reads
+	x, exifErr := exif.Decode(file)
 	hasExif := exifErr == nil
+	var captureTime time.Time
+	var cameraMake, cameraModel, software string
+	var tagCount int
+	if hasExif {
+		captureTime = exifCaptureTime(x)
+		cameraMake = exifString(x, exif.Make)
+		cameraModel = exifString(x, exif.Model)
+		software = exifString(x, exif.Software)
+		tagCount = exifTagCount(x)
+	}
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("failed to rewind file: %w", err)
 	}
 
-	// Decode image
-	img, format, err := image.Decode(file)
+	info := &models.ImageInfo{
+		Path:         path,
+		HashVariant:  h.Variant(),
+		FileSize:     stat.Size(),
+		ModTime:      stat.ModTime(),
+		HasExif:      hasExif,
+		CaptureTime:  captureTime,
+		CameraMake:   cameraMake,
+		CameraModel:  cameraModel,
+		Software:     software,
+		ExifTagCount: tagCount,
+	}
+	if h.headerOnly {
+		cfg, format, err := DecodeConfig(path, reads)
+		if reads.err != nil {
+			return nil, fmt.Errorf("failed to read image: %w", reads.err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image header: %w", err)
+		}
+		info.Width, info.Height, info.Format = cfg.Width, cfg.Height, strings.ToLower(format)
+	} else if err := h.hashPixels(reads, info); err != nil {
+		return nil, err
+	}
+
+	// Calculate score
+	info.Score = h.CalculateScore(info)
+
+	if h.cache != nil {
+		h.cache.PutCachedHash(key, info)
+	}
+
+	return info, nil
+}
+
+// hashPixels decodes the image in file and fills in info's perceptual hash,
+// dimensions, format and the values computed from the pixels
+func (h *Hasher) hashPixels(file *readErrFile, info *models.ImageInfo) error {
+	// Decode image. A failed read is reported as such, even where the
+	// decoder turned it into a format error or EXIF was silently dropped.
+	img, format, err := h.decode(info.Path, file)
+	if file.err != nil {
+		return fmt.Errorf("failed to read image: %w", file.err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Compute perceptual hash
-	hash, err := goimagehash.PerceptionHash(img)
+	// Compute perceptual hash. The decoded image is kept for dimensions;
+	// the rest is computed from work, with WithFastDecode a small copy.
+	work := img
+	if h.fastDecode {
+		work = downscale(img)
+	}
+	hashSrc := work
+	if h.centerCrop > 0 {
+		hashSrc = cropCenter(work, h.centerCrop)
+	}
+	var hashed image.Image
+	if h.normalizeLuma {
+		hashed = normalizeLuma(hashSrc)
+	} else {
+		hashed = hashable(hashSrc)
+	}
+	hash, err := goimagehash.PerceptionHash(hashed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute hash: %w", err)
+		return fmt.Errorf("failed to compute hash: %w", err)
 	}
 
 	bounds := img.Bounds()
-	width := bounds.Max.X - bounds.Min.X
-	height := bounds.Max.Y - bounds.Min.Y
+	info.Hash = hash.GetHash()
+	info.Width = bounds.Max.X - bounds.Min.X
+	info.Height = bounds.Max.Y - bounds.Min.Y
+	info.Format = strings.ToLower(format)
+	info.Sharpness = Sharpness(work)
+	if h.blurHash {
+		info.BlurHash = BlurHash(work)
+	}
+	if h.dHash {
+		if info.DHash, err = differenceHash(hashed); err != nil {
+			return fmt.Errorf("failed to compute dHash: %w", err)
+		}
+	}
+	if h.orientations {
+		if info.OrientationHashes, err = orientationHashes(hashed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	info := &models.ImageInfo{
-		Path:     path,
-		Hash:     hash.GetHash(),
-		Width:    width,
-		Height:   height,
-		Format:   strings.ToLower(format),
-		FileSize: stat.Size(),
-		ModTime:  stat.ModTime(),
-		HasExif:  hasExif,
+// readErrFile remembers the first error reading File other than io.EOF.
+// Decoders don't pass these on reliably: image.Decode reports a read
+// failure while sniffing the format as image.ErrFormat.
+type readErrFile struct {
+	File
+	err error
+}
+
+func (f *readErrFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err != nil && err != io.EOF && f.err == nil {
+		f.err = err
 	}
+	return n, err
+}
 
-	// Calculate score
-	info.Score = h.CalculateScore(info)
+// hashable returns img in a pixel format goimagehash reads directly. RGBA and
+// YCbCr (JPEG) images are passed through, which spares a full-size copy of
+// large photos; anything else (CMYK, paletted, 16-bit, decoder-specific
+// types) is drawn onto an RGBA image first.
+func hashable(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.YCbCr:
+		return img
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
 
-	return info, nil
+// exifTimeLayout is the EXIF date/time format ("YYYY:MM:DD HH:MM:SS")
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// exifCaptureTime returns DateTimeOriginal, interpreted in local time as EXIF
+// carries no zone, or the zero time if it is missing or malformed. The plain
+// DateTime tag is deliberately not used: editors rewrite it.
+func exifCaptureTime(x *exif.Exif) time.Time {
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		return time.Time{}
+	}
+	v, err := tag.StringVal()
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, strings.TrimRight(v, "\x00 "), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// exifString returns an ASCII tag with its NUL and space padding trimmed, or
+// "" if it is missing
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	v, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(v, "\x00"))
+}
+
+// exifTagCount counts the EXIF fields present, leaving out the pointers
+// to the EXIF, GPS and interoperability sub-IFDs, which carry no metadata
+// of their own
+func exifTagCount(x *exif.Exif) int {
+	var c tagCounter
+	x.Walk(&c)
+	return int(c)
+}
+
+// tagCounter is an exif.Walker counting the fields it is shown
+type tagCounter int
+
+func (c *tagCounter) Walk(name exif.FieldName, _ *tiff.Tag) error {
+	switch name {
+	case exif.ExifIFDPointer, exif.GPSInfoIFDPointer, exif.InteroperabilityIFDPointer:
+	default:
+		*c++
+	}
+	return nil
 }
 
 // CalculateScore computes the quality score for an image
@@ -104,7 +375,7 @@ func (h *Hasher) CalculateScore(info *models.ImageInfo) float64 {
 
 // ComputeFileHash computes the SHA256 hash of a file
 func ComputeFileHash(path string) (string, error) {
-	file, err := os.Open(path)
+	file, err := OpenFile(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file: %w", err)
 	}
@@ -118,17 +389,126 @@ func ComputeFileHash(path string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// HashSizeCollisions sets FileHash, computed by compute (normally
+// ComputeFileHash), on each image that has none yet and shares its FileSize
+// with another image. Files of a unique size can't be byte-identical to
+// anything, so they are never read. Files compute fails on are left without
+// a hash. It returns the number of hashes computed.
+func HashSizeCollisions(images []*models.ImageInfo, compute func(path string) (string, error)) int {
+	bySize := make(map[int64]int, len(images))
+	for _, img := range images {
+		bySize[img.FileSize]++
+	}
+
+	computed := 0
+	for _, img := range images {
+		if img.FileHash != "" || bySize[img.FileSize] < 2 {
+			continue
+		}
+		fileHash, err := compute(img.Path)
+		computed++
+		if err == nil {
+			img.FileHash = fileHash
+		}
+	}
+	return computed
+}
+
+// formatExtensions maps each format name accepted by ParseFormats to the
+// file extensions it covers. RAW formats must also be listed in rawFormats.
+var formatExtensions = map[string][]string{
+	"jpg":  {".jpg", ".jpeg"},
+	"png":  {".png"},
+	"gif":  {".gif"},
+	"webp": {".webp"},
+	"bmp":  {".bmp"},
+	"tiff": {".tiff", ".tif"},
+	"cr2":  {".cr2"},
+	"nef":  {".nef"},
+	"arw":  {".arw"},
+}
+
+// FormatSet is a set of accepted file extensions, lower-case with the dot
+type FormatSet map[string]bool
+
+// supportedFormats is the set IsSupportedImage consults
+var supportedFormats = AllFormats()
+
+// AllFormats returns a set holding every supported extension
+func AllFormats() FormatSet {
+	set := make(FormatSet)
+	for _, exts := range formatExtensions {
+		for _, ext := range exts {
+			set[ext] = true
+		}
+	}
+	return set
+}
+
+// FormatNames returns the format names ParseFormats accepts, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formatExtensions))
+	for name := range formatExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFormats parses a comma-separated list of format names such as
+// "jpg,png,webp". A name selects every extension of its format, so "jpg"
+// also accepts .jpeg files. Extensions work as names too ("tif", ".jpeg").
+func ParseFormats(list string) (FormatSet, error) {
+	set := make(FormatSet)
+	for _, field := range strings.Split(list, ",") {
+		name := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(field)), ".")
+		if name == "" {
+			continue
+		}
+		exts, ok := formatExtensions[name]
+		if !ok {
+			exts, ok = formatExtensions[extensionFormat(name)]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown image format %q (supported: %s)", strings.TrimSpace(field), strings.Join(FormatNames(), ", "))
+		}
+		for _, ext := range exts {
+			set[ext] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no image formats given")
+	}
+	return set, nil
+}
+
+// extensionFormat returns the name of the format covering extension ext
+// (without the dot), or "" if none does
+func extensionFormat(ext string) string {
+	for name, exts := range formatExtensions {
+		for _, e := range exts {
+			if e[1:] == ext {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Supports reports whether path has an extension in the set
+func (s FormatSet) Supports(path string) bool {
+	return s[strings.ToLower(filepath.Ext(path))]
+}
+
 // IsSupportedImage checks if a file is a supported image format
 func IsSupportedImage(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tiff", ".tif":
-		return true
-	default:
-		return false
-	}
+	return supportedFormats.Supports(path)
 }
 
+// HashBits is the width of a perceptual hash, and so the largest possible
+// Hamming distance
+const HashBits = 64
+
 // HammingDistance calculates the Hamming distance between two hashes.
 // Uses bits.OnesCount64, which compiles to a single POPCNT instruction on
 // supported CPUs. This is the hottest function in perceptual matching
@@ -140,28 +520,17 @@ func HammingDistance(hash1, hash2 uint64) int {
 // HashImageWithTimeout hashes an image with a timeout.
 //
 // Note: image.Decode is not cancellable, so on timeout the worker goroutine
-// runs to completion in the background. Results are passed over a buffered
-// channel so that late completion neither blocks the goroutine nor races with
-// the caller on shared variables.
+// runs to completion in the background. The file is closed on timeout so
+// the decoder's next read fails and the goroutine exits promptly instead of
+// holding the descriptor.
 func (h *Hasher) HashImageWithTimeout(path string, timeout time.Duration) (*models.ImageInfo, error) {
-	type result struct {
-		info *models.ImageInfo
-		err  error
+	file, err := h.open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
-	done := make(chan result, 1) // buffered: goroutine never blocks even after timeout
 
-	go func() {
-		info, err := h.HashImage(path)
-		done <- result{info, err}
-	}()
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	select {
-	case r := <-done:
-		return r.info, r.err
-	case <-timer.C:
-		return nil, fmt.Errorf("timeout hashing image: %s", path)
-	}
+	return withTimeout(timeout, fmt.Errorf("timeout hashing image: %s", path), file.Close, func() (*models.ImageInfo, error) {
+		defer file.Close() // before signalling, so the caller never sees it still open
+		return h.hashFile(path, file)
+	})
 }
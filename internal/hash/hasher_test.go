@@ -1,9 +1,18 @@
 package hash
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"imagedupfinder/internal/models"
 )
@@ -48,6 +57,9 @@ func TestIsSupportedImage(t *testing.T) {
 		{"photo.bmp", true},
 		{"photo.tiff", true},
 		{"photo.tif", true},
+		{"photo.cr2", true},
+		{"photo.NEF", true},
+		{"photo.arw", true},
 		{"document.pdf", false},
 		{"video.mp4", false},
 		{"text.txt", false},
@@ -65,6 +77,32 @@ func TestIsSupportedImage(t *testing.T) {
 	}
 }
 
+func TestParseFormats(t *testing.T) {
+	set, err := ParseFormats(" JPG, .tif ,webp")
+	if err != nil {
+		t.Fatalf("ParseFormats failed: %v", err)
+	}
+	for path, want := range map[string]bool{
+		"a.jpg":  true,
+		"a.jpeg": true,
+		"a.tiff": true,
+		"a.TIF":  true,
+		"a.webp": true,
+		"a.png":  false,
+		"a.cr2":  false,
+	} {
+		if got := set.Supports(path); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	for _, list := range []string{"jpg,heic", "", " , "} {
+		if _, err := ParseFormats(list); err == nil {
+			t.Errorf("ParseFormats(%q) succeeded, want error", list)
+		}
+	}
+}
+
 func TestComputeFileHash(t *testing.T) {
 	// Create temp file with known content
 	tmpDir := t.TempDir()
@@ -94,6 +132,55 @@ func TestComputeFileHash_NonExistent(t *testing.T) {
 	}
 }
 
+func TestHashSizeCollisions(t *testing.T) {
+	dir := t.TempDir()
+	var images []*models.ImageInfo
+	add := func(name string, data []byte) *models.ImageInfo {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		img := &models.ImageInfo{Path: path, FileSize: int64(len(data))}
+		images = append(images, img)
+		return img
+	}
+
+	// Unique sizes: never read
+	for i := 1; i <= 50; i++ {
+		add(fmt.Sprintf("unique%d.jpg", i), bytes.Repeat([]byte{'u'}, 100+i))
+	}
+	// Same size: an identical pair and one that only differs in content
+	copy1 := add("copy1.jpg", bytes.Repeat([]byte{'a'}, 64))
+	copy2 := add("copy2.jpg", bytes.Repeat([]byte{'a'}, 64))
+	other := add("other.jpg", bytes.Repeat([]byte{'b'}, 64))
+
+	var hashed []string
+	computed := HashSizeCollisions(images, func(path string) (string, error) {
+		hashed = append(hashed, filepath.Base(path))
+		return ComputeFileHash(path)
+	})
+
+	if computed != 3 || len(hashed) != 3 {
+		t.Errorf("computed %d hashes (%v), want 3", computed, hashed)
+	}
+	if copy1.FileHash == "" || copy1.FileHash != copy2.FileHash {
+		t.Errorf("identical files: hashes %q and %q", copy1.FileHash, copy2.FileHash)
+	}
+	if other.FileHash == "" || other.FileHash == copy1.FileHash {
+		t.Errorf("same size, different content: hash %q", other.FileHash)
+	}
+	for _, img := range images[:50] {
+		if img.FileHash != "" {
+			t.Errorf("%s has a unique size but was hashed", img.Path)
+		}
+	}
+
+	// Already hashed files are not read again
+	if n := HashSizeCollisions(images, ComputeFileHash); n != 0 {
+		t.Errorf("second pass computed %d hashes, want 0", n)
+	}
+}
+
 func TestCalculateScore(t *testing.T) {
 	h := NewHasher()
 
@@ -193,3 +280,342 @@ func TestHasher_SameImage_IdenticalHash(t *testing.T) {
 		t.Errorf("same image should have identical hash: %d != %d", info1.Hash, info2.Hash)
 	}
 }
+
+// blockingFile blocks every Read until it is closed.
+type blockingFile struct {
+	File
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (f *blockingFile) Read(p []byte) (int, error) {
+	<-f.closed
+	return 0, os.ErrClosed
+}
+
+func (f *blockingFile) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return f.File.Close()
+}
+
+func TestHashImageWithTimeout_ClosesFileOnTimeout(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "slow.png")
+	if err := os.WriteFile(testFile, []byte("not read"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var bf *blockingFile
+	h := NewHasher(WithOpener(func(path string) (File, error) {
+		f, err := OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		bf = &blockingFile{File: f, closed: make(chan struct{})}
+		return bf, nil
+	}))
+
+	if _, err := h.HashImageWithTimeout(testFile, 10*time.Millisecond); err == nil {
+		t.Fatal("expected timeout error")
+	}
+
+	select {
+	case <-bf.closed:
+	case <-time.After(time.Second):
+		t.Fatal("file was not closed after timeout")
+	}
+}
+
+// jpegWithCaptureTime returns a JPEG whose EXIF DateTimeOriginal is dt
+// ("YYYY:MM:DD HH:MM:SS").
+func jpegWithCaptureTime(t *testing.T, dt string) []byte {
+	t.Helper()
+
+	// TIFF: IFD0 holds only the EXIF IFD pointer; the EXIF IFD holds
+	// DateTimeOriginal (ASCII, 20 bytes incl. NUL) stored after it.
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	// IFD0 at 8: 1 entry -> EXIF IFD at 26
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x8769, 4})
+	binary.Write(&tiff, le, []uint32{1, 26})
+	binary.Write(&tiff, le, uint32(0))
+	// EXIF IFD at 26: 1 entry -> string at 44
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x9003, 2})
+	binary.Write(&tiff, le, []uint32{20, 44})
+	binary.Write(&tiff, le, uint32(0))
+	tiff.WriteString(dt + "\x00")
+	return jpegWithExif(t, tiff.Bytes(), 16)
+}
+
+// jpegWithCameraTags returns a size x size JPEG whose IFD0 holds the given
+// ASCII tags, which must be sorted by tag number.
+func jpegWithCameraTags(t *testing.T, size int, tags []struct {
+	tag   uint16
+	value string
+}) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	binary.Write(&tiff, le, uint16(len(tags)))
+	// Strings follow the entries and the next-IFD offset
+	offset := uint32(8 + 2 + 12*len(tags) + 4)
+	var data bytes.Buffer
+	for _, tag := range tags {
+		v := tag.value + "\x00"
+		binary.Write(&tiff, le, []uint16{tag.tag, 2})
+		if len(v) <= 4 {
+			binary.Write(&tiff, le, uint32(len(v)))
+			tiff.Write(append([]byte(v), make([]byte, 4-len(v))...))
+			continue
+		}
+		binary.Write(&tiff, le, []uint32{uint32(len(v)), offset + uint32(data.Len())})
+		data.WriteString(v)
+	}
+	binary.Write(&tiff, le, uint32(0))
+	tiff.Write(data.Bytes())
+	return jpegWithExif(t, tiff.Bytes(), size)
+}
+
+// jpegWithExif returns a size x size black JPEG carrying tiff as its EXIF
+func jpegWithExif(t *testing.T, tiff []byte, size int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert APP1 right after SOI
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	var out bytes.Buffer
+	out.Write(enc.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(enc.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestHashImage_CaptureTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, jpegWithCaptureTime(t, "2019:06:01 08:30:00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := NewHasher().HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	want := time.Date(2019, 6, 1, 8, 30, 0, 0, time.Local)
+	if !info.CaptureTime.Equal(want) {
+		t.Errorf("CaptureTime = %v, want %v", info.CaptureTime, want)
+	}
+	if !info.HasExif {
+		t.Error("HasExif should be true")
+	}
+}
+
+func TestHashImage_OpensFileOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, jpegWithCaptureTime(t, "2019:06:01 08:30:00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opens := 0
+	h := NewHasher(WithBlurHash(), WithOrientations(), WithOpener(func(path string) (File, error) {
+		opens++
+		return OpenFile(path)
+	}))
+	info, err := h.HashImage(path)
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if !info.HasExif || info.CaptureTime.IsZero() {
+		t.Error("EXIF should be read from the same open file as the pixels")
+	}
+	if opens != 1 {
+		t.Errorf("file opened %d times, want once for EXIF and decoding", opens)
+	}
+}
+
+func TestKeepOldestCapture_ExifBeatsModTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	original := filepath.Join(tmpDir, "original.jpg")
+	copied := filepath.Join(tmpDir, "copy.jpg")
+	if err := os.WriteFile(original, jpegWithCaptureTime(t, "2018:01:01 00:00:00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copied, jpegWithCaptureTime(t, "2020:01:01 00:00:00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mod times say the opposite of the capture dates, as after a copy
+	if err := os.Chtimes(original, time.Now(), time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(copied, time.Now(), time.Date(2015, 1, 1, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHasher()
+	var images []*models.ImageInfo
+	for _, path := range []string{copied, original} {
+		info, err := h.HashImage(path)
+		if err != nil {
+			t.Fatalf("HashImage failed: %v", err)
+		}
+		images = append(images, info)
+	}
+
+	group := &models.DuplicateGroup{ID: 1, Images: images}
+	group.SelectKeep(models.KeepOldestCapture)
+	if group.Keep.Path != original {
+		t.Errorf("kept %s, want %s (earliest EXIF capture date)", group.Keep.Path, original)
+	}
+}
+
+func TestKeepOriginalCamera_OriginalBeatsEditedExport(t *testing.T) {
+	type tag = struct {
+		tag   uint16
+		value string
+	}
+	tmpDir := t.TempDir()
+	original := filepath.Join(tmpDir, "IMG_0001.jpg")
+	edited := filepath.Join(tmpDir, "IMG_0001-edit.jpg")
+	// The edited export is upscaled, so it wins on quality alone
+	if err := os.WriteFile(original, jpegWithCameraTags(t, 16, []tag{
+		{0x010F, "Canon"}, {0x0110, "Canon EOS R5"}, {0x0131, "Firmware Version 1.8.1"},
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(edited, jpegWithCameraTags(t, 32, []tag{
+		{0x010F, "Canon"}, {0x0110, "Canon EOS R5"}, {0x0131, "Adobe Photoshop 25.0 (Windows)"},
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHasher()
+	var images []*models.ImageInfo
+	for _, path := range []string{edited, original} {
+		info, err := h.HashImage(path)
+		if err != nil {
+			t.Fatalf("HashImage failed: %v", err)
+		}
+		images = append(images, info)
+	}
+	if got := images[1]; got.CameraMake != "Canon" || got.CameraModel != "Canon EOS R5" || got.Software != "Firmware Version 1.8.1" {
+		t.Errorf("camera tags = %q/%q/%q", got.CameraMake, got.CameraModel, got.Software)
+	}
+
+	group := &models.DuplicateGroup{ID: 1, Images: images}
+	group.SelectKeep()
+	if group.Keep.Path != edited {
+		t.Fatalf("without the policy kept %s, want the larger %s", group.Keep.Path, edited)
+	}
+	group.SelectKeep(models.KeepOriginalCamera)
+	if group.Keep.Path != original {
+		t.Errorf("kept %s, want %s (camera original)", group.Keep.Path, original)
+	}
+}
+
+func TestKeepRichestExif_FullCopyBeatsStripped(t *testing.T) {
+	type tag = struct {
+		tag   uint16
+		value string
+	}
+	tmpDir := t.TempDir()
+	full := filepath.Join(tmpDir, "IMG_0002.jpg")
+	stripped := filepath.Join(tmpDir, "IMG_0002-sent.jpg")
+	if err := os.WriteFile(full, jpegWithCameraTags(t, 16, []tag{
+		{0x010F, "Nikon"}, {0x0110, "Z 6"}, {0x0131, "Ver.1.00"}, {0x013B, "A. Photographer"}, {0x8298, "(c) 2023"},
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The stripped copy is larger, so it wins on quality alone
+	if err := os.WriteFile(stripped, jpegWithCameraTags(t, 32, []tag{
+		{0x010F, "Nikon"},
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHasher()
+	var images []*models.ImageInfo
+	for _, path := range []string{stripped, full} {
+		info, err := h.HashImage(path)
+		if err != nil {
+			t.Fatalf("HashImage failed: %v", err)
+		}
+		images = append(images, info)
+	}
+	if images[0].ExifTagCount != 1 || images[1].ExifTagCount != 5 {
+		t.Errorf("ExifTagCount = %d (stripped), %d (full); want 1, 5", images[0].ExifTagCount, images[1].ExifTagCount)
+	}
+	if models.KeepRichestExif(images[1], images[0]) >= 0 {
+		t.Error("the full copy should rank before the stripped one")
+	}
+
+	group := &models.DuplicateGroup{ID: 1, Images: images}
+	group.SelectKeep()
+	if group.Keep.Path != stripped {
+		t.Fatalf("without the policy kept %s, want the larger %s", group.Keep.Path, stripped)
+	}
+	group.SelectKeep(models.KeepRichestExif)
+	if group.Keep.Path != full {
+		t.Errorf("kept %s, want %s (more EXIF fields)", group.Keep.Path, full)
+	}
+}
+
+func TestHashImage_PalettedPNG(t *testing.T) {
+	dir := t.TempDir()
+	src := colorDocument()
+	paletted := image.NewPaletted(src.Bounds(), palette.Plan9)
+	draw.Draw(paletted, paletted.Bounds(), src, image.Point{}, draw.Src)
+	writePNG(t, filepath.Join(dir, "paletted.png"), paletted)
+	writePNG(t, filepath.Join(dir, "rgba.png"), src)
+
+	h := NewHasher()
+	got, err := h.HashImage(filepath.Join(dir, "paletted.png"))
+	if err != nil {
+		t.Fatalf("HashImage failed on paletted PNG: %v", err)
+	}
+	if got.Width != 200 || got.Height != 160 || got.Format != "png" {
+		t.Errorf("got %dx%d %s, want 200x160 png", got.Width, got.Height, got.Format)
+	}
+	want, err := h.HashImage(filepath.Join(dir, "rgba.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := HammingDistance(got.Hash, want.Hash); d > 2 {
+		t.Errorf("paletted copy is %d bits from the RGBA original", d)
+	}
+}
+
+func TestHashable_ConvertsToRGBA(t *testing.T) {
+	src := colorDocument()
+	// CMYK with a non-zero origin, as a cropped SubImage would have
+	cmyk := image.NewCMYK(image.Rect(10, 10, 210, 170))
+	draw.Draw(cmyk, cmyk.Bounds(), src, image.Point{}, draw.Src)
+
+	got, ok := hashable(cmyk).(*image.RGBA)
+	if !ok {
+		t.Fatalf("hashable(CMYK) = %T, want *image.RGBA", hashable(cmyk))
+	}
+	if got.Bounds() != src.Bounds() {
+		t.Errorf("bounds = %v, want %v", got.Bounds(), src.Bounds())
+	}
+	if r, g, b, _ := got.At(50, 40).RGBA(); r>>8 < 190 || g>>8 > 40 || b>>8 > 40 {
+		t.Errorf("pixel (50,40) = %d,%d,%d, want the red block", r>>8, g>>8, b>>8)
+	}
+	if hashable(src) != image.Image(src) {
+		t.Error("RGBA images should be passed through")
+	}
+}
@@ -0,0 +1,25 @@
+package hash
+
+import "imagedupfinder/internal/models"
+
+// VariantHeader is the HashVariant of images read with WithHeaderOnly,
+// which have no perceptual hash
+const VariantHeader = "header"
+
+// WithHeaderOnly reads only each image's header and EXIF, which gives its
+// dimensions, format and metadata (and so its score) without decoding the
+// pixels: what exact matching by file hash needs, at a fraction of the
+// cost. Hash stays 0 and Sharpness unset, so the results carry
+// VariantHeader and must not be matched perceptually. The options that work
+// on the pixels have no effect alongside it.
+func WithHeaderOnly() Option {
+	return func(h *Hasher) {
+		h.headerOnly = true
+	}
+}
+
+// HasPerceptualHash reports whether img was hashed from its pixels, unlike
+// images read with WithHeaderOnly
+func HasPerceptualHash(img *models.ImageInfo) bool {
+	return img.HashVariant != VariantHeader
+}
@@ -0,0 +1,39 @@
+package hash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHeaderOnly_SkipsPixels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.png")
+	writePNG(t, path, largePhoto(120, 80))
+	// Cut the pixel data short: the header still reads, a full decode fails
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHasher().HashImage(path); err == nil {
+		t.Fatal("decoding the truncated image should fail")
+	}
+	h := NewHasher(WithHeaderOnly(), WithNormalizeLuma())
+	info, err := h.HashImage(path)
+	if err != nil {
+		t.Fatalf("header-only HashImage failed: %v", err)
+	}
+	if info.Width != 120 || info.Height != 80 || info.Hash != 0 || info.HashVariant != VariantHeader {
+		t.Errorf("got %dx%d, hash %016x, variant %q; want 120x80 with no pHash and variant %q",
+			info.Width, info.Height, info.Hash, info.HashVariant, VariantHeader)
+	}
+	if HasPerceptualHash(info) {
+		t.Error("HasPerceptualHash should be false for a header-only image")
+	}
+	if got := NewHasher(VariantOptions(h.Variant())...).Variant(); got != VariantHeader {
+		t.Errorf("VariantOptions round trip gives %q, want %q", got, VariantHeader)
+	}
+}
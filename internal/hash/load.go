@@ -0,0 +1,91 @@
+package hash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"imagedupfinder/internal/models"
+)
+
+// LoadedImage is an image file read into memory by LoadImage, so that it can
+// be decoded and hashed by HashLoaded without holding the file open
+type LoadedImage struct {
+	Path string
+	data []byte
+	stat os.FileInfo
+}
+
+// memFile serves a LoadedImage through the File interface hashFile reads
+type memFile struct {
+	*bytes.Reader
+	stat os.FileInfo
+}
+
+func (f memFile) Stat() (os.FileInfo, error) { return f.stat, nil }
+func (f memFile) Close() error               { return nil }
+
+// LoadImage reads the file at path into memory: the I/O half of
+// HashImageWithTimeout. On timeout the file is closed, as there.
+func (h *Hasher) LoadImage(path string, timeout time.Duration) (*LoadedImage, error) {
+	file, err := h.open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return withTimeout(timeout, fmt.Errorf("timeout reading image: %s", path), file.Close, func() (*LoadedImage, error) {
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		var buf bytes.Buffer
+		buf.Grow(int(stat.Size()))
+		if _, err := io.Copy(&buf, file); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return &LoadedImage{Path: path, data: buf.Bytes(), stat: stat}, nil
+	})
+}
+
+// HashLoaded decodes and hashes an image read by LoadImage: the CPU half of
+// HashImageWithTimeout. Decoding can't be interrupted, so on timeout it runs
+// to completion in the background, but it holds no file while doing so.
+func (h *Hasher) HashLoaded(img *LoadedImage, timeout time.Duration) (*models.ImageInfo, error) {
+	return withTimeout(timeout, fmt.Errorf("timeout hashing image: %s", img.Path), nil, func() (*models.ImageInfo, error) {
+		return h.hashFile(img.Path, memFile{bytes.NewReader(img.data), img.stat})
+	})
+}
+
+// withTimeout runs fn in a goroutine and waits up to timeout for it. On
+// timeout it calls cancel (if set) and returns errTimeout; fn finishes in the
+// background. Its result is passed over a buffered channel so that late
+// completion neither blocks the goroutine nor races with the caller.
+func withTimeout[T any](timeout time.Duration, errTimeout error, cancel func() error, fn func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1) // buffered: goroutine never blocks even after timeout
+
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-timer.C:
+		if cancel != nil {
+			cancel()
+		}
+		var zero T
+		return zero, errTimeout
+	}
+}
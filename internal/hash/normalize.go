@@ -0,0 +1,75 @@
+package hash
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// VariantLuma is the ImageInfo.HashVariant of hashes computed on the
+// normalized luminance image (see WithNormalizeLuma). The standard pHash has
+// variant "".
+const VariantLuma = "luma"
+
+// normalizeSize is the side of the image normalizeLuma produces. pHash
+// downsamples to 64x64 anyway, so normalizing at that size loses nothing.
+const normalizeSize = 64
+
+// WithNormalizeLuma hashes a luminance-normalized version of each image, so
+// color, grayscale and inverted copies of the same picture hash alike.
+// Results carry HashVariant VariantLuma and are not comparable with standard
+// hashes.
+func WithNormalizeLuma() Option {
+	return func(h *Hasher) {
+		h.normalizeLuma = true
+	}
+}
+
+// normalizeLuma downsamples img to grayscale and histogram-equalizes it,
+// which undoes luma-style desaturation and any monotonic tone change (levels,
+// contrast, gamma). Desaturation that reorders tones, such as a plain channel
+// average of strongly colored areas, is not undone. It then picks the
+// polarity whose border is brighter than average, so an inverted copy
+// normalizes to the same image.
+func normalizeLuma(img image.Image) *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, normalizeSize, normalizeSize))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	// Map each level to its mid-rank, which (unlike the usual cumulative
+	// count) is symmetric under inversion
+	var hist [256]int
+	for _, v := range gray.Pix {
+		hist[v]++
+	}
+	total := len(gray.Pix)
+	if hist[gray.Pix[0]] == total {
+		return gray // flat image: nothing to equalize
+	}
+	var level [256]uint8
+	below := 0
+	for v, n := range hist {
+		level[v] = uint8((2*below + n) * 255 / (2 * total))
+		below += n
+	}
+	for i, v := range gray.Pix {
+		gray.Pix[i] = level[v]
+	}
+
+	var all, border, borderN int
+	for y := 0; y < normalizeSize; y++ {
+		for x := 0; x < normalizeSize; x++ {
+			v := int(gray.Pix[y*gray.Stride+x])
+			all += v
+			if x == 0 || y == 0 || x == normalizeSize-1 || y == normalizeSize-1 {
+				border += v
+				borderN++
+			}
+		}
+	}
+	if border*total < all*borderN {
+		for i, v := range gray.Pix {
+			gray.Pix[i] = 255 - v
+		}
+	}
+	return gray
+}
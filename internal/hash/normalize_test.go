@@ -0,0 +1,151 @@
+package hash
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/corona10/goimagehash"
+)
+
+// colorDocument is a synthetic "scanned page": a light background with
+// colored blocks and a diagonal band, varied enough to give a stable pHash.
+func colorDocument() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 160))
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.RGBA{240, 235, 225, 255}
+			switch {
+			case x > 20 && x < 90 && y > 20 && y < 60:
+				c = color.RGBA{200, 30, 30, 255}
+			case x > 110 && x < 180 && y > 30 && y < 130:
+				c = color.RGBA{30, 60, 190, 255}
+			case x > 20 && x < 90 && y > 90 && y < 140:
+				c = color.RGBA{40, 160, 60, 255}
+			case (x+y)%50 < 6:
+				c = color.RGBA{90, 90, 90, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// grayscaleCopy desaturates img with a different tone curve, like a
+// washed-out grayscale scan of the same page.
+func grayscaleCopy(img image.Image, invert bool) *image.Gray {
+	b := img.Bounds()
+	out := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			// Rec. 709 weights, not the Rec. 601 ones pHash uses, with lifted
+			// blacks and a gamma curve
+			lum := (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(bl)) / 0xffff
+			v := uint8(60 + 170*math.Pow(lum, 0.6))
+			if invert {
+				v = 255 - v
+			}
+			out.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return out
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeLuma_GroupsColorAndGrayscale(t *testing.T) {
+	dir := t.TempDir()
+	colored := colorDocument()
+	paths := map[string]image.Image{
+		"color.png":    colored,
+		"gray.png":     grayscaleCopy(colored, false),
+		"inverted.png": grayscaleCopy(colored, true),
+	}
+	for name, img := range paths {
+		writePNG(t, filepath.Join(dir, name), img)
+	}
+
+	hashAll := func(h *Hasher) map[string]uint64 {
+		hashes := make(map[string]uint64)
+		for name := range paths {
+			info, err := h.HashImage(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("HashImage(%s) failed: %v", name, err)
+			}
+			if info.HashVariant != h.Variant() {
+				t.Errorf("%s: HashVariant = %q, want %q", name, info.HashVariant, h.Variant())
+			}
+			hashes[name] = info.Hash
+		}
+		return hashes
+	}
+	raw := hashAll(NewHasher())
+	normalized := hashAll(NewHasher(WithNormalizeLuma()))
+
+	const threshold = 10 // default matching threshold
+	for _, name := range []string{"gray.png", "inverted.png"} {
+		rawDist := HammingDistance(raw["color.png"], raw[name])
+		normDist := HammingDistance(normalized["color.png"], normalized[name])
+		t.Logf("%s: raw distance %d, normalized distance %d", name, rawDist, normDist)
+		if normDist > threshold {
+			t.Errorf("%s: normalized distance %d, want <= %d", name, normDist, threshold)
+		}
+	}
+	if d := HammingDistance(raw["color.png"], raw["inverted.png"]); d <= threshold {
+		t.Errorf("raw hashes of an inverted copy should not match (distance %d)", d)
+	}
+}
+
+func TestNormalizeLuma_KeepsDifferentImagesApart(t *testing.T) {
+	a := colorDocument()
+	b := image.NewRGBA(a.Bounds())
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 200; x++ {
+			b.Set(x, y, a.At(199-x, y)) // mirrored layout
+		}
+	}
+
+	ha, err := goimagehash.PerceptionHash(normalizeLuma(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := goimagehash.PerceptionHash(normalizeLuma(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := HammingDistance(ha.GetHash(), hb.GetHash()); d <= 10 {
+		t.Errorf("different images normalized to close hashes (distance %d)", d)
+	}
+}
+
+func TestNormalizeLuma_FlatImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{10, 200, 30, 255}), image.Point{}, draw.Src)
+
+	gray := normalizeLuma(src)
+	if gray.Bounds().Dx() != normalizeSize || gray.Bounds().Dy() != normalizeSize {
+		t.Fatalf("expected a %dx%d image, got %v", normalizeSize, normalizeSize, gray.Bounds())
+	}
+	first := gray.Pix[0]
+	for _, v := range gray.Pix {
+		if v != first {
+			t.Fatal("a flat image should stay flat")
+		}
+	}
+}
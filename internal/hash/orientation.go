@@ -0,0 +1,81 @@
+package hash
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/corona10/goimagehash"
+	"golang.org/x/image/draw"
+
+	"imagedupfinder/internal/models"
+)
+
+// orientationSample is the side of the square the image is scaled to before
+// it is turned: the size pHash resizes to anyway, so the turned copies hash
+// as the rotated file would
+const orientationSample = 64
+
+// WithOrientations also hashes each decoded image rotated by 90, 180 and 270
+// degrees and mirrored horizontally (ImageInfo OrientationHashes), so that a
+// copy whose pixels were rotated or flipped can be matched. A hash cache
+// entry without them is decoded again.
+func WithOrientations() Option {
+	return func(h *Hasher) {
+		h.orientations = true
+	}
+}
+
+// OrientedDistance returns how far apart a and b are by distance: the
+// smallest distance between any of a's hashes (upright or OrientationHashes)
+// and any of b's, so a rotated or mirrored copy is as close as the
+// orientation it matches, including a composed one (a's mirror against b's
+// 90° turn is a transpose). This is the set the matcher's BK-trees search,
+// which insert and query every orientation. Without orientation hashes it
+// is the distance of the upright hashes.
+func OrientedDistance(a, b *models.ImageInfo, distance func(x, y uint64) int) int {
+	d := distance(a.Hash, b.Hash)
+	for _, h := range a.OrientationHashes {
+		d = min(d, distance(h, b.Hash))
+	}
+	for _, hb := range b.OrientationHashes {
+		d = min(d, distance(a.Hash, hb))
+		for _, ha := range a.OrientationHashes {
+			d = min(d, distance(ha, hb))
+		}
+	}
+	return d
+}
+
+// orientations maps a destination pixel of a turned n×n image to the source
+// pixel it is copied from
+var orientations = []func(x, y, n int) (int, int){
+	func(x, y, n int) (int, int) { return y, n - 1 - x },         // 90° clockwise
+	func(x, y, n int) (int, int) { return n - 1 - x, n - 1 - y }, // 180°
+	func(x, y, n int) (int, int) { return n - 1 - y, x },         // 270° clockwise
+	func(x, y, n int) (int, int) { return n - 1 - x, y },         // mirrored
+}
+
+// orientationHashes returns the pHashes of img turned each way in
+// orientations, in that order
+func orientationHashes(img image.Image) ([]uint64, error) {
+	const n = orientationSample
+	small := image.NewRGBA(image.Rect(0, 0, n, n))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	hashes := make([]uint64, 0, len(orientations))
+	turned := image.NewRGBA(small.Bounds())
+	for _, from := range orientations {
+		for y := range n {
+			for x := range n {
+				sx, sy := from(x, y, n)
+				copy(turned.Pix[turned.PixOffset(x, y):][:4], small.Pix[small.PixOffset(sx, sy):][:4])
+			}
+		}
+		hash, err := goimagehash.PerceptionHash(turned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute orientation hash: %w", err)
+		}
+		hashes = append(hashes, hash.GetHash())
+	}
+	return hashes, nil
+}
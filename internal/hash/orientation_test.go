@@ -0,0 +1,76 @@
+package hash
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+// rotate90 returns img turned 90 degrees clockwise
+func rotate90(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Set(b.Dy()-1-y, x, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// mirror returns img flipped left to right
+func mirror(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Set(b.Dx()-1-x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
+
+func TestOrientations_MatchRotatedCopy(t *testing.T) {
+	dir := t.TempDir()
+	paths := map[string]image.Image{
+		"original.png": colorDocument(),
+		"rotated.png":  rotate90(colorDocument()),
+		"mirrored.png": mirror(colorDocument()),
+	}
+	for name, img := range paths {
+		writePNG(t, filepath.Join(dir, name), img)
+	}
+
+	plain, err := NewHasher().HashImage(filepath.Join(dir, "original.png"))
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if plain.OrientationHashes != nil {
+		t.Errorf("OrientationHashes = %x without WithOrientations, want none", plain.OrientationHashes)
+	}
+
+	h := NewHasher(WithOrientations())
+	original, err := h.HashImage(filepath.Join(dir, "original.png"))
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	if len(original.OrientationHashes) != 4 {
+		t.Fatalf("got %d orientation hashes, want 4", len(original.OrientationHashes))
+	}
+	if original.Hash != plain.Hash {
+		t.Errorf("Hash changed with WithOrientations: %x, want %x", original.Hash, plain.Hash)
+	}
+
+	for name, i := range map[string]int{"rotated.png": 0, "mirrored.png": 3} {
+		dup, err := NewHasher().HashImage(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("HashImage failed: %v", err)
+		}
+		if d := HammingDistance(original.Hash, dup.Hash); d <= 10 {
+			t.Errorf("%s upright: distance %d, want it too far to match without orientations", name, d)
+		}
+		if d := HammingDistance(original.OrientationHashes[i], dup.Hash); d > 4 {
+			t.Errorf("%s: distance %d to the matching orientation hash, want at most 4", name, d)
+		}
+	}
+}
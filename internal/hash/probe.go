@@ -0,0 +1,50 @@
+package hash
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// probeSamples holds a tiny image per supported format, written by the
+// encoders of the same libraries the hasher decodes with
+//
+//go:embed probe/*
+var probeSamples embed.FS
+
+// DecoderProbe is the result of decoding one format's sample
+type DecoderProbe struct {
+	Format string // file extension without the dot, e.g. "webp"
+	Err    error  // nil if the sample decoded
+}
+
+// ProbeDecoders decodes an embedded sample of each supported format and
+// reports which work, sorted by format. RAW files are decoded through their
+// JPEG preview, so the jpeg result covers them.
+func ProbeDecoders() []DecoderProbe {
+	entries, err := probeSamples.ReadDir("probe")
+	if err != nil {
+		return []DecoderProbe{{Format: "samples", Err: err}}
+	}
+
+	var probes []DecoderProbe
+	for _, e := range entries {
+		name := e.Name()
+		probe := DecoderProbe{Format: strings.TrimPrefix(path.Ext(name), ".")}
+		data, err := probeSamples.ReadFile(path.Join("probe", name))
+		if err == nil {
+			_, _, err = DecodeImage(name, bytes.NewReader(data))
+		}
+		if err != nil {
+			probe.Err = fmt.Errorf("failed to decode sample: %w", err)
+		}
+		probes = append(probes, probe)
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].Format < probes[j].Format
+	})
+	return probes
+}
@@ -0,0 +1,21 @@
+package hash
+
+import "testing"
+
+func TestProbeDecoders(t *testing.T) {
+	probes := ProbeDecoders()
+
+	got := make(map[string]bool)
+	for _, p := range probes {
+		if p.Err != nil {
+			t.Errorf("%s: %v", p.Format, p.Err)
+		}
+		got[p.Format] = true
+	}
+	// Every supported extension has a sample (tif covers tiff, jpg covers jpeg)
+	for _, format := range []string{"bmp", "gif", "jpg", "png", "tif", "webp"} {
+		if !got[format] || !IsSupportedImage("x."+format) {
+			t.Errorf("no working probe for %s", format)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rawFormats maps camera RAW extensions to the format name recorded for
+// them. Sensor data is never decoded: these formats are TIFF-based and embed
+// a full-size JPEG preview, which is what gets hashed.
+var rawFormats = map[string]string{
+	".cr2": "cr2",
+	".nef": "nef",
+	".arw": "arw",
+}
+
+// IsRawImage reports whether path has a camera RAW extension
+func IsRawImage(path string) bool {
+	_, ok := rawFormats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// DecodeImage decodes the image read from r. RAW files (by path extension)
+// are decoded from their embedded JPEG preview and reported with the RAW
+// format name rather than "jpeg".
+func DecodeImage(path string, r io.ReadSeeker) (image.Image, string, error) {
+	format, ok := rawFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return image.Decode(r)
+	}
+
+	preview, err := extractRawPreview(r)
+	if err != nil {
+		return nil, "", err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(preview))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode RAW preview: %w", err)
+	}
+	return img, format, nil
+}
+
+// DecodeConfig reads the dimensions and format of the image read from r
+// from its header, without decoding the pixels. RAW files report those of
+// their embedded preview, matching DecodeImage.
+func DecodeConfig(path string, r io.ReadSeeker) (image.Config, string, error) {
+	format, ok := rawFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return image.DecodeConfig(r)
+	}
+
+	preview, err := extractRawPreview(r)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("failed to decode RAW preview: %w", err)
+	}
+	return cfg, format, nil
+}
+
+// TIFF tags that locate embedded JPEG data
+const (
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+	tagExifIFD         = 0x8769
+
+	compressionOldJPEG = 6
+
+	// maxIFDs bounds the IFD walk so corrupt or cyclic offsets can't loop
+	maxIFDs = 64
+)
+
+var errNoRawPreview = errors.New("no embedded JPEG preview found")
+
+// rawCandidate is a byte range that may hold a JPEG stream
+type rawCandidate struct {
+	offset, length int64
+}
+
+// extractRawPreview walks the TIFF structure of a RAW file (IFD chain,
+// SubIFDs and the EXIF IFD) and returns the largest embedded JPEG that the
+// standard decoder accepts. Some candidates are unusable lossless-JPEG sensor
+// data (e.g. CR2's raw strip), so each is checked with DecodeConfig first.
+func extractRawPreview(r io.ReadSeeker) ([]byte, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RAW file: %w", err)
+	}
+
+	var header [8]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read RAW file: %w", err)
+	}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF-based RAW file")
+	}
+	if order.Uint16(header[2:4]) != 42 {
+		return nil, fmt.Errorf("not a TIFF-based RAW file")
+	}
+
+	candidates := collectRawCandidates(r, order, int64(order.Uint32(header[4:8])), size)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].length > candidates[j].length
+	})
+
+	for _, c := range candidates {
+		if _, err := r.Seek(c.offset, io.SeekStart); err != nil {
+			continue
+		}
+		if _, err := jpeg.DecodeConfig(io.LimitReader(r, c.length)); err != nil {
+			continue
+		}
+		if _, err := r.Seek(c.offset, io.SeekStart); err != nil {
+			continue
+		}
+		data := make([]byte, c.length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			continue
+		}
+		return data, nil
+	}
+
+	return nil, errNoRawPreview
+}
+
+// collectRawCandidates returns every JPEG-looking byte range referenced from
+// the IFD tree rooted at first. Unreadable IFDs are skipped.
+func collectRawCandidates(r io.ReadSeeker, order binary.ByteOrder, first, size int64) []rawCandidate {
+	var candidates []rawCandidate
+	visited := make(map[int64]bool)
+	queue := []int64{first}
+
+	for len(queue) > 0 && len(visited) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset <= 0 || offset >= size || visited[offset] {
+			continue
+		}
+		visited[offset] = true
+
+		tags, next, err := readIFD(r, order, offset)
+		if err != nil {
+			continue
+		}
+		queue = append(queue, next)
+
+		if off, ok := tags[tagJPEGOffset]; ok && len(off) == 1 {
+			if n, ok := tags[tagJPEGLength]; ok && len(n) == 1 {
+				candidates = append(candidates, rawCandidate{int64(off[0]), int64(n[0])})
+			}
+		}
+		if c, ok := tags[tagCompression]; ok && len(c) == 1 && c[0] == compressionOldJPEG {
+			off, n := tags[tagStripOffsets], tags[tagStripByteCounts]
+			if len(off) == 1 && len(n) == 1 {
+				candidates = append(candidates, rawCandidate{int64(off[0]), int64(n[0])})
+			}
+		}
+		for _, sub := range tags[tagSubIFDs] {
+			queue = append(queue, int64(sub))
+		}
+		if exif, ok := tags[tagExifIFD]; ok && len(exif) == 1 {
+			queue = append(queue, int64(exif[0]))
+		}
+	}
+
+	valid := candidates[:0]
+	for _, c := range candidates {
+		if c.offset > 0 && c.length > 0 && c.offset+c.length <= size {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+// readIFD reads the IFD at offset and returns the integer values of the tags
+// extractRawPreview cares about, plus the offset of the next IFD.
+func readIFD(r io.ReadSeeker, order binary.ByteOrder, offset int64) (map[uint16][]uint32, int64, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var countBuf [2]byte
+	if _, err := io.ReadFull(r, countBuf[:]); err != nil {
+		return nil, 0, err
+	}
+	count := int(order.Uint16(countBuf[:]))
+
+	entries := make([]byte, count*12+4)
+	if _, err := io.ReadFull(r, entries); err != nil {
+		return nil, 0, err
+	}
+
+	tags := make(map[uint16][]uint32)
+	for i := 0; i < count; i++ {
+		e := entries[i*12 : i*12+12]
+		tag := order.Uint16(e[0:2])
+		switch tag {
+		case tagCompression, tagStripOffsets, tagStripByteCounts, tagSubIFDs,
+			tagJPEGOffset, tagJPEGLength, tagExifIFD:
+		default:
+			continue
+		}
+		values, err := readIFDValues(r, order, order.Uint16(e[2:4]), order.Uint32(e[4:8]), e[8:12])
+		if err != nil {
+			continue
+		}
+		tags[tag] = values
+	}
+
+	next := int64(order.Uint32(entries[count*12:]))
+	return tags, next, nil
+}
+
+// readIFDValues decodes a SHORT or LONG (or IFD) entry. Values that fit in
+// four bytes are stored inline; larger arrays live at the offset in field.
+func readIFDValues(r io.ReadSeeker, order binary.ByteOrder, typ uint16, count uint32, field []byte) ([]uint32, error) {
+	var width int
+	switch typ {
+	case 3: // SHORT
+		width = 2
+	case 4, 13: // LONG, IFD
+		width = 4
+	default:
+		return nil, fmt.Errorf("unsupported TIFF type %d", typ)
+	}
+	if count == 0 || count > 1024 {
+		return nil, fmt.Errorf("unexpected TIFF value count %d", count)
+	}
+
+	data := field
+	if total := int(count) * width; total > 4 {
+		if _, err := r.Seek(int64(order.Uint32(field)), io.SeekStart); err != nil {
+			return nil, err
+		}
+		data = make([]byte, total)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		if width == 2 {
+			values[i] = uint32(order.Uint16(data[i*2:]))
+		} else {
+			values[i] = order.Uint32(data[i*4:])
+		}
+	}
+	return values, nil
+}
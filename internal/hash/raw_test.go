@@ -0,0 +1,140 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ifdEntry is a single LONG/SHORT TIFF tag for buildRaw
+type ifdEntry struct {
+	tag, typ uint16
+	value    uint32
+}
+
+// buildRaw assembles a minimal little-endian TIFF-based RAW: one IFD whose
+// entries are produced by entries(dataStart), followed by blobs.
+func buildRaw(entries func(dataStart uint32) []ifdEntry, numEntries int, blobs ...[]byte) []byte {
+	dataStart := uint32(8 + 2 + numEntries*12 + 4)
+
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, binary.LittleEndian, uint16(42))
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+
+	es := entries(dataStart)
+	binary.Write(&buf, binary.LittleEndian, uint16(len(es)))
+	for _, e := range es {
+		binary.Write(&buf, binary.LittleEndian, e.tag)
+		binary.Write(&buf, binary.LittleEndian, e.typ)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, e.value)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // no next IFD
+
+	for _, b := range blobs {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func testPreviewJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHashImage_RawPreview(t *testing.T) {
+	tmpDir := t.TempDir()
+	preview := testPreviewJPEG(t)
+
+	// Larger lossless-JPEG "sensor data" strip that the standard decoder
+	// rejects; the smaller preview must be chosen instead.
+	sensor := append([]byte{0xFF, 0xD8, 0xFF, 0xC3}, make([]byte, len(preview)+1000)...)
+
+	raw := buildRaw(func(start uint32) []ifdEntry {
+		return []ifdEntry{
+			{tagCompression, 3, compressionOldJPEG},
+			{tagStripOffsets, 4, start + uint32(len(preview))},
+			{tagStripByteCounts, 4, uint32(len(sensor))},
+			{tagJPEGOffset, 4, start},
+			{tagJPEGLength, 4, uint32(len(preview))},
+		}
+	}, 5, preview, sensor)
+
+	rawPath := filepath.Join(tmpDir, "IMG_0001.CR2")
+	jpgPath := filepath.Join(tmpDir, "preview.jpg")
+	if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jpgPath, preview, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHasher()
+	rawInfo, err := h.HashImage(rawPath)
+	if err != nil {
+		t.Fatalf("HashImage(raw) failed: %v", err)
+	}
+	jpgInfo, err := h.HashImage(jpgPath)
+	if err != nil {
+		t.Fatalf("HashImage(jpg) failed: %v", err)
+	}
+
+	if rawInfo.Hash != jpgInfo.Hash {
+		t.Errorf("RAW hash = %x, want preview hash %x", rawInfo.Hash, jpgInfo.Hash)
+	}
+	if rawInfo.Width != 64 || rawInfo.Height != 48 {
+		t.Errorf("dimensions = %dx%d, want 64x48", rawInfo.Width, rawInfo.Height)
+	}
+	if rawInfo.Format != "cr2" {
+		t.Errorf("Format = %q, want cr2", rawInfo.Format)
+	}
+	if rawInfo.FileSize != int64(len(raw)) {
+		t.Errorf("FileSize = %d, want RAW file size %d", rawInfo.FileSize, len(raw))
+	}
+}
+
+func TestHashImage_RawWithoutPreview(t *testing.T) {
+	raw := buildRaw(func(start uint32) []ifdEntry {
+		return []ifdEntry{
+			{tagCompression, 3, 1}, // uncompressed
+			{tagStripOffsets, 4, start},
+			{tagStripByteCounts, 4, 16},
+		}
+	}, 3, make([]byte, 16))
+
+	rawPath := filepath.Join(t.TempDir(), "DSC_0001.nef")
+	if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHasher().HashImage(rawPath); err == nil {
+		t.Error("expected error for RAW without preview")
+	}
+}
+
+func TestHashImage_RawNotTIFF(t *testing.T) {
+	rawPath := filepath.Join(t.TempDir(), "broken.arw")
+	if err := os.WriteFile(rawPath, []byte("definitely not a tiff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHasher().HashImage(rawPath); err == nil {
+		t.Error("expected error for non-TIFF RAW")
+	}
+}
@@ -0,0 +1,39 @@
+package hash
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// sharpnessSample is the side of the grayscale square Sharpness measures.
+// The fixed size makes copies of one picture at different resolutions
+// comparable.
+const sharpnessSample = 256
+
+// Sharpness estimates how sharp img is: the variance of the Laplacian of a
+// downscaled grayscale copy. Blur removes the fine edges the Laplacian
+// responds to, so of two frames of one scene the sharper scores higher. The
+// values only compare between versions of the same picture; a flat image is
+// 0.
+func Sharpness(img image.Image) float64 {
+	const n = sharpnessSample
+	gray := image.NewGray(image.Rect(0, 0, n, n))
+	// ApproxBiLinear samples rather than averages the source, which keeps
+	// fine detail from being smoothed away by the downscale itself
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var sum, sumSq float64
+	for y := 1; y < n-1; y++ {
+		for x := 1; x < n-1; x++ {
+			i := gray.PixOffset(x, y)
+			lap := 4*float64(gray.Pix[i]) - float64(gray.Pix[i-1]) - float64(gray.Pix[i+1]) -
+				float64(gray.Pix[i-gray.Stride]) - float64(gray.Pix[i+gray.Stride])
+			sum += lap
+			sumSq += lap * lap
+		}
+	}
+	count := float64((n - 2) * (n - 2))
+	mean := sum / count
+	return sumSq/count - mean*mean
+}
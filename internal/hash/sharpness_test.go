@@ -0,0 +1,76 @@
+package hash
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"imagedupfinder/internal/models"
+)
+
+// blurred returns img scaled by factor with a box blur of the given radius,
+// as a soft, upscaled frame of the same scene
+func blurred(img image.Image, factor, radius int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx()*factor, b.Dy()*factor
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, n uint32
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					sx := min(max((x+dx)/factor, 0), b.Dx()-1)
+					sy := min(max((y+dy)/factor, 0), b.Dy()-1)
+					cr, cg, cb, _ := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r, g, bl, n = r+cr>>8, g+cg>>8, bl+cb>>8, n+1
+				}
+			}
+			out.Set(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return out
+}
+
+func TestSharpness(t *testing.T) {
+	sharp := Sharpness(colorDocument())
+	soft := Sharpness(blurred(colorDocument(), 1, 3))
+	if sharp <= soft {
+		t.Errorf("Sharpness: sharp %.1f, blurred %.1f; want sharp higher", sharp, soft)
+	}
+	if got := Sharpness(image.NewUniform(color.Gray{128})); got != 0 {
+		t.Errorf("Sharpness of a flat image = %v, want 0", got)
+	}
+}
+
+func TestKeepSharpest_SharpBeatsBlurredUpscale(t *testing.T) {
+	tmpDir := t.TempDir()
+	sharpPath := filepath.Join(tmpDir, "burst_01.png")
+	softPath := filepath.Join(tmpDir, "burst_02.png")
+	// The blurred frame is upscaled, so it wins on quality alone
+	writePNG(t, sharpPath, colorDocument())
+	writePNG(t, softPath, blurred(colorDocument(), 2, 2))
+
+	h := NewHasher()
+	var images []*models.ImageInfo
+	for _, path := range []string{softPath, sharpPath} {
+		info, err := h.HashImage(path)
+		if err != nil {
+			t.Fatalf("HashImage failed: %v", err)
+		}
+		images = append(images, info)
+	}
+	if d := HammingDistance(images[0].Hash, images[1].Hash); d > 10 {
+		t.Fatalf("frames are %d apart, want them to group", d)
+	}
+
+	group := &models.DuplicateGroup{ID: 1, Images: images}
+	group.SelectKeep()
+	if group.Keep.Path != softPath {
+		t.Fatalf("without the policy kept %s, want the larger %s", group.Keep.Path, softPath)
+	}
+	group.SelectKeep(models.KeepSharpest)
+	if group.Keep.Path != sharpPath {
+		t.Errorf("kept %s (sharpness %.1f vs %.1f), want %s", group.Keep.Path, images[0].Sharpness, images[1].Sharpness, sharpPath)
+	}
+}
@@ -0,0 +1,29 @@
+package hash
+
+import "image"
+
+// SniffFormat reads the header of the file at path and returns the
+// extension of the image format it holds (".png", ".jpeg", ...), whatever
+// the file is named. Only formats Go decodes directly are recognized; RAW
+// files are told by their extension.
+func SniffFormat(path string) (string, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", err
+	}
+	return "." + format, nil
+}
+
+// SupportsContent reports whether the file at path holds an image in a
+// format of the set, judged by its first bytes rather than its name. It
+// opens the file, so it is meant for files Supports turned down.
+func (s FormatSet) SupportsContent(path string) bool {
+	ext, err := SniffFormat(path)
+	return err == nil && s[ext]
+}
@@ -0,0 +1,46 @@
+package hash
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(dir, "photo.dat")
+	bare := filepath.Join(dir, "photo")
+	text := filepath.Join(dir, "notes.png")
+	for path, data := range map[string][]byte{renamed: buf.Bytes(), bare: buf.Bytes(), text: []byte("not an image")} {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{renamed, bare} {
+		if ext, err := SniffFormat(path); err != nil || ext != ".png" {
+			t.Errorf("SniffFormat(%s) = %q, %v; want .png", filepath.Base(path), ext, err)
+		}
+		if !AllFormats().SupportsContent(path) {
+			t.Errorf("%s not supported by content", filepath.Base(path))
+		}
+	}
+	if _, err := SniffFormat(text); err == nil {
+		t.Error("SniffFormat recognized a text file named .png")
+	}
+
+	jpegOnly, err := ParseFormats("jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jpegOnly.SupportsContent(renamed) {
+		t.Error("a PNG passed a jpg-only set")
+	}
+}
@@ -0,0 +1,99 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+
+	"imagedupfinder/internal/models"
+)
+
+// ErrNotDuplicate is returned by Verifier.Verify when the files on disk no
+// longer match
+var ErrNotDuplicate = errors.New("not a duplicate")
+
+// Verifier re-reads files right before they are removed to confirm they
+// still duplicate the image kept in their group: byte for byte for exact
+// groups, within a hash distance for perceptual ones. Hashes are memoized by
+// path, so a kept image is read once however many copies it has.
+type Verifier struct {
+	fileHashes map[string]string
+	pHashes    map[string]*models.ImageInfo
+}
+
+// NewVerifier creates a Verifier
+func NewVerifier() *Verifier {
+	return &Verifier{
+		fileHashes: make(map[string]string),
+		pHashes:    make(map[string]*models.ImageInfo),
+	}
+}
+
+// Verify checks that remove still duplicates keep. For models.MatchExact
+// their SHA-256 must be equal; otherwise their perceptual hashes, computed
+// afresh in remove's HashVariant, must be at most maxDistance apart. When
+// either image was stored with OrientationHashes (scan --detect-rotations),
+// both are hashed with WithOrientations and measured by OrientedDistance, as
+// the matcher grouped them, so a rotated or mirrored copy still verifies. A
+// mismatch wraps ErrNotDuplicate; failing to read either file is returned as
+// is.
+func (v *Verifier) Verify(keep, remove *models.ImageInfo, method string, maxDistance int) error {
+	if method == models.MatchExact {
+		a, err := v.fileHash(keep.Path)
+		if err != nil {
+			return err
+		}
+		b, err := v.fileHash(remove.Path)
+		if err != nil {
+			return err
+		}
+		if a != b {
+			return fmt.Errorf("%w: content differs from %s", ErrNotDuplicate, keep.Path)
+		}
+		return nil
+	}
+
+	opts := VariantOptions(remove.HashVariant)
+	if len(keep.OrientationHashes) > 0 || len(remove.OrientationHashes) > 0 {
+		opts = append(opts, WithOrientations())
+	}
+	h := NewHasher(opts...)
+	a, err := v.pHash(h, keep.Path)
+	if err != nil {
+		return err
+	}
+	b, err := v.pHash(h, remove.Path)
+	if err != nil {
+		return err
+	}
+	if d := OrientedDistance(a, b, HammingDistance); d > maxDistance {
+		return fmt.Errorf("%w: distance %d from %s exceeds %d", ErrNotDuplicate, d, keep.Path, maxDistance)
+	}
+	return nil
+}
+
+func (v *Verifier) fileHash(path string) (string, error) {
+	if sum, ok := v.fileHashes[path]; ok {
+		return sum, nil
+	}
+	sum, err := ComputeFileHash(path)
+	if err != nil {
+		return "", err
+	}
+	v.fileHashes[path] = sum
+	return sum, nil
+}
+
+// pHash memoizes by path, variant and orientations, as one image can be
+// compared in several
+func (v *Verifier) pHash(h *Hasher, path string) (*models.ImageInfo, error) {
+	key := fmt.Sprintf("%s/%t\x00%s", h.Variant(), h.orientations, path)
+	if info, ok := v.pHashes[key]; ok {
+		return info, nil
+	}
+	info, err := h.HashImage(path)
+	if err != nil {
+		return nil, err
+	}
+	v.pHashes[key] = info
+	return info, nil
+}
@@ -0,0 +1,77 @@
+package hash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"imagedupfinder/internal/models"
+)
+
+func TestVerifier_Exact(t *testing.T) {
+	dir := t.TempDir()
+	keep := &models.ImageInfo{Path: filepath.Join(dir, "keep.jpg")}
+	remove := &models.ImageInfo{Path: filepath.Join(dir, "copy.jpg")}
+	for _, img := range []*models.ImageInfo{keep, remove} {
+		if err := os.WriteFile(img.Path, []byte("same bytes"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewVerifier().Verify(keep, remove, models.MatchExact, 0); err != nil {
+		t.Fatalf("identical files failed verification: %v", err)
+	}
+
+	// Overwritten since the scan: same size, different bytes
+	if err := os.WriteFile(remove.Path, []byte("same bytez"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewVerifier().Verify(keep, remove, models.MatchExact, 0); !errors.Is(err, ErrNotDuplicate) {
+		t.Errorf("tampered file: got %v, want ErrNotDuplicate", err)
+	}
+
+	// The kept file is gone: not verified either, so the copy is kept too
+	os.Remove(keep.Path)
+	if err := NewVerifier().Verify(keep, remove, models.MatchExact, 0); err == nil {
+		t.Error("verification should fail when the kept file is missing")
+	}
+}
+
+func TestVerifier_Perceptual(t *testing.T) {
+	dir := t.TempDir()
+	keep := &models.ImageInfo{Path: filepath.Join(dir, "keep.png")}
+	remove := &models.ImageInfo{Path: filepath.Join(dir, "copy.png")}
+	writePNG(t, keep.Path, colorDocument())
+	writePNG(t, remove.Path, colorDocument())
+
+	v := NewVerifier()
+	if err := v.Verify(keep, remove, models.MatchPerceptual, 10); err != nil {
+		t.Fatalf("matching images failed verification: %v", err)
+	}
+
+	// Replaced by a different picture; a fresh Verifier re-reads it
+	writePNG(t, remove.Path, grayscaleCopy(colorDocument(), true))
+	if err := NewVerifier().Verify(keep, remove, models.MatchPerceptual, 10); !errors.Is(err, ErrNotDuplicate) {
+		t.Errorf("replaced image: got %v, want ErrNotDuplicate", err)
+	}
+}
+
+func TestVerifier_MirroredCopy(t *testing.T) {
+	dir := t.TempDir()
+	// Grouped by scan --detect-rotations, which stored orientation hashes
+	keep := &models.ImageInfo{Path: filepath.Join(dir, "keep.png"), OrientationHashes: []uint64{1, 2, 3, 4}}
+	remove := &models.ImageInfo{Path: filepath.Join(dir, "mirrored.png"), OrientationHashes: []uint64{1, 2, 3, 4}}
+	writePNG(t, keep.Path, colorDocument())
+	writePNG(t, remove.Path, mirror(colorDocument()))
+
+	if err := NewVerifier().Verify(keep, remove, models.MatchPerceptual, 10); err != nil {
+		t.Errorf("mirrored copy failed verification: %v", err)
+	}
+
+	// Without orientation hashes only the upright pHashes are compared
+	keep.OrientationHashes, remove.OrientationHashes = nil, nil
+	if err := NewVerifier().Verify(keep, remove, models.MatchPerceptual, 10); !errors.Is(err, ErrNotDuplicate) {
+		t.Errorf("mirrored copy without orientations: got %v, want ErrNotDuplicate", err)
+	}
+}
@@ -0,0 +1,40 @@
+package hash
+
+import "math/bits"
+
+// pHashBitWeights holds, for each bit of a pHash, its weight in quarter
+// bits. goimagehash sets bit 63-i from the i-th coefficient of the 8x8 DCT
+// block in row-major order, so the most significant bits are the lowest
+// frequencies: the overall shapes and tones a resize or re-encode keeps.
+// High frequencies carry fine detail and noise.
+var pHashBitWeights = func() [64]int {
+	var w [64]int
+	for i := range w {
+		switch u, v := i/8, i%8; {
+		case u+v <= 2:
+			w[63-i] = 6 // 1.5 bits
+		case u+v <= 6:
+			w[63-i] = 4 // 1 bit
+		default:
+			w[63-i] = 3 // 0.75 bits
+		}
+	}
+	return w
+}()
+
+// WeightedHammingDistance is a Hamming distance between two pHashes in
+// which a differing low-frequency bit counts 1.5, a mid-frequency bit 1 and
+// a high-frequency bit 0.75, rounded up. Like HammingDistance it is a metric
+// in roughly the same units, so it can replace it in a BK-tree with the same
+// thresholds.
+func WeightedHammingDistance(hash1, hash2 uint64) int {
+	diff := hash1 ^ hash2
+	quarters := 0
+	for diff != 0 {
+		bit := bits.TrailingZeros64(diff)
+		quarters += pHashBitWeights[bit]
+		diff &= diff - 1
+	}
+	// Rounding up keeps the triangle inequality: ceil(a+b) <= ceil(a)+ceil(b)
+	return (quarters + 3) / 4
+}
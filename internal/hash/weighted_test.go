@@ -0,0 +1,44 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestWeightedHammingDistance(t *testing.T) {
+	const dc = uint64(1) << 63        // coefficient (0,0)
+	const finest = uint64(1)          // coefficient (7,7)
+	const mid = uint64(1) << (63 - 3) // coefficient (0,3)
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, dc, 2},          // 1.5 rounded up
+		{0, dc | finest, 3}, // 2.25
+		{0, mid, 1},
+		{0, 0xF, 3},         // four high-frequency bits
+		{0, ^uint64(0), 58}, // 6*1.5 + 22*1 + 36*0.75
+	}
+	for _, tt := range tests {
+		if got := WeightedHammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("WeightedHammingDistance(%#x, %#x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedHammingDistance_IsMetric(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b := r.Uint64(), r.Uint64()
+		// Nearby hashes exercise the rounding
+		c := b ^ uint64(1)<<r.Intn(64)
+		ab, bc, ac := WeightedHammingDistance(a, b), WeightedHammingDistance(b, c), WeightedHammingDistance(a, c)
+		if ab != WeightedHammingDistance(b, a) {
+			t.Fatalf("not symmetric for %#x, %#x", a, b)
+		}
+		if ac > ab+bc {
+			t.Fatalf("triangle inequality violated: d(a,c)=%d > %d+%d", ac, ab, bc)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package importer loads perceptual hashes computed by other tools into the
+// database, so that a library hashed elsewhere can be grouped without
+// decoding its images again.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+)
+
+// FormatCSV is the only import format so far: a header row naming the
+// columns, then one row per image
+const FormatCSV = "csv"
+
+// csvColumns maps the accepted header names to the field they fill. Only
+// path and hash are required.
+var csvColumns = map[string]string{
+	"path":      "path",
+	"file":      "path",
+	"hash":      "hash",
+	"phash":     "hash",
+	"size":      "size",
+	"file_size": "size",
+	"mtime":     "mtime",
+	"mod_time":  "mtime",
+	"width":     "width",
+	"height":    "height",
+}
+
+// Skip is a row left out of an import, e.g. because its file is missing
+type Skip struct {
+	Line int
+	Path string
+	Err  error
+}
+
+// ReadCSV parses rows of path and hash (plus optional size, mtime, width and
+// height columns) from r. Relative paths are resolved against base. Each
+// file is stat'ed, and its header read for the format and any dimensions
+// the row lacks; pixels are never decoded. Rows whose file can't be read are
+// returned as skips, while a malformed value fails the whole import.
+func ReadCSV(r io.Reader, base string) ([]*models.ImageInfo, []Skip, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		if field, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			cols[field] = i
+		}
+	}
+	for _, field := range []string{"path", "hash"} {
+		if _, ok := cols[field]; !ok {
+			return nil, nil, fmt.Errorf("header has no %s column", field)
+		}
+	}
+
+	var (
+		images []*models.ImageInfo
+		skips  []Skip
+	)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		value := func(field string) string {
+			if i, ok := cols[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		path := value("path")
+		if path == "" {
+			return nil, nil, fmt.Errorf("line %d: empty path", line)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(base, path)
+		}
+		img, err := parseRow(path, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := stat(img); err != nil {
+			skips = append(skips, Skip{Line: line, Path: path, Err: err})
+			continue
+		}
+		images = append(images, img)
+	}
+	return images, skips, nil
+}
+
+// parseRow builds the image of one row from the values given in it
+func parseRow(path string, value func(field string) string) (*models.ImageInfo, error) {
+	img := &models.ImageInfo{Path: path}
+	var err error
+	if img.Hash, err = ParseHash(value("hash")); err != nil {
+		return nil, err
+	}
+	if s := value("size"); s != "" {
+		if img.FileSize, err = strconv.ParseInt(s, 10, 64); err != nil || img.FileSize < 0 {
+			return nil, fmt.Errorf("invalid size %q", s)
+		}
+	}
+	if s := value("mtime"); s != "" {
+		if img.ModTime, err = parseModTime(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, dim := range []struct {
+		field string
+		dst   *int
+	}{{"width", &img.Width}, {"height", &img.Height}} {
+		if s := value(dim.field); s != "" {
+			if *dim.dst, err = strconv.Atoi(s); err != nil || *dim.dst < 0 {
+				return nil, fmt.Errorf("invalid %s %q", dim.field, s)
+			}
+		}
+	}
+	return img, nil
+}
+
+// stat fills in what the row left out of img from the file itself: size and
+// modification time from the file system, format and dimensions from the
+// image header
+func stat(img *models.ImageInfo) error {
+	info, err := hash.Stat(img.Path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("is a directory")
+	}
+	if img.FileSize == 0 {
+		img.FileSize = info.Size()
+	}
+	if img.ModTime.IsZero() {
+		img.ModTime = info.ModTime()
+	}
+
+	f, err := hash.OpenFile(img.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, format, err := hash.DecodeConfig(img.Path, f)
+	if err != nil {
+		return fmt.Errorf("failed to read image header: %w", err)
+	}
+	img.Format = strings.ToLower(format)
+	if img.Width == 0 || img.Height == 0 {
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+	img.Score = hash.NewHasher().CalculateScore(img)
+	return nil
+}
+
+// ParseHash parses a 64-bit perceptual hash as written by another tool. It
+// is read as hexadecimal when it has a 0x prefix, is 16 digits long (the
+// usual rendering of a 64-bit hash) or contains the letters a-f, and as
+// decimal otherwise. goimagehash's "p:" prefix is accepted.
+func ParseHash(s string) (uint64, error) {
+	digits := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "p:"))
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		digits, base = digits[2:], 16
+	case len(digits) == 16 || strings.ContainsAny(digits, "abcdef"):
+		base = 16
+	}
+	h, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q", s)
+	}
+	return h, nil
+}
+
+// parseModTime reads an RFC 3339 time or Unix seconds
+func parseModTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid mtime %q: want RFC 3339 or Unix seconds", s)
+}
+
+// Store is the storage Import saves images to and groups them in
+type Store interface {
+	match.GroupStore
+	SaveImages(images []*models.ImageInfo) error
+}
+
+// Import saves images to store and regroups every stored image with m, as
+// regroup does. Returns the new groups and the number of images matched.
+func Import(store Store, m match.Matcher, images []*models.ImageInfo) ([]*models.DuplicateGroup, int, error) {
+	if err := store.SaveImages(images); err != nil {
+		return nil, 0, fmt.Errorf("failed to save images: %w", err)
+	}
+	return match.Regroup(store, m)
+}
@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/storage"
+)
+
+func writePNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImport_CSV(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "a.png"), 40, 30)
+	writePNG(t, filepath.Join(dir, "b.png"), 20, 15)
+	writePNG(t, filepath.Join(dir, "c.png"), 40, 30)
+
+	// a and b are 1 apart (hex and decimal spellings), c is far from both;
+	// b's row gives its dimensions, the others are read from the header
+	csv := strings.Join([]string{
+		"path,phash,width,height",
+		"a.png,00000000000000ff,,",
+		filepath.Join(dir, "b.png") + ",254,800,600",
+		"c.png,0xffffffff00000000,,",
+		"missing.png,00000000000000ff,,",
+	}, "\n")
+	images, skips, err := ReadCSV(strings.NewReader(csv), dir)
+	if err != nil {
+		t.Fatalf("ReadCSV failed: %v", err)
+	}
+	if len(skips) != 1 || skips[0].Line != 5 || !os.IsNotExist(skips[0].Err) {
+		t.Errorf("skips = %+v, want missing.png on line 5", skips)
+	}
+
+	store, err := storage.NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	groups, matched, err := Import(store, match.NewPerceptualMatcher(10), images)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if matched != 3 || len(groups) != 1 {
+		t.Fatalf("matched %d images into %d groups, want 3 into 1", matched, len(groups))
+	}
+
+	stored, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	byName := make(map[string]int)
+	for i, img := range stored {
+		byName[filepath.Base(img.Path)] = i
+	}
+	if len(stored) != 3 {
+		t.Fatalf("stored %d images, want 3", len(stored))
+	}
+	a, b := stored[byName["a.png"]], stored[byName["b.png"]]
+	if a.Hash != 0xff || a.Width != 40 || a.Height != 30 || a.Format != "png" || a.FileSize == 0 {
+		t.Errorf("a = %x %dx%d %s %d bytes, want ff 40x30 png from the file", a.Hash, a.Width, a.Height, a.Format, a.FileSize)
+	}
+	if b.Hash != 254 || b.Width != 800 || b.Height != 600 {
+		t.Errorf("b = %d %dx%d, want 254 800x600 from the CSV", b.Hash, b.Width, b.Height)
+	}
+
+	dbGroups, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(dbGroups) != 1 || len(dbGroups[0].Images) != 2 {
+		t.Fatalf("stored groups = %d, want one of a and b", len(dbGroups))
+	}
+	if keep := filepath.Base(dbGroups[0].Keep.Path); keep != "b.png" {
+		t.Errorf("kept %s, want b.png (larger by the CSV's dimensions)", keep)
+	}
+}
+
+func TestParseHash(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"00000000000000ff", 0xff},
+		{"0xFF", 0xff},
+		{"p:8000000000000001", 0x8000000000000001},
+		{"ff3a", 0xff3a},
+		{"255", 255},
+		{"18446744073709551615", 1<<64 - 1},
+	}
+	for _, tt := range tests {
+		got, err := ParseHash(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseHash(%q) = %x, %v; want %x", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "0x", "not-a-hash", "123456789012345678901"} {
+		if _, err := ParseHash(bad); err == nil {
+			t.Errorf("ParseHash(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestReadCSV_InvalidHashFailsWithLine(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "a.png"), 4, 4)
+	_, _, err := ReadCSV(strings.NewReader("path,hash\na.png,zz\n"), dir)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want an invalid hash on line 2", err)
+	}
+	if _, _, err := ReadCSV(strings.NewReader("file,size\na.png,1\n"), dir); err == nil {
+		t.Error("ReadCSV accepted a header without a hash column")
+	}
+}
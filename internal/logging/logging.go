@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Level controls which messages a Logger emits
+type Level int
+
+const (
+	// LevelQuiet emits only command output and errors
+	LevelQuiet Level = iota
+	// LevelNormal additionally emits progress and summaries
+	LevelNormal
+	// LevelVerbose additionally emits per-file details
+	LevelVerbose
+)
+
+// Logger writes leveled messages. Output and info messages go to out,
+// errors always go to errOut regardless of level.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	errOut io.Writer
+	level  Level
+}
+
+// New creates a new Logger
+func New(out, errOut io.Writer, level Level) *Logger {
+	return &Logger{out: out, errOut: errOut, level: level}
+}
+
+// SetLevel changes the level of the logger
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
+// Level returns the current level
+func (l *Logger) Level() Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// Printf writes command output (e.g. the groups printed by list), which is
+// emitted at every level.
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.write(l.out, LevelQuiet, format, args...)
+}
+
+// Infof writes progress and summary messages, suppressed in quiet mode.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write(l.out, LevelNormal, format, args...)
+}
+
+// Debugf writes detailed messages, emitted only in verbose mode.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.write(l.out, LevelVerbose, format, args...)
+}
+
+// Errorf writes an error message to the error output.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.write(l.errOut, LevelQuiet, format, args...)
+}
+
+func (l *Logger) write(w io.Writer, min Level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level < min {
+		return
+	}
+	fmt.Fprintf(w, format, args...)
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogger_Levels(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   Level
+		wantOut string
+		wantErr string
+	}{
+		{"quiet", LevelQuiet, "output\n", "error\n"},
+		{"normal", LevelNormal, "output\ninfo\n", "error\n"},
+		{"verbose", LevelVerbose, "output\ninfo\ndebug\n", "error\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			l := New(&out, &errOut, tt.level)
+
+			l.Printf("output\n")
+			l.Infof("info\n")
+			l.Debugf("debug\n")
+			l.Errorf("error\n")
+
+			if out.String() != tt.wantOut {
+				t.Errorf("stdout = %q, want %q", out.String(), tt.wantOut)
+			}
+			if errOut.String() != tt.wantErr {
+				t.Errorf("stderr = %q, want %q", errOut.String(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogger_SetLevel(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, &out, LevelNormal)
+
+	l.SetLevel(LevelQuiet)
+	if l.Level() != LevelQuiet {
+		t.Errorf("level = %v, want %v", l.Level(), LevelQuiet)
+	}
+	l.Infof("hidden")
+	if out.Len() != 0 {
+		t.Errorf("expected no output in quiet mode, got %q", out.String())
+	}
+}
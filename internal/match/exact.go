@@ -32,5 +32,5 @@ func (m *ExactMatcher) FindGroups(images []*models.ImageInfo) []*models.Duplicat
 		idx++
 	}
 
-	return buildGroups(groupMap)
+	return buildGroups(groupMap, models.MatchExact)
 }
@@ -38,3 +38,17 @@ func TestExactMatcher_Duplicates(t *testing.T) {
 		t.Errorf("expected 1 group, got %d", len(groups))
 	}
 }
+
+func TestExactMatcher_ReportsMethod(t *testing.T) {
+	images := []*models.ImageInfo{
+		{Path: "a.jpg", FileHash: "abc123", Hash: 0b0000},
+		{Path: "b.jpg", FileHash: "abc123", Hash: 0b0111}, // e.g. re-hashed with another variant
+	}
+	groups := NewExactMatcher().FindGroups(images)
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if groups[0].MatchMethod != models.MatchExact || groups[0].Distance != 0 {
+		t.Errorf("got method %q distance %d, want %q 0", groups[0].MatchMethod, groups[0].Distance, models.MatchExact)
+	}
+}
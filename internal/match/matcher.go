@@ -1,6 +1,7 @@
 package match
 
 import (
+	"hash/fnv"
 	"sort"
 
 	"imagedupfinder/internal/models"
@@ -11,24 +12,63 @@ type Matcher interface {
 	FindGroups(images []*models.ImageInfo) []*models.DuplicateGroup
 }
 
-// buildGroups builds DuplicateGroup slice from a group map
-func buildGroups(groupMap map[int][]*models.ImageInfo) []*models.DuplicateGroup {
-	var groups []*models.DuplicateGroup
-	groupID := 1
+// MinResolution returns the images at least width x height, so that tiny
+// images (icons, sprites), whose low-detail hashes all look alike, can be
+// kept out of matching. The input slice is not modified.
+func MinResolution(images []*models.ImageInfo, width, height int) []*models.ImageInfo {
+	kept := make([]*models.ImageInfo, 0, len(images))
+	for _, img := range images {
+		if img.Width >= width && img.Height >= height {
+			kept = append(kept, img)
+		}
+	}
+	return kept
+}
 
+// buildGroups builds DuplicateGroup slice from a group map, recording method
+// as the way the groups were matched. Group IDs come from the members (see
+// groupKey), so a cluster keeps its ID across scans as long as its members
+// don't change, whatever order the map or the scan yields them in.
+func buildGroups(groupMap map[int][]*models.ImageInfo, method string) []*models.DuplicateGroup {
+	type keyed struct {
+		key   uint32
+		first string // smallest member path, orders groups whose keys collide
+		imgs  []*models.ImageInfo
+	}
+	var clusters []keyed
 	for _, imgs := range groupMap {
 		if len(imgs) < 2 {
 			continue
 		}
+		key, first := groupKey(imgs)
+		clusters = append(clusters, keyed{key, first, imgs})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].key != clusters[j].key {
+			return clusters[i].key < clusters[j].key
+		}
+		return clusters[i].first < clusters[j].first
+	})
+
+	// A collision takes the next free ID; clusters are visited in a fixed
+	// order, so that is deterministic too.
+	groups := make([]*models.DuplicateGroup, 0, len(clusters))
+	used := make(map[int]bool, len(clusters))
+	for _, c := range clusters {
+		id := int(c.key)
+		for used[id] {
+			id = id%maxGroupID + 1
+		}
+		used[id] = true
 
 		group := &models.DuplicateGroup{
-			ID:     groupID,
-			Images: imgs,
+			ID:          id,
+			Images:      c.imgs,
+			MatchMethod: method,
 		}
 
 		selectKeepAndRemove(group)
 		groups = append(groups, group)
-		groupID++
 	}
 
 	// Sort groups by ID for consistent output
@@ -39,44 +79,30 @@ func buildGroups(groupMap map[int][]*models.ImageInfo) []*models.DuplicateGroup
 	return groups
 }
 
-// selectKeepAndRemove determines which image to keep and which to remove
-func selectKeepAndRemove(group *models.DuplicateGroup) {
-	if len(group.Images) == 0 {
-		return
-	}
-
-	// Sort images by score (descending), then by file size (descending),
-	// then by mod time (descending), then by path (ascending)
-	sorted := make([]*models.ImageInfo, len(group.Images))
-	copy(sorted, group.Images)
+// maxGroupID bounds group IDs to 31 bits, so they are positive on every
+// platform and in JavaScript
+const maxGroupID = 1<<31 - 1
 
-	sort.Slice(sorted, func(i, j int) bool {
-		a, b := sorted[i], sorted[j]
-
-		// Primary: score (higher is better)
-		if a.Score != b.Score {
-			return a.Score > b.Score
-		}
-
-		// Secondary: file size (larger is better - more information)
-		if a.FileSize != b.FileSize {
-			return a.FileSize > b.FileSize
-		}
-
-		// Tertiary: mod time (newer is better)
-		if !a.ModTime.Equal(b.ModTime) {
-			return a.ModTime.After(b.ModTime)
-		}
-
-		// Fallback: path (alphabetical)
-		return a.Path < b.Path
-	})
+// groupKey hashes the sorted member paths of a group (FNV-1a) into
+// 1..maxGroupID, and returns the smallest path too
+func groupKey(imgs []*models.ImageInfo) (uint32, string) {
+	paths := make([]string, len(imgs))
+	for i, img := range imgs {
+		paths[i] = img.Path
+	}
+	sort.Strings(paths)
 
-	// First image is the one to keep
-	group.Keep = sorted[0]
+	h := fnv.New32a()
+	for _, path := range paths {
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+	}
+	return h.Sum32()%maxGroupID + 1, paths[0]
+}
 
-	// Rest are to be removed
-	group.Remove = sorted[1:]
+// selectKeepAndRemove determines which image to keep and which to remove
+func selectKeepAndRemove(group *models.DuplicateGroup) {
+	group.SelectKeep()
 
 	// Assign group ID to all images
 	for _, img := range group.Images {
@@ -1,6 +1,8 @@
 package match
 
 import (
+	"maps"
+	"slices"
 	"testing"
 	"time"
 
@@ -52,6 +54,54 @@ func TestSelectKeepAndRemove(t *testing.T) {
 	}
 }
 
+func TestSelectKeep_OldestCapture(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		images       []*models.ImageInfo
+		expectedKeep string
+	}{
+		{
+			name: "capture date beats quality",
+			images: []*models.ImageInfo{
+				{Path: "best.jpg", Score: 10.0, CaptureTime: base.Add(time.Hour)},
+				{Path: "first.jpg", Score: 1.0, CaptureTime: base},
+			},
+			expectedKeep: "first.jpg",
+		},
+		{
+			name: "missing capture date falls back to mod time",
+			images: []*models.ImageInfo{
+				{Path: "exif.jpg", Score: 10.0, CaptureTime: base},
+				{Path: "noexif.jpg", Score: 1.0, ModTime: base.Add(-time.Hour)},
+			},
+			expectedKeep: "noexif.jpg",
+		},
+		{
+			name: "same capture date falls back to quality",
+			images: []*models.ImageInfo{
+				{Path: "low.jpg", Score: 1.0, CaptureTime: base},
+				{Path: "high.jpg", Score: 10.0, CaptureTime: base},
+			},
+			expectedKeep: "high.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &models.DuplicateGroup{ID: 1, Images: tt.images}
+			group.SelectKeep(models.KeepOldestCapture)
+			if group.Keep.Path != tt.expectedKeep {
+				t.Errorf("expected to keep %s, got %s", tt.expectedKeep, group.Keep.Path)
+			}
+			if len(group.Remove) != len(tt.images)-1 {
+				t.Errorf("expected %d to remove, got %d", len(tt.images)-1, len(group.Remove))
+			}
+		})
+	}
+}
+
 func TestBuildGroups(t *testing.T) {
 	images := []*models.ImageInfo{
 		{Path: "a.jpg", Score: 1.0},
@@ -64,7 +114,7 @@ func TestBuildGroups(t *testing.T) {
 		1: {images[2]},            // single (should be excluded)
 	}
 
-	groups := buildGroups(groupMap)
+	groups := buildGroups(groupMap, models.MatchExact)
 
 	if len(groups) != 1 {
 		t.Errorf("expected 1 group, got %d", len(groups))
@@ -74,3 +124,74 @@ func TestBuildGroups(t *testing.T) {
 		t.Errorf("expected b.jpg to be kept (higher score), got %s", groups[0].Keep.Path)
 	}
 }
+
+func TestFindGroups_StableIDsAcrossScans(t *testing.T) {
+	// A fresh slice of fresh ImageInfos each time, in a different order, as
+	// two scans of the same folder would produce
+	scan := func(reverse bool) []*models.ImageInfo {
+		images := []*models.ImageInfo{
+			{Path: "/p/a.jpg", Hash: 0x0000000000000000, FileHash: "x", Score: 1},
+			{Path: "/p/b.jpg", Hash: 0x0000000000000001, FileHash: "x", Score: 2},
+			{Path: "/p/c.jpg", Hash: 0xFFFFFFFFFFFFFFFF, FileHash: "y", Score: 1},
+			{Path: "/p/d.jpg", Hash: 0xFFFFFFFFFFFFFFFE, FileHash: "y", Score: 2},
+			{Path: "/p/e.jpg", Hash: 0x00000000FFFFFFFF, FileHash: "z", Score: 1},
+			{Path: "/p/f.jpg", Hash: 0x00000000FFFFFFFE, FileHash: "z", Score: 2},
+		}
+		if reverse {
+			slices.Reverse(images)
+		}
+		return images
+	}
+	ids := func(groups []*models.DuplicateGroup) map[string]int {
+		byPath := make(map[string]int)
+		for _, g := range groups {
+			if g.ID <= 0 {
+				t.Errorf("group ID %d is not positive", g.ID)
+			}
+			for _, img := range g.Images {
+				byPath[img.Path] = g.ID
+			}
+		}
+		return byPath
+	}
+
+	for _, m := range []Matcher{NewPerceptualMatcher(1), NewExactMatcher()} {
+		first := ids(m.FindGroups(scan(false)))
+		second := ids(m.FindGroups(scan(true)))
+		if len(first) != 6 {
+			t.Fatalf("%T: expected 3 groups of 2, got %v", m, first)
+		}
+		if !maps.Equal(first, second) {
+			t.Errorf("%T: IDs changed between scans: %v vs %v", m, first, second)
+		}
+		if first["/p/a.jpg"] == first["/p/c.jpg"] || first["/p/a.jpg"] == first["/p/e.jpg"] {
+			t.Errorf("%T: distinct clusters share an ID: %v", m, first)
+		}
+	}
+}
+
+func TestMinResolution_KeepsTinyImagesOutOfGroups(t *testing.T) {
+	// Icons hash alike and would merge into one group with the photos' copy
+	images := []*models.ImageInfo{
+		{Path: "favicon.png", Hash: 0b0000, Width: 16, Height: 16},
+		{Path: "sprite.png", Hash: 0b0001, Width: 32, Height: 32},
+		{Path: "button.png", Hash: 0b0011, Width: 120, Height: 40},
+		{Path: "photo.jpg", Hash: 0xFF00, Width: 800, Height: 600},
+		{Path: "photo_copy.jpg", Hash: 0xFF01, Width: 800, Height: 600},
+	}
+	matcher := NewPerceptualMatcher(2)
+
+	if groups := matcher.FindGroups(images); len(groups) != 2 {
+		t.Fatalf("without filter: expected 2 groups, got %d", len(groups))
+	}
+
+	groups := matcher.FindGroups(MinResolution(images, 200, 200))
+	if len(groups) != 1 {
+		t.Fatalf("with filter: expected 1 group, got %d", len(groups))
+	}
+	for _, img := range groups[0].Images {
+		if img.Width < 200 || img.Height < 200 {
+			t.Errorf("%s (%dx%d) should not be grouped", img.Path, img.Width, img.Height)
+		}
+	}
+}
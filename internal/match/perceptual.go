@@ -1,26 +1,213 @@
 package match
 
 import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
 	"imagedupfinder/internal/hash"
 	"imagedupfinder/internal/models"
 )
 
 // PerceptualMatcher finds groups of similar images using perceptual hashing
 type PerceptualMatcher struct {
-	threshold int
+	threshold     int
+	maxSpread     int
+	ignoreSameDir bool
+	orientations  bool
+	maxGroupSize  int
+	linkage       bool
+	linkageCutoff int
+	concurrency   int
+	formatLimits  map[string]int
+	dHashMode     Combine
+	dHashLimit    int
+	distance      DistanceFunc
+	search        search
+	oversized     [][]*models.ImageInfo
+}
+
+// search is how FindGroups looks up the images near each image
+type search int
+
+const (
+	searchTree  search = iota // BK-trees
+	searchPairs               // compare every pair
+	searchAuto                // pairs below pairsCrossover images, else trees
+)
+
+// DistanceFunc measures how far apart two hashes are. It must be a metric
+// (zero only for equal hashes, symmetric, and satisfying the triangle
+// inequality), as the BK-tree prunes its search by it.
+type DistanceFunc func(a, b uint64) int
+
+// PerceptualOption configures a PerceptualMatcher
+type PerceptualOption func(*PerceptualMatcher)
+
+// WithMaxSpread refuses merges that would create a group whose diameter (the
+// largest distance between any two members) exceeds n. Without it, similarity
+// chains transitively: A~B and B~C group A, B and C however far A is from C.
+// n <= 0 means no limit.
+func WithMaxSpread(n int) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.maxSpread = n
+	}
+}
+
+// WithIgnoreSameDir never matches two images in the same directory, for
+// libraries where a directory is an album and similar shots in it (bursts)
+// are intended. They can still end up in one group through a copy elsewhere
+// that matches both.
+func WithIgnoreSameDir() PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.ignoreSameDir = true
+	}
+}
+
+// WithDistance compares hashes with fn instead of hash.HammingDistance, e.g.
+// hash.WeightedHammingDistance. The threshold, the spread limit and the
+// groups' Distance are all in fn's units.
+func WithDistance(fn DistanceFunc) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.distance = fn
+	}
+}
+
+// WithOrientations also matches an image with a rotated or mirrored copy:
+// the distance between two images is the smallest between either's Hash and
+// the other's Hash or OrientationHashes (see hash.WithOrientations). Images
+// without OrientationHashes are compared upright only.
+func WithOrientations() PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.orientations = true
+	}
+}
+
+// WithMaxGroupSize leaves clusters of more than n images out of the groups,
+// as transitive matching can chain thousands of near-blank images (scanned
+// documents, dark frames) into one cluster that isn't actionable. They are
+// returned by Oversized instead. n <= 0 means no limit.
+func WithMaxGroupSize(n int) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.maxGroupSize = n
+	}
+}
+
+// WithAverageLinkage splits each cluster found by transitive matching into
+// tighter subclusters: starting from single images, the two subclusters whose
+// members are closest on average are merged while that average distance is
+// at most cutoff. A bridge image between two sets of copies then no longer
+// joins them into one group. This is quadratic in memory and cubic in time
+// in the cluster size.
+func WithAverageLinkage(cutoff int) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.linkage = true
+		m.linkageCutoff = cutoff
+	}
+}
+
+// WithConcurrency looks up neighbors with n goroutines: the images are
+// split into n BK-trees built concurrently, and every image is queried
+// against them for the earlier images within the threshold, which is what
+// the single tree returns. The groups are the same either way. n <= 1
+// builds one tree.
+func WithConcurrency(n int) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.concurrency = n
+	}
+}
+
+// WithFormatThresholds gives images of some formats their own threshold, e.g.
+// a looser one for JPEGs, whose compression artifacts move their hashes,
+// than for PNGs. Two images match within the larger of their formats'
+// thresholds; formats not in thresholds use the matcher's. Keys are format
+// names such as "jpg" or "png" (see models.CanonicalFormat).
+func WithFormatThresholds(thresholds map[string]int) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.formatLimits = make(map[string]int, len(thresholds))
+		for format, t := range thresholds {
+			m.formatLimits[models.CanonicalFormat(format)] = t
+		}
+	}
+}
+
+// Combine is how WithDHash combines the pHash and dHash comparisons
+type Combine int
+
+const (
+	// CombineBoth matches two images only if both hashes are within their
+	// thresholds
+	CombineBoth Combine = iota + 1
+	// CombineEither matches two images if either hash is
+	CombineEither
+)
+
+// WithDHash also compares the images' dHashes (see hash.WithDHash), within
+// threshold bits. With CombineBoth a pHash match whose dHashes are further
+// apart is dropped, removing false positives of either hash alone; with
+// CombineEither images whose dHashes are that close match even if their
+// pHashes don't, and the format thresholds apply to the pHash only.
+// WithMaxSpread and the groups' Distance still measure pHashes. Images
+// without a dHash (DHash 0) are matched by pHash alone.
+func WithDHash(threshold int, mode Combine) PerceptualOption {
+	return func(m *PerceptualMatcher) {
+		m.dHashMode = mode
+		m.dHashLimit = threshold
+	}
 }
 
 // NewPerceptualMatcher creates a new PerceptualMatcher
-func NewPerceptualMatcher(threshold int) *PerceptualMatcher {
+func NewPerceptualMatcher(threshold int, opts ...PerceptualOption) *PerceptualMatcher {
 	if threshold < 0 {
-		threshold = 10 // Default threshold
+		threshold = DefaultThreshold
+	}
+	m := &PerceptualMatcher{threshold: threshold, distance: hash.HammingDistance}
+	for _, opt := range opts {
+		opt(m)
 	}
-	return &PerceptualMatcher{threshold: threshold}
+	return m
 }
 
-// FindGroups finds groups of similar images based on Hamming distance.
-// Uses BK-Tree for O(n log n) average-case performance instead of O(n²).
+// NewAutoMatcher creates a PerceptualMatcher that picks the neighbor search
+// for each FindGroups call by the number of images and the threshold:
+// below pairsCrossover images it compares every pair, which costs no
+// allocations, and above it it searches BK-trees. The groups are the same
+// either way.
+func NewAutoMatcher(threshold int, opts ...PerceptualOption) *PerceptualMatcher {
+	m := NewPerceptualMatcher(threshold, opts...)
+	m.search = searchAuto
+	return m
+}
+
+// pairsCrossover returns the number of images from which BK-trees are used
+// instead of comparing every pair at the given search radius: the smallest
+// count BenchmarkPerceptualMatcher_Search measured (100 to 60,000 images)
+// at which the trees won on random or on clustered hashes. Hashes of
+// unrelated images are about 32 bits apart, so a tree prunes little once it
+// searches more than a few bits wide: from radius 5 on, comparing every
+// pair won at every count measured, up to 60,000 images (at radius 10 on
+// random hashes by 7x). Nothing larger was measured, so larger sets use the
+// trees rather than an O(n²) compare no benchmark backs.
+func pairsCrossover(radius int) int {
+	switch radius {
+	case 0, 1:
+		return 1000
+	case 2:
+		return 3000
+	case 3, 4:
+		return 30000
+	default:
+		return 60000
+	}
+}
+
+// FindGroups finds groups of similar images based on Hamming distance (or
+// the WithDistance metric).
+// Uses BK-Tree for O(n log n) average-case performance instead of O(n²),
+// or with NewAutoMatcher compares every pair when there are few images.
 func (m *PerceptualMatcher) FindGroups(images []*models.ImageInfo) []*models.DuplicateGroup {
+	m.oversized = nil
 	n := len(images)
 	if n < 2 {
 		return nil
@@ -29,17 +216,68 @@ func (m *PerceptualMatcher) FindGroups(images []*models.ImageInfo) []*models.Dup
 	// Use Union-Find to group similar images
 	uf := newUnionFind(n)
 
-	// Use BK-Tree for efficient similarity search
-	tree := newBKTree(hash.HammingDistance)
-
-	for i, img := range images {
-		// Find all existing images within threshold distance
-		neighbors := tree.findWithinDistance(img.Hash, m.threshold)
-		for _, j := range neighbors {
+	var edges []edge
+	// byDHash is set for the pairs CombineEither found by dHash, which the
+	// pHash thresholds don't apply to
+	link := func(i, j int, byDHash bool) {
+		if m.ignoreSameDir && filepath.Dir(images[i].Path) == filepath.Dir(images[j].Path) {
+			return
+		}
+		if m.dHashMode == CombineBoth && !m.dHashNear(images[i], images[j]) {
+			return
+		}
+		if !byDHash && m.formatLimits != nil && m.imageDistance(images[i], images[j]) > m.pairThreshold(images[i], images[j]) {
+			return
+		}
+		if m.maxSpread > 0 {
+			edges = append(edges, edge{j, i, m.imageDistance(images[i], images[j])})
+		} else {
 			uf.union(i, j)
 		}
-		// Add current image to tree
-		tree.insert(img.Hash, i)
+	}
+
+	pairs := m.search == searchPairs || m.search == searchAuto && n < pairsCrossover(m.radius())
+	if pairs || m.concurrency > 1 {
+		lookup := m.earlierNeighbors
+		if pairs {
+			lookup = m.pairNeighbors
+		}
+		for i, earlier := range lookup(images) {
+			for _, j := range earlier {
+				link(i, j, false)
+			}
+		}
+	} else {
+		// Use BK-Tree for efficient similarity search
+		tree := newBKTree(m.distance)
+		for i, img := range images {
+			// Find all existing images within threshold distance, in
+			// index order so edges tie the same way as with concurrency
+			neighbors := m.neighbors(tree, img)
+			slices.Sort(neighbors)
+			for _, j := range neighbors {
+				link(i, j, false)
+			}
+			m.insert(tree, img, i)
+		}
+	}
+	if m.dHashMode == CombineEither {
+		tree := newBKTree(hash.HammingDistance)
+		for i, img := range images {
+			if img.DHash == 0 {
+				continue
+			}
+			neighbors := tree.findWithinDistance(img.DHash, m.dHashLimit)
+			slices.Sort(neighbors)
+			for _, j := range neighbors {
+				link(i, j, true)
+			}
+			tree.insert(img.DHash, i)
+		}
+	}
+
+	if m.maxSpread > 0 {
+		m.mergeWithinSpread(images, uf, edges)
 	}
 
 	// Collect groups
@@ -48,8 +286,339 @@ func (m *PerceptualMatcher) FindGroups(images []*models.ImageInfo) []*models.Dup
 		root := uf.find(i)
 		groupMap[root] = append(groupMap[root], img)
 	}
+	if m.linkage {
+		groupMap = m.splitByLinkage(groupMap)
+	}
+	if m.maxGroupSize > 0 {
+		m.takeOversized(groupMap)
+	}
+
+	groups := buildGroups(groupMap, models.MatchPerceptual)
+	for _, g := range groups {
+		g.Distance = m.spread(g.Images)
+	}
+	return groups
+}
+
+// Oversized returns the clusters the last FindGroups left out for having
+// more than WithMaxGroupSize images, largest first
+func (m *PerceptualMatcher) Oversized() [][]*models.ImageInfo {
+	return m.oversized
+}
+
+// takeOversized moves the clusters above maxGroupSize out of groupMap
+func (m *PerceptualMatcher) takeOversized(groupMap map[int][]*models.ImageInfo) {
+	for root, imgs := range groupMap {
+		if len(imgs) > m.maxGroupSize {
+			m.oversized = append(m.oversized, imgs)
+			delete(groupMap, root)
+		}
+	}
+	sort.Slice(m.oversized, func(a, b int) bool {
+		if len(m.oversized[a]) != len(m.oversized[b]) {
+			return len(m.oversized[a]) > len(m.oversized[b])
+		}
+		return m.oversized[a][0].Path < m.oversized[b][0].Path
+	})
+}
 
-	return buildGroups(groupMap)
+// insert adds img to tree as index i, turned each way too so that a later
+// upright hash finds it
+func (m *PerceptualMatcher) insert(tree *bkTree, img *models.ImageInfo, i int) {
+	tree.insert(img.Hash, i)
+	if m.orientations {
+		for _, h := range img.OrientationHashes {
+			tree.insert(h, i)
+		}
+	}
+}
+
+// earlierNeighbors returns, for each image, the sorted indexes of the
+// earlier images within threshold of it. Shard s holds a contiguous range of
+// images, so an image only queries the shards starting before it and does
+// no more comparisons than with one tree.
+func (m *PerceptualMatcher) earlierNeighbors(images []*models.ImageInfo) [][]int {
+	n := len(images)
+	k := min(m.concurrency, n)
+	shards := make([]*bkTree, k)
+	start := func(s int) int { return s * n / k }
+	var wg sync.WaitGroup
+	for s := range k {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tree := newBKTree(m.distance)
+			for i := start(s); i < start(s+1); i++ {
+				m.insert(tree, images[i], i)
+			}
+			shards[s] = tree
+		}()
+	}
+	wg.Wait()
+
+	// Later images query more shards, so workers take every k-th image
+	// rather than a range
+	found := make([][]int, n)
+	for w := range k {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < n; i += k {
+				for s := 0; s < k && start(s) < i; s++ {
+					for _, j := range m.neighbors(shards[s], images[i]) {
+						if j < i {
+							found[i] = append(found[i], j)
+						}
+					}
+				}
+				slices.Sort(found[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return found
+}
+
+// pairNeighbors returns what earlierNeighbors does by comparing each image
+// with every earlier one, on WithConcurrency goroutines
+func (m *PerceptualMatcher) pairNeighbors(images []*models.ImageInfo) [][]int {
+	n := len(images)
+	k := max(1, min(m.concurrency, n))
+	radius := m.radius()
+	found := make([][]int, n)
+	var wg sync.WaitGroup
+	for w := range k {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < n; i += k {
+				for j := range i {
+					if m.near(images[i], images[j], radius) {
+						found[i] = append(found[i], j)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return found
+}
+
+// near reports whether b is within radius of a as the tree search finds
+// it: a's Hash or, WithOrientations, any of its OrientationHashes within
+// radius of any that insert adds for b, which is imageDistance
+func (m *PerceptualMatcher) near(a, b *models.ImageInfo, radius int) bool {
+	return m.imageDistance(a, b) <= radius
+}
+
+// neighbors returns the indexes of images in tree within the search radius
+// of img's Hash or, WithOrientations, of any of its OrientationHashes
+func (m *PerceptualMatcher) neighbors(tree *bkTree, img *models.ImageInfo) []int {
+	radius := m.radius()
+	if !m.orientations {
+		return tree.findWithinDistance(img.Hash, radius)
+	}
+	var found []int
+	for _, h := range append([]uint64{img.Hash}, img.OrientationHashes...) {
+		for _, j := range tree.findWithinDistance(h, radius) {
+			if !slices.Contains(found, j) {
+				found = append(found, j)
+			}
+		}
+	}
+	return found
+}
+
+// dHashNear reports whether a and b are within the WithDHash threshold, or
+// either has no dHash
+func (m *PerceptualMatcher) dHashNear(a, b *models.ImageInfo) bool {
+	return a.DHash == 0 || b.DHash == 0 || hash.HammingDistance(a.DHash, b.DHash) <= m.dHashLimit
+}
+
+// radius is the largest threshold any pair can have: the tree is searched
+// that far, and link drops the pairs beyond their own pairThreshold
+func (m *PerceptualMatcher) radius() int {
+	r := m.threshold
+	for _, t := range m.formatLimits {
+		r = max(r, t)
+	}
+	return r
+}
+
+// pairThreshold is the threshold a and b match within: the larger of their
+// formats' thresholds
+func (m *PerceptualMatcher) pairThreshold(a, b *models.ImageInfo) int {
+	limit := func(img *models.ImageInfo) int {
+		if t, ok := m.formatLimits[models.CanonicalFormat(img.Format)]; ok {
+			return t
+		}
+		return m.threshold
+	}
+	return max(limit(a), limit(b))
+}
+
+// imageDistance is the distance between two images' hashes, or
+// WithOrientations the smallest over their orientations
+// (hash.OrientedDistance), the distance neighbors and near link them at
+func (m *PerceptualMatcher) imageDistance(a, b *models.ImageInfo) int {
+	if !m.orientations {
+		return m.distance(a.Hash, b.Hash)
+	}
+	return hash.OrientedDistance(a, b, m.distance)
+}
+
+// spread returns the largest distance between any two images
+func (m *PerceptualMatcher) spread(images []*models.ImageInfo) int {
+	maxDist := 0
+	for a := 0; a < len(images); a++ {
+		for b := a + 1; b < len(images); b++ {
+			maxDist = max(maxDist, m.imageDistance(images[a], images[b]))
+		}
+	}
+	return maxDist
+}
+
+// edge is a candidate merge between images i and j at distance dist
+type edge struct {
+	i, j, dist int
+}
+
+// mergeWithinSpread unions edges closest-first, skipping any merge that
+// would put two images more than maxSpread apart in the same group.
+func (m *PerceptualMatcher) mergeWithinSpread(images []*models.ImageInfo, uf *unionFind, edges []edge) {
+	sort.SliceStable(edges, func(a, b int) bool {
+		return edges[a].dist < edges[b].dist
+	})
+
+	members := make(map[int][]int, len(images))
+	for i := range images {
+		members[i] = []int{i}
+	}
+
+	for _, e := range edges {
+		ri, rj := uf.find(e.i), uf.find(e.j)
+		if ri == rj || !m.withinSpread(images, members[ri], members[rj]) {
+			continue
+		}
+		uf.union(ri, rj)
+		root := uf.find(ri)
+		merged := append(members[ri], members[rj]...)
+		delete(members, ri)
+		delete(members, rj)
+		members[root] = merged
+	}
+}
+
+// withinSpread reports whether every image in a is within maxSpread of
+// every image in b
+func (m *PerceptualMatcher) withinSpread(images []*models.ImageInfo, a, b []int) bool {
+	for _, i := range a {
+		for _, j := range b {
+			if m.imageDistance(images[i], images[j]) > m.maxSpread {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitByLinkage replaces every cluster in groupMap by its average linkage
+// subclusters
+func (m *PerceptualMatcher) splitByLinkage(groupMap map[int][]*models.ImageInfo) map[int][]*models.ImageInfo {
+	split := make(map[int][]*models.ImageInfo, len(groupMap))
+	for _, imgs := range groupMap {
+		if len(imgs) < 3 {
+			split[len(split)] = imgs
+			continue
+		}
+		for _, sub := range m.averageLinkage(imgs) {
+			split[len(split)] = sub
+		}
+	}
+	return split
+}
+
+// averageLinkage clusters images agglomeratively, merging the pair of
+// subclusters with the smallest average distance between their members
+// until it exceeds linkageCutoff. Distances between subclusters are kept as
+// sums over member pairs, so a merge only adds two rows.
+func (m *PerceptualMatcher) averageLinkage(images []*models.ImageInfo) [][]*models.ImageInfo {
+	n := len(images)
+	sum := make([][]int, n)
+	for a := range sum {
+		sum[a] = make([]int, n)
+	}
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			d := m.imageDistance(images[a], images[b])
+			sum[a][b], sum[b][a] = d, d
+		}
+	}
+	members := make([][]int, n)
+	for i := range members {
+		members[i] = []int{i}
+	}
+
+	for {
+		bestA, bestB, best := -1, -1, 0.0
+		for a := 0; a < n; a++ {
+			if members[a] == nil {
+				continue
+			}
+			for b := a + 1; b < n; b++ {
+				if members[b] == nil {
+					continue
+				}
+				avg := float64(sum[a][b]) / float64(len(members[a])*len(members[b]))
+				if bestA < 0 || avg < best {
+					bestA, bestB, best = a, b, avg
+				}
+			}
+		}
+		if bestA < 0 || best > float64(m.linkageCutoff) {
+			break
+		}
+		// b joins a
+		for c := 0; c < n; c++ {
+			sum[bestA][c] += sum[bestB][c]
+			sum[c][bestA] = sum[bestA][c]
+		}
+		members[bestA] = append(members[bestA], members[bestB]...)
+		members[bestB] = nil
+	}
+
+	var clusters [][]*models.ImageInfo
+	for _, idx := range members {
+		if idx == nil {
+			continue
+		}
+		sort.Ints(idx)
+		cluster := make([]*models.ImageInfo, len(idx))
+		for k, i := range idx {
+			cluster[k] = images[i]
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// PairwiseDistances returns the hash distance between every pair of images,
+// indexed into images, taking stored OrientationHashes into account as
+// WithOrientations does, so a rotated pair is as close as its group says.
+// This is quadratic in the group size, so groups only carry Pairs when a
+// caller asks for them.
+func PairwiseDistances(images []*models.ImageInfo) []models.ImagePair {
+	var pairs []models.ImagePair
+	for a := 0; a < len(images); a++ {
+		for b := a + 1; b < len(images); b++ {
+			pairs = append(pairs, models.ImagePair{
+				A:    a,
+				B:    b,
+				Dist: hash.OrientedDistance(images[a], images[b], hash.HammingDistance),
+			})
+		}
+	}
+	return pairs
 }
 
 // GetThreshold returns the current threshold
@@ -99,17 +668,20 @@ func (uf *unionFind) union(x, y int) {
 // a given distance threshold.
 type bkTree struct {
 	root     *bkNode
-	distance func(a, b uint64) int
+	distance DistanceFunc
 }
 
+// bkNode holds every index inserted with its hash. Identical hashes are
+// common (byte-identical copies); chained through children[0] they would turn
+// the tree into a list, so they share the node instead.
 type bkNode struct {
 	hash     uint64
-	index    int
+	indices  []int
 	children map[int]*bkNode // distance -> child node
 }
 
 // newBKTree creates a new BK-tree with the given distance function.
-func newBKTree(distanceFn func(a, b uint64) int) *bkTree {
+func newBKTree(distanceFn DistanceFunc) *bkTree {
 	return &bkTree{
 		distance: distanceFn,
 	}
@@ -119,7 +691,7 @@ func newBKTree(distanceFn func(a, b uint64) int) *bkTree {
 func (t *bkTree) insert(hash uint64, index int) {
 	node := &bkNode{
 		hash:     hash,
-		index:    index,
+		indices:  []int{index},
 		children: make(map[int]*bkNode),
 	}
 
@@ -131,6 +703,10 @@ func (t *bkTree) insert(hash uint64, index int) {
 	current := t.root
 	for {
 		dist := t.distance(hash, current.hash)
+		if dist == 0 {
+			current.indices = append(current.indices, index)
+			return
+		}
 		if child, exists := current.children[dist]; exists {
 			current = child
 		} else {
@@ -156,7 +732,7 @@ func (t *bkTree) searchNode(node *bkNode, hash uint64, threshold int, results *[
 	dist := t.distance(hash, node.hash)
 
 	if dist <= threshold {
-		*results = append(*results, node.index)
+		*results = append(*results, node.indices...)
 	}
 
 	// Triangle inequality: only need to check children with distance
@@ -183,7 +759,7 @@ func (t *bkTree) size() int {
 }
 
 func (t *bkTree) countNodes(node *bkNode) int {
-	count := 1
+	count := len(node.indices)
 	for _, child := range node.children {
 		count += t.countNodes(child)
 	}
@@ -1,6 +1,12 @@
 package match
 
 import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -123,6 +129,43 @@ func TestBKTree_LargeThreshold(t *testing.T) {
 	}
 }
 
+func TestBKTree_IdenticalHashesShareNode(t *testing.T) {
+	var calls int
+	counting := func(a, b uint64) int {
+		calls++
+		return hash.HammingDistance(a, b)
+	}
+	tree := newBKTree(counting)
+	for i := range 1000 {
+		tree.insert(0xdeadbeef, i)
+	}
+	tree.insert(0xdeadbeef^0b1, 1000)
+	tree.insert(0xdeadbeef^0xff00, 1001)
+
+	if tree.size() != 1002 {
+		t.Errorf("size = %d, want 1002", tree.size())
+	}
+	if len(tree.root.children) != 2 {
+		t.Errorf("root has %d children, want the 2 distinct hashes only", len(tree.root.children))
+	}
+
+	calls = 0
+	results := tree.findWithinDistance(0xdeadbeef, 1)
+	if len(results) != 1001 {
+		t.Fatalf("found %d indices, want the 1000 copies and index 1000", len(results))
+	}
+	slices.Sort(results)
+	for i, idx := range results {
+		if idx != i {
+			t.Fatalf("results[%d] = %d, want every index 0..1000 once", i, idx)
+		}
+	}
+	// A chain of 1000 nodes would take a distance per copy
+	if calls > 3 {
+		t.Errorf("query took %d distance computations, want one per distinct hash", calls)
+	}
+}
+
 // Helper function to check if all expected values are in results
 func containsAll(results []int, expected []int) bool {
 	if len(results) != len(expected) {
@@ -202,6 +245,31 @@ func TestPerceptualMatcher_SimilarImages(t *testing.T) {
 	}
 }
 
+func TestPerceptualMatcher_ReportsDistance(t *testing.T) {
+	matcher := NewPerceptualMatcher(2)
+	images := []*models.ImageInfo{
+		{Path: "a.jpg", Hash: 0b00000000},
+		{Path: "b.jpg", Hash: 0b00000001},
+		{Path: "c.jpg", Hash: 0b00000011}, // chains through b: 2 from a
+		{Path: "d.jpg", Hash: 0b11110000},
+		{Path: "e.jpg", Hash: 0b11110000},
+	}
+	groups := matcher.FindGroups(images)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+
+	want := map[int]int{3: 2, 2: 0} // group size -> distance
+	for _, g := range groups {
+		if g.MatchMethod != models.MatchPerceptual {
+			t.Errorf("group %d method = %q, want %q", g.ID, g.MatchMethod, models.MatchPerceptual)
+		}
+		if g.Distance != want[len(g.Images)] {
+			t.Errorf("group of %d distance = %d, want %d", len(g.Images), g.Distance, want[len(g.Images)])
+		}
+	}
+}
+
 func TestPerceptualMatcher_MultipleGroups(t *testing.T) {
 	matcher := NewPerceptualMatcher(1)
 	images := []*models.ImageInfo{
@@ -235,6 +303,298 @@ func TestPerceptualMatcher_KeepHighestScore(t *testing.T) {
 	}
 }
 
+func TestPerceptualMatcher_MaxSpreadSplitsChain(t *testing.T) {
+	// a~b and b~c are within the threshold, but a and c are 8 apart
+	images := func() []*models.ImageInfo {
+		return []*models.ImageInfo{
+			{Path: "a.jpg", Hash: 0x00, Score: 1.0},
+			{Path: "b.jpg", Hash: 0x0F, Score: 1.0}, // 4 from a
+			{Path: "c.jpg", Hash: 0xFF, Score: 1.0}, // 4 from b, 8 from a
+		}
+	}
+
+	// Without a limit the chain over-merges into one group
+	groups := NewPerceptualMatcher(5).FindGroups(images())
+	if len(groups) != 1 || len(groups[0].Images) != 3 {
+		t.Fatalf("without max spread: expected 1 group of 3, got %d groups", len(groups))
+	}
+
+	// With a limit below a–c, c is kept out
+	groups = NewPerceptualMatcher(5, WithMaxSpread(5)).FindGroups(images())
+	if len(groups) != 1 {
+		t.Fatalf("with max spread: expected 1 group, got %d", len(groups))
+	}
+	if len(groups[0].Images) != 2 {
+		t.Fatalf("with max spread: expected 2 images, got %d", len(groups[0].Images))
+	}
+	for _, img := range groups[0].Images {
+		if img.Path == "c.jpg" {
+			t.Error("c.jpg should not be merged: it is 8 from a.jpg")
+		}
+	}
+}
+
+func TestPerceptualMatcher_AverageLinkageSplitsBarbell(t *testing.T) {
+	// Two tight sets of copies, 16+ bits apart, joined by one bridge image
+	// within the threshold of both
+	images := func() []*models.ImageInfo {
+		var images []*models.ImageInfo
+		for i, h := range []uint64{0, 1 << 40, 1 << 41, 1 << 42} {
+			images = append(images,
+				&models.ImageInfo{Path: fmt.Sprintf("a%d.jpg", i), Hash: h, Score: 1.0},
+				&models.ImageInfo{Path: fmt.Sprintf("b%d.jpg", i), Hash: h | 0xFFFF, Score: 1.0})
+		}
+		return append(images, &models.ImageInfo{Path: "bridge.jpg", Hash: 0xFF, Score: 1.0})
+	}
+
+	groups := NewPerceptualMatcher(10).FindGroups(images())
+	if len(groups) != 1 || len(groups[0].Images) != 9 {
+		t.Fatalf("single linkage: expected 1 group of 9, got %d groups", len(groups))
+	}
+
+	groups = NewPerceptualMatcher(10, WithAverageLinkage(4)).FindGroups(images())
+	if len(groups) != 2 {
+		t.Fatalf("average linkage: expected 2 groups, got %d", len(groups))
+	}
+	for _, g := range groups {
+		if len(g.Images) != 4 {
+			t.Fatalf("average linkage: expected groups of 4, got %d", len(g.Images))
+		}
+		set := g.Images[0].Path[0]
+		for _, img := range g.Images {
+			if img.Path[0] != set {
+				t.Errorf("%s grouped with %s", img.Path, g.Images[0].Path)
+			}
+		}
+		if g.Distance > 2 {
+			t.Errorf("group of %s has distance %d, want at most 2", g.Images[0].Path, g.Distance)
+		}
+	}
+
+	// A cutoff above the bridge's average distance keeps the whole cluster
+	groups = NewPerceptualMatcher(10, WithAverageLinkage(16)).FindGroups(images())
+	if len(groups) != 1 || len(groups[0].Images) != 9 {
+		t.Errorf("cutoff 16: expected 1 group of 9, got %d groups", len(groups))
+	}
+}
+
+func TestPerceptualMatcher_MaxGroupSizeExcludesChain(t *testing.T) {
+	// A chain of 20 near-blank pages, each one bit from the next, plus one
+	// ordinary pair far from all of them
+	var images []*models.ImageInfo
+	for i := range 20 {
+		images = append(images, &models.ImageInfo{Path: fmt.Sprintf("page%02d.png", i), Hash: 1<<i - 1, Score: 1.0})
+	}
+	images = append(images,
+		&models.ImageInfo{Path: "photo.jpg", Hash: 0xFFFF000000000000, Score: 1.0},
+		&models.ImageInfo{Path: "photo-copy.jpg", Hash: 0xFFFF000000000001, Score: 1.0},
+	)
+
+	m := NewPerceptualMatcher(2, WithMaxGroupSize(10))
+	groups := m.FindGroups(images)
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("expected only the photo pair, got %d groups", len(groups))
+	}
+	oversized := m.Oversized()
+	if len(oversized) != 1 || len(oversized[0]) != 20 {
+		t.Fatalf("Oversized() = %d clusters, want 1 of 20 pages", len(oversized))
+	}
+	for _, img := range oversized[0] {
+		if img.GroupID != 0 {
+			t.Errorf("%s got group %d, want none", img.Path, img.GroupID)
+		}
+	}
+
+	// A later call forgets the earlier exclusions
+	m.FindGroups(images[20:])
+	if n := len(m.Oversized()); n != 0 {
+		t.Errorf("after regrouping the pair: %d oversized, want 0", n)
+	}
+
+	// At the limit the cluster is an ordinary group
+	m = NewPerceptualMatcher(2, WithMaxGroupSize(20))
+	if groups := m.FindGroups(images); len(groups) != 2 || len(m.Oversized()) != 0 {
+		t.Errorf("max 20: got %d groups, %d oversized; want 2, 0", len(groups), len(m.Oversized()))
+	}
+}
+
+func TestPerceptualMatcher_MaxSpreadPrefersClosest(t *testing.T) {
+	// b is 1 from c but 3 from a; merging closest-first groups b with c
+	images := []*models.ImageInfo{
+		{Path: "a.jpg", Hash: 0x00, Score: 1.0},
+		{Path: "b.jpg", Hash: 0x07, Score: 1.0}, // 3 from a
+		{Path: "c.jpg", Hash: 0x0F, Score: 1.0}, // 1 from b, 4 from a
+	}
+	groups := NewPerceptualMatcher(4, WithMaxSpread(3)).FindGroups(images)
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("expected 1 group of 2, got %d groups", len(groups))
+	}
+	paths := map[string]bool{}
+	for _, img := range groups[0].Images {
+		paths[img.Path] = true
+	}
+	if !paths["b.jpg"] || !paths["c.jpg"] {
+		t.Errorf("expected b.jpg and c.jpg grouped, got %v", paths)
+	}
+}
+
+func TestPerceptualMatcher_IgnoreSameDir(t *testing.T) {
+	burst := []*models.ImageInfo{
+		{Path: filepath.Join("album1", "IMG_1.jpg"), Hash: 0x00, Score: 1.0},
+		{Path: filepath.Join("album1", "IMG_2.jpg"), Hash: 0x01, Score: 1.0},
+		{Path: filepath.Join("album1", "IMG_3.jpg"), Hash: 0x03, Score: 1.0},
+	}
+
+	if groups := NewPerceptualMatcher(5).FindGroups(burst); len(groups) != 1 {
+		t.Fatalf("without the option: expected the burst grouped, got %d groups", len(groups))
+	}
+	if groups := NewPerceptualMatcher(5, WithIgnoreSameDir()).FindGroups(burst); len(groups) != 0 {
+		t.Fatalf("a burst in one folder should not be grouped, got %d groups", len(groups))
+	}
+
+	// A copy in another album matches the shots it is close to
+	copied := &models.ImageInfo{Path: filepath.Join("album2", "IMG_1.jpg"), Hash: 0x00, Score: 1.0}
+	far := &models.ImageInfo{Path: filepath.Join("album1", "IMG_9.jpg"), Hash: 0xFFFF, Score: 1.0}
+	images := append([]*models.ImageInfo{copied, far}, burst...)
+	groups := NewPerceptualMatcher(1, WithIgnoreSameDir()).FindGroups(images)
+	if len(groups) != 1 {
+		t.Fatalf("expected one group across albums, got %d", len(groups))
+	}
+	paths := map[string]bool{}
+	for _, img := range groups[0].Images {
+		paths[img.Path] = true
+	}
+	if len(paths) != 3 || !paths[copied.Path] || !paths[burst[0].Path] || !paths[burst[1].Path] {
+		t.Errorf("expected the copy with IMG_1 and IMG_2, got %v", paths)
+	}
+}
+
+func TestPerceptualMatcher_FormatThresholds(t *testing.T) {
+	// Each pair is 8 bits apart, the pairs far from each other
+	images := []*models.ImageInfo{
+		{Path: "a.jpg", Format: "jpeg", Hash: 0x0000, Score: 1.0},
+		{Path: "a_copy.jpg", Format: "jpeg", Hash: 0x00FF, Score: 1.0},
+		{Path: "b.png", Format: "png", Hash: 0xFFFF0000, Score: 1.0},
+		{Path: "b_copy.png", Format: "png", Hash: 0xFFFF00FF, Score: 1.0},
+		{Path: "c.png", Format: "png", Hash: 0xFFFF00000000, Score: 1.0},
+		{Path: "c_copy.jpg", Format: "jpeg", Hash: 0xFFFF000000FF, Score: 1.0},
+	}
+	grouped := func(groups []*models.DuplicateGroup) []string {
+		var firsts []string
+		for _, g := range groups {
+			paths := make([]string, len(g.Images))
+			for i, img := range g.Images {
+				paths[i] = img.Path
+			}
+			slices.Sort(paths)
+			firsts = append(firsts, paths[0])
+		}
+		slices.Sort(firsts)
+		return firsts
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		formats   map[string]int
+		want      []string
+	}{
+		{"global 8 groups every pair", 8, nil, []string{"a.jpg", "b.png", "c.png"}},
+		{"global 6 groups none", 6, nil, nil},
+		{"looser jpeg, also for the mixed pair", 6, map[string]int{"jpg": 12}, []string{"a.jpg", "c.png"}},
+		{"stricter png", 8, map[string]int{"png": 4}, []string{"a.jpg", "c.png"}},
+		{"both stricter", 8, map[string]int{"png": 4, "jpeg": 4}, nil},
+	}
+	for _, tt := range tests {
+		for _, n := range []int{1, 3} {
+			m := NewPerceptualMatcher(tt.threshold, WithFormatThresholds(tt.formats), WithConcurrency(n))
+			if got := grouped(m.FindGroups(images)); !slices.Equal(got, tt.want) {
+				t.Errorf("%s (concurrency %d): groups starting %v, want %v", tt.name, n, got, tt.want)
+			}
+		}
+	}
+}
+
+// dctBits sets the pHash bits of the given DCT coefficients (row, column)
+func dctBits(coeffs ...[2]int) uint64 {
+	var h uint64
+	for _, c := range coeffs {
+		h |= 1 << (63 - (c[0]*8 + c[1]))
+	}
+	return h
+}
+
+func TestPerceptualMatcher_WeightedDistance(t *testing.T) {
+	// 11 bits apart, all fine detail: just missed by plain Hamming at 10
+	detail := dctBits([2]int{7, 7}, [2]int{7, 6}, [2]int{6, 7}, [2]int{7, 5}, [2]int{5, 7}, [2]int{6, 6},
+		[2]int{7, 4}, [2]int{4, 7}, [2]int{6, 5}, [2]int{5, 6}, [2]int{7, 3})
+	// 10 bits apart, mostly overall structure: just merged by plain Hamming
+	base := ^uint64(0)
+	structure := base ^ dctBits([2]int{0, 0}, [2]int{0, 1}, [2]int{1, 0}, [2]int{0, 2}, [2]int{1, 1}, [2]int{2, 0},
+		[2]int{0, 3}, [2]int{1, 2}, [2]int{2, 1}, [2]int{3, 0})
+	images := []*models.ImageInfo{
+		{Path: "/detail_a.jpg", Hash: 0, Score: 1},
+		{Path: "/detail_b.jpg", Hash: detail, Score: 1},
+		{Path: "/structure_a.jpg", Hash: base, Score: 1},
+		{Path: "/structure_b.jpg", Hash: structure, Score: 1},
+	}
+
+	pairOf := func(groups []*models.DuplicateGroup) string {
+		if len(groups) != 1 || len(groups[0].Images) != 2 {
+			return fmt.Sprintf("%d groups", len(groups))
+		}
+		a, b := groups[0].Images[0].Path, groups[0].Images[1].Path
+		return strings.TrimSuffix(min(a, b), "_a.jpg")
+	}
+
+	if got := pairOf(NewPerceptualMatcher(10).FindGroups(images)); got != "/structure" {
+		t.Errorf("plain Hamming grouped %s, want only the structure pair", got)
+	}
+	weighted := NewPerceptualMatcher(10, WithDistance(hash.WeightedHammingDistance)).FindGroups(images)
+	if got := pairOf(weighted); got != "/detail" {
+		t.Fatalf("weighted Hamming grouped %s, want only the detail pair", got)
+	}
+	if d := weighted[0].Distance; d != hash.WeightedHammingDistance(0, detail) {
+		t.Errorf("group distance = %d, want the weighted distance %d", d, hash.WeightedHammingDistance(0, detail))
+	}
+}
+
+func TestPairwiseDistances(t *testing.T) {
+	images := []*models.ImageInfo{
+		{Hash: 0x00},
+		{Hash: 0x0F},
+		{Hash: 0xFF},
+	}
+	pairs := PairwiseDistances(images)
+
+	want := []models.ImagePair{
+		{A: 0, B: 1, Dist: 4},
+		{A: 0, B: 2, Dist: 8},
+		{A: 1, B: 2, Dist: 4},
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("got %d pairs, want %d", len(pairs), len(want))
+	}
+	for i := range want {
+		if pairs[i] != want[i] {
+			t.Errorf("pair %d = %+v, want %+v", i, pairs[i], want[i])
+		}
+	}
+
+	if PairwiseDistances(images[:1]) != nil {
+		t.Error("expected no pairs for a single image")
+	}
+
+	// A rotated copy is as close as its matching orientation hash
+	rotated := []*models.ImageInfo{
+		{Hash: 0x00, OrientationHashes: []uint64{0xFFFF_0001, 0xFFFF, 0xFF, 0xF0}},
+		{Hash: 0xFFFF_0000},
+	}
+	if pairs := PairwiseDistances(rotated); len(pairs) != 1 || pairs[0].Dist != 1 {
+		t.Errorf("rotated pair = %+v, want distance 1", pairs)
+	}
+}
+
 // Test that BK-Tree produces same results as brute force O(n²)
 func TestPerceptualMatcher_EquivalenceWithBruteForce(t *testing.T) {
 	// Create test images with various hashes
@@ -279,6 +639,96 @@ func TestPerceptualMatcher_EquivalenceWithBruteForce(t *testing.T) {
 	}
 }
 
+// bandTestImages returns n images with hashes in a narrow band, so that
+// chains, spread limits and same-dir exclusions all come into play
+func bandTestImages(n int) []*models.ImageInfo {
+	images := make([]*models.ImageInfo, n)
+	for i := range images {
+		h := uint64(i*2654435761) & 0xFFF
+		images[i] = &models.ImageInfo{
+			Path:              fmt.Sprintf("/dir%d/%03d.jpg", i%7, i),
+			Hash:              h,
+			OrientationHashes: []uint64{h << 20},
+			Score:             float64(i % 13),
+		}
+	}
+	return images
+}
+
+// groupSummary describes each group by its ID, distance, members and kept
+// image, for comparing the results of two matchers
+func groupSummary(groups []*models.DuplicateGroup) []string {
+	var out []string
+	for _, g := range groups {
+		var paths []string
+		for _, img := range g.Images {
+			paths = append(paths, img.Path)
+		}
+		out = append(out, fmt.Sprintf("#%d d%d %s keep %s", g.ID, g.Distance, strings.Join(paths, ","), g.Keep.Path))
+	}
+	return out
+}
+
+func TestPerceptualMatcher_ConcurrencyMatchesSingleTree(t *testing.T) {
+	images := bandTestImages(400)
+	for _, tt := range []struct {
+		name string
+		opts []PerceptualOption
+	}{
+		{"plain", nil},
+		{"max spread", []PerceptualOption{WithMaxSpread(4)}},
+		{"same dir", []PerceptualOption{WithIgnoreSameDir()}},
+		{"orientations", []PerceptualOption{WithOrientations()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			want := groupSummary(NewPerceptualMatcher(3, tt.opts...).FindGroups(images))
+			if len(want) == 0 {
+				t.Fatal("no groups to compare")
+			}
+			for _, n := range []int{2, 3, 8, 1000} {
+				opts := append(slices.Clone(tt.opts), WithConcurrency(n))
+				got := groupSummary(NewPerceptualMatcher(3, opts...).FindGroups(images))
+				if !slices.Equal(got, want) {
+					t.Errorf("concurrency %d: %d groups differ from the single tree's %d", n, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestAutoMatcher_PairsMatchTree(t *testing.T) {
+	images := bandTestImages(400)
+	for _, tt := range []struct {
+		name string
+		opts []PerceptualOption
+	}{
+		{"plain", nil},
+		{"max spread", []PerceptualOption{WithMaxSpread(4)}},
+		{"same dir", []PerceptualOption{WithIgnoreSameDir()}},
+		{"orientations", []PerceptualOption{WithOrientations()}},
+		{"format thresholds", []PerceptualOption{WithFormatThresholds(map[string]int{"jpg": 5})}},
+		{"concurrency", []PerceptualOption{WithConcurrency(3)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewPerceptualMatcher(3, tt.opts...)
+			want := groupSummary(tree.FindGroups(images))
+			if len(want) == 0 {
+				t.Fatal("no groups to compare")
+			}
+
+			pairs := NewPerceptualMatcher(3, tt.opts...)
+			pairs.search = searchPairs
+			if got := groupSummary(pairs.FindGroups(images)); !slices.Equal(got, want) {
+				t.Errorf("comparing every pair: %d groups differ from the tree's %d", len(got), len(want))
+			}
+			// 400 images at radius 3 or 5 are below the crossover
+			if got := groupSummary(NewAutoMatcher(3, tt.opts...).FindGroups(images)); !slices.Equal(got, want) {
+				t.Errorf("NewAutoMatcher: %d groups differ from the tree's %d", len(got), len(want))
+			}
+		})
+	}
+}
+
 func TestUnionFind(t *testing.T) {
 	uf := newUnionFind(5)
 
@@ -333,6 +783,27 @@ func BenchmarkBKTree_Find(b *testing.B) {
 	}
 }
 
+// BenchmarkBKTree_FindIdentical queries a tree holding many copies of one
+// hash; the time per query should not grow with the number of copies
+func BenchmarkBKTree_FindIdentical(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			tree := newBKTree(hash.HammingDistance)
+			for i := range n {
+				tree.insert(0xdeadbeef, i)
+			}
+			for i := range 1000 {
+				tree.insert(uint64(i*12345), n+i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.findWithinDistance(uint64(i*67890), 10)
+			}
+		})
+	}
+}
+
 func BenchmarkPerceptualMatcher_1000(b *testing.B) {
 	images := generateTestImages(1000)
 	matcher := NewPerceptualMatcher(10)
@@ -353,6 +824,36 @@ func BenchmarkPerceptualMatcher_5000(b *testing.B) {
 	}
 }
 
+// BenchmarkPerceptualMatcher_50000 compares one BK-tree with one per CPU.
+// Random hashes make the tree prune little at threshold 10, so a single
+// tree takes minutes; run it with -benchtime 1x.
+func BenchmarkPerceptualMatcher_50000(b *testing.B) {
+	images := randomTestImages(50000)
+	for _, n := range slices.Compact([]int{1, runtime.NumCPU()}) {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			matcher := NewPerceptualMatcher(10, WithConcurrency(n))
+			for b.Loop() {
+				matcher.FindGroups(images)
+			}
+		})
+	}
+}
+
+// randomTestImages returns n images with random hashes, like pHashes of
+// unrelated photos, every tenth a near copy of an earlier one
+func randomTestImages(n int) []*models.ImageInfo {
+	rng := rand.New(rand.NewPCG(1, 2))
+	images := make([]*models.ImageInfo, n)
+	for i := range images {
+		h := rng.Uint64()
+		if i%10 == 9 {
+			h = images[rng.IntN(i)].Hash ^ 1<<rng.IntN(64) ^ 1<<rng.IntN(64)
+		}
+		images[i] = &models.ImageInfo{Path: fmt.Sprintf("/%06d.jpg", i), Hash: h, Score: float64(i)}
+	}
+	return images
+}
+
 func generateTestImages(n int) []*models.ImageInfo {
 	images := make([]*models.ImageInfo, n)
 	for i := 0; i < n; i++ {
@@ -365,3 +866,151 @@ func generateTestImages(n int) []*models.ImageInfo {
 	}
 	return images
 }
+
+func TestPerceptualMatcher_Orientations(t *testing.T) {
+	const turned = 0xFFFF0000FFFF0000
+	// The original's hash turned 90 degrees is 2 bits from the rotated copy's,
+	// while the upright hashes are 32 apart. The copy has no orientation
+	// hashes of its own, as if scanned without --detect-rotations.
+	original := &models.ImageInfo{Path: "/original.jpg", Hash: 0, Score: 1,
+		OrientationHashes: []uint64{turned, ^uint64(0), ^uint64(turned), 0xF0F0F0F0F0F0F0F0}}
+	rotated := &models.ImageInfo{Path: "/rotated.jpg", Hash: turned ^ 0b11, Score: 1}
+
+	if groups := NewPerceptualMatcher(10).FindGroups([]*models.ImageInfo{original, rotated}); len(groups) != 0 {
+		t.Errorf("without WithOrientations: got %d groups, want none", len(groups))
+	}
+
+	for _, images := range [][]*models.ImageInfo{{original, rotated}, {rotated, original}} {
+		groups := NewPerceptualMatcher(10, WithOrientations()).FindGroups(images)
+		if len(groups) != 1 || len(groups[0].Images) != 2 {
+			t.Fatalf("%s first: got %d groups, want the original and its rotation", images[0].Path, len(groups))
+		}
+		if groups[0].Distance != 2 {
+			t.Errorf("%s first: group distance %d, want 2 (to the turned hash)", images[0].Path, groups[0].Distance)
+		}
+	}
+
+	groups := NewPerceptualMatcher(10, WithOrientations(), WithMaxSpread(4)).FindGroups([]*models.ImageInfo{original, rotated})
+	if len(groups) != 1 {
+		t.Errorf("WithMaxSpread(4): got %d groups, want the pair within spread by orientation", len(groups))
+	}
+}
+
+func TestPerceptualMatcher_ComposedOrientation(t *testing.T) {
+	// a's mirror is 1 bit from b's 90° turn (a transpose of a), while every
+	// upright hash is far from the other image's hashes
+	a := &models.ImageInfo{Path: "/a.jpg", Format: "jpeg", Hash: 0, Score: 1,
+		OrientationHashes: []uint64{0xFF, 0xFF00, 0xFF0000, 0xFFFF_0000_0000_0000}}
+	b := &models.ImageInfo{Path: "/b.jpg", Format: "jpeg", Hash: 0xFF_FFFF_FF00_0000, Score: 1,
+		OrientationHashes: []uint64{0xFFFF_0000_0000_0001, 0xFF00_0000, 0xF0F0_F0F0_0000, 0x0F0F_0F0F_0000}}
+	if d := hash.OrientedDistance(a, b, hash.HammingDistance); d != 1 {
+		t.Fatalf("OrientedDistance = %d, want 1 through the composed orientation", d)
+	}
+
+	for _, newMatcher := range []func(int, ...PerceptualOption) *PerceptualMatcher{NewPerceptualMatcher, NewAutoMatcher} {
+		for _, opts := range [][]PerceptualOption{
+			{WithOrientations()},
+			{WithOrientations(), WithMaxSpread(2)},
+			{WithOrientations(), WithAverageLinkage(2)},
+			{WithOrientations(), WithFormatThresholds(map[string]int{"jpg": 2})},
+		} {
+			groups := newMatcher(2, opts...).FindGroups([]*models.ImageInfo{a, b})
+			if len(groups) != 1 {
+				t.Fatalf("got %d groups, want a and b linked by the composed orientation", len(groups))
+			}
+			if groups[0].Distance != 1 {
+				t.Errorf("group distance = %d, want the linking distance 1", groups[0].Distance)
+			}
+		}
+	}
+	if pairs := PairwiseDistances([]*models.ImageInfo{a, b}); pairs[0].Dist != 1 {
+		t.Errorf("pairwise distance = %d, want 1", pairs[0].Dist)
+	}
+}
+
+// clusteredTestImages returns n images in sets of five: a random hash and
+// four copies within 6 bits of it (clusteredHashes), like a library where
+// most near-duplicates come in sets
+func clusteredTestImages(n int) []*models.ImageInfo {
+	hashes := clusteredHashes(rand.New(rand.NewPCG(3, 4)), (n+4)/5, 4, 6)[:n]
+	images := make([]*models.ImageInfo, n)
+	for i, h := range hashes {
+		images[i] = &models.ImageInfo{Path: fmt.Sprintf("/%06d.jpg", i), Hash: h, Score: float64(i)}
+	}
+	return images
+}
+
+// BenchmarkPerceptualMatcher_Search compares BK-trees with comparing every
+// pair across image counts, thresholds and two hash distributions: random
+// hashes with a few near copies (randomTestImages) and sets of near copies
+// (clusteredTestImages). pairsCrossover is taken from it. The largest
+// counts take seconds per run; select them with -bench and -benchtime=1x.
+func BenchmarkPerceptualMatcher_Search(b *testing.B) {
+	for _, dist := range []struct {
+		name   string
+		images func(int) []*models.ImageInfo
+	}{{"random", randomTestImages}, {"clustered", clusteredTestImages}} {
+		for _, threshold := range []int{0, 1, 2, 3, 4, 6, 10} {
+			for _, n := range []int{100, 300, 1000, 3000, 10000, 30000, 60000} {
+				images := dist.images(n)
+				for _, s := range []struct {
+					name   string
+					search search
+				}{{"tree", searchTree}, {"pairs", searchPairs}} {
+					b.Run(fmt.Sprintf("%s/threshold=%d/n=%d/%s", dist.name, threshold, n, s.name), func(b *testing.B) {
+						matcher := NewPerceptualMatcher(threshold)
+						matcher.search = s.search
+						for b.Loop() {
+							matcher.FindGroups(images)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestPerceptualMatcher_DHash(t *testing.T) {
+	// b's pHash is as close to a's as c's, but its dHash disagrees: a pHash
+	// false positive. d only matches a by dHash.
+	images := []*models.ImageInfo{
+		{Path: "/a.jpg", Hash: 0x00, DHash: 0xF0F0, Score: 1.0},
+		{Path: "/b.jpg", Hash: 0x03, DHash: 0x0F0F_0000_FFFF, Score: 1.0},
+		{Path: "/c.jpg", Hash: 0x05, DHash: 0xF0F1, Score: 1.0},
+		{Path: "/d.jpg", Hash: 0xFFFF_0000, DHash: 0xF0F3, Score: 1.0},
+	}
+	paths := func(groups []*models.DuplicateGroup) []string {
+		var out []string
+		for _, g := range groups {
+			var p []string
+			for _, img := range g.Images {
+				p = append(p, img.Path)
+			}
+			slices.Sort(p)
+			out = append(out, strings.Join(p, ","))
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	for _, m := range []struct {
+		name string
+		new  func(int, ...PerceptualOption) *PerceptualMatcher
+	}{{"tree", NewPerceptualMatcher}, {"pairs", NewAutoMatcher}} {
+		if got := paths(m.new(5).FindGroups(images)); !slices.Equal(got, []string{"/a.jpg,/b.jpg,/c.jpg"}) {
+			t.Errorf("%s, pHash only: groups %v, want a, b and c together", m.name, got)
+		}
+		if got := paths(m.new(5, WithDHash(5, CombineBoth)).FindGroups(images)); !slices.Equal(got, []string{"/a.jpg,/c.jpg"}) {
+			t.Errorf("%s, both: groups %v, want b dropped from a and c", m.name, got)
+		}
+		if got := paths(m.new(5, WithDHash(5, CombineEither)).FindGroups(images)); !slices.Equal(got, []string{"/a.jpg,/b.jpg,/c.jpg,/d.jpg"}) {
+			t.Errorf("%s, either: groups %v, want d joined by its dHash", m.name, got)
+		}
+	}
+
+	// An image without a dHash is matched by pHash alone
+	noDHash := []*models.ImageInfo{images[0], {Path: "/e.jpg", Hash: 0x01, Score: 1.0}}
+	if groups := NewPerceptualMatcher(5, WithDHash(5, CombineBoth)).FindGroups(noDHash); len(groups) != 1 {
+		t.Errorf("both: an image without a dHash should still match by pHash, got %d groups", len(groups))
+	}
+}
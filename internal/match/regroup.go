@@ -0,0 +1,63 @@
+package match
+
+import (
+	"fmt"
+	"slices"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// GroupStore is the storage Regroup reads stored images from and writes the
+// new groups to
+type GroupStore interface {
+	GetAllImages() ([]*models.ImageInfo, error)
+	GetIgnoredPaths() ([]string, error)
+	UpdateGroups(groups []*models.DuplicateGroup) error
+	CanonicalPath(path string) string
+}
+
+// Regroup runs m over every image in store, leaving out ignored ones and
+// those without a perceptual hash (read by an exact scan with
+// hash.WithHeaderOnly), and replaces the stored groups with the result. Only
+// stored hashes are used; no file is read. Returns the new groups and the
+// number of images matched.
+func Regroup(store GroupStore, m Matcher) ([]*models.DuplicateGroup, int, error) {
+	images, err := store.GetAllImages()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load images: %w", err)
+	}
+	ignored, err := store.GetIgnoredPaths()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load ignore list: %w", err)
+	}
+	candidates := slices.DeleteFunc(WithoutPaths(images, ignored, store.CanonicalPath), func(img *models.ImageInfo) bool {
+		return !hash.HasPerceptualHash(img)
+	})
+
+	groups := m.FindGroups(candidates)
+	if err := store.UpdateGroups(groups); err != nil {
+		return nil, 0, fmt.Errorf("failed to update groups: %w", err)
+	}
+	return groups, len(candidates), nil
+}
+
+// WithoutPaths returns the images whose path is not in paths, e.g. the
+// ignore list, comparing both as key maps them (such as
+// storage.Storage.CanonicalPath). The input slice is not modified.
+func WithoutPaths(images []*models.ImageInfo, paths []string, key func(string) string) []*models.ImageInfo {
+	if len(paths) == 0 {
+		return images
+	}
+	skip := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		skip[key(path)] = true
+	}
+	kept := make([]*models.ImageInfo, 0, len(images))
+	for _, img := range images {
+		if !skip[key(img.Path)] {
+			kept = append(kept, img)
+		}
+	}
+	return kept
+}
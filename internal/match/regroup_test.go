@@ -0,0 +1,73 @@
+package match
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/storage"
+)
+
+func TestRegroup_TighterThreshold(t *testing.T) {
+	store, err := storage.NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	images := []*models.ImageInfo{
+		{Path: "/a.jpg", Hash: 0, ModTime: now},
+		{Path: "/b.jpg", Hash: 0b1, ModTime: now},                // 1 from a
+		{Path: "/c.jpg", Hash: 0xFF, ModTime: now},               // 8 from a
+		{Path: "/d.jpg", Hash: 0xFFFFFFFF00000000, ModTime: now}, // far from all
+		{Path: "/ignored.jpg", Hash: 0, ModTime: now},
+		{Path: "/exact.jpg", HashVariant: hash.VariantHeader, ModTime: now}, // no pHash to match
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.IgnorePath("/ignored.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+
+	memberCount := func() int {
+		t.Helper()
+		groups, err := store.GetDuplicateGroups()
+		if err != nil {
+			t.Fatalf("GetDuplicateGroups failed: %v", err)
+		}
+		n := 0
+		for _, g := range groups {
+			n += len(g.Images)
+		}
+		return n
+	}
+
+	groups, matched, err := Regroup(store, NewPerceptualMatcher(10))
+	if err != nil {
+		t.Fatalf("Regroup failed: %v", err)
+	}
+	if matched != 4 {
+		t.Errorf("matched %d images, want 4 (ignored and header-only ones left out)", matched)
+	}
+	if len(groups) != 1 || len(groups[0].Images) != 3 {
+		t.Fatalf("threshold 10: got %d groups, want one of a, b, c", len(groups))
+	}
+	if n := memberCount(); n != 3 {
+		t.Errorf("threshold 10: %d images stored in groups, want 3", n)
+	}
+
+	groups, _, err = Regroup(store, NewPerceptualMatcher(6))
+	if err != nil {
+		t.Fatalf("Regroup failed: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("threshold 6: got %d groups, want one of a and b", len(groups))
+	}
+	if n := memberCount(); n != 2 {
+		t.Errorf("threshold 6: %d images stored in groups, want 2 (c no longer grouped)", n)
+	}
+}
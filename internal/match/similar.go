@@ -0,0 +1,39 @@
+package match
+
+import (
+	"sort"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// Neighbor is an image found near a query by FindSimilar
+type Neighbor struct {
+	Image    *models.ImageInfo
+	Distance int
+}
+
+// FindSimilar returns the images within threshold of query's hash, closest
+// first (ties by path). Only hashes of query's HashVariant are comparable, so
+// other images are skipped, as is query's own path.
+func FindSimilar(query *models.ImageInfo, images []*models.ImageInfo, threshold int) []Neighbor {
+	tree := newBKTree(hash.HammingDistance)
+	for i, img := range images {
+		if img.HashVariant == query.HashVariant && img.Path != query.Path {
+			tree.insert(img.Hash, i)
+		}
+	}
+
+	found := tree.findWithinDistance(query.Hash, threshold)
+	neighbors := make([]Neighbor, len(found))
+	for k, i := range found {
+		neighbors[k] = Neighbor{images[i], hash.HammingDistance(query.Hash, images[i].Hash)}
+	}
+	sort.Slice(neighbors, func(a, b int) bool {
+		if neighbors[a].Distance != neighbors[b].Distance {
+			return neighbors[a].Distance < neighbors[b].Distance
+		}
+		return neighbors[a].Image.Path < neighbors[b].Image.Path
+	})
+	return neighbors
+}
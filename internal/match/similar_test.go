@@ -0,0 +1,45 @@
+package match
+
+import (
+	"testing"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+func TestFindSimilar_RankedByDistance(t *testing.T) {
+	images := []*models.ImageInfo{
+		{Path: "/far.jpg", Hash: 0xFFFFFFFF00000000},
+		{Path: "/d3.jpg", Hash: 0b111},
+		{Path: "/d1.jpg", Hash: 0b1},
+		{Path: "/d0.jpg", Hash: 0},
+		{Path: "/d1b.jpg", Hash: 0b10},
+		{Path: "/d8.jpg", Hash: 0xFF},
+		{Path: "/luma.jpg", Hash: 0, HashVariant: hash.VariantLuma},
+		{Path: "/query.jpg", Hash: 0},
+	}
+	query := &models.ImageInfo{Path: "/query.jpg", Hash: 0}
+
+	found := FindSimilar(query, images, 5)
+	want := []struct {
+		path string
+		dist int
+	}{
+		{"/d0.jpg", 0},
+		{"/d1.jpg", 1},
+		{"/d1b.jpg", 1},
+		{"/d3.jpg", 3},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(found), len(want), found)
+	}
+	for i, w := range want {
+		if found[i].Image.Path != w.path || found[i].Distance != w.dist {
+			t.Errorf("match %d = %s at %d, want %s at %d", i, found[i].Image.Path, found[i].Distance, w.path, w.dist)
+		}
+	}
+
+	if found := FindSimilar(query, images, 10); len(found) != 5 || found[4].Image.Path != "/d8.jpg" {
+		t.Errorf("threshold 10: got %+v, want d8.jpg last of 5", found)
+	}
+}
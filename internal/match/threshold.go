@@ -0,0 +1,135 @@
+package match
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"imagedupfinder/internal/hash"
+)
+
+// DefaultThreshold is the Hamming distance threshold used when none is given
+// or none can be suggested
+const DefaultThreshold = 10
+
+const (
+	// maxSuggestSample caps how many hashes SuggestThreshold compares
+	// pairwise (n²/2 distances)
+	maxSuggestSample = 4000
+
+	// minFarDistance is where SuggestThreshold starts looking for the mode of
+	// unrelated images. Unrelated pHashes differ in about half their bits, so
+	// that cluster peaks around 32.
+	minFarDistance = 16
+)
+
+// ThresholdForSimilarity converts a similarity such as "90%" (the % is
+// optional), the share of bits two hashes of width bits must have in common,
+// to the largest Hamming distance that still meets it: 90% of 64 bits allows
+// 6 differing bits.
+func ThresholdForSimilarity(s string, bits int) (int, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid similarity %q: want a percentage from 0 to 100, e.g. 90%%", s)
+	}
+	// A hair of slack so that e.g. 87.5% of 64 is exactly 8, not 7.99...
+	return int(math.Floor(float64(bits)*(100-percent)/100 + 1e-9)), nil
+}
+
+// ParseFormatThresholds parses per-format thresholds such as
+// "jpg=12,png=6" for WithFormatThresholds. Format names are those
+// hash.ParseFormats accepts.
+func ParseFormatThresholds(s string) (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		format, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %q: want FORMAT=THRESHOLD, e.g. jpg=12", strings.TrimSpace(field))
+		}
+		format = strings.TrimSpace(format)
+		if _, err := hash.ParseFormats(format); err != nil {
+			return nil, err
+		}
+		t, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || t < 0 || t > hash.HashBits {
+			return nil, fmt.Errorf("invalid threshold %q for %s: want 0-%d", strings.TrimSpace(value), format, hash.HashBits)
+		}
+		thresholds[format] = t
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("no format thresholds given")
+	}
+	return thresholds, nil
+}
+
+// SuggestThreshold picks a Hamming threshold from the distribution of
+// pairwise distances between hashes. Near-duplicates form a cluster close to
+// 0 and unrelated images one around 32; the suggestion is the middle of the
+// widest valley between the two. Large inputs are thinned to an evenly spaced
+// sample first, which keeps fewer near-duplicate pairs, so the valley is
+// still found but may be noisier. Returns DefaultThreshold if there are too
+// few hashes or no near-duplicate cluster.
+func SuggestThreshold(hashes []uint64) int {
+	sample := hashes
+	if len(sample) > maxSuggestSample {
+		sample = make([]uint64, maxSuggestSample)
+		for i := range sample {
+			sample[i] = hashes[i*len(hashes)/maxSuggestSample]
+		}
+	}
+	if len(sample) < 2 {
+		return DefaultThreshold
+	}
+
+	var hist [65]int
+	for i := range sample {
+		for j := i + 1; j < len(sample); j++ {
+			hist[hash.HammingDistance(sample[i], sample[j])]++
+		}
+	}
+
+	far := minFarDistance
+	for d := minFarDistance; d < len(hist); d++ {
+		if hist[d] > hist[far] {
+			far = d
+		}
+	}
+
+	// Smooth over neighbouring distances so a stray pair in the gap doesn't
+	// split the valley in two
+	smoothed := func(d int) int {
+		sum := hist[d]
+		if d > 0 {
+			sum += hist[d-1]
+		}
+		if d < len(hist)-1 {
+			sum += hist[d+1]
+		}
+		return sum
+	}
+
+	// Widest run of the lowest smoothed count below the far mode
+	bestStart, bestLen, bestVal := 0, 0, -1
+	for d := 0; d < far; {
+		v := smoothed(d)
+		end := d + 1
+		for end < far && smoothed(end) == v {
+			end++
+		}
+		if bestVal < 0 || v < bestVal || (v == bestVal && end-d > bestLen) {
+			bestStart, bestLen, bestVal = d, end-d, v
+		}
+		d = end
+	}
+
+	// A valley starting at 0 means nothing is closer than the gap: no
+	// near-duplicates to separate
+	if bestStart == 0 {
+		return DefaultThreshold
+	}
+	return bestStart + (bestLen-1)/2
+}
@@ -0,0 +1,141 @@
+package match
+
+import (
+	"maps"
+	"math/rand/v2"
+	"testing"
+
+	"imagedupfinder/internal/hash"
+)
+
+// clusteredHashes returns groups random base hashes, each with copies
+// variants that flip up to maxFlip bits.
+func clusteredHashes(rng *rand.Rand, groups, copies, maxFlip int) []uint64 {
+	var hashes []uint64
+	for g := 0; g < groups; g++ {
+		base := rng.Uint64()
+		hashes = append(hashes, base)
+		for c := 0; c < copies; c++ {
+			h := base
+			for f := rng.IntN(maxFlip + 1); f > 0; f-- {
+				h ^= 1 << rng.IntN(64)
+			}
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// gap returns the largest within-cluster and smallest between-cluster
+// distance of hashes built by clusteredHashes.
+func gap(hashes []uint64, copies int) (near, far int) {
+	far = 64
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			d := hash.HammingDistance(hashes[i], hashes[j])
+			if i/(copies+1) == j/(copies+1) {
+				near = max(near, d)
+			} else {
+				far = min(far, d)
+			}
+		}
+	}
+	return near, far
+}
+
+func TestSuggestThreshold_SeparatedClusters(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	hashes := clusteredHashes(rng, 200, 3, 2)
+	near, far := gap(hashes, 3)
+	if near >= far {
+		t.Fatalf("test data not separated: near %d, far %d", near, far)
+	}
+
+	got := SuggestThreshold(hashes)
+	if got < near || got >= far {
+		t.Errorf("SuggestThreshold = %d, want within gap [%d, %d)", got, near, far)
+	}
+}
+
+func TestSuggestThreshold_SampledInput(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	// Large enough to be sampled; copies stay adjacent so some survive
+	hashes := clusteredHashes(rng, 2500, 3, 2)
+	if len(hashes) <= maxSuggestSample {
+		t.Fatalf("expected more than %d hashes, got %d", maxSuggestSample, len(hashes))
+	}
+
+	got := SuggestThreshold(hashes)
+	if got < 4 || got >= minFarDistance {
+		t.Errorf("SuggestThreshold = %d, want between the clusters", got)
+	}
+}
+
+func TestSuggestThreshold_Fallbacks(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	unrelated := make([]uint64, 300)
+	for i := range unrelated {
+		unrelated[i] = rng.Uint64()
+	}
+
+	tests := []struct {
+		name   string
+		hashes []uint64
+	}{
+		{"empty", nil},
+		{"single", []uint64{42}},
+		{"no near duplicates", unrelated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SuggestThreshold(tt.hashes); got != DefaultThreshold {
+				t.Errorf("SuggestThreshold = %d, want default %d", got, DefaultThreshold)
+			}
+		})
+	}
+}
+
+func TestThresholdForSimilarity(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"100%", 0},
+		{"90%", 6}, // 57.6 matching bits needed, so 58: 6 may differ
+		{"90", 6},
+		{"87.5%", 8},
+		{"85%", 9},
+		{"50%", 32},
+		{" 75% ", 16},
+		{"0%", 64},
+	}
+	for _, tt := range tests {
+		got, err := ThresholdForSimilarity(tt.in, hash.HashBits)
+		if err != nil || got != tt.want {
+			t.Errorf("ThresholdForSimilarity(%q, 64) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	if got, _ := ThresholdForSimilarity("90%", 256); got != 25 {
+		t.Errorf("90%% of 256 bits = %d, want 25", got)
+	}
+	for _, bad := range []string{"", "%", "ninety", "101%", "-5%"} {
+		if _, err := ThresholdForSimilarity(bad, hash.HashBits); err == nil {
+			t.Errorf("ThresholdForSimilarity(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseFormatThresholds(t *testing.T) {
+	got, err := ParseFormatThresholds("jpg=12, png = 6,.tif=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"jpg": 12, "png": 6, ".tif": 3}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range []string{"", "jpg", "jpg=", "jpg=-1", "jpg=65", "doc=5", "=5"} {
+		if _, err := ParseFormatThresholds(bad); err == nil {
+			t.Errorf("ParseFormatThresholds(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -1,29 +1,415 @@
 package models
 
-import "time"
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
 
 // ImageInfo holds metadata and hash information for an image
 type ImageInfo struct {
-	ID       int64     `json:"id"`
-	Path     string    `json:"path"`
-	Hash     uint64    `json:"hash"`
-	FileHash string    `json:"file_hash,omitempty"` // SHA256 hash for exact matching
-	Width    int       `json:"width"`
-	Height   int       `json:"height"`
-	Format   string    `json:"format"`
-	FileSize int64     `json:"file_size"`
-	ModTime  time.Time `json:"mod_time"`
-	HasExif  bool      `json:"has_exif"`
-	Score    float64   `json:"score"`
-	GroupID  int       `json:"group_id,omitempty"`
+	ID                int64     `json:"id"`
+	Path              string    `json:"path"`
+	Hash              uint64    `json:"hash"`
+	HashVariant       string    `json:"hash_variant,omitempty"` // how Hash was computed; "" is the standard pHash
+	FileHash          string    `json:"file_hash,omitempty"`    // SHA256 hash for exact matching
+	Width             int       `json:"width"`
+	Height            int       `json:"height"`
+	Format            string    `json:"format"`
+	FileSize          int64     `json:"file_size"`
+	ModTime           time.Time `json:"mod_time"`
+	HasExif           bool      `json:"has_exif"`
+	CaptureTime       time.Time `json:"capture_time,omitzero"`        // EXIF DateTimeOriginal; zero when absent
+	CameraMake        string    `json:"camera_make,omitempty"`        // EXIF Make
+	CameraModel       string    `json:"camera_model,omitempty"`       // EXIF Model
+	Software          string    `json:"software,omitempty"`           // EXIF Software, e.g. the editor that exported the file
+	ExifTagCount      int       `json:"exif_tag_count,omitempty"`     // number of EXIF fields present; 0 without EXIF or if unknown
+	BlurHash          string    `json:"blur_hash,omitempty"`          // placeholder for the web UI; only with scan --blurhash
+	OrientationHashes []uint64  `json:"orientation_hashes,omitempty"` // Hash of the image rotated 90/180/270° and mirrored; only with scan --detect-rotations
+	DHash             uint64    `json:"d_hash,omitempty"`             // difference hash, from the same image as Hash; 0 unless scanned with --match-both/--match-either
+	Sharpness         float64   `json:"sharpness,omitempty"`          // variance of the Laplacian (see hash.Sharpness); 0 if unknown
+	SidecarOf         string    `json:"sidecar_of,omitempty"`         // the other file of a RAW+JPEG pair shot together (see scan.LinkSidecars); "" if none
+	Score             float64   `json:"score"`
+	GroupID           int       `json:"group_id,omitempty"`
 }
 
+// ContentKey identifies a file's content for the hash cache without reading
+// the whole file: its size and mod time plus a digest of its first and last
+// bytes.
+type ContentKey struct {
+	Size    int64
+	ModTime time.Time
+	Sample  string // hex SHA-256 of the sampled bytes
+}
+
+// Match methods recorded on a DuplicateGroup
+const (
+	MatchExact      = "exact"      // byte-identical files
+	MatchPerceptual = "perceptual" // similar perceptual hashes
+)
+
 // DuplicateGroup represents a group of similar images
 type DuplicateGroup struct {
-	ID     int          `json:"id"`
-	Images []*ImageInfo `json:"images"`
-	Keep   *ImageInfo   `json:"keep"`   // Image to keep (highest score)
-	Remove []*ImageInfo `json:"remove"` // Images to remove
+	ID          int          `json:"id"`
+	Images      []*ImageInfo `json:"images"`
+	Keep        *ImageInfo   `json:"keep"`                   // Image to keep (see SelectKeep)
+	Keeps       []*ImageInfo `json:"keeps,omitempty"`        // Images kept besides Keep (see KeepTop)
+	Remove      []*ImageInfo `json:"remove"`                 // Images to remove
+	Pairs       []ImagePair  `json:"pairs,omitempty"`        // Distances within the group, when requested
+	MatchMethod string       `json:"match_method,omitempty"` // MatchExact or MatchPerceptual; "" if unknown
+	Distance    int          `json:"distance"`               // Largest hash distance within the group when it was formed
+	ReviewedAt  time.Time    `json:"reviewed_at,omitzero"`   // When the group was marked reviewed; zero if it isn't
+}
+
+// ImagePair is the hash distance between two images of a group. A and B
+// index the group's Images.
+type ImagePair struct {
+	A    int `json:"a"`
+	B    int `json:"b"`
+	Dist int `json:"dist"`
+}
+
+// KeepPolicy expresses a preference between two images of a group. It
+// returns a negative number if a should be kept over b, positive if b should
+// be kept over a, and 0 if it has no preference.
+type KeepPolicy func(a, b *ImageInfo) int
+
+// KeepOldestCapture prefers the image captured first. Copying a file rewrites
+// its mod time but not its EXIF date, so the EXIF date is used when present,
+// falling back to mod time.
+func KeepOldestCapture(a, b *ImageInfo) int {
+	return a.EffectiveCaptureTime().Compare(b.EffectiveCaptureTime())
+}
+
+// KeepSharpest prefers the sharper image (higher Sharpness), e.g. the best
+// frame of a burst. Images scanned before sharpness was recorded have none
+// and leave the choice to the next policy.
+func KeepSharpest(a, b *ImageInfo) int {
+	if a.Sharpness == 0 || b.Sharpness == 0 {
+		return 0
+	}
+	return cmp.Compare(b.Sharpness, a.Sharpness)
+}
+
+// KeepRichestExif prefers the image with more EXIF fields (ExifTagCount),
+// e.g. the copy that kept its GPS and lens data over one stripped down to a
+// timestamp by a messenger app. Images without EXIF, or scanned before the
+// fields were counted, leave the choice to the next policy.
+func KeepRichestExif(a, b *ImageInfo) int {
+	if a.ExifTagCount == 0 || b.ExifTagCount == 0 {
+		return 0
+	}
+	return cmp.Compare(b.ExifTagCount, a.ExifTagCount)
+}
+
+// KeepFormatOrder returns a policy preferring the image whose format comes
+// first in formats, e.g. {"png", "jpg"}; formats not listed rank after all
+// listed ones. Names are matched against ImageInfo.Format case-insensitively,
+// with "jpg" and "tif" standing for "jpeg" and "tiff".
+func KeepFormatOrder(formats []string) KeepPolicy {
+	rank := make(map[string]int, len(formats))
+	for i, f := range formats {
+		f = CanonicalFormat(f)
+		if _, dup := rank[f]; f != "" && !dup {
+			rank[f] = i
+		}
+	}
+	rankOf := func(img *ImageInfo) int {
+		if r, ok := rank[CanonicalFormat(img.Format)]; ok {
+			return r
+		}
+		return len(formats)
+	}
+	return func(a, b *ImageInfo) int {
+		return cmp.Compare(rankOf(a), rankOf(b))
+	}
+}
+
+// CanonicalFormat maps a format name to the form stored in ImageInfo.Format
+func CanonicalFormat(name string) string {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), ".")
+	switch name {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	}
+	return name
+}
+
+// KeepOriginalCamera prefers the file straight from the camera over edited
+// exports (see IsCameraOriginal).
+func KeepOriginalCamera(a, b *ImageInfo) int {
+	return cmp.Compare(editedRank(a), editedRank(b))
+}
+
+func editedRank(img *ImageInfo) int {
+	if img.IsCameraOriginal() {
+		return 0
+	}
+	return 1
+}
+
+// editingSoftware lists lowercase substrings of EXIF Software values written
+// by photo editors. Cameras and phones record their firmware there instead.
+var editingSoftware = []string{
+	"photoshop", "lightroom", "gimp", "affinity", "capture one", "darktable",
+	"rawtherapee", "pixelmator", "snapseed", "luminar", "paint.net", "acdsee",
+	"picasa",
+}
+
+// IsCameraOriginal reports whether img carries camera EXIF (Make or Model)
+// and was not written by a known photo editor
+func (img *ImageInfo) IsCameraOriginal() bool {
+	if img.CameraMake == "" && img.CameraModel == "" {
+		return false
+	}
+	software := strings.ToLower(img.Software)
+	for _, editor := range editingSoftware {
+		if strings.Contains(software, editor) {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectiveCaptureTime returns CaptureTime, or ModTime if it is unknown
+func (img *ImageInfo) EffectiveCaptureTime() time.Time {
+	if img.CaptureTime.IsZero() {
+		return img.ModTime
+	}
+	return img.CaptureTime
+}
+
+// keepByQuality is the default preference, applied after any policies:
+// higher score, then larger file, then newer mod time, then path.
+func keepByQuality(a, b *ImageInfo) int {
+	// Primary: score (higher is better)
+	if a.Score != b.Score {
+		if a.Score > b.Score {
+			return -1
+		}
+		return 1
+	}
+
+	// Secondary: file size (larger is better - more information)
+	if a.FileSize != b.FileSize {
+		if a.FileSize > b.FileSize {
+			return -1
+		}
+		return 1
+	}
+
+	// Tertiary: mod time (newer is better)
+	if c := a.ModTime.Compare(b.ModTime); c != 0 {
+		return -c
+	}
+
+	// Fallback: path (alphabetical)
+	if a.Path < b.Path {
+		return -1
+	}
+	if a.Path > b.Path {
+		return 1
+	}
+	return 0
+}
+
+// SelectKeep sets Keep and Remove from Images. policies are consulted in
+// order; ties fall through to the default quality ordering.
+func (g *DuplicateGroup) SelectKeep(policies ...KeepPolicy) {
+	if len(g.Images) == 0 {
+		return
+	}
+
+	sorted := make([]*ImageInfo, len(g.Images))
+	copy(sorted, g.Images)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		for _, policy := range policies {
+			if c := policy(a, b); c != 0 {
+				return c < 0
+			}
+		}
+		return keepByQuality(a, b) < 0
+	})
+
+	g.Keep = sorted[0]
+	g.Keeps = nil
+	g.Remove = sorted[1:]
+}
+
+// KeepTop keeps the n best images of the group instead of only Keep: the
+// first n-1 of Remove, which SelectKeep orders best first, move to Keeps.
+// Keep stays the single best image. n <= 1 changes nothing.
+func (g *DuplicateGroup) KeepTop(n int) {
+	if n <= 1 {
+		return
+	}
+	k := min(n-1, len(g.Remove))
+	g.Keeps = append(g.Keeps, g.Remove[:k]...)
+	g.Remove = g.Remove[k:]
+}
+
+// Reclaimable returns the total size of the images to remove
+func (g *DuplicateGroup) Reclaimable() int64 {
+	var total int64
+	for _, img := range g.Remove {
+		total += img.FileSize
+	}
+	return total
+}
+
+// FilterByReclaimable returns the groups whose Reclaimable is at least min,
+// in order
+func FilterByReclaimable(groups []*DuplicateGroup, min int64) []*DuplicateGroup {
+	var filtered []*DuplicateGroup
+	for _, g := range groups {
+		if g.Reclaimable() >= min {
+			filtered = append(filtered, g)
+		}
+	}
+	return filtered
+}
+
+// Reviewed reports whether the group has been marked reviewed
+func (g *DuplicateGroup) Reviewed() bool {
+	return !g.ReviewedAt.IsZero()
+}
+
+// FilterUnreviewed returns the groups not marked reviewed, in order
+func FilterUnreviewed(groups []*DuplicateGroup) []*DuplicateGroup {
+	var filtered []*DuplicateGroup
+	for _, g := range groups {
+		if !g.Reviewed() {
+			filtered = append(filtered, g)
+		}
+	}
+	return filtered
+}
+
+// GroupOrder compares two groups for sorting: negative if a sorts first,
+// positive if b does, 0 if equal
+type GroupOrder func(a, b *DuplicateGroup) int
+
+// ByGroupID orders groups by ID
+func ByGroupID(a, b *DuplicateGroup) int {
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// ByReclaimable orders groups by the bytes removing their duplicates frees
+func ByReclaimable(a, b *DuplicateGroup) int {
+	return cmp.Compare(a.Reclaimable(), b.Reclaimable())
+}
+
+// ByImageCount orders groups by number of images
+func ByImageCount(a, b *DuplicateGroup) int {
+	return cmp.Compare(len(a.Images), len(b.Images))
+}
+
+// GroupOrders maps the names group orders are chosen by (list --sort,
+// /api/groups?sort=) to the orders
+var GroupOrders = map[string]GroupOrder{
+	"id":          ByGroupID,
+	"reclaimable": ByReclaimable,
+	"images":      ByImageCount,
+}
+
+// SortGroups sorts groups by order, descending if desc. Ties keep ID order.
+func SortGroups(groups []*DuplicateGroup, order GroupOrder, desc bool) {
+	slices.SortStableFunc(groups, func(a, b *DuplicateGroup) int {
+		c := order(a, b)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = ByGroupID(a, b)
+		}
+		return c
+	})
+}
+
+// WriteGroupsJSON writes groups to w as one JSON array ([] if empty)
+func WriteGroupsJSON(w io.Writer, groups []*DuplicateGroup) error {
+	if groups == nil {
+		groups = []*DuplicateGroup{}
+	}
+	return json.NewEncoder(w).Encode(groups)
+}
+
+// WriteGroupsJSONL writes groups to w as newline-delimited JSON, one group
+// per line. Each line is written as soon as it is encoded, so a consumer can
+// process groups while the rest are still coming.
+func WriteGroupsJSONL(w io.Writer, groups []*DuplicateGroup) error {
+	enc := json.NewEncoder(w)
+	for _, g := range groups {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sidecar returns the image paired with img by SidecarOf, looked up in
+// byPath, or nil if it has none. A sidecar in a duplicate group of its own
+// is left to that group's keep decision and not returned either.
+func Sidecar(img *ImageInfo, byPath map[string]*ImageInfo) *ImageInfo {
+	if img.SidecarOf == "" {
+		return nil
+	}
+	sidecar := byPath[img.SidecarOf]
+	if sidecar == nil || sidecar.GroupID != 0 {
+		return nil
+	}
+	return sidecar
+}
+
+// DirRemoval summarizes the images to be removed from one directory
+type DirRemoval struct {
+	Dir     string
+	Count   int
+	Size    int64
+	Emptied bool // every scanned image in Dir is being removed
+}
+
+// RemovalsByDir groups remove by parent directory, sorted by directory.
+// scanned holds every scanned image and decides Emptied; subdirectories
+// count as separate directories.
+func RemovalsByDir(remove, scanned []*ImageInfo) []DirRemoval {
+	byDir := make(map[string]*DirRemoval)
+	for _, img := range remove {
+		dir := filepath.Dir(img.Path)
+		r, ok := byDir[dir]
+		if !ok {
+			r = &DirRemoval{Dir: dir}
+			byDir[dir] = r
+		}
+		r.Count++
+		r.Size += img.FileSize
+	}
+
+	inDir := make(map[string]int, len(byDir))
+	for _, img := range scanned {
+		if dir := filepath.Dir(img.Path); byDir[dir] != nil {
+			inDir[dir]++
+		}
+	}
+
+	removals := make([]DirRemoval, 0, len(byDir))
+	for dir, r := range byDir {
+		r.Emptied = r.Count >= inDir[dir]
+		removals = append(removals, *r)
+	}
+	slices.SortFunc(removals, func(a, b DirRemoval) int {
+		return cmp.Compare(a.Dir, b.Dir)
+	})
+	return removals
 }
 
 // ScanResult holds the result of a folder scan
@@ -34,11 +420,23 @@ type ScanResult struct {
 	Groups          []*DuplicateGroup `json:"groups"`
 }
 
+// ScanRecord is an entry of scan history. Regroups and imports cover the
+// whole database and are recorded with an empty Folder.
+type ScanRecord struct {
+	Folder          string    `json:"folder"`
+	ScannedAt       time.Time `json:"scanned_at"`
+	Matcher         string    `json:"matcher,omitempty"`   // MatchExact or MatchPerceptual; empty for scans recorded before it was kept
+	Threshold       int       `json:"threshold,omitempty"` // Distance threshold of a perceptual scan
+	TotalImages     int       `json:"total_images"`
+	TotalGroups     int       `json:"total_groups"`
+	TotalDuplicates int       `json:"total_duplicates"`
+}
+
 // FormatQualityMultiplier returns quality multiplier for image format
 func FormatQualityMultiplier(format string) float64 {
 	switch format {
-	case "png", "tiff", "bmp":
-		return 1.2 // Lossless formats
+	case "png", "tiff", "bmp", "cr2", "nef", "arw":
+		return 1.2 // Lossless formats (RAW: camera originals)
 	case "webp":
 		return 1.1 // Often lossless or high quality
 	case "jpeg", "jpg":
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func groupOf(id int, sizes ...int64) *DuplicateGroup {
+	g := &DuplicateGroup{ID: id}
+	for _, size := range sizes {
+		g.Images = append(g.Images, &ImageInfo{FileSize: size})
+	}
+	g.Keep, g.Remove = g.Images[0], g.Images[1:]
+	return g
+}
+
+func TestSortGroups_ReclaimableDesc(t *testing.T) {
+	groups := []*DuplicateGroup{
+		groupOf(1, 100, 100),           // 100 reclaimable
+		groupOf(2, 10, 5000),           // 5000
+		groupOf(3, 100, 100, 100, 100), // 300, most images
+	}
+
+	SortGroups(groups, ByReclaimable, true)
+
+	var ids []int
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+	if ids[0] != 2 || ids[1] != 3 || ids[2] != 1 {
+		t.Errorf("order = %v, want [2 3 1]", ids)
+	}
+}
+
+func TestSortGroups_TiesKeepIDOrder(t *testing.T) {
+	groups := []*DuplicateGroup{groupOf(3, 1, 1), groupOf(1, 1, 1), groupOf(2, 1, 1, 1)}
+
+	SortGroups(groups, ByImageCount, true)
+
+	if groups[0].ID != 2 || groups[1].ID != 1 || groups[2].ID != 3 {
+		t.Errorf("order = %d %d %d, want 2 1 3", groups[0].ID, groups[1].ID, groups[2].ID)
+	}
+}
+
+func TestFilterByReclaimable_KeepsLargeGroups(t *testing.T) {
+	const mb = 1 << 20
+	groups := []*DuplicateGroup{
+		groupOf(1, 8*mb, 8*mb),           // 8 MB reclaimable
+		groupOf(2, 4*mb, 1*mb),           // 1 MB
+		groupOf(3, 2*mb, 2*mb, 2*mb, mb), // 5 MB, exactly the threshold
+		groupOf(4, 100, 100, 100),        // 200 B
+	}
+
+	var ids []int
+	for _, g := range FilterByReclaimable(groups, 5*mb) {
+		ids = append(ids, g.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("kept groups %v, want [1 3]", ids)
+	}
+}
+
+func TestRemovalsByDir_FlagsEmptiedFolder(t *testing.T) {
+	img := func(path string, size int64) *ImageInfo {
+		return &ImageInfo{Path: path, FileSize: size}
+	}
+	scanned := []*ImageInfo{
+		img("/photos/a.jpg", 100),
+		img("/photos/b.jpg", 100),
+		img("/backup/a.jpg", 100),
+		img("/backup/b.jpg", 200),
+		img("/backup/old/c.jpg", 100), // a subfolder doesn't keep /backup alive
+	}
+	remove := []*ImageInfo{scanned[3], scanned[2], scanned[1]}
+
+	got := RemovalsByDir(remove, scanned)
+
+	want := []DirRemoval{
+		{Dir: filepath.FromSlash("/backup"), Count: 2, Size: 300, Emptied: true},
+		{Dir: filepath.FromSlash("/photos"), Count: 1, Size: 100, Emptied: false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("removal %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteGroupsJSONL_OneGroupPerLine(t *testing.T) {
+	groups := []*DuplicateGroup{groupOf(7, 100, 50), groupOf(3, 10, 10, 10), groupOf(12, 1, 2)}
+
+	var buf bytes.Buffer
+	if err := WriteGroupsJSONL(&buf, groups); err != nil {
+		t.Fatalf("WriteGroupsJSONL failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(groups) {
+		t.Fatalf("got %d lines, want one per group (%d)", len(lines), len(groups))
+	}
+	for i, line := range lines {
+		var g DuplicateGroup
+		if err := json.Unmarshal([]byte(line), &g); err != nil {
+			t.Fatalf("line %d is not valid JSON on its own: %v", i+1, err)
+		}
+		if g.ID != groups[i].ID || len(g.Images) != len(groups[i].Images) {
+			t.Errorf("line %d = group %d with %d images, want group %d with %d", i+1, g.ID, len(g.Images), groups[i].ID, len(groups[i].Images))
+		}
+	}
+
+	buf.Reset()
+	if err := WriteGroupsJSON(&buf, nil); err != nil || buf.String() != "[]\n" {
+		t.Errorf("WriteGroupsJSON(nil) = %q, %v; want an empty array", buf.String(), err)
+	}
+}
+
+func TestIsCameraOriginal(t *testing.T) {
+	tests := []struct {
+		img  ImageInfo
+		want bool
+	}{
+		{ImageInfo{CameraMake: "Apple", CameraModel: "iPhone 15", Software: "17.1"}, true},
+		{ImageInfo{CameraModel: "ILCE-7M4"}, true},
+		{ImageInfo{CameraMake: "Canon", Software: "Adobe Photoshop Lightroom Classic 13.0"}, false},
+		{ImageInfo{CameraMake: "FUJIFILM", Software: "GIMP 2.10.36"}, false},
+		{ImageInfo{Software: "Snapseed 2.0"}, false},
+		{ImageInfo{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.img.IsCameraOriginal(); got != tt.want {
+			t.Errorf("IsCameraOriginal(%q/%q/%q) = %v, want %v", tt.img.CameraMake, tt.img.CameraModel, tt.img.Software, got, tt.want)
+		}
+	}
+}
+
+func TestKeepFormatOrder_PrefersListedFormat(t *testing.T) {
+	// The JPEG scores higher, as a larger re-encode of the PNG might
+	png := &ImageInfo{Path: "/photo.png", Format: "png", Score: 100, FileSize: 500}
+	jpg := &ImageInfo{Path: "/photo.jpg", Format: "jpeg", Score: 900, FileSize: 2000}
+	gif := &ImageInfo{Path: "/photo.gif", Format: "gif", Score: 1000, FileSize: 100}
+
+	group := &DuplicateGroup{ID: 1, Images: []*ImageInfo{jpg, png}}
+	group.SelectKeep()
+	if group.Keep != jpg {
+		t.Fatalf("without the policy kept %s, want the higher-scoring JPEG", group.Keep.Path)
+	}
+	group.SelectKeep(KeepFormatOrder([]string{"png", "tiff", "webp", "jpg", "gif"}))
+	if group.Keep != png {
+		t.Errorf("kept %s, want the PNG", group.Keep.Path)
+	}
+
+	// Unlisted formats rank after listed ones, whatever their score
+	group = &DuplicateGroup{ID: 2, Images: []*ImageInfo{gif, jpg, png}}
+	group.SelectKeep(KeepFormatOrder([]string{" JPG", ".png"}))
+	if group.Keep != jpg || group.Remove[0] != png || group.Remove[1] != gif {
+		t.Errorf("order = %s, %s, %s; want jpg, png, gif", group.Keep.Path, group.Remove[0].Path, group.Remove[1].Path)
+	}
+}
+
+func TestKeepSharpest_UnknownSharpnessDefers(t *testing.T) {
+	sharp := &ImageInfo{Path: "/burst_01.jpg", Sharpness: 900, Score: 100}
+	soft := &ImageInfo{Path: "/burst_02.jpg", Sharpness: 150, Score: 200}
+	old := &ImageInfo{Path: "/burst_03.jpg", Score: 300} // scanned before sharpness was recorded
+
+	group := &DuplicateGroup{ID: 1, Images: []*ImageInfo{soft, sharp}}
+	group.SelectKeep(KeepSharpest)
+	if group.Keep != sharp {
+		t.Errorf("kept %s, want the sharper frame", group.Keep.Path)
+	}
+
+	group = &DuplicateGroup{ID: 2, Images: []*ImageInfo{sharp, old}}
+	group.SelectKeep(KeepSharpest)
+	if group.Keep != old {
+		t.Errorf("kept %s, want the higher score when one sharpness is unknown", group.Keep.Path)
+	}
+}
+
+func TestKeepRichestExif_UnknownCountDefers(t *testing.T) {
+	full := &ImageInfo{Path: "/IMG_0001.jpg", ExifTagCount: 42, Score: 100}
+	stripped := &ImageInfo{Path: "/IMG_0001-shared.jpg", ExifTagCount: 3, Score: 200}
+	old := &ImageInfo{Path: "/IMG_0001-old.jpg", Score: 300} // no EXIF, or scanned before it was counted
+
+	group := &DuplicateGroup{ID: 1, Images: []*ImageInfo{stripped, full}}
+	group.SelectKeep(KeepRichestExif)
+	if group.Keep != full {
+		t.Errorf("kept %s, want the copy with more EXIF fields", group.Keep.Path)
+	}
+
+	group = &DuplicateGroup{ID: 2, Images: []*ImageInfo{full, old}}
+	group.SelectKeep(KeepRichestExif)
+	if group.Keep != old {
+		t.Errorf("kept %s, want the higher score when one count is unknown", group.Keep.Path)
+	}
+}
+
+func TestSidecar(t *testing.T) {
+	raw := &ImageInfo{Path: "/a/IMG_1234.CR2", SidecarOf: "/a/IMG_1234.JPG"}
+	jpg := &ImageInfo{Path: "/a/IMG_1234.JPG", SidecarOf: "/a/IMG_1234.CR2", GroupID: 3}
+	single := &ImageInfo{Path: "/a/IMG_1235.JPG"}
+	byPath := map[string]*ImageInfo{raw.Path: raw, jpg.Path: jpg, single.Path: single}
+
+	if got := Sidecar(jpg, byPath); got != raw {
+		t.Errorf("Sidecar(jpg) = %v, want the RAW", got)
+	}
+	if got := Sidecar(raw, byPath); got != nil {
+		t.Errorf("Sidecar(raw) = %s, want nil for a sidecar in a group of its own", got.Path)
+	}
+	if got := Sidecar(single, byPath); got != nil {
+		t.Errorf("Sidecar(single) = %s, want nil", got.Path)
+	}
+}
+
+func TestKeepTop_KeepsBestN(t *testing.T) {
+	group := &DuplicateGroup{ID: 1}
+	for i, score := range []float64{300, 500, 100, 400, 200} {
+		group.Images = append(group.Images, &ImageInfo{Path: fmt.Sprintf("/%d.jpg", i), Score: score})
+	}
+	group.SelectKeep()
+	group.KeepTop(2)
+
+	if group.Keep.Score != 500 || len(group.Keeps) != 1 || group.Keeps[0].Score != 400 {
+		t.Fatalf("kept %v and %d others, want the 500 and 400 scores", group.Keep.Score, len(group.Keeps))
+	}
+	if len(group.Remove) != 3 {
+		t.Fatalf("removing %d images, want 3", len(group.Remove))
+	}
+	for _, img := range group.Remove {
+		if img.Score > 300 {
+			t.Errorf("removing %s (score %v), one of the two best", img.Path, img.Score)
+		}
+	}
+
+	// More than the group holds keeps everything
+	group.KeepTop(10)
+	if len(group.Remove) != 0 || len(group.Keeps) != 4 {
+		t.Errorf("KeepTop(10): %d kept besides Keep, %d removed; want 4 and 0", len(group.Keeps), len(group.Remove))
+	}
+}
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/models"
+)
+
+// WriteComparison writes the kept image of group and removal, one of its
+// images to remove, side by side: resolution, size, format and score, with
+// a mark on each row where the removal is the bigger of the two, so a kept
+// image that looks like the worse copy stands out before anything is
+// removed.
+func WriteComparison(w io.Writer, group *models.DuplicateGroup, removal *models.ImageInfo) error {
+	keep := group.Keep
+	header := fmt.Sprintf("Group #%d: keep vs. 1 of %d to remove\n", group.ID, len(group.Remove))
+	if _, err := fmt.Fprintf(w, "%s  keep:   %s\n  remove: %s\n", header, keep.Path, removal.Path); err != nil {
+		return err
+	}
+
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	row := func(name, a, b string, removalBigger bool) {
+		mark := ""
+		if removalBigger {
+			mark = "<- removal is bigger"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", name, a, b, mark)
+	}
+	row("", "keep", "remove", false)
+	row("Resolution", fmt.Sprintf("%dx%d", keep.Width, keep.Height), fmt.Sprintf("%dx%d", removal.Width, removal.Height),
+		removal.Width*removal.Height > keep.Width*keep.Height)
+	row("Size", fileutil.FormatSize(keep.FileSize), fileutil.FormatSize(removal.FileSize), removal.FileSize > keep.FileSize)
+	row("Format", strings.ToUpper(keep.Format), strings.ToUpper(removal.Format), false)
+	row("Score", fmt.Sprintf("%.0f", keep.Score), fmt.Sprintf("%.0f", removal.Score), removal.Score > keep.Score)
+	tw.Flush()
+	// Rows without a mark end in padding
+	for line := range strings.Lines(table.String()) {
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " \n")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
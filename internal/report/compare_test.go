@@ -0,0 +1,37 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"imagedupfinder/internal/models"
+)
+
+func TestWriteComparison(t *testing.T) {
+	keep := &models.ImageInfo{Path: "/photos/IMG_1.jpg", Width: 1024, Height: 768, FileSize: 200 << 10, Format: "jpeg", Score: 900}
+	removal := &models.ImageInfo{Path: "/backup/IMG_1.png", Width: 4032, Height: 3024, FileSize: 3 << 20, Format: "png", Score: 850}
+	other := &models.ImageInfo{Path: "/backup/IMG_1 small.jpg", Width: 640, Height: 480}
+	group := &models.DuplicateGroup{ID: 7, Keep: keep, Remove: []*models.ImageInfo{removal, other}}
+
+	var buf bytes.Buffer
+	if err := WriteComparison(&buf, group, removal); err != nil {
+		t.Fatal(err)
+	}
+	want := `Group #7: keep vs. 1 of 2 to remove
+  keep:   /photos/IMG_1.jpg
+  remove: /backup/IMG_1.png
+              keep      remove
+  Resolution  1024x768  4032x3024  <- removal is bigger
+  Size        200.0 KB  3.0 MB     <- removal is bigger
+  Format      JPEG      PNG
+  Score       900       850
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(buf.String(), other.Path) {
+		t.Error("only the given removal should be shown")
+	}
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// LinkStats counts what WriteLinks made
+type LinkStats struct {
+	Groups  int
+	Links   int
+	Skipped int // images inside archives, which have no file to link to
+}
+
+// WriteLinks lays the groups out under dir for review in a file browser: a
+// folder per group, group-<ID>, holding a symbolic link to every member
+// named keep_<name> or remove_<name> (with copyFiles, a copy instead). The
+// images themselves are never touched. dir is created if needed and must be
+// empty, so links from an earlier export aren't mixed in.
+func WriteLinks(dir string, groups []*models.DuplicateGroup, copyFiles bool) (LinkStats, error) {
+	var stats LinkStats
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return stats, fmt.Errorf("%s is not empty", dir)
+	}
+
+	for _, group := range groups {
+		groupDir := filepath.Join(dir, fmt.Sprintf("group-%04d", group.ID))
+		if err := os.MkdirAll(groupDir, 0755); err != nil {
+			return stats, fmt.Errorf("failed to create %s: %w", groupDir, err)
+		}
+		stats.Groups++
+
+		members := append([]*models.ImageInfo{group.Keep}, group.Remove...)
+		for i, img := range members {
+			if hash.IsArchiveEntry(img.Path) {
+				stats.Skipped++
+				continue
+			}
+			prefix := "remove_"
+			if i == 0 {
+				prefix = "keep_"
+			}
+			if _, err := fileutil.LinkFile(img.Path, groupDir, prefix+filepath.Base(img.Path), copyFiles); err != nil {
+				return stats, fmt.Errorf("failed to link %s: %w", img.Path, err)
+			}
+			stats.Links++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"imagedupfinder/internal/models"
+)
+
+func TestWriteLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need extra rights on Windows")
+	}
+	src := t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		os.MkdirAll(filepath.Join(src, dir), 0755)
+	}
+	keep := writePNG(t, filepath.Join(src, "a", "photo.png"))
+	dup1 := writePNG(t, filepath.Join(src, "b", "photo.png"))
+	dup2 := writePNG(t, filepath.Join(src, "c", "photo.png"))
+	other := writePNG(t, filepath.Join(src, "a", "cat.png"))
+	zipped := &models.ImageInfo{Path: filepath.Join(src, "album.zip") + "!cat.png"}
+	groups := []*models.DuplicateGroup{
+		{ID: 7, Keep: keep, Remove: []*models.ImageInfo{dup1, dup2}},
+		{ID: 12345, Keep: other, Remove: []*models.ImageInfo{zipped}},
+	}
+
+	out := filepath.Join(t.TempDir(), "review")
+	stats, err := WriteLinks(out, groups, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (LinkStats{Groups: 2, Links: 4, Skipped: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	want := map[string]string{
+		"group-0007/keep_photo.png":     keep.Path,
+		"group-0007/remove_photo.png":   dup1.Path,
+		"group-0007/remove_photo_1.png": dup2.Path,
+		"group-12345/keep_cat.png":      other.Path,
+	}
+	var got []string
+	filepath.WalkDir(out, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(out, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if len(got) != len(want) {
+		t.Errorf("export holds %v, want %d links", got, len(want))
+	}
+	for name, target := range want {
+		if !slices.Contains(got, name) {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if link, err := os.Readlink(filepath.Join(out, name)); err != nil || link != target {
+			t.Errorf("%s -> %q (%v), want a link to %s", name, link, err, target)
+		}
+	}
+
+	if _, err := WriteLinks(out, groups, false); err == nil {
+		t.Error("WriteLinks into a non-empty folder should fail")
+	}
+}
+
+func TestWriteLinks_Copy(t *testing.T) {
+	src := t.TempDir()
+	keep := writePNG(t, filepath.Join(src, "a.png"))
+	dup := writePNG(t, filepath.Join(src, "b.png"))
+	groups := []*models.DuplicateGroup{{ID: 1, Keep: keep, Remove: []*models.ImageInfo{dup}}}
+
+	out := t.TempDir()
+	if _, err := WriteLinks(out, groups, true); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(out, "group-0001", "remove_b.png"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("remove_b.png: %v, %v; want a regular copy", info, err)
+	}
+	if _, err := os.Stat(dup.Path); err != nil {
+		t.Errorf("the copied image is gone: %v", err)
+	}
+}
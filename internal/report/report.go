@@ -0,0 +1,122 @@
+// Package report writes duplicate groups as one self-contained HTML page,
+// thumbnails included, so what a scan found can be reviewed, shared or
+// archived without the database, the web UI or the files themselves.
+// Reports have no way to remove anything.
+package report
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/match"
+	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/thumbnail"
+)
+
+// DefaultThumbnailSize is the longest side of embedded thumbnails in pixels
+const DefaultThumbnailSize = 256
+
+//go:embed report.html
+var pageTemplate string
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size": fileutil.FormatSize,
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"hash": func(h uint64) string { return fmt.Sprintf("%016x", h) },
+	"inc":  func(i int) int { return i + 1 },
+}).Parse(pageTemplate))
+
+// Report is what a report describes
+type Report struct {
+	Folder      string
+	Matcher     string // models.MatchExact or models.MatchPerceptual
+	Threshold   int    // only shown for perceptual reports
+	TotalImages int
+	Groups      []*models.DuplicateGroup
+	CreatedAt   time.Time
+}
+
+// Option configures WriteHTML
+type Option func(*writer)
+
+// WithThumbnailSize sets the longest side of embedded thumbnails; n <= 0
+// leaves thumbnails out, which keeps the report small
+func WithThumbnailSize(n int) Option {
+	return func(w *writer) {
+		w.thumbSize = n
+	}
+}
+
+type writer struct {
+	thumbSize int
+}
+
+// pageData is the template's view of a Report
+type pageData struct {
+	Report
+	Perceptual bool
+	Duplicates int
+	Groups     []groupData
+}
+
+type groupData struct {
+	*models.DuplicateGroup
+	Members []memberData
+}
+
+type memberData struct {
+	*models.ImageInfo
+	Index     int
+	Thumbnail template.URL // data: URI; empty if the image couldn't be rendered
+}
+
+// WriteHTML writes r to w as an HTML page with a section per group. Each
+// member is embedded as a data: URI thumbnail with its metadata, and for
+// perceptual groups the hash distance between every pair of members is
+// listed. An image that can no longer be read is listed without a
+// thumbnail rather than failing the report.
+func WriteHTML(w io.Writer, r Report, opts ...Option) error {
+	wr := &writer{thumbSize: DefaultThumbnailSize}
+	for _, opt := range opts {
+		opt(wr)
+	}
+
+	data := pageData{Report: r, Perceptual: r.Matcher == models.MatchPerceptual}
+	for _, group := range r.Groups {
+		gd := groupData{DuplicateGroup: group}
+		if group.MatchMethod != models.MatchExact && len(group.Pairs) == 0 {
+			// Groups are copied so the caller's don't gain Pairs
+			g := *group
+			g.Pairs = match.PairwiseDistances(g.Images)
+			gd.DuplicateGroup = &g
+		}
+		for i, img := range group.Images {
+			gd.Members = append(gd.Members, memberData{ImageInfo: img, Index: i, Thumbnail: wr.thumbnail(img.Path)})
+		}
+		data.Duplicates += len(group.Images) - 1
+		data.Groups = append(data.Groups, gd)
+	}
+
+	if err := page.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// thumbnail returns the image at path as a data: URI thumbnail, or "" if
+// thumbnails are off or it can't be rendered
+func (w *writer) thumbnail(path string) template.URL {
+	if w.thumbSize <= 0 {
+		return ""
+	}
+	data, contentType, err := thumbnail.Render(path, w.thumbSize, false)
+	if err != nil {
+		return ""
+	}
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data))
+}
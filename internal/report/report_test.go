@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"imagedupfinder/internal/models"
+)
+
+func writePNG(t *testing.T, path string) *models.ImageInfo {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	return &models.ImageInfo{Path: path, Width: 40, Height: 30, Format: "png", FileSize: 100}
+}
+
+func TestWriteHTML(t *testing.T) {
+	dir := t.TempDir()
+	a := writePNG(t, filepath.Join(dir, "a.png"))
+	b := writePNG(t, filepath.Join(dir, "b.png"))
+	c := writePNG(t, filepath.Join(dir, "c.png"))
+	d := writePNG(t, filepath.Join(dir, "d.png"))
+	e := writePNG(t, filepath.Join(dir, "e.png"))
+	gone := &models.ImageInfo{Path: filepath.Join(dir, "gone.png"), Format: "png"}
+	b.Hash = 0b111
+
+	groups := []*models.DuplicateGroup{
+		{ID: 1, Images: []*models.ImageInfo{a, b, gone}, MatchMethod: models.MatchPerceptual, Distance: 3},
+		{ID: 2, Images: []*models.ImageInfo{c, d}, MatchMethod: models.MatchExact},
+	}
+	var buf bytes.Buffer
+	err := WriteHTML(&buf, Report{Folder: dir, Matcher: models.MatchPerceptual, Threshold: 10, TotalImages: 6, Groups: groups})
+	if err != nil {
+		t.Fatalf("WriteHTML failed: %v", err)
+	}
+	out := buf.String()
+
+	if n := strings.Count(out, `<section class="group"`); n != len(groups) {
+		t.Errorf("got %d group sections, want %d", n, len(groups))
+	}
+	for _, group := range groups {
+		start := strings.Index(out, fmt.Sprintf(`id="group-%d"`, group.ID))
+		if start < 0 {
+			t.Fatalf("no section for group %d", group.ID)
+		}
+		section, _, _ := strings.Cut(out[start:], "</section>")
+		for _, img := range group.Images {
+			if !strings.Contains(section, html.EscapeString(img.Path)) {
+				t.Errorf("group %d section doesn't reference %s", group.ID, img.Path)
+			}
+		}
+	}
+	if strings.Contains(out, e.Path) {
+		t.Errorf("report references %s, which is in no group", e.Path)
+	}
+	if n := strings.Count(out, `src="data:image/png;base64,`); n != 4 {
+		t.Errorf("got %d embedded thumbnails, want 4", n)
+	}
+	if !strings.Contains(out, "no preview") {
+		t.Error("unreadable image should be listed without a thumbnail")
+	}
+	if !strings.Contains(out, "<td>#1 ↔ #2</td><td>3</td>") {
+		t.Error("perceptual group should list its pairwise distances")
+	}
+	if groups[0].Pairs != nil {
+		t.Error("WriteHTML should not modify the caller's groups")
+	}
+}
+
+func TestWriteHTML_WithoutThumbnails(t *testing.T) {
+	a := writePNG(t, filepath.Join(t.TempDir(), "a.png"))
+	groups := []*models.DuplicateGroup{{ID: 1, Images: []*models.ImageInfo{a, a}, MatchMethod: models.MatchExact}}
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, Report{Matcher: models.MatchExact, Groups: groups}, WithThumbnailSize(0)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "data:") {
+		t.Error("WithThumbnailSize(0) should leave thumbnails out")
+	}
+}
@@ -0,0 +1,84 @@
+package scan
+
+import (
+	"runtime"
+	"time"
+
+	"imagedupfinder/internal/hash"
+)
+
+// ScanEstimate is what Estimate found: the files a scan would consider and a
+// rough duration for hashing them
+type ScanEstimate struct {
+	Files    int   // files passing the scan's filters
+	Bytes    int64 // their total size
+	Cached   int   // of which known and unchanged, so not re-hashed
+	Sampled  int   // files hashed to time the rest
+	Duration time.Duration
+}
+
+// Estimate walks folder with the scanner's filters like ScanFolder, but only
+// hashes up to sample of the files that would need hashing, spread over the
+// walk order, one at a time. Duration extrapolates their time per byte to
+// the bytes of all such files, divided among the hashing workers (at most
+// one per CPU). It is 0 when nothing needs hashing or no sampled file could
+// be hashed. Nothing is stored.
+func (s *Scanner) Estimate(folder string, sample int) (ScanEstimate, error) {
+	paths, err := s.collectPaths(folder, nil)
+	if err != nil {
+		return ScanEstimate{}, err
+	}
+
+	var est ScanEstimate
+	type pending struct {
+		path string
+		size int64
+	}
+	var todo []pending
+	var todoBytes int64
+	for _, path := range paths {
+		stat, err := hash.Stat(path)
+		if err != nil {
+			s.logf("skip %s: %v\n", path, err)
+			continue
+		}
+		est.Files++
+		est.Bytes += stat.Size()
+		if s.cachedInfo(path) != nil {
+			est.Cached++
+			continue
+		}
+		todo = append(todo, pending{path, stat.Size()})
+		todoBytes += stat.Size()
+	}
+
+	n := min(sample, len(todo))
+	var elapsed time.Duration
+	var sampledBytes int64
+	for i := range n {
+		f := todo[i*len(todo)/n]
+		start := s.now()
+		if _, err := s.hasher.HashImageWithTimeout(f.path, s.timeout); err != nil {
+			s.logf("skip %s: %v\n", f.path, err)
+			continue
+		}
+		elapsed += s.now().Sub(start)
+		sampledBytes += f.size
+		est.Sampled++
+	}
+	if sampledBytes > 0 {
+		perByte := float64(elapsed) / float64(sampledBytes)
+		est.Duration = time.Duration(perByte * float64(todoBytes) / float64(s.parallelism()))
+	}
+	return est, nil
+}
+
+// parallelism is the number of files hashed at once, capped by the CPUs
+// since decoding is CPU-bound
+func (s *Scanner) parallelism() int {
+	n := s.workers
+	if s.hashers > 0 {
+		n = s.hashers
+	}
+	return max(1, min(n, runtime.NumCPU()))
+}
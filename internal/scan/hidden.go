@@ -0,0 +1,23 @@
+package scan
+
+import (
+	"os"
+	"strings"
+)
+
+// isHidden reports whether a walked file or directory is hidden: a dotfile,
+// or on Windows one with the hidden attribute
+func isHidden(d os.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".") || hasHiddenAttribute(d)
+}
+
+// hiddenEntry reports whether any component of a zip entry name starts with
+// a dot, such as the "._photo.jpg" resource forks macOS adds to archives
+func hiddenEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package scan
+
+import "os"
+
+// hasHiddenAttribute is false outside Windows, where hidden means a dotfile
+func hasHiddenAttribute(d os.DirEntry) bool {
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package scan
+
+import (
+	"os"
+	"syscall"
+)
+
+// hasHiddenAttribute reports whether d has FILE_ATTRIBUTE_HIDDEN set, as
+// Explorer hides such files whatever their name
+func hasHiddenAttribute(d os.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
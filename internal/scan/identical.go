@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"os"
+	"sync"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// WithDedupeExactFirst collapses byte-identical files before hashing: files
+// that share their size with another are SHA-256'd, only one file of each
+// identical set is decoded and hashed, and the others are returned as copies
+// of its result under their own path, size and mod time. All of them carry
+// the FileHash. Reading a file is much cheaper than decoding it, so this pays
+// off in libraries with many exact copies. Known unchanged files are reused
+// as usual and take no part.
+func WithDedupeExactFirst(enabled bool) Option {
+	return func(s *Scanner) {
+		s.dedupeExact = enabled
+	}
+}
+
+// identicalSet is the files byte-identical to a representative, which alone
+// is hashed
+type identicalSet struct {
+	fileHash string
+	copies   []identicalFile
+}
+
+// identicalFile is a file found during the walk with its stat
+type identicalFile struct {
+	path     string
+	stat     os.FileInfo
+	fileHash string
+}
+
+// collapseIdentical returns paths without the files byte-identical to an
+// earlier one, and the sets of those left out keyed by the path they are
+// identical to
+func (s *Scanner) collapseIdentical(paths []string) ([]string, map[string]*identicalSet) {
+	var files []identicalFile
+	bySize := make(map[int64]int)
+	for _, path := range paths {
+		if s.cachedInfo(path) != nil {
+			continue
+		}
+		stat, err := hash.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, identicalFile{path: path, stat: stat})
+		bySize[stat.Size()]++
+	}
+
+	// Only files whose size collides can be identical to another, so the
+	// others are never read here
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if fileHash, err := hash.ComputeFileHash(files[i].path); err == nil {
+					files[i].fileHash = fileHash
+				}
+			}
+		}()
+	}
+	for i, f := range files {
+		if bySize[f.stat.Size()] > 1 {
+			work <- i
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	first := make(map[string]string) // file hash -> representative path
+	sets := make(map[string]*identicalSet)
+	collapsed := make(map[string]bool)
+	for _, f := range files {
+		if f.fileHash == "" {
+			continue
+		}
+		rep, ok := first[f.fileHash]
+		if !ok {
+			first[f.fileHash] = f.path
+			continue
+		}
+		if sets[rep] == nil {
+			sets[rep] = &identicalSet{fileHash: f.fileHash}
+		}
+		sets[rep].copies = append(sets[rep].copies, f)
+		collapsed[f.path] = true
+	}
+	if len(collapsed) == 0 {
+		return paths, nil
+	}
+
+	reps := make([]string, 0, len(paths)-len(collapsed))
+	for _, path := range paths {
+		if !collapsed[path] {
+			reps = append(reps, path)
+		}
+	}
+	return reps, sets
+}
+
+// copyInfo returns info as the result for f, a file identical to the one
+// info was hashed from
+func copyInfo(info *models.ImageInfo, f identicalFile) *models.ImageInfo {
+	dup := *info
+	dup.Path = f.path
+	dup.FileSize = f.stat.Size()
+	dup.ModTime = f.stat.ModTime()
+	dup.FileHash = f.fileHash
+	return &dup
+}
@@ -0,0 +1,147 @@
+package scan
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressInfo is passed to WithProgressInfo callbacks
+type ProgressInfo struct {
+	Scanned int
+	Total   int
+	Current string        // path just processed
+	Rate    float64       // files per second (moving average)
+	Elapsed time.Duration // since the first file started
+	ETA     time.Duration // estimated time remaining; 0 while unknown
+}
+
+// JSONProgress returns a WithProgressInfo callback that writes each tick to w
+// as one line of JSON, {"scanned":n,"total":t,"path":"..."}, for programs
+// driving the CLI. Write errors are ignored, like those of a progress line.
+func JSONProgress(w io.Writer) func(ProgressInfo) {
+	enc := json.NewEncoder(w)
+	return func(p ProgressInfo) {
+		enc.Encode(struct {
+			Scanned int    `json:"scanned"`
+			Total   int    `json:"total"`
+			Path    string `json:"path"`
+		}{p.Scanned, p.Total, p.Current})
+	}
+}
+
+// ScanSummary counts what became of the files a Scanner found
+type ScanSummary struct {
+	Hashed  int // returned: freshly hashed or reused
+	Skipped int // left out on purpose: unsupported type, hidden, excluded by an option
+	Failed  int // could not be read or hashed, including timeouts (see also WalkErrors)
+	Total   int // Hashed + Skipped + Failed
+}
+
+// summaryCounters accumulates a ScanSummary from concurrent workers
+type summaryCounters struct {
+	hashed, skipped, failed atomic.Int64
+}
+
+func (c *summaryCounters) summary() ScanSummary {
+	sum := ScanSummary{
+		Hashed:  int(c.hashed.Load()),
+		Skipped: int(c.skipped.Load()),
+		Failed:  int(c.failed.Load()),
+	}
+	sum.Total = sum.Hashed + sum.Skipped + sum.Failed
+	return sum
+}
+
+// WalkError is a path the walk could not read, with why
+type WalkError struct {
+	Path string
+	Err  error
+}
+
+// walkErrors collects WalkErrors from concurrent folder scans
+type walkErrors struct {
+	mu   sync.Mutex
+	errs []WalkError
+}
+
+func (w *walkErrors) add(path string, err error) {
+	w.mu.Lock()
+	w.errs = append(w.errs, WalkError{Path: path, Err: err})
+	w.mu.Unlock()
+}
+
+func (w *walkErrors) list() []WalkError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.errs)
+}
+
+const (
+	// rateInterval is how often a new rate sample is taken. Sampling over an
+	// interval rather than per file keeps bursts of reused (unchanged) files
+	// from swinging the rate.
+	rateInterval = time.Second
+
+	// rateSmoothing is the EWMA weight given to the newest sample
+	rateSmoothing = 0.3
+)
+
+// progressTracker turns scanned/total counts into ProgressInfo with a rate
+// and ETA. It is safe for concurrent use.
+type progressTracker struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	start    time.Time
+	lastTime time.Time
+	lastN    int
+	rate     float64
+}
+
+func newProgressTracker(now func() time.Time) *progressTracker {
+	start := now()
+	return &progressTracker{now: now, start: start, lastTime: start}
+}
+
+// update records that scanned of total files are done and returns the
+// resulting progress. Until the first sample interval has passed the rate is
+// the plain average since start.
+func (t *progressTracker) update(scanned, total int, current string) ProgressInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	elapsed := now.Sub(t.start)
+
+	if dt := now.Sub(t.lastTime); dt >= rateInterval && scanned >= t.lastN {
+		sample := float64(scanned-t.lastN) / dt.Seconds()
+		if t.rate == 0 {
+			t.rate = sample
+		} else {
+			t.rate = rateSmoothing*sample + (1-rateSmoothing)*t.rate
+		}
+		t.lastTime, t.lastN = now, scanned
+	}
+
+	rate := t.rate
+	if rate == 0 && elapsed > 0 {
+		rate = float64(scanned) / elapsed.Seconds()
+	}
+
+	var eta time.Duration
+	if rate > 0 && total > scanned {
+		eta = time.Duration(float64(total-scanned) / rate * float64(time.Second))
+	}
+
+	return ProgressInfo{
+		Scanned: scanned,
+		Total:   total,
+		Current: current,
+		Rate:    rate,
+		Elapsed: elapsed,
+		ETA:     eta,
+	}
+}
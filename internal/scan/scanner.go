@@ -1,11 +1,13 @@
 package scan
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"imagedupfinder/internal/hash"
@@ -14,11 +16,44 @@ import (
 
 // Scanner scans folders for images and computes hashes
 type Scanner struct {
-	hasher     *hash.Hasher
-	workers    int
-	timeout    time.Duration
-	progressFn func(scanned, total int, current string)
-	known      map[string]*models.ImageInfo
+	hasher      *hash.Hasher
+	workers     int
+	slots       chan struct{} // one per worker, shared by concurrent folders
+	readers     int           // read stage of the split pipeline; 0 when not split
+	hashers     int
+	readSlots   chan struct{}
+	hashSlots   chan struct{}
+	folders     int
+	maxOpen     int
+	cache       hash.Cache
+	normalize   bool
+	fastDecode  bool
+	centerCrop  float64
+	headerOnly  bool
+	blurHash    bool
+	orient      bool
+	dHash       bool
+	timeout     time.Duration
+	progressFn  func(scanned, total int, current string)
+	infoFn      func(ProgressInfo)
+	now         func() time.Time
+	known       map[string]*models.ImageInfo
+	knownKey    func(path string) string
+	skip        map[string]bool
+	since       time.Time
+	formats     hash.FormatSet
+	byContent   bool
+	archives    bool
+	hidden      bool
+	dedupeExact bool
+	batchSize   int
+	sinkFn      func(batch []*models.ImageInfo) error
+	logf        func(format string, args ...interface{})
+	counts      summaryCounters
+	walkErrs    walkErrors
+	ioErrs      walkErrors
+	retries     int
+	backoff     time.Duration
 }
 
 // Option configures a Scanner
@@ -33,6 +68,114 @@ func WithWorkers(n int) Option {
 	}
 }
 
+// WithReadWorkers splits the scan into two stages connected by a channel: n
+// goroutines read files into memory (I/O-bound), and WithHashWorkers
+// goroutines decode and hash them (CPU-bound), so each can be sized for the
+// disk and the CPU separately. Only readers hold files open. Setting either
+// option enables the split; the other stage then defaults to WithWorkers.
+func WithReadWorkers(n int) Option {
+	return func(s *Scanner) {
+		if n > 0 {
+			s.readers = n
+		}
+	}
+}
+
+// WithHashWorkers sets the number of goroutines decoding and hashing files
+// read by the read stage (see WithReadWorkers)
+func WithHashWorkers(n int) Option {
+	return func(s *Scanner) {
+		if n > 0 {
+			s.hashers = n
+		}
+	}
+}
+
+// WithFolderConcurrency lets ScanFolders scan up to n folders at once, which
+// helps when each is I/O-bound (e.g. network shares). Files are still hashed
+// by at most WithWorkers goroutines in total. n <= 1 scans folders one by one.
+func WithFolderConcurrency(n int) Option {
+	return func(s *Scanner) {
+		s.folders = n
+	}
+}
+
+// WithMaxOpenFiles limits how many image files may be open at once,
+// independently of the worker count. A file counts against the limit until
+// it is closed, including files still held by hashes that timed out.
+// n <= 0 means no limit.
+func WithMaxOpenFiles(n int) Option {
+	return func(s *Scanner) {
+		s.maxOpen = n
+	}
+}
+
+// WithHashCache looks files up in c by content before decoding them, so a
+// file already hashed under another path is not decoded again.
+func WithHashCache(c hash.Cache) Option {
+	return func(s *Scanner) {
+		s.cache = c
+	}
+}
+
+// WithNormalizeLuma hashes luminance-normalized images (see
+// hash.WithNormalizeLuma). Known images hashed the other way are re-hashed.
+func WithNormalizeLuma(enabled bool) Option {
+	return func(s *Scanner) {
+		s.normalize = enabled
+	}
+}
+
+// WithFastDecode hashes a downscaled copy of each image (see
+// hash.WithFastDecode). Known images hashed at full size are re-hashed.
+func WithFastDecode(enabled bool) Option {
+	return func(s *Scanner) {
+		s.fastDecode = enabled
+	}
+}
+
+// WithCenterCrop hashes the middle fraction of each image (see
+// hash.WithCenterCrop). Known images hashed with another crop are re-hashed.
+func WithCenterCrop(fraction float64) Option {
+	return func(s *Scanner) {
+		s.centerCrop = fraction
+	}
+}
+
+// WithHeaderOnly reads only the header and EXIF of each image, no pixels
+// (see hash.WithHeaderOnly), for exact matching by file hash, which needs no
+// perceptual hash. The other hashing options are then ignored. Known images
+// are reused whatever their variant.
+func WithHeaderOnly(enabled bool) Option {
+	return func(s *Scanner) {
+		s.headerOnly = enabled
+	}
+}
+
+// WithBlurHash computes a BlurHash placeholder for each hashed image (see
+// hash.WithBlurHash). Known images without one are re-hashed.
+func WithBlurHash(enabled bool) Option {
+	return func(s *Scanner) {
+		s.blurHash = enabled
+	}
+}
+
+// WithOrientations also hashes each image rotated and mirrored (see
+// hash.WithOrientations). Known images without those hashes are re-hashed.
+func WithOrientations(enabled bool) Option {
+	return func(s *Scanner) {
+		s.orient = enabled
+	}
+}
+
+// WithDHash also computes a dHash for each image (see hash.WithDHash).
+// Known images without one are re-hashed.
+func WithDHash(enabled bool) Option {
+	return func(s *Scanner) {
+		s.dHash = enabled
+	}
+}
+
 // WithTimeout sets the timeout for hashing each image
 func WithTimeout(d time.Duration) Option {
 	return func(s *Scanner) {
@@ -47,6 +190,15 @@ func WithProgress(fn func(scanned, total int, current string)) Option {
 	}
 }
 
+// WithProgressInfo sets a progress callback that also receives the scan rate
+// and an ETA. It can be combined with WithProgress. Calls are serialized and
+// Scanned never decreases from one call to the next.
+func WithProgressInfo(fn func(ProgressInfo)) Option {
+	return func(s *Scanner) {
+		s.infoFn = fn
+	}
+}
+
 // WithKnownImages provides previously scanned results keyed by path. Files
 // whose size and modification time still match their entry are not re-hashed;
 // the stored entry is returned as-is.
@@ -56,121 +208,669 @@ func WithKnownImages(known map[string]*models.ImageInfo) Option {
 	}
 }
 
+// WithKnownKey looks files up in the known images by key(path) instead of
+// the path itself, for known images keyed by a canonical form of their
+// paths (see storage.Storage.CanonicalPath)
+func WithKnownKey(key func(path string) string) Option {
+	return func(s *Scanner) {
+		s.knownKey = key
+	}
+}
+
+// WithSkipPaths excludes the given paths from the scan entirely: they are
+// neither hashed nor returned. Used to resume an interrupted scan, where the
+// caller already holds the results for these paths.
+func WithSkipPaths(skip map[string]bool) Option {
+	return func(s *Scanner) {
+		s.skip = skip
+	}
+}
+
+// WithModifiedSince skips files last modified before t during the walk, so
+// only newer files are hashed and returned. The zero time disables it.
+func WithModifiedSince(t time.Time) Option {
+	return func(s *Scanner) {
+		s.since = t
+	}
+}
+
+// WithFormats limits the scan to files with an extension in set (see
+// hash.ParseFormats). Other files are skipped during the walk. The default is
+// every supported format; an empty set keeps it.
+func WithFormats(set hash.FormatSet) Option {
+	return func(s *Scanner) {
+		if len(set) > 0 {
+			s.formats = set
+		}
+	}
+}
+
+// WithDetectByContent also accepts files whose extension is not an image
+// one, or that have none, when their first bytes are those of a format in
+// the WithFormats set (see hash.SniffFormat). Every such file met during the
+// walk is opened, so this slows down folders full of other files.
+func WithDetectByContent(enabled bool) Option {
+	return func(s *Scanner) {
+		s.byContent = enabled
+	}
+}
+
+// WithArchives makes the scan look inside .zip archives: each supported
+// image in one is hashed in memory and recorded under hash.ArchivePath, so it
+// groups with loose copies. The archives themselves are left untouched.
+func WithArchives(enabled bool) Option {
+	return func(s *Scanner) {
+		s.archives = enabled
+	}
+}
+
+// WithIncludeHidden also scans hidden files and descends into hidden
+// directories: those whose name starts with a dot and, on Windows, those
+// with the hidden attribute. By default they are skipped, .git and .cache
+// included. The folder being scanned is never skipped itself.
+func WithIncludeHidden(enabled bool) Option {
+	return func(s *Scanner) {
+		s.hidden = enabled
+	}
+}
+
+// WithRetries reads a file again up to n times after a transient I/O error
+// (EIO, a timeout, EAGAIN), as network mounts produce now and then, waiting
+// backoff before the first retry and twice as long before each next one.
+// The worker slot stays taken meanwhile, which slows the scan down on a
+// struggling mount. Decode failures are not retried. Files still failing are
+// listed by IOErrors.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(s *Scanner) {
+		s.retries = max(0, n)
+		s.backoff = backoff
+	}
+}
+
+// WithBatchSink sets a callback that receives results in batches of size n
+// as they are produced, so they can be persisted before the whole scan
+// finishes. Calls are serialized. If fn returns an error the scan stops and
+// ScanFolder returns that error.
+func WithBatchSink(n int, fn func(batch []*models.ImageInfo) error) Option {
+	return func(s *Scanner) {
+		if n > 0 {
+			s.batchSize = n
+			s.sinkFn = fn
+		}
+	}
+}
+
+// WithLogf sets a function receiving per-file details (hashed, reused,
+// skipped and why). Calls may come from multiple goroutines.
+func WithLogf(fn func(format string, args ...interface{})) Option {
+	return func(s *Scanner) {
+		s.logf = fn
+	}
+}
+
 // NewScanner creates a new Scanner
 func NewScanner(opts ...Option) *Scanner {
 	s := &Scanner{
 		hasher:  hash.NewHasher(),
 		workers: 8,
+		formats: hash.AllFormats(),
 		timeout: 30 * time.Second,
+		logf:    func(string, ...interface{}) {},
+		now:     time.Now,
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.slots = make(chan struct{}, s.workers)
+	if s.readers > 0 || s.hashers > 0 {
+		if s.readers == 0 {
+			s.readers = s.workers
+		}
+		if s.hashers == 0 {
+			s.hashers = s.workers
+		}
+		s.readSlots = make(chan struct{}, s.readers)
+		s.hashSlots = make(chan struct{}, s.hashers)
+	}
+	var hasherOpts []hash.Option
+	if s.maxOpen > 0 {
+		hasherOpts = append(hasherOpts, hash.WithOpener(limitOpen(hash.OpenFile, s.maxOpen)))
+	}
+	if s.cache != nil {
+		hasherOpts = append(hasherOpts, hash.WithCache(s.cache))
+	}
+	if s.normalize {
+		hasherOpts = append(hasherOpts, hash.WithNormalizeLuma())
+	}
+	if s.fastDecode {
+		hasherOpts = append(hasherOpts, hash.WithFastDecode())
+	}
+	if s.headerOnly {
+		hasherOpts = append(hasherOpts, hash.WithHeaderOnly())
+	}
+	if s.centerCrop > 0 && s.centerCrop < 1 {
+		hasherOpts = append(hasherOpts, hash.WithCenterCrop(s.centerCrop))
+	}
+	if s.blurHash {
+		hasherOpts = append(hasherOpts, hash.WithBlurHash())
+	}
+	if s.orient {
+		hasherOpts = append(hasherOpts, hash.WithOrientations())
+	}
+	if s.dHash {
+		hasherOpts = append(hasherOpts, hash.WithDHash())
+	}
+	if len(hasherOpts) > 0 {
+		s.hasher = hash.NewHasher(hasherOpts...)
+	}
 	return s
 }
 
+// supports reports whether path is to be scanned as an image, by its
+// extension or WithDetectByContent its content
+func (s *Scanner) supports(path string) bool {
+	if s.formats.Supports(path) {
+		return true
+	}
+	return s.byContent && !hash.IsArchiveEntry(path) && s.formats.SupportsContent(path)
+}
+
 // ScanFolder scans a folder for images and returns their info
 func (s *Scanner) ScanFolder(folder string) ([]*models.ImageInfo, error) {
-	// First, collect all image paths. WalkDir uses fs.DirEntry and avoids an
-	// os.Lstat syscall per file (unlike filepath.Walk), which is noticeably
-	// faster on large trees.
-	var paths []string
-	err := filepath.WalkDir(folder, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil // Skip errors
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if hash.IsSupportedImage(path) {
-			paths = append(paths, path)
-		}
-		return nil
-	})
+	return s.scanFolder(folder, nil)
+}
+
+// scanFolder is ScanFolder, but if claim is set only paths it returns true
+// for are scanned. ScanFolders uses it so that a file under overlapping
+// roots is scanned once.
+func (s *Scanner) scanFolder(folder string, claim func(path string) bool) ([]*models.ImageInfo, error) {
+	paths, err := s.collectPaths(folder, claim)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk folder: %w", err)
+		return nil, err
 	}
-
 	if len(paths) == 0 {
 		return nil, nil
 	}
 
+	var identical map[string]*identicalSet
+	total := len(paths)
+	if s.dedupeExact {
+		paths, identical = s.collapseIdentical(paths)
+	}
+
 	// Process images in parallel
 	var (
-		results   = make([]*models.ImageInfo, 0, len(paths))
+		results   = make([]*models.ImageInfo, 0, total)
 		resultsMu sync.Mutex
 		wg        sync.WaitGroup
 		scanned   int64
-		total     = len(paths)
+		sink      = s.newBatcher()
+		tracker   = newProgressTracker(s.now)
+		infoMu    sync.Mutex
 	)
 
 	// Feed paths through a small bounded channel rather than buffering all of
-	// them at once, keeping memory flat regardless of folder size.
+	// them at once, keeping memory flat regardless of folder size. Feeding
+	// stops early if the sink fails.
 	work := make(chan string, s.workers)
 	go func() {
+		defer close(work)
 		for _, p := range paths {
-			work <- p
+			select {
+			case work <- p:
+			case <-sink.failed:
+				return
+			}
 		}
-		close(work)
 	}()
 
+	var record func(path string, info *models.ImageInfo)
+	record = func(path string, info *models.ImageInfo) {
+		if set := identical[path]; set != nil {
+			if info != nil {
+				info.FileHash = set.fileHash
+			}
+			for _, f := range set.copies {
+				if info == nil {
+					record(f.path, nil)
+					continue
+				}
+				s.logf("copy %s: identical to %s\n", f.path, path)
+				record(f.path, copyInfo(info, f))
+			}
+		}
+		if info == nil {
+			s.counts.failed.Add(1)
+			atomic.AddInt64(&scanned, 1)
+			return
+		}
+		s.counts.hashed.Add(1)
+
+		resultsMu.Lock()
+		results = append(results, info)
+		resultsMu.Unlock()
+		sink.add(info)
+
+		n := atomic.AddInt64(&scanned, 1)
+		if s.progressFn != nil {
+			s.progressFn(int(n), total, path)
+		}
+		if s.infoFn != nil {
+			// Read under the lock, so another worker's later count is never
+			// reported before this one
+			infoMu.Lock()
+			s.infoFn(tracker.update(int(atomic.LoadInt64(&scanned)), total, path))
+			infoMu.Unlock()
+		}
+	}
+
 	// Start workers
-	for i := 0; i < s.workers; i++ {
+	if s.readers > 0 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for path := range work {
-				info := s.cachedInfo(path)
-				if info == nil {
-					var err error
-					info, err = s.hasher.HashImageWithTimeout(path, s.timeout)
-					if err != nil {
-						// Skip failed images silently
-						atomic.AddInt64(&scanned, 1)
-						continue
-					}
+			s.scanPipelined(work, record)
+		}()
+	} else {
+		for i := 0; i < s.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for path := range work {
+					record(path, s.scanFile(path))
 				}
+			}()
+		}
+	}
 
-				resultsMu.Lock()
-				results = append(results, info)
-				resultsMu.Unlock()
+	wg.Wait()
 
-				n := atomic.AddInt64(&scanned, 1)
-				if s.progressFn != nil {
-					s.progressFn(int(n), total, path)
+	if err := sink.flush(); err != nil {
+		return nil, fmt.Errorf("failed to store scan results: %w", err)
+	}
+
+	return results, nil
+}
+
+// collectPaths walks folder and returns the paths of the files to scan,
+// after the format, hidden, resume, since and claim filters; the others are
+// counted as skipped and walk errors recorded. WalkDir uses fs.DirEntry and
+// avoids an os.Lstat syscall per file (unlike filepath.Walk), which is
+// noticeably faster on large trees.
+func (s *Scanner) collectPaths(folder string, claim func(path string) bool) ([]string, error) {
+	var paths []string
+	add := func(path string, info func() (os.FileInfo, error)) {
+		switch {
+		case !s.supports(path):
+			s.logf("skip %s: unsupported file type\n", path)
+		case s.skip[path]:
+			s.logf("skip %s: already processed\n", path)
+		case s.modifiedBefore(info):
+			s.logf("skip %s: modified before %s\n", path, s.since.Format(time.RFC3339))
+		case claim != nil && !claim(path):
+			s.logf("skip %s: already scanned under another folder\n", path)
+		default:
+			paths = append(paths, path)
+			return
+		}
+		s.counts.skipped.Add(1)
+	}
+	err := filepath.WalkDir(folder, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			// Keep walking, but record the error: for a directory it means
+			// the whole subtree was missed
+			s.logf("skip %s: %v\n", path, err)
+			s.walkErrs.add(path, err)
+			return nil
+		}
+		if path != folder && !s.hidden && isHidden(d) {
+			s.logf("skip %s: hidden\n", path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			s.counts.skipped.Add(1)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if s.archives && hash.IsArchive(path) {
+			entries, err := hash.ArchiveImages(path, s.formats)
+			if err != nil {
+				s.logf("skip %s: %v\n", path, err)
+				s.counts.failed.Add(1)
+				return nil
+			}
+			for _, f := range entries {
+				if !s.hidden && hiddenEntry(f.Name) {
+					s.logf("skip %s: hidden\n", hash.ArchivePath(path, f.Name))
+					s.counts.skipped.Add(1)
+					continue
 				}
+				add(hash.ArchivePath(path, f.Name), func() (os.FileInfo, error) { return f.FileInfo(), nil })
+			}
+			return nil
+		}
+		add(path, d.Info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk folder: %w", err)
+	}
+	return paths, nil
+}
+
+// Summary counts the files found by every scan this scanner has run so
+// far. Directories are not counted, nor the contents of skipped hidden ones.
+// Safe to call while a scan is running.
+func (s *Scanner) Summary() ScanSummary {
+	return s.counts.summary()
+}
+
+// WalkErrors returns the paths every scan so far could not walk into,
+// typically directories whose listing was denied, in the order they were
+// met. Their contents are missing from the results.
+func (s *Scanner) WalkErrors() []WalkError {
+	return s.walkErrs.list()
+}
+
+// IOErrors returns the files every scan so far gave up on after a transient
+// I/O error (see WithRetries). They are left out of the results, so they
+// are not marked processed and scan again on the next run or --resume.
+func (s *Scanner) IOErrors() []WalkError {
+	return s.ioErrs.list()
+}
+
+// modifiedBefore reports whether WithModifiedSince is set and the file info
+// describes was last modified before it. Files whose mod time can't be read
+// are scanned.
+func (s *Scanner) modifiedBefore(stat func() (os.FileInfo, error)) bool {
+	if s.since.IsZero() {
+		return false
+	}
+	info, err := stat()
+	return err == nil && info.ModTime().Before(s.since)
+}
+
+// scanFile returns the info for path, reused or freshly hashed, or nil if
+// it could not be hashed. It holds one of the scanner's worker slots, so
+// concurrent folder scans share the worker limit.
+func (s *Scanner) scanFile(path string) *models.ImageInfo {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	if info := s.cachedInfo(path); info != nil {
+		s.logf("reuse %s: unchanged since last scan\n", path)
+		return info
+	}
+	info, err := withRetries(s, path, func() (*models.ImageInfo, error) {
+		return s.hasher.HashImageWithTimeout(path, s.timeout)
+	})
+	if err != nil {
+		// Skip failed images
+		s.logf("skip %s: %v\n", path, err)
+		return nil
+	}
+	s.logf("hash %s\n", path)
+	return info
+}
+
+// scanPipelined is the worker loop split in two (WithReadWorkers): readers
+// take paths from work and pass loaded files to hashers over a channel. It
+// returns once every path has been recorded.
+func (s *Scanner) scanPipelined(work <-chan string, record func(path string, info *models.ImageInfo)) {
+	loaded := make(chan *hash.LoadedImage, s.hashers)
+
+	var readers sync.WaitGroup
+	for i := 0; i < s.readers; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for path := range work {
+				reused, img := s.loadFile(path)
+				if img == nil {
+					record(path, reused)
+					continue
+				}
+				loaded <- img
 			}
 		}()
 	}
+	go func() {
+		readers.Wait()
+		close(loaded)
+	}()
 
-	wg.Wait()
+	var hashers sync.WaitGroup
+	for i := 0; i < s.hashers; i++ {
+		hashers.Add(1)
+		go func() {
+			defer hashers.Done()
+			for img := range loaded {
+				record(img.Path, s.hashLoaded(img))
+			}
+		}()
+	}
+	hashers.Wait()
+}
 
-	return results, nil
+// loadFile is the read stage of scanFile: it returns the reused entry for
+// path, or else the file read into memory, or neither if it could not be
+// read. It holds a read slot.
+func (s *Scanner) loadFile(path string) (*models.ImageInfo, *hash.LoadedImage) {
+	s.readSlots <- struct{}{}
+	defer func() { <-s.readSlots }()
+
+	if info := s.cachedInfo(path); info != nil {
+		s.logf("reuse %s: unchanged since last scan\n", path)
+		return info, nil
+	}
+	img, err := withRetries(s, path, func() (*hash.LoadedImage, error) {
+		return s.hasher.LoadImage(path, s.timeout)
+	})
+	if err != nil {
+		s.logf("skip %s: %v\n", path, err)
+		return nil, nil
+	}
+	return nil, img
+}
+
+// withRetries calls fn, and again after each transient I/O error as set by
+// WithRetries. A transient error that outlasts the retries is recorded in
+// IOErrors.
+func withRetries[T any](s *Scanner, path string, fn func() (T, error)) (T, error) {
+	delay := s.backoff
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || !isTransient(err) {
+			return v, err
+		}
+		if attempt == s.retries {
+			s.ioErrs.add(path, err)
+			return v, err
+		}
+		s.logf("retry %s in %v: %v\n", path, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is an I/O error that may go away when the
+// file is read again, as opposed to a broken or unsupported file
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.EAGAIN)
+}
+
+// hashLoaded is the hash stage of scanFile. It holds a hash slot.
+func (s *Scanner) hashLoaded(img *hash.LoadedImage) *models.ImageInfo {
+	s.hashSlots <- struct{}{}
+	defer func() { <-s.hashSlots }()
+
+	info, err := s.hasher.HashLoaded(img, s.timeout)
+	if err != nil {
+		s.logf("skip %s: %v\n", img.Path, err)
+		return nil
+	}
+	s.logf("hash %s\n", img.Path)
+	return info
+}
+
+// batcher accumulates scan results and hands them to the sink in fixed-size
+// batches. Sink calls are serialized; after the first error no further calls
+// are made and failed is closed so the scan can stop early. A batcher
+// without a sink function ignores everything.
+type batcher struct {
+	mu      sync.Mutex
+	size    int
+	fn      func(batch []*models.ImageInfo) error
+	pending []*models.ImageInfo
+	err     error
+	failed  chan struct{}
+}
+
+func (s *Scanner) newBatcher() *batcher {
+	return &batcher{size: s.batchSize, fn: s.sinkFn, failed: make(chan struct{})}
+}
+
+func (b *batcher) add(info *models.ImageInfo) {
+	if b.fn == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
+	}
+	b.pending = append(b.pending, info)
+	if len(b.pending) >= b.size {
+		b.sendLocked()
+	}
+}
+
+// flush sends any remaining results and returns the first sink error.
+func (b *batcher) flush() error {
+	if b.fn == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil && len(b.pending) > 0 {
+		b.sendLocked()
+	}
+	return b.err
+}
+
+func (b *batcher) sendLocked() {
+	batch := b.pending
+	b.pending = nil
+	if err := b.fn(batch); err != nil {
+		b.err = err
+		close(b.failed)
+	}
 }
 
 // cachedInfo returns the known entry for path if the file on disk still has
-// the same size and modification time, or nil if it must be (re-)hashed.
+// the same size and modification time and its hash is of the variant this
+// scanner computes (with a BlurHash, orientation hashes and a dHash if
+// wanted), or nil if it must be (re-)hashed. WithHeaderOnly takes any hash
+// variant, as a full hash carries everything a header read would give.
 func (s *Scanner) cachedInfo(path string) *models.ImageInfo {
-	prev, ok := s.known[path]
+	key := path
+	if s.knownKey != nil {
+		key = s.knownKey(path)
+	}
+	prev, ok := s.known[key]
 	if !ok {
 		return nil
 	}
-	stat, err := os.Stat(path)
+	if !s.headerOnly && (prev.HashVariant != s.hasher.Variant() || (s.blurHash && prev.BlurHash == "") ||
+		(s.orient && len(prev.OrientationHashes) == 0) || (s.dHash && prev.DHash == 0)) {
+		return nil
+	}
+	stat, err := hash.Stat(path)
 	if err != nil || stat.Size() != prev.FileSize || !stat.ModTime().Equal(prev.ModTime) {
 		return nil
 	}
 	return prev
 }
 
-// ScanFolders scans multiple folders
+// ScanFolders scans multiple folders, WithFolderConcurrency at a time, and
+// returns their results in folder order. A file reachable from more than one
+// folder (overlapping or repeated roots) is scanned and returned once.
+// Progress callbacks report on each folder separately.
 func (s *Scanner) ScanFolders(folders []string) ([]*models.ImageInfo, error) {
+	var (
+		seen   = make(map[string]bool)
+		seenMu sync.Mutex
+	)
+	claim := func(path string) bool {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		seenMu.Lock()
+		defer seenMu.Unlock()
+		if seen[path] {
+			return false
+		}
+		seen[path] = true
+		return true
+	}
+
+	results := make([][]*models.ImageInfo, len(folders))
+	errs := make([]error, len(folders))
+	sem := make(chan struct{}, max(s.folders, 1))
+	var wg sync.WaitGroup
+	for i, folder := range folders {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = s.scanFolder(folder, claim)
+		}()
+	}
+	wg.Wait()
+
 	var allResults []*models.ImageInfo
-	for _, folder := range folders {
-		results, err := s.ScanFolder(folder)
+	for i := range folders {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		allResults = append(allResults, results[i]...)
+	}
+	return allResults, nil
+}
+
+// limitOpen wraps open so that at most n files returned by it are open at
+// the same time. Callers block in open until a slot is free; the slot is
+// released when the file is closed.
+func limitOpen(open hash.Opener, n int) hash.Opener {
+	sem := make(chan struct{}, n)
+	return func(path string) (hash.File, error) {
+		sem <- struct{}{}
+		f, err := open(path)
 		if err != nil {
+			<-sem
 			return nil, err
 		}
-		allResults = append(allResults, results...)
+		return &limitedFile{File: f, release: func() { <-sem }}, nil
 	}
-	return allResults, nil
+}
+
+// limitedFile releases its limitOpen slot on the first Close. The hasher may
+// close a file twice (once on timeout, once when decoding finishes).
+type limitedFile struct {
+	hash.File
+	once    sync.Once
+	release func()
+}
+
+func (f *limitedFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(f.release)
+	return err
 }
@@ -1,13 +1,35 @@
 package scan
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"golang.org/x/image/tiff"
+	"golang.org/x/text/unicode/norm"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/match"
 	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/storage"
 )
 
 func TestNewScanner_Defaults(t *testing.T) {
@@ -237,6 +259,45 @@ func TestScanFolder_ProgressCallback(t *testing.T) {
 	}
 }
 
+func TestScanFolder_JSONProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := range 20 {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("img%02d.png", i)), scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Several workers, so ticks race to be reported
+	var stderr bytes.Buffer
+	s := NewScanner(WithWorkers(4), WithProgressInfo(JSONProgress(&stderr)))
+	if _, err := s.ScanFolder(tmpDir); err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("got %d progress lines, want 20:\n%s", len(lines), stderr.String())
+	}
+	last := 0
+	for i, line := range lines {
+		var tick struct {
+			Scanned int    `json:"scanned"`
+			Total   int    `json:"total"`
+			Path    string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &tick); err != nil {
+			t.Fatalf("line %d %q is not JSON: %v", i+1, line, err)
+		}
+		if tick.Scanned < last || tick.Total != 20 || !strings.HasPrefix(tick.Path, tmpDir) {
+			t.Errorf("line %d = %+v after scanned %d, want monotonic scanned of 20 under %s", i+1, tick, last, tmpDir)
+		}
+		last = tick.Scanned
+	}
+	if last != 20 {
+		t.Errorf("last tick scanned %d, want 20", last)
+	}
+}
+
 func TestScanFolders_Multiple(t *testing.T) {
 	tmpDir1 := t.TempDir()
 	tmpDir2 := t.TempDir()
@@ -320,6 +381,36 @@ func TestScanFolder_KnownImagesSkipsUnchanged(t *testing.T) {
 	}
 }
 
+func TestScanFolder_KnownKey(t *testing.T) {
+	// The walk reports the decomposed name; the known entry is keyed by the
+	// precomposed one, as a normalizing Storage returns it
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "cafe\u0301.png"), scanTestPNG(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := NewScanner().ScanFolder(tmpDir)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("first scan: %d images, %v", len(first), err)
+	}
+	known := map[string]*models.ImageInfo{norm.NFC.String(first[0].Path): first[0]}
+
+	second, err := NewScanner(WithKnownImages(known)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("second scan failed: %v", err)
+	}
+	if len(second) != 1 || second[0] == first[0] {
+		t.Error("without WithKnownKey the NFC-keyed entry should not be found")
+	}
+
+	third, err := NewScanner(WithKnownImages(known), WithKnownKey(norm.NFC.String)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("third scan failed: %v", err)
+	}
+	if len(third) != 1 || third[0] != first[0] {
+		t.Error("WithKnownKey should find the unchanged file under its NFC key")
+	}
+}
+
 func TestScanFolder_KnownImagesRehashesChanged(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "a.png")
@@ -357,3 +448,1173 @@ func TestScanFolder_KnownImagesRehashesChanged(t *testing.T) {
 		t.Errorf("re-hashed ModTime = %v, want %v", second[0].ModTime, newTime)
 	}
 }
+
+func TestScanFolder_ResumeAfterInterruption(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"a.png", "b.png", "c.png", "d.png", "e.png", "f.png"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First run: the sink persists one batch, then fails as if the process
+	// had crashed while saving the second.
+	processed := make(map[string]bool)
+	var batches int
+	_, err := NewScanner(
+		WithWorkers(1),
+		WithBatchSink(2, func(batch []*models.ImageInfo) error {
+			batches++
+			if batches > 1 {
+				return os.ErrClosed
+			}
+			for _, img := range batch {
+				processed[img.Path] = true
+			}
+			return nil
+		}),
+	).ScanFolder(tmpDir)
+	if err == nil {
+		t.Fatal("expected interrupted scan to return an error")
+	}
+	if len(processed) != 2 {
+		t.Fatalf("expected 2 processed paths before interruption, got %d", len(processed))
+	}
+
+	// Resume: only the remaining files are hashed.
+	rest, err := NewScanner(WithWorkers(1), WithSkipPaths(processed)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("resumed scan failed: %v", err)
+	}
+	if len(rest) != 4 {
+		t.Fatalf("expected 4 images on resume, got %d", len(rest))
+	}
+	for _, img := range rest {
+		if processed[img.Path] {
+			t.Errorf("%s was processed twice", img.Path)
+		}
+	}
+}
+
+func TestScanFolder_BatchSinkReceivesAll(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"a.png", "b.png", "c.png"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var batchSizes []int
+	images, err := NewScanner(
+		WithWorkers(2),
+		WithBatchSink(2, func(batch []*models.ImageInfo) error {
+			batchSizes = append(batchSizes, len(batch))
+			return nil
+		}),
+	).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("expected 3 images, got %d", len(images))
+	}
+	if len(batchSizes) != 2 || batchSizes[0] != 2 || batchSizes[1] != 1 {
+		t.Errorf("batch sizes = %v, want [2 1]", batchSizes)
+	}
+}
+
+// countingFile tracks how many files are open through countingOpener.
+type countingFile struct {
+	hash.File
+	open *int32
+}
+
+func (f *countingFile) Close() error {
+	atomic.AddInt32(f.open, -1)
+	return f.File.Close()
+}
+
+func TestScanFolder_MaxOpenFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := scanTestPNG()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(tmpDir, "img"+string(rune('a'+i))+".png")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var open, peak int32
+	counting := countingOpener(&open, &peak)
+
+	const limit = 2
+	s := NewScanner(WithWorkers(8), WithMaxOpenFiles(limit))
+	s.hasher = hash.NewHasher(hash.WithOpener(limitOpen(counting, limit)))
+
+	results, err := s.ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(results) != 20 {
+		t.Errorf("got %d results, want 20", len(results))
+	}
+	if p := atomic.LoadInt32(&peak); p > limit {
+		t.Errorf("peak open files = %d, want <= %d", p, limit)
+	}
+	if n := atomic.LoadInt32(&open); n != 0 {
+		t.Errorf("%d files left open after scan", n)
+	}
+}
+
+// countingOpener opens files with hash.OpenFile, tracking how many are open
+// and the peak. Each open sleeps briefly to widen the window for overlap.
+func countingOpener(open, peak *int32) hash.Opener {
+	return func(path string) (hash.File, error) {
+		f, err := hash.OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		n := atomic.AddInt32(open, 1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &countingFile{File: f, open: open}, nil
+	}
+}
+
+func TestScanFolder_SplitPipeline(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := scanTestPNG()
+	for i := 0; i < 20; i++ {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("img%02d.png", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "broken.png"), []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One file is known and unchanged, so the read stage reuses it
+	knownPath := filepath.Join(tmpDir, "img00.png")
+	stat, err := os.Stat(knownPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := &models.ImageInfo{Path: knownPath, FileSize: stat.Size(), ModTime: stat.ModTime()}
+
+	var open, peak int32
+	var progress int32
+	s := NewScanner(
+		WithReadWorkers(2),
+		WithHashWorkers(4),
+		WithKnownImages(map[string]*models.ImageInfo{knownPath: known}),
+		WithProgress(func(scanned, total int, current string) { atomic.AddInt32(&progress, 1) }),
+	)
+	s.hasher = hash.NewHasher(hash.WithOpener(countingOpener(&open, &peak)))
+
+	results, err := s.ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(results) != 20 {
+		t.Errorf("got %d results, want 20 (the broken file skipped)", len(results))
+	}
+	if !slices.Contains(results, known) {
+		t.Error("the unchanged known entry should be returned as-is")
+	}
+	if n := atomic.LoadInt32(&progress); n != 20 {
+		t.Errorf("progress reported %d times, want 20", n)
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("peak open files = %d, want <= 2 read workers", p)
+	}
+	if n := atomic.LoadInt32(&open); n != 0 {
+		t.Errorf("%d files left open after scan", n)
+	}
+}
+
+func TestScanFolder_Summary(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string][]byte{
+		"a.png":           scanTestPNG(),
+		"b.png":           scanTestPNG(),
+		"sub/c.png":       scanTestPNG(),
+		"notes.txt":       []byte("not an image"),
+		"sub/.hidden.png": scanTestPNG(),
+		"broken.jpg":      []byte("not a jpeg"),
+		"truncated.png":   scanTestPNG()[:20],
+	}
+	for name, data := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := ScanSummary{Hashed: 3, Skipped: 2, Failed: 2, Total: 7}
+	for _, split := range []bool{false, true} {
+		opts := []Option{WithWorkers(3)}
+		if split {
+			opts = append(opts, WithReadWorkers(2))
+		}
+		s := NewScanner(opts...)
+		results, err := s.ScanFolder(tmpDir)
+		if err != nil {
+			t.Fatalf("ScanFolder failed: %v", err)
+		}
+		if got := s.Summary(); got != want || len(results) != got.Hashed {
+			t.Errorf("split %t: Summary() = %+v with %d results, want %+v", split, got, len(results), want)
+		}
+	}
+}
+
+func TestScanFolder_DedupeExactFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	rng := rand.New(rand.NewPCG(3, 4))
+	noise := func() []byte {
+		img := image.NewGray(image.Rect(0, 0, 64, 64))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(rng.UintN(256))
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	a, b, c := noise(), noise(), noise()
+	files := map[string][]byte{
+		"a.jpg": a, "copies/a.jpg": a, "copies/a-2.jpg": a,
+		"b.jpg": b, "copies/b.jpg": b,
+		"c.jpg": c,
+	}
+	for name, data := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, split := range []bool{false, true} {
+		opts := []Option{WithDedupeExactFirst(true)}
+		if split {
+			opts = append(opts, WithReadWorkers(2))
+		}
+		var decoded atomic.Int32
+		s := NewScanner(opts...)
+		s.hasher = hash.NewHasher(hash.WithOpener(func(path string) (hash.File, error) {
+			decoded.Add(1)
+			return hash.OpenFile(path)
+		}))
+
+		results, err := s.ScanFolder(tmpDir)
+		if err != nil {
+			t.Fatalf("ScanFolder failed: %v", err)
+		}
+		if n := decoded.Load(); n != 3 {
+			t.Errorf("split %t: hashed %d files, want 3 (one per identical set)", split, n)
+		}
+		if len(results) != len(files) || s.Summary().Hashed != len(files) {
+			t.Fatalf("split %t: got %d results, want all %d files", split, len(results), len(files))
+		}
+
+		sizes := make(map[int]bool)
+		for _, g := range match.NewPerceptualMatcher(0).FindGroups(results) {
+			sizes[len(g.Images)] = true
+			for _, img := range g.Images {
+				if img.Path == g.Images[0].Path {
+					continue
+				}
+				if img.Hash != g.Images[0].Hash || img.FileHash == "" || img.FileHash != g.Images[0].FileHash {
+					t.Errorf("split %t: %s should share hash and file hash with %s", split, img.Path, g.Images[0].Path)
+				}
+			}
+		}
+		if len(sizes) != 2 || !sizes[3] || !sizes[2] {
+			t.Errorf("split %t: group sizes %v, want one of 3 and one of 2", split, sizes)
+		}
+	}
+}
+
+func TestScanFolder_ReportsUnreadableDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("folder permissions don't block listing on Windows")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores file permissions")
+	}
+
+	tmpDir := t.TempDir()
+	locked := filepath.Join(tmpDir, "locked")
+	for _, dir := range []string{tmpDir, locked} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "img.png"), scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	s := NewScanner()
+	results, err := s.ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results, want the readable image", len(results))
+	}
+	walkErrs := s.WalkErrors()
+	if len(walkErrs) != 1 || walkErrs[0].Path != locked || !errors.Is(walkErrs[0].Err, fs.ErrPermission) {
+		t.Errorf("WalkErrors() = %v, want permission denied on %s", walkErrs, locked)
+	}
+}
+
+func TestScanFolders_FolderConcurrency(t *testing.T) {
+	root := t.TempDir()
+	data := scanTestPNG()
+	var folders []string
+	for _, sub := range []string{"a", "b", "c", "d"} {
+		dir := filepath.Join(root, sub)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("img%d.png", i)), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		folders = append(folders, dir)
+	}
+	// Overlapping roots: the parent and a repeat reach the same files again
+	folders = append(folders, root, folders[0])
+
+	const workers = 2
+	var open, peak int32
+	s := NewScanner(WithWorkers(workers), WithFolderConcurrency(3))
+	s.hasher = hash.NewHasher(hash.WithOpener(countingOpener(&open, &peak)))
+
+	results, err := s.ScanFolders(folders)
+	if err != nil {
+		t.Fatalf("ScanFolders failed: %v", err)
+	}
+	if len(results) != 20 {
+		t.Errorf("got %d results, want 20", len(results))
+	}
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if seen[r.Path] {
+			t.Errorf("%s returned more than once", r.Path)
+		}
+		seen[r.Path] = true
+	}
+	if p := atomic.LoadInt32(&peak); p > workers {
+		t.Errorf("peak files hashed at once = %d, want <= %d", p, workers)
+	}
+}
+
+func TestScanFolder_ModifiedSince(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := scanTestPNG()
+	cutoff := time.Now().Add(-24 * time.Hour)
+	files := map[string]time.Time{
+		"old1.png": cutoff.Add(-48 * time.Hour),
+		"old2.png": cutoff.Add(-time.Minute),
+		"new1.png": cutoff.Add(time.Minute),
+		"new2.png": time.Now(),
+	}
+	for name, mtime := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var hashed []string
+	var mu sync.Mutex
+	s := NewScanner(WithModifiedSince(cutoff))
+	s.hasher = hash.NewHasher(hash.WithOpener(func(path string) (hash.File, error) {
+		mu.Lock()
+		hashed = append(hashed, filepath.Base(path))
+		mu.Unlock()
+		return hash.OpenFile(path)
+	}))
+
+	results, err := s.ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("got %d results, want 2", len(results))
+	}
+	slices.Sort(hashed)
+	if want := []string{"new1.png", "new2.png"}; !slices.Equal(hashed, want) {
+		t.Errorf("hashed %v, want %v", hashed, want)
+	}
+}
+
+func TestScanFolder_Formats(t *testing.T) {
+	tmpDir := t.TempDir()
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "scan.tiff"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "photo.png"), scanTestPNG(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		formats string
+		want    []string
+	}{
+		{"jpg,png,webp", []string{"photo.png"}},
+		{"png,tiff", []string{"photo.png", "scan.tiff"}},
+		{"tif", []string{"scan.tiff"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formats, func(t *testing.T) {
+			set, err := hash.ParseFormats(tt.formats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := NewScanner(WithFormats(set)).ScanFolder(tmpDir)
+			if err != nil {
+				t.Fatalf("ScanFolder failed: %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, filepath.Base(r.Path))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scanned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFolder_DetectByContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"photo.png":    scanTestPNG(),
+		"renamed.dat":  scanTestPNG(),
+		"no-extension": scanTestPNG(),
+		"notes.txt":    []byte("not an image"),
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jpegOnly, err := hash.ParseFormats("jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"by extension", nil, []string{"photo.png"}},
+		{"by content", []Option{WithDetectByContent(true)}, []string{"no-extension", "photo.png", "renamed.dat"}},
+		{"other format", []Option{WithDetectByContent(true), WithFormats(jpegOnly)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := NewScanner(tt.opts...).ScanFolder(tmpDir)
+			if err != nil {
+				t.Fatalf("ScanFolder failed: %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, filepath.Base(r.Path))
+				if r.Format != "png" {
+					t.Errorf("%s has format %q, want png", filepath.Base(r.Path), r.Format)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scanned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeClock returns a controllable time source for progress tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func TestProgressTracker_RateAndETA(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tracker := newProgressTracker(clock.now)
+
+	// Before the first sample interval: plain average (50 files in 0.5s)
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	p := tracker.update(50, 1000, "a.jpg")
+	if p.Rate != 100 {
+		t.Errorf("initial rate = %v, want 100", p.Rate)
+	}
+	if p.ETA != 9500*time.Millisecond {
+		t.Errorf("initial ETA = %v, want 9.5s", p.ETA)
+	}
+	if p.Elapsed != 500*time.Millisecond {
+		t.Errorf("Elapsed = %v, want 500ms", p.Elapsed)
+	}
+
+	// First sample: 100 files in 1s
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	p = tracker.update(100, 1000, "b.jpg")
+	if p.Rate != 100 {
+		t.Errorf("rate after first sample = %v, want 100", p.Rate)
+	}
+	if p.ETA != 9*time.Second {
+		t.Errorf("ETA = %v, want 9s", p.ETA)
+	}
+
+	// Second sample at 200/s is smoothed: 0.3*200 + 0.7*100 = 130/s
+	clock.t = clock.t.Add(time.Second)
+	p = tracker.update(300, 1000, "c.jpg")
+	if math.Abs(p.Rate-130) > 1e-9 {
+		t.Errorf("smoothed rate = %v, want 130", p.Rate)
+	}
+	wantETA := time.Duration(700.0 / p.Rate * float64(time.Second))
+	if p.ETA != wantETA {
+		t.Errorf("ETA = %v, want %v", p.ETA, wantETA)
+	}
+
+	// Done: no time remaining
+	clock.t = clock.t.Add(time.Second)
+	p = tracker.update(1000, 1000, "d.jpg")
+	if p.ETA != 0 {
+		t.Errorf("ETA when done = %v, want 0", p.ETA)
+	}
+}
+
+func TestScanFolder_ProgressInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := scanTestPNG()
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var simple, infos int32
+	var last ProgressInfo
+	s := NewScanner(
+		WithWorkers(2),
+		WithProgress(func(_, _ int, _ string) { atomic.AddInt32(&simple, 1) }),
+		WithProgressInfo(func(p ProgressInfo) {
+			infos++ // serialized by the scanner
+			if p.Scanned > last.Scanned {
+				last = p
+			}
+		}),
+	)
+
+	if _, err := s.ScanFolder(tmpDir); err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if simple != 3 || infos != 3 {
+		t.Errorf("callbacks = %d simple, %d info; want 3 each", simple, infos)
+	}
+	if last.Scanned != 3 || last.Total != 3 {
+		t.Errorf("last progress = %d/%d, want 3/3", last.Scanned, last.Total)
+	}
+}
+
+// countingCache is an in-memory hash.Cache that counts hits
+type countingCache struct {
+	mu      sync.Mutex
+	entries map[models.ContentKey]models.ImageInfo
+	hits    int
+}
+
+func (c *countingCache) GetCachedHash(key models.ContentKey) (*models.ImageInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key.ModTime = key.ModTime.UTC()
+	info, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	c.hits++
+	return &info, nil
+}
+
+func (c *countingCache) PutCachedHash(key models.ContentKey, info *models.ImageInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key.ModTime = key.ModTime.UTC()
+	c.entries[key] = *info
+	return nil
+}
+
+func TestScanFolder_HashCacheAcrossRoots(t *testing.T) {
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	var roots []string
+	for _, name := range []string{"before", "after"} {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "a.png")
+		if err := os.WriteFile(path, scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, dir)
+	}
+
+	cache := &countingCache{entries: make(map[models.ContentKey]models.ImageInfo)}
+	first, err := NewScanner(WithHashCache(cache)).ScanFolder(roots[0])
+	if err != nil {
+		t.Fatalf("first scan failed: %v", err)
+	}
+	if cache.hits != 0 || len(cache.entries) != 1 {
+		t.Fatalf("after first scan: %d hits, %d entries; want 0, 1", cache.hits, len(cache.entries))
+	}
+
+	second, err := NewScanner(WithHashCache(cache)).ScanFolder(roots[1])
+	if err != nil {
+		t.Fatalf("second scan failed: %v", err)
+	}
+	if cache.hits != 1 {
+		t.Errorf("expected the second scan to hit the cache, got %d hits", cache.hits)
+	}
+	if len(second) != 1 || second[0].Path != filepath.Join(roots[1], "a.png") || second[0].Hash != first[0].Hash {
+		t.Errorf("unexpected cached result: %+v", second)
+	}
+}
+
+func TestScanFolder_NormalizeLumaRehashesOtherVariant(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.png"), scanTestPNG(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := NewScanner().ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("first scan failed: %v", err)
+	}
+	known := map[string]*models.ImageInfo{first[0].Path: first[0]}
+
+	second, err := NewScanner(WithKnownImages(known), WithNormalizeLuma(true)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("second scan failed: %v", err)
+	}
+	if len(second) != 1 || second[0] == first[0] {
+		t.Fatal("an image hashed without normalization should be re-hashed")
+	}
+	if second[0].HashVariant != hash.VariantLuma {
+		t.Errorf("HashVariant = %q, want %q", second[0].HashVariant, hash.VariantLuma)
+	}
+
+	known = map[string]*models.ImageInfo{second[0].Path: second[0]}
+	third, err := NewScanner(WithKnownImages(known), WithNormalizeLuma(true)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("third scan failed: %v", err)
+	}
+	if len(third) != 1 || third[0] != second[0] {
+		t.Error("an unchanged image of the same variant should be reused")
+	}
+}
+
+// largeJPEG encodes a smooth w x h image of waves and gradients, mirrored when
+// flip is set
+func largeJPEG(t *testing.T, w, h, quality int, flip bool) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if flip {
+				sx = w - 1 - x
+			}
+			i := img.PixOffset(x, y)
+			fx, fy := float64(sx)/float64(w), float64(y)/float64(h)
+			img.Pix[i] = uint8(128 + 100*math.Sin(3*math.Pi*fx)*math.Cos(2*math.Pi*fy))
+			img.Pix[i+1] = uint8(255 * fx * fy)
+			img.Pix[i+2] = uint8(128 + 100*math.Cos(5*math.Pi*fx*fy))
+			img.Pix[i+3] = 255
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanFolder_FastDecodeGroupsCopies(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string][]byte{
+		"photo.jpg":  largeJPEG(t, 1600, 1200, 95, false),
+		"copy.jpg":   largeJPEG(t, 1600, 1200, 60, false),
+		"mirror.jpg": largeJPEG(t, 1600, 1200, 95, true),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := NewScanner(WithFastDecode(true)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	for _, img := range results {
+		if img.HashVariant != hash.VariantFast || img.Width != 1600 {
+			t.Errorf("%s: variant %q, width %d; want %q and the full 1600", img.Path, img.HashVariant, img.Width, hash.VariantFast)
+		}
+	}
+
+	groups := match.NewPerceptualMatcher(10).FindGroups(results)
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("groups = %d, want one of photo.jpg and copy.jpg", len(groups))
+	}
+	for _, img := range groups[0].Images {
+		if filepath.Base(img.Path) == "mirror.jpg" {
+			t.Error("the mirrored image should not be grouped")
+		}
+	}
+}
+
+// decodeHeavyFolder writes n noisy 1024x1024 JPEGs, which are slow to decode
+// relative to their size
+func decodeHeavyFolder(b *testing.B, n int) string {
+	b.Helper()
+	dir := b.TempDir()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	for i := 0; i < n; i++ {
+		for p := range img.Pix {
+			img.Pix[p] = uint8(rng.UintN(256))
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("img%02d.jpg", i)), buf.Bytes(), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func BenchmarkScanFolder_DecodeHeavy(b *testing.B) {
+	const images = 16
+	dir := decodeHeavyFolder(b, images)
+
+	// The default worker count against the same number of hashers fed by
+	// one or two readers
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{"single/workers=1", []Option{WithWorkers(1)}},
+		{"single/workers=8", []Option{WithWorkers(8)}},
+		{"split/read=1,hash=8", []Option{WithReadWorkers(1), WithHashWorkers(8)}},
+		{"split/read=2,hash=8", []Option{WithReadWorkers(2), WithHashWorkers(8)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				results, err := NewScanner(bm.opts...).ScanFolder(dir)
+				if err != nil || len(results) != images {
+					b.Fatalf("ScanFolder: %d results, %v", len(results), err)
+				}
+			}
+			b.ReportMetric(float64(images*b.N)/b.Elapsed().Seconds(), "images/s")
+		})
+	}
+}
+
+func TestScanFolder_ArchiveGroupsWithLooseCopy(t *testing.T) {
+	tmpDir := t.TempDir()
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "photo.jpg"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	album := filepath.Join(tmpDir, "album.zip")
+	f, err := os.Create(album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"2019/photo.jpg":            buf.Bytes(),
+		"__MACOSX/2019/._photo.jpg": buf.Bytes(), // hidden: skipped
+		"notes.txt":                 []byte("not an image"),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	results, err := NewScanner().ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("without WithArchives: got %d images, want only the loose one", len(results))
+	}
+
+	results, err = NewScanner(WithArchives(true)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.Path)
+	}
+	slices.Sort(paths)
+	want := []string{hash.ArchivePath(album, "2019/photo.jpg"), filepath.Join(tmpDir, "photo.jpg")}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("scanned %v, want %v", paths, want)
+	}
+
+	groups := match.NewPerceptualMatcher(0).FindGroups(results)
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Errorf("got %d groups, want the zipped and loose copy grouped together", len(groups))
+	}
+}
+
+func TestScanFolder_SkipsHidden(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{"photo.png", ".thumbnails/photo.png", ".hidden.png", "album/.cache/x.png", "album/visible.png"}
+	for _, name := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, scanTestPNG(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanned := func(opts ...Option) []string {
+		results, err := NewScanner(opts...).ScanFolder(tmpDir)
+		if err != nil {
+			t.Fatalf("ScanFolder failed: %v", err)
+		}
+		var got []string
+		for _, r := range results {
+			rel, _ := filepath.Rel(tmpDir, r.Path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		slices.Sort(got)
+		return got
+	}
+
+	if got, want := scanned(), []string{"album/visible.png", "photo.png"}; !slices.Equal(got, want) {
+		t.Errorf("default: scanned %v, want %v", got, want)
+	}
+	want := slices.Clone(files)
+	slices.Sort(want)
+	if got := scanned(WithIncludeHidden(true)); !slices.Equal(got, want) {
+		t.Errorf("WithIncludeHidden: scanned %v, want %v", got, want)
+	}
+
+	// A hidden folder named as the root is scanned
+	root := filepath.Join(tmpDir, ".thumbnails")
+	results, err := NewScanner().ScanFolder(root)
+	if err != nil || len(results) != 1 {
+		t.Errorf("scanning %s itself: got %d images, %v; want 1", root, len(results), err)
+	}
+}
+
+func TestLinkSidecars_PairsRawWithJPEG(t *testing.T) {
+	dir := filepath.Join("photos", "2024")
+	img := func(name string) *models.ImageInfo {
+		return &models.ImageInfo{Path: filepath.Join(dir, name)}
+	}
+	raw, jpg := img("IMG_1234.CR2"), img("IMG_1234.jpg")
+	lone := img("IMG_1235.JPG")
+	other := &models.ImageInfo{Path: filepath.Join("photos", "IMG_1234.NEF")} // another folder
+	nef, arw, both := img("DSC_1.NEF"), img("DSC_1.ARW"), img("DSC_1.JPG")    // ambiguous
+	stale := img("IMG_1236.png")
+	stale.SidecarOf = filepath.Join(dir, "IMG_1236.CR2")
+
+	images := []*models.ImageInfo{raw, lone, jpg, other, nef, arw, both, stale}
+	if n := LinkSidecars(images); n != 1 {
+		t.Errorf("LinkSidecars = %d pairs, want 1", n)
+	}
+	if raw.SidecarOf != jpg.Path || jpg.SidecarOf != raw.Path {
+		t.Errorf("pair not linked both ways: %q, %q", raw.SidecarOf, jpg.SidecarOf)
+	}
+	for _, img := range []*models.ImageInfo{lone, other, nef, arw, both, stale} {
+		if img.SidecarOf != "" {
+			t.Errorf("%s: SidecarOf = %q, want none", img.Path, img.SidecarOf)
+		}
+	}
+}
+
+func TestVerifyHashes_DetectsAndFixesWrongHash(t *testing.T) {
+	dir := t.TempDir()
+	for name, flip := range map[string]bool{"good.jpg": false, "bad.jpg": true, "edited.jpg": false} {
+		if err := os.WriteFile(filepath.Join(dir, name), largeJPEG(t, 320, 240, 90, flip), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := NewScanner().ScanFolder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var rightHash uint64
+	for _, img := range images {
+		if filepath.Base(img.Path) == "bad.jpg" {
+			rightHash = img.Hash
+			img.Hash ^= 0xffff // as if an interrupted scan had stored garbage
+		}
+	}
+	gone := &models.ImageInfo{Path: filepath.Join(dir, "gone.jpg"), Format: "jpeg", FileSize: 1, ModTime: time.Now()}
+	if err := store.SaveImages(append(images, gone)); err != nil {
+		t.Fatal(err)
+	}
+	// An edit after the scan is expected to change the hash, and not a bug
+	edited := filepath.Join(dir, "edited.jpg")
+	if err := os.WriteFile(edited, largeJPEG(t, 320, 240, 50, true), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(edited, time.Now(), time.Now().Add(time.Hour))
+
+	res, err := VerifyHashes(store, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 2 || res.Changed != 1 || res.Missing != 1 || res.Failed != 0 || res.Fixed != 0 {
+		t.Errorf("result = %+v, want 2 checked, 1 changed, 1 missing, none fixed", res)
+	}
+	if len(res.Mismatches) != 1 || filepath.Base(res.Mismatches[0].Path) != "bad.jpg" || res.Mismatches[0].Actual != rightHash {
+		t.Fatalf("mismatches = %+v, want bad.jpg with its real hash", res.Mismatches)
+	}
+
+	if res, err = VerifyHashes(store, true, nil); err != nil || res.Fixed != 1 {
+		t.Fatalf("VerifyHashes with fix: %+v, %v; want 1 fixed", res, err)
+	}
+	stored, err := store.GetImage(filepath.Join(dir, "bad.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Hash != rightHash {
+		t.Errorf("stored hash = %016x after the fix, want %016x", stored.Hash, rightHash)
+	}
+	if res, err = VerifyHashes(store, false, nil); err != nil || len(res.Mismatches) != 0 {
+		t.Errorf("after the fix: %+v, %v; want no mismatches", res, err)
+	}
+}
+
+// flakyFile fails its first read with EIO, like a file on a network mount
+// that drops a request
+type flakyFile struct {
+	hash.File
+	fail bool
+}
+
+func (f *flakyFile) Read(p []byte) (int, error) {
+	if f.fail {
+		return 0, &fs.PathError{Op: "read", Path: "flaky", Err: syscall.EIO}
+	}
+	return f.File.Read(p)
+}
+
+func TestScanFolder_RetriesTransientErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"flaky.png":  scanTestPNG(),
+		"dead.png":   scanTestPNG(),
+		"broken.png": []byte("not a png"),
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	opens := make(map[string]int)
+	s := NewScanner(WithRetries(2, time.Millisecond))
+	s.hasher = hash.NewHasher(hash.WithOpener(func(path string) (hash.File, error) {
+		f, err := hash.OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		name := filepath.Base(path)
+		opens[name]++
+		fail := name == "dead.png" || name == "flaky.png" && opens[name] == 1
+		return &flakyFile{File: f, fail: fail}, nil
+	}))
+
+	images, err := s.ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || filepath.Base(images[0].Path) != "flaky.png" {
+		t.Fatalf("scanned %v, want only flaky.png, hashed on its second attempt", images)
+	}
+	if opens["flaky.png"] != 2 || opens["dead.png"] != 3 || opens["broken.png"] != 1 {
+		t.Errorf("opens = %v; want flaky.png read twice, dead.png once plus 2 retries, broken.png never retried", opens)
+	}
+	ioErrs := s.IOErrors()
+	if len(ioErrs) != 1 || filepath.Base(ioErrs[0].Path) != "dead.png" || !errors.Is(ioErrs[0].Err, syscall.EIO) {
+		t.Errorf("IOErrors = %v, want dead.png with EIO", ioErrs)
+	}
+}
+
+func TestScanFolder_HeaderOnlyGroupsByFileHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	rng := rand.New(rand.NewPCG(5, 6))
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.UintN(256))
+	}
+	// The same pixels encoded twice: visually identical, different bytes
+	encode := func(level png.CompressionLevel) []byte {
+		var buf bytes.Buffer
+		if err := (&png.Encoder{CompressionLevel: level}).Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	fast, small := encode(png.BestSpeed), encode(png.BestCompression)
+	if bytes.Equal(fast, small) {
+		t.Fatal("both encodings have the same bytes")
+	}
+	files := map[string][]byte{"a.png": fast, "copy/a.png": fast, "b.png": small}
+	for name, data := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A perceptual threshold of 0 groups all three
+	results, err := NewScanner().ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if groups := match.NewPerceptualMatcher(0).FindGroups(results); len(groups) != 1 || len(groups[0].Images) != 3 {
+		t.Fatalf("perceptual threshold 0: got %d groups, want all three images in one", len(groups))
+	}
+
+	results, err = NewScanner(WithHeaderOnly(true)).ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	for _, r := range results {
+		if r.HashVariant != hash.VariantHeader || r.Hash != 0 {
+			t.Errorf("%s: variant %q, hash %016x; want %q and no pHash", r.Path, r.HashVariant, r.Hash, hash.VariantHeader)
+		}
+		if r.Width != 64 || r.Height != 48 || r.Format != "png" {
+			t.Errorf("%s: %dx%d %s, want the header's 64x48 png", r.Path, r.Width, r.Height, r.Format)
+		}
+	}
+	hash.HashSizeCollisions(results, hash.ComputeFileHash)
+	groups := match.NewExactMatcher().FindGroups(results)
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("exact: got %d groups, want one of the two byte-identical files", len(groups))
+	}
+	for _, img := range groups[0].Images {
+		if filepath.Base(img.Path) != "a.png" {
+			t.Errorf("exact group holds %s, which only looks like a.png", img.Path)
+		}
+	}
+}
+
+func TestEstimate_CountsCandidatesAndExtrapolates(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := scanTestPNG()
+	for _, name := range []string{"a.png", "d.png", "sub/b.png", "sub/c.png", "note.txt", ".hidden.png"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	known := filepath.Join(tmpDir, "a.png")
+	stat, err := os.Stat(known)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScanner(WithWorkers(1), WithKnownImages(map[string]*models.ImageInfo{
+		known: {Path: known, FileSize: stat.Size(), ModTime: stat.ModTime()},
+	}))
+	// Every hash takes 100ms by this clock
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s.now = func() time.Time {
+		clock.t = clock.t.Add(100 * time.Millisecond)
+		return clock.t
+	}
+
+	est, err := s.Estimate(tmpDir, 2)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	scanned, err := NewScanner().ScanFolder(tmpDir)
+	if err != nil {
+		t.Fatalf("ScanFolder failed: %v", err)
+	}
+	if est.Files != len(scanned) || est.Files != 4 {
+		t.Errorf("Files = %d, want the %d images a scan finds (4)", est.Files, len(scanned))
+	}
+	if want := int64(4 * len(data)); est.Bytes != want {
+		t.Errorf("Bytes = %d, want %d", est.Bytes, want)
+	}
+	if est.Cached != 1 || est.Sampled != 2 {
+		t.Errorf("Cached = %d, Sampled = %d; want 1 and 2", est.Cached, est.Sampled)
+	}
+	// 100ms per file for the 3 files to hash, on one worker
+	if d := est.Duration - 300*time.Millisecond; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("Duration = %v, want 300ms", est.Duration)
+	}
+}
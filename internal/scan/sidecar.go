@@ -0,0 +1,52 @@
+package scan
+
+import (
+	"path/filepath"
+	"strings"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// LinkSidecars pairs each camera RAW file with the JPEG shot alongside it:
+// the one in the same folder with the same name but for the extension
+// (IMG_1234.CR2 and IMG_1234.JPG, compared case-insensitively). Both get
+// the other's path as SidecarOf; any SidecarOf left from an earlier scan is
+// cleared first. A name with more than one RAW or JPEG is ambiguous and
+// left unpaired, as are images inside archives. Returns the number of
+// pairs.
+func LinkSidecars(images []*models.ImageInfo) int {
+	type pair struct{ raw, jpeg []*models.ImageInfo }
+	pairs := make(map[string]*pair)
+	for _, img := range images {
+		img.SidecarOf = ""
+		if hash.IsArchiveEntry(img.Path) {
+			continue
+		}
+		ext := filepath.Ext(img.Path)
+		key := strings.ToLower(strings.TrimSuffix(img.Path, ext))
+		p := pairs[key]
+		if p == nil {
+			p = &pair{}
+			pairs[key] = p
+		}
+		switch strings.ToLower(ext) {
+		case ".jpg", ".jpeg":
+			p.jpeg = append(p.jpeg, img)
+		default:
+			if hash.IsRawImage(img.Path) {
+				p.raw = append(p.raw, img)
+			}
+		}
+	}
+
+	n := 0
+	for _, p := range pairs {
+		if len(p.raw) == 1 && len(p.jpeg) == 1 {
+			p.raw[0].SidecarOf = p.jpeg[0].Path
+			p.jpeg[0].SidecarOf = p.raw[0].Path
+			n++
+		}
+	}
+	return n
+}
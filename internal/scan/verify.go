@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
+)
+
+// HashStore is the storage VerifyHashes reads stored images from and saves
+// corrected hashes to
+type HashStore interface {
+	IterateImages(fn func(*models.ImageInfo) error) error
+	SaveImages(images []*models.ImageInfo) error
+}
+
+// Mismatch is a stored image whose file is unchanged since it was scanned
+// but hashes differently now
+type Mismatch struct {
+	Path   string
+	Stored uint64
+	Actual uint64
+}
+
+// VerifyResult is what VerifyHashes found
+type VerifyResult struct {
+	Checked    int // files re-hashed
+	Changed    int // files whose size or mtime differ from the stored ones
+	Missing    int
+	Failed     int // files that could not be read or decoded
+	Mismatches []Mismatch
+	Fixed      int
+}
+
+// VerifyHashes re-hashes every stored image whose file still has its stored
+// size and modification time, in the image's own HashVariant, and reports
+// those whose pHash (or orientation hashes) no longer match: the file is the
+// same, so the stored hash is wrong. Files changed since the scan are only
+// counted; a rescan handles them. With fix, the mismatched images are saved
+// with the new hashes once all have been checked. logf, if set, receives a
+// line per changed, missing or unreadable file. Images stored without a
+// pHash (see hash.WithHeaderOnly) are skipped.
+func VerifyHashes(store HashStore, fix bool, logf func(format string, args ...any)) (VerifyResult, error) {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	var res VerifyResult
+	hashers := make(map[string]*hash.Hasher)
+	var corrected []*models.ImageInfo
+
+	err := store.IterateImages(func(img *models.ImageInfo) error {
+		if !hash.HasPerceptualHash(img) {
+			return nil
+		}
+		stat, err := hash.Stat(img.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			res.Missing++
+			logf("missing: %s\n", img.Path)
+			return nil
+		}
+		if err != nil {
+			res.Failed++
+			logf("failed to stat %s: %v\n", img.Path, err)
+			return nil
+		}
+		if stat.Size() != img.FileSize || !stat.ModTime().Equal(img.ModTime) {
+			res.Changed++
+			logf("changed since scan: %s\n", img.Path)
+			return nil
+		}
+
+		orient := len(img.OrientationHashes) > 0
+		key := fmt.Sprintf("%s/%t", img.HashVariant, orient)
+		h := hashers[key]
+		if h == nil {
+			opts := hash.VariantOptions(img.HashVariant)
+			if orient {
+				opts = append(opts, hash.WithOrientations())
+			}
+			h = hash.NewHasher(opts...)
+			hashers[key] = h
+		}
+		fresh, err := h.HashImage(img.Path)
+		if err != nil {
+			res.Failed++
+			logf("failed to hash %s: %v\n", img.Path, err)
+			return nil
+		}
+		res.Checked++
+		if fresh.Hash == img.Hash && (!orient || slices.Equal(fresh.OrientationHashes, img.OrientationHashes)) {
+			return nil
+		}
+
+		res.Mismatches = append(res.Mismatches, Mismatch{Path: img.Path, Stored: img.Hash, Actual: fresh.Hash})
+		if fix {
+			img.Hash = fresh.Hash
+			if orient {
+				img.OrientationHashes = fresh.OrientationHashes
+			}
+			corrected = append(corrected, img)
+		}
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to read images: %w", err)
+	}
+
+	// Saved only now: the iteration's open query would block the write
+	if len(corrected) > 0 {
+		if err := store.SaveImages(corrected); err != nil {
+			return res, fmt.Errorf("failed to save corrected hashes: %w", err)
+		}
+		res.Fixed = len(corrected)
+	}
+	return res, nil
+}
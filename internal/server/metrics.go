@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// metrics are the counters served at /metrics. requests is filled while
+// routes are registered and only read afterwards, so it needs no lock.
+type metrics struct {
+	requests      map[string]*atomic.Int64 // by route pattern
+	cleanRequests atomic.Int64
+	trashed       atomic.Int64
+	deleted       atomic.Int64
+}
+
+// countRequests registers a request counter for pattern and returns h
+// wrapped to increment it
+func (s *Server) countRequests(pattern string, h http.Handler) http.Handler {
+	counter := new(atomic.Int64)
+	s.metrics.requests[pattern] = counter
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.Add(1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleMetrics serves the counters in the Prometheus text exposition
+// format. Group totals are read from the database on each scrape. Scrapes
+// don't count as activity, so a scraper can't keep an idle server alive.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.storage.GetDuplicateGroups(s.keep...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var reclaimable int64
+	for _, g := range groups {
+		reclaimable += g.Reclaimable()
+	}
+
+	s.clientsMu.Lock()
+	clients := len(s.clients)
+	s.clientsMu.Unlock()
+
+	var b strings.Builder
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("imagedupfinder_duplicate_groups", "gauge", "Duplicate groups in the database.")
+	fmt.Fprintf(&b, "imagedupfinder_duplicate_groups %d\n", len(groups))
+	metric("imagedupfinder_reclaimable_bytes", "gauge", "Bytes freed by removing every image but the kept one in each group.")
+	fmt.Fprintf(&b, "imagedupfinder_reclaimable_bytes %d\n", reclaimable)
+	metric("imagedupfinder_clean_requests_total", "counter", "Clean requests handled.")
+	fmt.Fprintf(&b, "imagedupfinder_clean_requests_total %d\n", s.metrics.cleanRequests.Load())
+	metric("imagedupfinder_cleaned_files_total", "counter", "Files removed by clean requests.")
+	fmt.Fprintf(&b, "imagedupfinder_cleaned_files_total{action=\"trashed\"} %d\n", s.metrics.trashed.Load())
+	fmt.Fprintf(&b, "imagedupfinder_cleaned_files_total{action=\"deleted\"} %d\n", s.metrics.deleted.Load())
+	metric("imagedupfinder_websocket_clients", "gauge", "Connected WebSocket clients.")
+	fmt.Fprintf(&b, "imagedupfinder_websocket_clients %d\n", clients)
+
+	patterns := make([]string, 0, len(s.metrics.requests))
+	for pattern := range s.metrics.requests {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	metric("imagedupfinder_http_requests_total", "counter", "HTTP requests by endpoint.")
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "imagedupfinder_http_requests_total{path=%q} %d\n", pattern, s.metrics.requests[pattern].Load())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"imagedupfinder/internal/models"
+)
+
+// parseMetrics parses Prometheus text output into sample name (with labels)
+// -> value, failing on any malformed line
+func parseMetrics(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i <= 0 {
+			t.Fatalf("malformed metrics line %q", line)
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed metrics line %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestHandleMetrics_ReflectsClean(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	var images []*models.ImageInfo
+	for i, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &models.ImageInfo{
+			Path: path, Hash: 1, Width: 10, Height: 10, Format: "jpeg",
+			FileSize: 100, ModTime: time.Now(), Score: float64(300 - i), GroupID: 1,
+		})
+	}
+	if err := s.storage.SaveImages(images); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Host = "127.0.0.1"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d", method, target, rec.Code)
+		}
+		return rec
+	}
+
+	before := parseMetrics(t, serve("GET", "/metrics", "").Body.String())
+	if before["imagedupfinder_duplicate_groups"] != 1 || before["imagedupfinder_reclaimable_bytes"] != 200 {
+		t.Errorf("before clean: %v", before)
+	}
+
+	serve("POST", "/api/clean", `{"paths":["`+images[2].Path+`"],"permanent":true}`)
+
+	rec := serve("GET", "/metrics", "")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	after := parseMetrics(t, rec.Body.String())
+	for name, want := range map[string]float64{
+		`imagedupfinder_duplicate_groups`:                       1,
+		`imagedupfinder_reclaimable_bytes`:                      100,
+		`imagedupfinder_clean_requests_total`:                   1,
+		`imagedupfinder_cleaned_files_total{action="deleted"}`:  1,
+		`imagedupfinder_cleaned_files_total{action="trashed"}`:  0,
+		`imagedupfinder_websocket_clients`:                      0,
+		`imagedupfinder_http_requests_total{path="/api/clean"}`: 1,
+		`imagedupfinder_http_requests_total{path="/metrics"}`:   2,
+	} {
+		if got, ok := after[name]; !ok || got != want {
+			t.Errorf("%s = %v (present: %v), want %v", name, got, ok, want)
+		}
+	}
+}
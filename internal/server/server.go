@@ -1,21 +1,31 @@
 package server
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"imagedupfinder/internal/audit"
 	"imagedupfinder/internal/fileutil"
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/models"
 	"imagedupfinder/internal/storage"
 )
 
@@ -29,6 +39,21 @@ type Server struct {
 	idleTimeout time.Duration
 	httpServer  *http.Server
 	thumbs      *thumbCache
+	keep        []models.KeepPolicy
+	webpThumbs  bool
+	readOnly    bool
+	storageOpts []storage.Option
+	rescan      RescanFunc
+	rescanning  atomic.Bool
+	audit       *audit.Log
+	metrics     metrics
+
+	clientsMu sync.Mutex
+	clients   map[*wsConn]bool
+
+	// WebSocket keepalive; see defaultWSPingInterval
+	wsPingInterval time.Duration
+	wsPongWait     time.Duration
 
 	// Idle timeout management
 	mu            sync.Mutex
@@ -38,51 +63,100 @@ type Server struct {
 	shutdownChan  chan struct{}
 }
 
-// New creates a new Server
-func New(dbPath string, port int, idleTimeout time.Duration) (*Server, error) {
-	store, err := storage.NewStorage(dbPath)
-	if err != nil {
-		return nil, err
+// Option configures a Server
+type Option func(*Server)
+
+// WithKeepPolicies sets the policies used to pick the image to keep in each
+// group (default: highest quality)
+func WithKeepPolicies(policies ...models.KeepPolicy) Option {
+	return func(s *Server) {
+		s.keep = policies
 	}
+}
+
+// WithWebPThumbnails controls whether thumbnails are served as WebP to
+// browsers that accept it (default true). JPEG/PNG are used otherwise.
+func WithWebPThumbnails(enabled bool) Option {
+	return func(s *Server) {
+		s.webpThumbs = enabled
+	}
+}
+
+// WithReadOnly disables cleaning: /api/clean is refused and the UI is served
+// without its delete controls. Browsing groups and images still works.
+func WithReadOnly(enabled bool) Option {
+	return func(s *Server) {
+		s.readOnly = enabled
+	}
+}
+
+// RescanFunc scans folder (an absolute directory path), regroups and saves
+// the results to store, reporting per-file progress, and returns the new
+// summary. store is the server's own database.
+type RescanFunc func(store *storage.Storage, folder string, progress func(scanned, total int)) (*models.ScanResult, error)
+
+// WithRescan enables POST /api/rescan, which runs fn
+func WithRescan(fn RescanFunc) Option {
+	return func(s *Server) {
+		s.rescan = fn
+	}
+}
+
+// WithStorageOptions sets options for opening the database
+func WithStorageOptions(opts ...storage.Option) Option {
+	return func(s *Server) {
+		s.storageOpts = opts
+	}
+}
+
+// WithAuditLog records each file /api/clean removes in log. The caller
+// keeps ownership and closes it after the server stops.
+func WithAuditLog(log *audit.Log) Option {
+	return func(s *Server) {
+		s.audit = log
+	}
+}
 
+// New creates a new Server
+func New(dbPath string, port int, idleTimeout time.Duration, opts ...Option) (*Server, error) {
 	s := &Server{
-		storage:      store,
-		port:         port,
-		idleTimeout:  idleTimeout,
-		thumbs:       newThumbCache(thumbCacheBudget),
-		lastActivity: time.Now(),
-		tabActive:    false,
-		shutdownChan: make(chan struct{}),
+		port:           port,
+		idleTimeout:    idleTimeout,
+		thumbs:         newThumbCache(thumbCacheBudget),
+		clients:        make(map[*wsConn]bool),
+		wsPingInterval: defaultWSPingInterval,
+		wsPongWait:     defaultWSPongWait,
+		metrics:        metrics{requests: make(map[string]*atomic.Int64)},
+		webpThumbs:     true,
+		lastActivity:   time.Now(),
+		tabActive:      false,
+		shutdownChan:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	store, err := storage.NewStorage(dbPath, s.storageOpts...)
+	if err != nil {
+		return nil, err
 	}
+	s.storage = store
 
 	return s, nil
 }
 
 // Start starts the server
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
-
-	// API routes
-	mux.HandleFunc("/api/groups", s.handleGroups)
-	mux.HandleFunc("/api/clean", s.handleClean)
-	mux.HandleFunc("/api/image", s.handleImage)
-	mux.HandleFunc("/api/thumbnail", s.handleThumbnail)
-
-	// WebSocket for connection monitoring
-	mux.HandleFunc("/ws", s.handleWebSocket)
-
-	// Static files
-	staticFS, err := fs.Sub(staticFiles, "static")
+	handler, err := s.routes()
 	if err != nil {
 		return err
 	}
-	mux.Handle("/", http.FileServer(http.FS(staticFS)))
 
 	s.httpServer = &http.Server{
 		// Bind to loopback only: this server can read and delete local files,
 		// so it must never be reachable from other machines.
 		Addr:    fmt.Sprintf("127.0.0.1:%d", s.port),
-		Handler: s.requireLocalOrigin(mux),
+		Handler: handler,
 	}
 
 	// Start idle timeout checker
@@ -100,6 +174,52 @@ func (s *Server) Start() error {
 	return err
 }
 
+// routes returns the server's handler: every endpoint, counted for
+// /metrics, behind the local-origin check
+func (s *Server) routes() (http.Handler, error) {
+	mux := http.NewServeMux()
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, s.countRequests(pattern, h))
+	}
+
+	// API routes
+	handle("/api/groups", s.handleGroups)
+	handle("/api/groups/{id}/reviewed", s.handleReviewed)
+	handle("/api/clean", s.handleClean)
+	handle("/api/rescan", s.handleRescan)
+	handle("/api/image", s.handleImage)
+	handle("/api/thumbnail", s.handleThumbnail)
+	handle("/metrics", s.handleMetrics)
+
+	// WebSocket for connection monitoring
+	handle("/ws", s.handleWebSocket)
+
+	// Static files
+	staticFS, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+	handle("/", s.staticHandler(staticFS).ServeHTTP)
+
+	return s.requireLocalOrigin(s.trackActivity(mux)), nil
+}
+
+// trackActivity resets the idle timer when a request arrives and again when
+// it is answered, so browsing the UI keeps the server up whatever the tab
+// reports, and a long request (a rescan, a large image) doesn't time out as
+// soon as it ends. Metrics scrapes don't count.
+func (s *Server) trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.recordActivity()
+		defer s.recordActivity()
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) handleShutdownSignals() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -195,28 +315,126 @@ func (s *Server) requireLocalOrigin(next http.Handler) http.Handler {
 	})
 }
 
+// staticHandler serves the embedded UI. In read-only mode the page is marked
+// on the server so its delete controls are never shown, rather than relying
+// on client-side checks.
+func (s *Server) staticHandler(staticFS fs.FS) http.Handler {
+	files := http.FileServer(http.FS(staticFS))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.readOnly || (r.URL.Path != "/" && r.URL.Path != "/index.html") {
+			files.ServeHTTP(w, r)
+			return
+		}
+		page, err := fs.ReadFile(staticFS, "index.html")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page = bytes.Replace(page, []byte("<body>"), []byte(`<body class="read-only">`), 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+}
+
 // API Handlers
 
+// handleGroups returns the duplicate groups as a JSON array. The query
+// params sort (id, reclaimable, images) and order (asc, desc) order them, and
+// method (exact, perceptual) keeps only groups found that way. The applied
+// values are echoed in the X-Sort, X-Order and X-Method headers.
 func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
-	s.recordActivity()
+	q := r.URL.Query()
+	sortBy := cmp.Or(q.Get("sort"), "id")
+	orderBy := cmp.Or(q.Get("order"), "asc")
+	method := q.Get("method")
+	order, ok := models.GroupOrders[sortBy]
+	if !ok {
+		http.Error(w, "invalid sort: want id, reclaimable or images", http.StatusBadRequest)
+		return
+	}
+	if orderBy != "asc" && orderBy != "desc" {
+		http.Error(w, "invalid order: want asc or desc", http.StatusBadRequest)
+		return
+	}
 
-	groups, err := s.storage.GetDuplicateGroups()
+	var groups []*models.DuplicateGroup
+	var err error
+	switch method {
+	case "":
+		groups, err = s.storage.GetDuplicateGroups(s.keep...)
+	case models.MatchExact, models.MatchPerceptual:
+		groups, err = s.storage.GetDuplicateGroupsByMethod(method, s.keep...)
+	default:
+		http.Error(w, "invalid method: want exact or perceptual", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	models.SortGroups(groups, order, orderBy == "desc")
 
+	w.Header().Set("X-Sort", sortBy)
+	w.Header().Set("X-Order", orderBy)
+	if method != "" {
+		w.Header().Set("X-Method", method)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(groups)
 }
 
+// handleReviewed marks the group in the path reviewed, or clears the mark
+// if the body is {"reviewed": false}. An empty body marks it.
+func (s *Server) handleReviewed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.readOnly {
+		http.Error(w, "server is read-only", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+	req := struct {
+		Reviewed bool `json:"reviewed"`
+	}{Reviewed: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.storage.SetGroupReviewed(id, req.Reviewed); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNoGroup) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"reviewed": req.Reviewed,
+	})
+}
+
 func (s *Server) handleClean(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.readOnly {
+		http.Error(w, "server is read-only", http.StatusForbidden)
+		return
+	}
 
-	s.recordActivity()
+	s.metrics.cleanRequests.Add(1)
 
 	var req struct {
 		Paths     []string `json:"paths"`
@@ -228,7 +446,17 @@ func (s *Server) handleClean(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Files are removed one by one; the rows of those removed are deleted
+	// in one transaction after the loop, so the database changes at once
 	var results []map[string]interface{}
+	var removed []string
+	summary := map[string]int{"trashed": 0, "deleted": 0, "not_found": 0, "failed": 0}
+	finish := func() error {
+		if err := s.storage.DeleteImages(removed); err != nil {
+			return fmt.Errorf("files were removed but the database was not updated: %w", err)
+		}
+		return nil
+	}
 
 	for _, path := range req.Paths {
 		result := map[string]interface{}{"path": path}
@@ -236,50 +464,155 @@ func (s *Server) handleClean(w http.ResponseWriter, r *http.Request) {
 
 		// Only operate on files this tool has scanned; otherwise the API
 		// could be used to delete arbitrary files on the machine.
-		known, err := s.storage.ImageExists(path)
+		img, err := s.storage.GetImage(path)
 		if err != nil {
 			result["error"] = err.Error()
+			summary["failed"]++
 			continue
 		}
-		if !known {
+		if img == nil {
 			result["error"] = "path is not a scanned image"
+			summary["failed"]++
 			continue
 		}
 
+		if hash.IsArchiveEntry(path) {
+			result["error"] = "file is inside a zip archive (read-only)"
+			summary["failed"]++
+			continue
+		}
+
+		var status, op string
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			// File doesn't exist, just remove from DB
-			s.storage.DeleteImage(path)
-			result["status"] = "not_found"
+			status = "not_found"
 		} else if req.Permanent {
 			// Delete file permanently
-			err := os.Remove(path)
-			if err != nil {
+			if err := os.Remove(path); err != nil {
 				result["error"] = err.Error()
-			} else {
-				result["status"] = "deleted"
-				s.storage.DeleteImage(path)
+				summary["failed"]++
+				continue
 			}
+			status, op = "deleted", audit.OpDelete
+			s.metrics.deleted.Add(1)
 		} else {
 			// Move to trash (default)
-			err := fileutil.MoveToTrash(path)
-			if err != nil {
+			if err := fileutil.MoveToTrash(path); err != nil {
 				result["error"] = err.Error()
-			} else {
-				result["status"] = "trashed"
-				s.storage.DeleteImage(path)
+				summary["failed"]++
+				continue
+			}
+			status, op = "trashed", audit.OpTrash
+			s.metrics.trashed.Add(1)
+		}
+		result["status"] = status
+		summary[status]++
+		removed = append(removed, path)
+
+		if op != "" {
+			if err := s.recordClean(op, img); err != nil {
+				if ferr := finish(); ferr != nil {
+					err = fmt.Errorf("%w; %w", err, ferr)
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
 		}
 	}
 
+	if err := finish(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"results": results,
+		"summary": summary,
 	})
 }
 
-func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
-	s.recordActivity()
+// recordClean writes img's removal to the audit log, if there is one, with
+// the image its group keeps by the server's policies. Failing to record
+// stops the request, so nothing more is removed unrecorded.
+func (s *Server) recordClean(op string, img *models.ImageInfo) error {
+	if s.audit == nil {
+		return nil
+	}
+	entry := audit.Entry{Operation: op, Path: img.Path, GroupID: img.GroupID, Size: img.FileSize}
+	if img.GroupID != 0 {
+		members, err := s.storage.GetImagesByGroupID(img.GroupID)
+		if err == nil && len(members) > 0 {
+			group := &models.DuplicateGroup{ID: img.GroupID, Images: members}
+			group.SelectKeep(s.keep...)
+			entry.KeepPath = group.Keep.Path
+		}
+	}
+	return s.audit.Record(entry)
+}
+
+// handleRescan runs one rescan at a time; a request while one is running
+// gets 409. Progress is broadcast to WebSocket clients as it happens, and
+// counts as activity so the idle timer doesn't fire mid-scan.
+func (s *Server) handleRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.readOnly {
+		http.Error(w, "server is read-only", http.StatusForbidden)
+		return
+	}
+	if s.rescan == nil {
+		http.Error(w, "rescan not available", http.StatusNotImplemented)
+		return
+	}
+
+	var req struct {
+		Folder string `json:"folder"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Folder == "" {
+		http.Error(w, "folder required", http.StatusBadRequest)
+		return
+	}
+	folder, err := filepath.Abs(req.Folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+		http.Error(w, "not a directory: "+folder, http.StatusBadRequest)
+		return
+	}
+
+	if !s.rescanning.CompareAndSwap(false, true) {
+		http.Error(w, "a rescan is already running", http.StatusConflict)
+		return
+	}
+	defer s.rescanning.Store(false)
+
+	result, err := s.rescan(s.storage, folder, func(scanned, total int) {
+		s.recordActivity()
+		s.broadcast(fmt.Sprintf(`{"type":"rescan_progress","scanned":%d,"total":%d}`, scanned, total))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_scanned":    result.TotalScanned,
+		"total_groups":     result.TotalGroups,
+		"total_duplicates": result.TotalDuplicates,
+	})
+}
+
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
 	if path == "" {
 		http.Error(w, "path required", http.StatusBadRequest)
@@ -288,15 +621,49 @@ func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 
 	// Only serve files this tool has scanned; otherwise this endpoint would
 	// allow reading arbitrary files on the machine.
-	known, err := s.storage.ImageExists(path)
+	img, err := s.storage.GetImage(path)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !known {
+	if img == nil {
 		http.Error(w, "path is not a scanned image", http.StatusNotFound)
 		return
 	}
 
-	http.ServeFile(w, r, path)
+	f, err := hash.OpenFile(path)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The scanned format decides the type rather than sniffing, and the
+	// validators follow the file so a replaced image isn't served from cache.
+	// ServeContent answers conditional and range requests from them.
+	if contentType, ok := imageContentTypes[img.Format]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, stat.Size(), stat.ModTime().UnixNano()))
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), f)
+}
+
+// imageContentTypes maps ImageInfo.Format to the Content-Type of the original
+// file. Unlisted formats are left to ServeContent (by extension, then
+// sniffing).
+var imageContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"cr2":  "image/x-canon-cr2",
+	"nef":  "image/x-nikon-nef",
+	"arw":  "image/x-sony-arw",
 }
@@ -1,16 +1,25 @@
 package server
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"imagedupfinder/internal/audit"
 	"imagedupfinder/internal/models"
+	"imagedupfinder/internal/storage"
 )
 
 func newTestServer(t *testing.T) *Server {
@@ -68,6 +77,229 @@ func TestHandleImage_ServesScannedPath(t *testing.T) {
 	}
 }
 
+func TestHandleImage_ContentTypeAndConditional(t *testing.T) {
+	s := newTestServer(t)
+
+	// The bytes would sniff as text, and misnamed.png is a JPEG: only the
+	// stored format gives the right type
+	dir := t.TempDir()
+	files := []struct {
+		name, format, want string
+	}{
+		{"a.png", "png", "image/png"},
+		{"b.jpg", "jpeg", "image/jpeg"},
+		{"misnamed.png", "jpeg", "image/jpeg"},
+	}
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var images []*models.ImageInfo
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte("fake image data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &models.ImageInfo{Path: path, Hash: 1, Format: f.format, FileSize: 15, ModTime: modTime})
+	}
+	if err := s.storage.SaveImages(images); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/image?path="+url.QueryEscape(path), nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		s.handleImage(rec, req)
+		return rec
+	}
+
+	for i, f := range files {
+		if got := get(images[i].Path).Header().Get("Content-Type"); got != f.want {
+			t.Errorf("%s: Content-Type = %q, want %q", f.name, got, f.want)
+		}
+	}
+
+	path := images[0].Path
+	rec := get(path)
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Fatalf("ETag = %q, Last-Modified = %q; want both from the file", etag, rec.Header().Get("Last-Modified"))
+	}
+	if rec := get(path, "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: got %d, want 304", rec.Code)
+	}
+	if rec := get(path, "If-Modified-Since", modTime.Format(http.TimeFormat)); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since the mod time: got %d, want 304", rec.Code)
+	}
+	if rec := get(path, "Range", "bytes=0-3"); rec.Code != http.StatusPartialContent || rec.Body.String() != "fake" {
+		t.Errorf("range request: got %d %q, want 206 \"fake\"", rec.Code, rec.Body.String())
+	}
+
+	// Replacing the file changes the ETag, so a cached copy is not reused
+	later := modTime.Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(path, "If-None-Match", etag); rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: got %d, want 200", rec.Code)
+	}
+}
+
+// saveSortableGroups stores three groups that sort differently by each key:
+// 1 exact, 2 images, 100 B reclaimable; 2 perceptual, 3 images, 20 B;
+// 3 perceptual, 2 images, 500 B
+func saveSortableGroups(t *testing.T, s *Server) {
+	t.Helper()
+	specs := []struct {
+		id, images int
+		size       int64
+		method     string
+	}{
+		{1, 2, 100, models.MatchExact},
+		{2, 3, 10, models.MatchPerceptual},
+		{3, 2, 500, models.MatchPerceptual},
+	}
+	var images []*models.ImageInfo
+	var groups []*models.DuplicateGroup
+	for _, spec := range specs {
+		g := &models.DuplicateGroup{ID: spec.id, MatchMethod: spec.method}
+		for i := range spec.images {
+			img := &models.ImageInfo{Path: fmt.Sprintf("/g%d/%d.jpg", spec.id, i), FileSize: spec.size, ModTime: time.Now(), Score: 100}
+			images = append(images, img)
+			g.Images = append(g.Images, img)
+		}
+		groups = append(groups, g)
+	}
+	if err := s.storage.SaveImages(images); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.storage.UpdateGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleGroups_SortAndFilter(t *testing.T) {
+	s := newTestServer(t)
+	saveSortableGroups(t, s)
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{1, 2, 3}},
+		{"?sort=id&order=desc", []int{3, 2, 1}},
+		{"?sort=reclaimable", []int{2, 1, 3}},
+		{"?sort=reclaimable&order=desc", []int{3, 1, 2}},
+		{"?sort=images&order=asc", []int{1, 3, 2}},
+		{"?sort=images&order=desc", []int{2, 1, 3}},
+		{"?method=exact", []int{1}},
+		{"?method=perceptual&sort=reclaimable&order=desc", []int{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.handleGroups(rec, httptest.NewRequest("GET", "/api/groups"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+			var groups []*models.DuplicateGroup
+			if err := json.NewDecoder(rec.Body).Decode(&groups); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, g := range groups {
+				ids = append(ids, g.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("groups %v, want %v", ids, tt.want)
+			}
+
+			q, _ := url.ParseQuery(strings.TrimPrefix(tt.query, "?"))
+			if got, want := rec.Header().Get("X-Sort"), cmp.Or(q.Get("sort"), "id"); got != want {
+				t.Errorf("X-Sort = %q, want %q", got, want)
+			}
+			if got, want := rec.Header().Get("X-Order"), cmp.Or(q.Get("order"), "asc"); got != want {
+				t.Errorf("X-Order = %q, want %q", got, want)
+			}
+			if got := rec.Header().Get("X-Method"); got != q.Get("method") {
+				t.Errorf("X-Method = %q, want %q", got, q.Get("method"))
+			}
+		})
+	}
+
+	for _, query := range []string{"?sort=size", "?order=up", "?method=fuzzy"} {
+		rec := httptest.NewRecorder()
+		s.handleGroups(rec, httptest.NewRequest("GET", "/api/groups"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestHandleReviewed(t *testing.T) {
+	s := newTestServer(t)
+	saveSortableGroups(t, s)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Host = "localhost:8080"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	reviewed := func() []int {
+		t.Helper()
+		groups, err := s.storage.GetDuplicateGroups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, g := range groups {
+			if g.Reviewed() {
+				ids = append(ids, g.ID)
+			}
+		}
+		return ids
+	}
+
+	if rec := post("/api/groups/2/reviewed", ""); rec.Code != http.StatusOK {
+		t.Fatalf("marking group 2: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/api/groups/3/reviewed", `{"reviewed":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("marking group 3: got %d: %s", rec.Code, rec.Body)
+	}
+	if ids := reviewed(); !slices.Equal(ids, []int{2, 3}) {
+		t.Errorf("reviewed groups = %v, want [2 3]", ids)
+	}
+	if rec := post("/api/groups/2/reviewed", `{"reviewed":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("clearing group 2: got %d: %s", rec.Code, rec.Body)
+	}
+	if ids := reviewed(); !slices.Equal(ids, []int{3}) {
+		t.Errorf("reviewed groups after clearing = %v, want [3]", ids)
+	}
+
+	for path, want := range map[string]int{
+		"/api/groups/9/reviewed":   http.StatusNotFound,
+		"/api/groups/abc/reviewed": http.StatusBadRequest,
+	} {
+		if rec := post(path, ""); rec.Code != want {
+			t.Errorf("%s: got %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	WithReadOnly(true)(s)
+	if rec := post("/api/groups/1/reviewed", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("read-only server: got %d, want 403", rec.Code)
+	}
+}
+
 func TestHandleClean_RejectsUnknownPath(t *testing.T) {
 	s := newTestServer(t)
 
@@ -93,6 +325,207 @@ func TestHandleClean_RejectsUnknownPath(t *testing.T) {
 	}
 }
 
+func TestHandleClean_AuditLog(t *testing.T) {
+	s := newTestServer(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	WithAuditLog(log)(s)
+
+	dir := t.TempDir()
+	var images []*models.ImageInfo
+	for i, name := range []string{"keep.jpg", "dup1.jpg", "dup2.jpg"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &models.ImageInfo{
+			Path: path, Hash: 1, Format: "jpeg", FileSize: int64(100 * (i + 1)),
+			ModTime: time.Now(), Score: float64(300 - i), GroupID: 4,
+		})
+	}
+	if err := s.storage.SaveImages(images); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]any{"paths": []string{images[1].Path, images[2].Path}, "permanent": true})
+	rec := httptest.NewRecorder()
+	s.handleClean(rec, httptest.NewRequest("POST", "/api/clean", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit entries, want one per removed file:\n%s", len(lines), data)
+	}
+	for i, line := range lines {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("audit line %q is not JSON: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339, fmt.Sprint(e["timestamp"])); err != nil {
+			t.Errorf("entry %d timestamp = %v", i, e["timestamp"])
+		}
+		removed := images[i+1]
+		if e["operation"] != audit.OpDelete || e["path"] != removed.Path || e["destination"] != "" ||
+			e["group_id"] != 4.0 || e["size"] != float64(removed.FileSize) || e["keep_path"] != images[0].Path {
+			t.Errorf("entry %d = %v, want the deletion of %s keeping %s", i, e, removed.Path, images[0].Path)
+		}
+	}
+}
+
+func TestHandleClean_FailureKeepsDatabaseInStep(t *testing.T) {
+	s := newTestServer(t)
+
+	// The last "image" is a non-empty directory, which os.Remove refuses
+	dir := t.TempDir()
+	var images []*models.ImageInfo
+	for _, name := range []string{"keep.jpg", "dup1.jpg", "dup2.jpg", "stuck.jpg"} {
+		path := filepath.Join(dir, name)
+		if name == "stuck.jpg" {
+			if err := os.MkdirAll(filepath.Join(path, "inner"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &models.ImageInfo{
+			Path: path, Hash: 1, Format: "jpeg", FileSize: 100, ModTime: time.Now(), GroupID: 4,
+		})
+	}
+	if err := s.storage.SaveImages(images); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{images[1].Path, images[2].Path, images[3].Path}
+	body, _ := json.Marshal(map[string]any{"paths": paths, "permanent": true})
+	rec := httptest.NewRecorder()
+	s.handleClean(rec, httptest.NewRequest("POST", "/api/clean", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Results []map[string]string `json:"results"`
+		Summary map[string]int      `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 3 || resp.Results[2]["error"] == "" {
+		t.Fatalf("results = %v, want an error for the last path", resp.Results)
+	}
+	if want := map[string]int{"deleted": 2, "failed": 1, "trashed": 0, "not_found": 0}; !maps.Equal(resp.Summary, want) {
+		t.Errorf("summary = %v, want %v", resp.Summary, want)
+	}
+
+	// Every path is in the database exactly when it is still on disk
+	for _, img := range images {
+		_, statErr := os.Stat(img.Path)
+		stored, err := s.storage.GetImage(img.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if onDisk, inDB := statErr == nil, stored != nil; onDisk != inDB {
+			t.Errorf("%s: on disk %v, in database %v", filepath.Base(img.Path), onDisk, inDB)
+		}
+	}
+	if _, err := os.Stat(images[3].Path); err != nil {
+		t.Errorf("the failed path should be left alone: %v", err)
+	}
+}
+
+func TestHandleClean_ReadOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		want     int
+	}{
+		{"read-only", true, http.StatusForbidden},
+		{"read-write", false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			WithReadOnly(tt.readOnly)(s)
+
+			req := httptest.NewRequest("POST", "/api/clean", strings.NewReader(`{"paths":[]}`))
+			rec := httptest.NewRecorder()
+			s.handleClean(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleRescan_RejectsConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := newTestServer(t)
+	WithRescan(func(store *storage.Storage, folder string, progress func(scanned, total int)) (*models.ScanResult, error) {
+		close(started)
+		<-release
+		return &models.ScanResult{TotalScanned: 3, TotalGroups: 1, TotalDuplicates: 2}, nil
+	})(s)
+
+	body := `{"folder":"` + t.TempDir() + `"}`
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleRescan(first, httptest.NewRequest("POST", "/api/rescan", strings.NewReader(body)))
+	}()
+	<-started
+
+	second := httptest.NewRecorder()
+	s.handleRescan(second, httptest.NewRequest("POST", "/api/rescan", strings.NewReader(body)))
+	if second.Code != http.StatusConflict {
+		t.Errorf("concurrent rescan: expected 409, got %d", second.Code)
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Fatalf("first rescan: expected 200, got %d", first.Code)
+	}
+	if !strings.Contains(first.Body.String(), `"total_duplicates":2`) {
+		t.Errorf("unexpected summary: %s", first.Body.String())
+	}
+}
+
+func TestStaticHandler_MarksReadOnlyPage(t *testing.T) {
+	staticFS, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, readOnly := range []bool{true, false} {
+		s := newTestServer(t)
+		WithReadOnly(readOnly)(s)
+
+		rec := httptest.NewRecorder()
+		s.staticHandler(staticFS).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("readOnly=%v: expected 200, got %d", readOnly, rec.Code)
+		}
+		if got := strings.Contains(rec.Body.String(), `<body class="read-only">`); got != readOnly {
+			t.Errorf("readOnly=%v: page marked read-only = %v", readOnly, got)
+		}
+	}
+}
+
 func TestRequireLocalOrigin(t *testing.T) {
 	s := newTestServer(t)
 	handler := s.requireLocalOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -129,3 +562,41 @@ func TestRequireLocalOrigin(t *testing.T) {
 		})
 	}
 }
+
+func TestTrackActivity_StaticRequestResetsIdleTimer(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idleSince := func() time.Time {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.lastActivity
+	}
+	request := func(path string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "localhost:8080"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+	}
+
+	stale := time.Now().Add(-time.Hour)
+	s.mu.Lock()
+	s.lastActivity = stale
+	s.mu.Unlock()
+
+	request("/metrics")
+	if got := idleSince(); !got.Equal(stale) {
+		t.Errorf("metrics scrape moved lastActivity to %v", got)
+	}
+
+	request("/")
+	if got := idleSince(); !got.After(stale) {
+		t.Errorf("static request left lastActivity at %v", got)
+	}
+}
@@ -1,23 +1,16 @@
 package server
 
 import (
-	"bytes"
 	"container/list"
 	"fmt"
-	"image"
-	_ "image/gif"
-	"image/jpeg"
-	"image/png"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	_ "golang.org/x/image/bmp"
-	"golang.org/x/image/draw"
-	_ "golang.org/x/image/tiff"
-	_ "golang.org/x/image/webp"
+	"imagedupfinder/internal/hash"
+	"imagedupfinder/internal/thumbnail"
 )
 
 const (
@@ -25,7 +18,6 @@ const (
 	thumbMinSize     = 64
 	thumbMaxSize     = 2048
 	thumbCacheBudget = 100 << 20 // 100 MiB of encoded thumbnails
-	thumbJPEGQuality = 80
 )
 
 // thumbEntry is one cached, encoded thumbnail. fileSize and modTime identify
@@ -96,8 +88,6 @@ func (c *thumbCache) removeLocked(el *list.Element) {
 }
 
 func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
-	s.recordActivity()
-
 	path := r.URL.Query().Get("path")
 	if path == "" {
 		http.Error(w, "path required", http.StatusBadRequest)
@@ -125,22 +115,31 @@ func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
 		size = min(max(n, thumbMinSize), thumbMaxSize)
 	}
 
-	stat, err := os.Stat(path)
+	stat, err := hash.Stat(path)
 	if err != nil {
 		http.Error(w, "file not found", http.StatusNotFound)
 		return
 	}
 
-	etag := fmt.Sprintf(`"%x-%x-%x"`, stat.Size(), stat.ModTime().UnixNano(), size)
+	// The encoding depends on Accept, so it is part of both the ETag and the
+	// cache key.
+	webp := s.webpThumbs && acceptsWebP(r.Header.Get("Accept"))
+	w.Header().Set("Vary", "Accept")
+
+	variant := ""
+	if webp {
+		variant = "-webp"
+	}
+	etag := fmt.Sprintf(`"%x-%x-%x%s"`, stat.Size(), stat.ModTime().UnixNano(), size, variant)
 	if r.Header.Get("If-None-Match") == etag {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	key := fmt.Sprintf("%s\x00%d", path, size)
+	key := fmt.Sprintf("%s\x00%d\x00%t", path, size, webp)
 	entry := s.thumbs.get(key, stat.Size(), stat.ModTime())
 	if entry == nil {
-		data, contentType, err := renderThumbnail(path, size)
+		data, contentType, err := thumbnail.Render(path, size, webp)
 		if err != nil {
 			http.Error(w, "failed to render thumbnail", http.StatusInternalServerError)
 			return
@@ -161,43 +160,22 @@ func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
 	w.Write(entry.data)
 }
 
-// renderThumbnail decodes the image at path and re-encodes it scaled down to
-// fit within maxDim×maxDim. Formats that may carry transparency are encoded
-// as PNG, the rest as JPEG. Re-encoding server-side also makes formats
-// browsers cannot display natively (e.g. TIFF) viewable in the UI.
-func renderThumbnail(path string, maxDim int) ([]byte, string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, "", err
-	}
-	defer f.Close()
-
-	src, format, err := image.Decode(f)
-	if err != nil {
-		return nil, "", err
-	}
-
-	bounds := src.Bounds()
-	w, h := bounds.Dx(), bounds.Dy()
-	if w > maxDim || h > maxDim {
-		scale := float64(maxDim) / float64(max(w, h))
-		w = max(int(float64(w)*scale+0.5), 1)
-		h = max(int(float64(h)*scale+0.5), 1)
-	}
-	dst := image.NewRGBA(image.Rect(0, 0, w, h))
-	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
-
-	var buf bytes.Buffer
-	switch format {
-	case "png", "gif", "webp":
-		if err := png.Encode(&buf, dst); err != nil {
-			return nil, "", err
+// acceptsWebP reports whether an Accept header explicitly lists image/webp.
+// Wildcards are not enough: browsers that decode WebP advertise it by name.
+func acceptsWebP(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), "image/webp") {
+			continue
 		}
-		return buf.Bytes(), "image/png", nil
-	default:
-		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbJPEGQuality}); err != nil {
-			return nil, "", err
+		for _, param := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+					return false
+				}
+			}
 		}
-		return buf.Bytes(), "image/jpeg", nil
+		return true
 	}
+	return false
 }
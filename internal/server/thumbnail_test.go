@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
@@ -151,6 +152,94 @@ func TestHandleThumbnail_ETagRevalidation(t *testing.T) {
 	}
 }
 
+func TestHandleThumbnail_AcceptNegotiation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name            string
+		accept          string
+		webp            bool
+		wantContentType string
+	}{
+		{"browser accepting webp", "image/avif,image/webp,image/apng,*/*;q=0.8", true, "image/webp"},
+		{"no accept header", "", true, "image/jpeg"},
+		{"wildcard only", "*/*", true, "image/jpeg"},
+		{"webp refused with q=0", "image/webp;q=0, */*", true, "image/jpeg"},
+		{"webp disabled by option", "image/webp,*/*", false, "image/jpeg"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath := filepath.Join(tmpDir, fmt.Sprintf("test%d.db", i))
+			s, err := New(dbPath, 0, 0, WithWebPThumbnails(tt.webp))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer s.storage.Close()
+
+			path := filepath.Join(tmpDir, fmt.Sprintf("photo%d.jpg", i))
+			writeTestImage(t, path, 200, 100, func(f *os.File, img image.Image) error { return jpeg.Encode(f, img, nil) })
+			registerImage(t, s, path)
+
+			req := httptest.NewRequest("GET", "/api/thumbnail?path="+url.QueryEscape(path)+"&size=64", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.handleThumbnail(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary = %q, want Accept", rec.Header().Get("Vary"))
+			}
+
+			thumb, _, err := image.Decode(rec.Body)
+			if err != nil {
+				t.Fatalf("thumbnail is not a decodable image: %v", err)
+			}
+			if b := thumb.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+				t.Errorf("thumbnail size = %dx%d, want 64x32", b.Dx(), b.Dy())
+			}
+		})
+	}
+}
+
+func TestHandleThumbnail_FormatsCachedSeparately(t *testing.T) {
+	s := newTestServer(t)
+
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeTestImage(t, path, 100, 100, func(f *os.File, img image.Image) error { return jpeg.Encode(f, img, nil) })
+	registerImage(t, s, path)
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/thumbnail?path="+url.QueryEscape(path), nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		s.handleThumbnail(rec, req)
+		return rec
+	}
+
+	webp := get("image/webp")
+	jpg := get("*/*")
+	if webp.Header().Get("Content-Type") != "image/webp" || jpg.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("content types = %q, %q; want image/webp, image/jpeg",
+			webp.Header().Get("Content-Type"), jpg.Header().Get("Content-Type"))
+	}
+	if webp.Header().Get("ETag") == jpg.Header().Get("ETag") {
+		t.Error("WebP and JPEG thumbnails must have different ETags")
+	}
+
+	// A cached WebP entry must not be served to a client that didn't ask for it
+	if again := get("*/*"); again.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("Content-Type = %q after WebP was cached, want image/jpeg", again.Header().Get("Content-Type"))
+	}
+}
+
 func TestThumbCache_InvalidatesOnFileChange(t *testing.T) {
 	c := newThumbCache(1 << 20)
 	now := time.Now()
@@ -23,6 +23,22 @@ const (
 	// control messages, so anything larger is a protocol error and must not
 	// trigger a huge allocation.
 	maxWSPayload = 64 * 1024
+
+	// wsWriteTimeout bounds each frame write, so a client that stopped
+	// reading can't block a broadcast
+	wsWriteTimeout = 10 * time.Second
+
+	// Defaults for Server.wsPingInterval and Server.wsPongWait. A client
+	// that sends nothing, not even the pong browsers answer pings with, for
+	// wsPongWait is taken for gone (a sleeping laptop, a dropped network).
+	defaultWSPingInterval = 30 * time.Second
+	defaultWSPongWait     = 75 * time.Second
+
+	// Frame opcodes
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
 )
 
 type wsConn struct {
@@ -46,8 +62,14 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	s.activeClients++
 	s.lastActivity = time.Now()
 	s.mu.Unlock()
+	s.clientsMu.Lock()
+	s.clients[ws] = true
+	s.clientsMu.Unlock()
 
 	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, ws)
+		s.clientsMu.Unlock()
 		ws.close()
 		s.mu.Lock()
 		s.activeClients--
@@ -57,13 +79,38 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Send initial connected message
 	ws.sendText(`{"type":"connected"}`)
 
-	// Read messages (for ping/pong and activity)
+	// Ping until the connection is done; a failed write closes it, which
+	// ends the read loop below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(s.wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if ws.writeFrame(wsOpPing, nil) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// Read messages (for ping/pong and activity). Any frame shows the
+	// client is still there and extends the read deadline; without one in
+	// time, the read fails and the client is dropped.
 	reader := bufio.NewReader(conn)
 	for {
-		msg, err := readWSMessage(reader)
+		conn.SetReadDeadline(time.Now().Add(s.wsPongWait))
+		opcode, msg, err := readWSMessage(reader)
 		if err != nil {
 			break
 		}
+		if opcode == wsOpPong {
+			continue
+		}
 
 		s.recordActivity()
 
@@ -81,6 +128,16 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// broadcast sends msg to every connected client. Clients that fail to
+// receive it are dropped by their own read loop.
+func (s *Server) broadcast(msg string) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	for ws := range s.clients {
+		ws.sendText(msg)
+	}
+}
+
 func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
 	if r.Header.Get("Upgrade") != "websocket" {
 		return nil, fmt.Errorf("not a websocket request")
@@ -120,6 +177,12 @@ func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, error)
 }
 
 func (ws *wsConn) sendText(msg string) error {
+	return ws.writeFrame(wsOpText, []byte(msg))
+}
+
+// writeFrame writes a single unfragmented frame within wsWriteTimeout. A
+// failed write closes the connection, as the frame may have been cut off.
+func (ws *wsConn) writeFrame(opcode byte, data []byte) error {
 	ws.mu.Lock()
 	defer ws.mu.Unlock()
 
@@ -127,11 +190,10 @@ func (ws *wsConn) sendText(msg string) error {
 		return fmt.Errorf("connection closed")
 	}
 
-	data := []byte(msg)
 	frame := make([]byte, 0, 2+len(data))
 
-	// Text frame, FIN bit set
-	frame = append(frame, 0x81)
+	// FIN bit set
+	frame = append(frame, 0x80|opcode)
 
 	// Length
 	if len(data) < 126 {
@@ -148,8 +210,13 @@ func (ws *wsConn) sendText(msg string) error {
 
 	frame = append(frame, data...)
 
-	_, err := ws.conn.Write(frame)
-	return err
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := ws.conn.Write(frame); err != nil {
+		ws.closed = true
+		ws.conn.Close()
+		return err
+	}
+	return nil
 }
 
 func (ws *wsConn) close() {
@@ -162,17 +229,18 @@ func (ws *wsConn) close() {
 	}
 }
 
-func readWSMessage(r *bufio.Reader) ([]byte, error) {
+// readWSMessage reads one frame and returns its opcode and unmasked payload
+func readWSMessage(r *bufio.Reader) (byte, []byte, error) {
 	// Read first two bytes
 	header := make([]byte, 2)
 	if _, err := io.ReadFull(r, header); err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	// Check if it's a close frame
 	opcode := header[0] & 0x0F
-	if opcode == 0x08 {
-		return nil, fmt.Errorf("close frame received")
+	if opcode == wsOpClose {
+		return 0, nil, fmt.Errorf("close frame received")
 	}
 
 	// Get payload length
@@ -182,23 +250,23 @@ func readWSMessage(r *bufio.Reader) ([]byte, error) {
 	if payloadLen == 126 {
 		lenBytes := make([]byte, 2)
 		if _, err := io.ReadFull(r, lenBytes); err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 		payloadLen = int(binary.BigEndian.Uint16(lenBytes))
 	} else if payloadLen == 127 {
 		lenBytes := make([]byte, 8)
 		if _, err := io.ReadFull(r, lenBytes); err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 		len64 := binary.BigEndian.Uint64(lenBytes)
 		if len64 > maxWSPayload {
-			return nil, fmt.Errorf("payload too large: %d", len64)
+			return 0, nil, fmt.Errorf("payload too large: %d", len64)
 		}
 		payloadLen = int(len64)
 	}
 
 	if payloadLen > maxWSPayload {
-		return nil, fmt.Errorf("payload too large: %d", payloadLen)
+		return 0, nil, fmt.Errorf("payload too large: %d", payloadLen)
 	}
 
 	// Read mask key if present
@@ -206,14 +274,14 @@ func readWSMessage(r *bufio.Reader) ([]byte, error) {
 	if masked {
 		maskKey = make([]byte, 4)
 		if _, err := io.ReadFull(r, maskKey); err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 	}
 
 	// Read payload
 	payload := make([]byte, payloadLen)
 	if _, err := io.ReadFull(r, payload); err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	// Unmask if needed
@@ -223,5 +291,5 @@ func readWSMessage(r *bufio.Reader) ([]byte, error) {
 		}
 	}
 
-	return payload, nil
+	return opcode, payload, nil
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket opens a WebSocket to s and reads the upgrade response
+func dialWebSocket(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	t.Cleanup(ts.Close)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade failed: %v, %v", resp, err)
+	}
+	return conn, reader
+}
+
+func activeClients(s *Server) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeClients
+}
+
+func TestWebSocket_DropsClientThatStopsAnswering(t *testing.T) {
+	s := newTestServer(t)
+	s.wsPingInterval = 10 * time.Millisecond
+	s.wsPongWait = 100 * time.Millisecond
+
+	conn, reader := dialWebSocket(t, s)
+	if opcode, msg, err := readWSMessage(reader); err != nil || opcode != wsOpText || !strings.Contains(string(msg), "connected") {
+		t.Fatalf("first frame = %x %q, %v; want the connected message", opcode, msg, err)
+	}
+	if n := activeClients(s); n != 1 {
+		t.Fatalf("activeClients = %d after connecting, want 1", n)
+	}
+
+	// The client goes silent: it reads the pings but never answers them
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	pinged := false
+	for {
+		opcode, _, err := readWSMessage(reader)
+		if err != nil {
+			break
+		}
+		pinged = pinged || opcode == wsOpPing
+	}
+	if !pinged {
+		t.Error("server sent no ping before closing")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for activeClients(s) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("activeClients = %d after the client stopped answering, want 0", activeClients(s))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocket_KeepsClientThatAnswersPings(t *testing.T) {
+	s := newTestServer(t)
+	s.wsPingInterval = 10 * time.Millisecond
+	s.wsPongWait = 100 * time.Millisecond
+
+	conn, reader := dialWebSocket(t, s)
+	// Answer every ping with a masked, empty pong, for several times the
+	// pong wait
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	for {
+		opcode, _, err := readWSMessage(reader)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			t.Fatalf("connection dropped while answering pings: %v", err)
+		}
+		if opcode == wsOpPing {
+			conn.Write([]byte{0x80 | wsOpPong, 0x80, 1, 2, 3, 4})
+		}
+	}
+	if n := activeClients(s); n != 1 {
+		t.Errorf("activeClients = %d, want the answering client still counted", n)
+	}
+}
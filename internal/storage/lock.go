@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned by NewStorage with WithWriterLock when another
+// process already holds the database's writer lock
+var ErrLocked = errors.New("another imagedupfinder instance is using this database")
+
+// WithWriterLock makes NewStorage take an exclusive advisory lock on a
+// sidecar dbPath+".lock" file, held until Close, so that two commands can't
+// write the same database at once. Opening without it takes no lock: readers
+// such as list run alongside a writer and each other.
+func WithWriterLock() Option {
+	return func(s *Storage) {
+		s.writerLock = true
+	}
+}
+
+// fileLock is an exclusive advisory lock held through an open file
+type fileLock struct {
+	f *os.File
+}
+
+// acquireLock locks path, creating it if needed, without waiting. It fails
+// with ErrLocked if the lock is held elsewhere. The file is left in place
+// on release; removing it could race with the next process locking it.
+func acquireLock(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLockHeld) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &fileLock{f: f}, nil
+}
+
+// release unlocks by closing the file; a nil lock is a no-op
+func (l *fileLock) release() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
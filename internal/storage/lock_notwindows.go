@@ -0,0 +1,22 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errLockHeld reports that lockFile failed because another file handle
+// holds the lock
+var errLockHeld = syscall.EWOULDBLOCK
+
+// lockFile takes an exclusive flock on f without blocking
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLockHeld
+	}
+	return err
+}
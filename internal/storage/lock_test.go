@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	first, err := NewStorage(dbPath, WithWriterLock())
+	if err != nil {
+		t.Fatalf("first writer: %v", err)
+	}
+
+	if _, err := NewStorage(dbPath, WithWriterLock()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second writer: got %v, want ErrLocked", err)
+	}
+
+	// Readers don't take the lock and aren't blocked by it
+	reader, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("reader while locked: %v", err)
+	}
+	reader.Close()
+
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	second, err := NewStorage(dbPath, WithWriterLock())
+	if err != nil {
+		t.Fatalf("writer after release: %v", err)
+	}
+	second.Close()
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Paths are stored as given, for display and for opening the files, and
+// matched by a canonical key next to them (images.path_key and
+// ignored_paths.path_key), which carries the UNIQUE constraint. The options
+// below decide how the key is made.
+
+// WithUnicodeNormalization matches paths in Unicode NFC, so a name the
+// filesystem reports decomposed (NFD) and the same name typed precomposed
+// are one image. macOS filesystems treat both forms as the same file, so
+// this is the default there; elsewhere they can name different files and it
+// is off.
+func WithUnicodeNormalization(enabled bool) Option {
+	return func(s *Storage) {
+		s.normalizePaths = enabled
+	}
+}
+
+// WithCaseFolding matches paths regardless of case, for libraries on a
+// case-insensitive filesystem where the same file can be reached under
+// paths differing only in case. Paths keep the case they were last saved
+// with. Don't use it on a case-sensitive filesystem: files differing only in
+// case would be merged.
+func WithCaseFolding(enabled bool) Option {
+	return func(s *Storage) {
+		s.foldCase = enabled
+	}
+}
+
+// defaultNormalizePaths reports whether WithUnicodeNormalization is on
+// unless set
+func defaultNormalizePaths() bool {
+	return runtime.GOOS == "darwin"
+}
+
+// canonicalPath returns the key path is matched by
+func (s *Storage) canonicalPath(path string) string {
+	if s.normalizePaths {
+		path = norm.NFC.String(path)
+	}
+	if s.foldCase {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// CanonicalPath returns the key path is matched by, so callers can match
+// their own paths against stored ones (see WithUnicodeNormalization and
+// WithCaseFolding)
+func (s *Storage) CanonicalPath(path string) string {
+	return s.canonicalPath(path)
+}
+
+// keyMode names the options canonicalPath applies, as recorded in the
+// settings table for the stored keys
+func (s *Storage) keyMode() string {
+	var mode []string
+	if s.normalizePaths {
+		mode = append(mode, "nfc")
+	}
+	if s.foldCase {
+		mode = append(mode, "fold")
+	}
+	return strings.Join(mode, ",")
+}
+
+// keyedTables are the tables with a path_key column
+var keyedTables = []string{"images", "ignored_paths"}
+
+// rekeyPaths recomputes the stored path keys when they were made with other
+// options than s has, or not at all (rows saved before path_key existed).
+// Rows whose paths now have the same key are merged into one, as saving
+// them again would.
+func (s *Storage) rekeyPaths() error {
+	mode := s.keyMode()
+	var stored string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE name = 'path_keys'").Scan(&stored)
+	if err == nil && stored == mode {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range keyedTables {
+		rows, err := queryPaths(tx, "SELECT rowid, path FROM "+table)
+		if err != nil {
+			return err
+		}
+		// Old keys are dropped first, so a new key only ever collides with
+		// another new one
+		if _, err := tx.Exec("UPDATE " + table + " SET path_key = NULL"); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := tx.Exec("UPDATE OR REPLACE "+table+" SET path_key = ? WHERE rowid = ?", s.canonicalPath(row.path), row.id); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES ('path_keys', ?)", mode); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+
+	"imagedupfinder/internal/models"
+)
+
+// "café.jpg" precomposed (NFC) and decomposed (NFD), as macOS reports it
+var (
+	nfcPath = "/photos/caf\u00e9.jpg"
+	nfdPath = "/photos/cafe\u0301.jpg"
+)
+
+func pathImage(path string) *models.ImageInfo {
+	return &models.ImageInfo{Path: path, Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000}
+}
+
+func TestCanonicalPath_NFDAndNFCAreOneImage(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithUnicodeNormalization(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfdPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfcPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	images, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if len(images) != 1 || images[0].Path != nfcPath {
+		t.Fatalf("stored %d images, want one under the NFC path", len(images))
+	}
+	if img, err := store.GetImage(nfdPath); err != nil || img == nil {
+		t.Errorf("GetImage(NFD) = %v, %v; want the stored image", img, err)
+	}
+	if ok, err := store.ImageExists(nfdPath); err != nil || !ok {
+		t.Errorf("ImageExists(NFD) = %v, %v; want true", ok, err)
+	}
+	if folder, err := store.GetImagesByFolder(norm.NFD.String("/photos")); err != nil || len(folder) != 1 {
+		t.Errorf("GetImagesByFolder = %d images, %v; want 1", len(folder), err)
+	}
+
+	if err := store.DeleteImage(nfdPath); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	if images, _ := store.GetAllImages(); len(images) != 0 {
+		t.Errorf("DeleteImage(NFD) left %d images", len(images))
+	}
+}
+
+func TestCanonicalPath_RekeysRowSavedUnnormalized(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewStorage(dbPath, WithUnicodeNormalization(false))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfdPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	store.Close()
+
+	store, err = NewStorage(dbPath, WithUnicodeNormalization(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfdPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	images, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if len(images) != 1 || images[0].Path != nfdPath {
+		t.Fatalf("stored %d images, want the NFD row updated in place", len(images))
+	}
+	if ok, err := store.ImageExists(nfcPath); err != nil || !ok {
+		t.Errorf("ImageExists(NFC) = %v, %v; want true", ok, err)
+	}
+}
+
+func TestCanonicalPath_NotNormalizedKeepsBothForms(t *testing.T) {
+	// Linux filesystems store names as bytes: both forms can be real files
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithUnicodeNormalization(false))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfdPath), pathImage(nfcPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if images, _ := store.GetAllImages(); len(images) != 2 {
+		t.Errorf("stored %d images, want 2", len(images))
+	}
+}
+
+func TestCanonicalPath_CaseFolding(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithCaseFolding(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	a, b, c := pathImage("/Photos/IMG_0001.JPG"), pathImage("/photos/img_0001.jpg"), pathImage("/Photos/IMG_0002.JPG")
+	if err := store.SaveImages([]*models.ImageInfo{a, b, c}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	images, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("stored %d images, want 2", len(images))
+	}
+	// The last saved spelling is kept, not the lower-cased key
+	if images[0].Path != "/Photos/IMG_0002.JPG" || images[1].Path != "/photos/img_0001.jpg" {
+		t.Errorf("stored paths %q, %q; want them as saved", images[0].Path, images[1].Path)
+	}
+
+	// Groups and the ignore list match whatever case they are given in
+	if err := store.UpdateGroups([]*models.DuplicateGroup{{ID: 1, Images: []*models.ImageInfo{a, c}}}); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+	if groups, _ := store.GetDuplicateGroups(); len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	if err := store.IgnorePath("/PHOTOS/img_0002.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+	if groups, _ := store.GetDuplicateGroups(); len(groups) != 0 {
+		t.Errorf("got %d groups after ignoring a member, want 0", len(groups))
+	}
+}
+
+func TestCanonicalPath_ResumeFindsProcessedImages(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithUnicodeNormalization(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	// An interrupted scan saved the file and marked it under its walked NFD name
+	if err := store.SaveImages([]*models.ImageInfo{pathImage(nfdPath)}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.MarkProcessed("/photos", []string{nfdPath}); err != nil {
+		t.Fatalf("MarkProcessed failed: %v", err)
+	}
+
+	images, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	known := make(map[string]*models.ImageInfo, len(images))
+	for _, img := range images {
+		known[store.CanonicalPath(img.Path)] = img
+	}
+	processed, err := store.GetProcessedPaths("/photos")
+	if err != nil {
+		t.Fatalf("GetProcessedPaths failed: %v", err)
+	}
+	if len(processed) != 1 {
+		t.Fatalf("got %d processed paths, want 1", len(processed))
+	}
+	for path := range processed {
+		if known[store.CanonicalPath(path)] == nil {
+			t.Errorf("processed %q not found among the stored images", path)
+		}
+	}
+}
+
+func TestCanonicalPath_CaseFoldingKeepsOriginalPath(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithCaseFolding(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	raw, jpeg := pathImage("/Photos/Trip/IMG_0001.CR2"), pathImage("/Photos/Trip/IMG_0001.JPG")
+	raw.SidecarOf, jpeg.SidecarOf = jpeg.Path, raw.Path
+	if err := store.SaveImages([]*models.ImageInfo{raw, jpeg}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.IgnorePath("/Photos/Trip/IMG_0001.JPG"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+
+	img, err := store.GetImage("/photos/trip/img_0001.cr2")
+	if err != nil || img == nil {
+		t.Fatalf("GetImage(lower case) = %v, %v; want the stored image", img, err)
+	}
+	if img.Path != raw.Path || img.SidecarOf != jpeg.Path {
+		t.Errorf("got path %q sidecar %q, want them as saved", img.Path, img.SidecarOf)
+	}
+	if ignored, _ := store.GetIgnoredPaths(); len(ignored) != 1 || ignored[0] != jpeg.Path {
+		t.Errorf("ignored %q, want [%s]", ignored, jpeg.Path)
+	}
+
+	// Remapping matches the prefix in any case and keeps the rest as saved
+	n, err := store.RemapPaths("/photos", "/Archive/Photos")
+	if err != nil || n != 2 {
+		t.Fatalf("RemapPaths = %d, %v; want 2", n, err)
+	}
+	images, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	want := []string{"/Archive/Photos/Trip/IMG_0001.CR2", "/Archive/Photos/Trip/IMG_0001.JPG"}
+	if len(images) != 2 || images[0].Path != want[0] || images[1].Path != want[1] {
+		t.Fatalf("remapped to %d images, want %q", len(images), want)
+	}
+	if images[0].SidecarOf != want[1] {
+		t.Errorf("sidecar_of = %q, want %q", images[0].SidecarOf, want[1])
+	}
+	if ignored, _ := store.GetIgnoredPaths(); len(ignored) != 1 || ignored[0] != want[1] {
+		t.Errorf("ignored %q, want [%s]", ignored, want[1])
+	}
+	if err := store.UnignorePath("/archive/photos/trip/img_0001.jpg"); err != nil {
+		t.Fatalf("UnignorePath failed: %v", err)
+	}
+	if ignored, _ := store.GetIgnoredPaths(); len(ignored) != 0 {
+		t.Errorf("UnignorePath left %q", ignored)
+	}
+}
+
+func TestCanonicalPath_RekeysWhenCaseFoldingChanges(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	if err := store.SaveImages([]*models.ImageInfo{pathImage("/Photos/IMG_0001.JPG")}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	store.Close()
+
+	store, err = NewStorage(dbPath, WithCaseFolding(true))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+	if ok, err := store.ImageExists("/photos/img_0001.jpg"); err != nil || !ok {
+		t.Errorf("ImageExists(lower case) = %v, %v; want true", ok, err)
+	}
+	if folder, err := store.GetImagesByFolder("/PHOTOS"); err != nil || len(folder) != 1 || folder[0].Path != "/Photos/IMG_0001.JPG" {
+		t.Errorf("GetImagesByFolder = %d images, %v; want the one as saved", len(folder), err)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrBusy is returned (wrapping the driver error) when a write still finds
+// the database locked after the busy timeout and all retries.
+var ErrBusy = errors.New("database is busy; another imagedupfinder command may be using it")
+
+// ErrReadOnly is returned by writes to a database opened WithReadOnly
+var ErrReadOnly = errors.New("database is opened read-only")
+
+const (
+	// maxBusyRetries bounds how often a write is retried after SQLITE_BUSY.
+	// Each attempt already waits up to the busy timeout inside SQLite.
+	maxBusyRetries = 3
+
+	// busyRetryDelay is the pause before the first retry, doubled each time
+	busyRetryDelay = 50 * time.Millisecond
+)
+
+// retry runs the write op, retrying it while the database is locked by
+// another connection. op must be safe to repeat, i.e. run in its own
+// transaction or be a single statement. On a read-only Storage, op is not
+// run and ErrReadOnly is returned.
+func (s *Storage) retry(op func() error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = op(); !isBusy(err) {
+			return err
+		}
+		if attempt == maxBusyRetries {
+			return fmt.Errorf("%w: %w", ErrBusy, err)
+		}
+		time.Sleep(busyRetryDelay << attempt)
+	}
+}
+
+// exec runs a single write statement with retry
+func (s *Storage) exec(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := s.retry(func() error {
+		var err error
+		result, err = s.db.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// isBusy reports whether err is SQLite's "database is locked"
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff // strip extended result code
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"imagedupfinder/internal/models"
+)
+
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	// Separate Storage values behave like separate processes (scan + list)
+	var stores []*Storage
+	for i := 0; i < 3; i++ {
+		store, err := NewStorage(dbPath)
+		if err != nil {
+			t.Fatalf("NewStorage failed: %v", err)
+		}
+		defer store.Close()
+		stores = append(stores, store)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for w, store := range stores[:2] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := 0; batch < 20; batch++ {
+				var images []*models.ImageInfo
+				for i := 0; i < 20; i++ {
+					images = append(images, &models.ImageInfo{
+						Path: fmt.Sprintf("/w%d/%d/%d.jpg", w, batch, i), Hash: uint64(i),
+						Format: "jpeg", ModTime: time.Now(), GroupID: batch + 1,
+					})
+				}
+				if err := store.SaveImages(images); err != nil {
+					errs <- fmt.Errorf("writer %d: %w", w, err)
+					return
+				}
+				if err := store.RecordScan(models.ScanRecord{Folder: "/w", TotalImages: len(images), TotalGroups: 1}); err != nil {
+					errs <- fmt.Errorf("writer %d: %w", w, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 40; i++ {
+			if _, err := stores[2].GetDuplicateGroups(); err != nil {
+				errs <- fmt.Errorf("reader: %w", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	images, err := stores[2].GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if len(images) != 2*20*20 {
+		t.Errorf("expected %d images, got %d", 2*20*20, len(images))
+	}
+}
+
+func TestWrite_ReportsBusyAfterRetries(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	holder, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer holder.Close()
+	store, err := NewStorage(dbPath, WithBusyTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	// Transactions begin IMMEDIATE, so this holds the write lock
+	tx, err := holder.db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = store.IgnorePath("/a.jpg")
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy while another writer holds the lock, got %v", err)
+	}
+
+	// Once released, the write goes through
+	tx.Rollback()
+	if err := store.IgnorePath("/a.jpg"); err != nil {
+		t.Errorf("IgnorePath after unlock failed: %v", err)
+	}
+}
+
+func TestWithWAL(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), WithWAL(enabled))
+		if err != nil {
+			t.Fatalf("NewStorage failed: %v", err)
+		}
+		var mode string
+		if err := store.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatalf("PRAGMA journal_mode failed: %v", err)
+		}
+		store.Close()
+
+		if want := map[bool]string{true: "wal", false: "delete"}[enabled]; mode != want {
+			t.Errorf("WithWAL(%v): journal_mode = %s, want %s", enabled, mode, want)
+		}
+	}
+}
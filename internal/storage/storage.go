@@ -2,10 +2,15 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	_ "modernc.org/sqlite"
 
@@ -14,12 +19,74 @@ import (
 
 // Storage handles persistence of image hashes and duplicate groups
 type Storage struct {
-	db     *sql.DB
-	dbPath string
+	db          *sql.DB
+	dbPath      string
+	busyTimeout time.Duration
+	wal         bool
+	writerLock  bool
+	lock        *fileLock
+	backup      bool
+	existing    bool // the database file had content before opening
+	readOnly    bool
+
+	normalizePaths bool
+	foldCase       bool
+}
+
+// Option configures a Storage
+type Option func(*Storage)
+
+// WithBusyTimeout sets how long SQLite waits for another connection or
+// process to release a lock before failing with SQLITE_BUSY (default 5s).
+func WithBusyTimeout(d time.Duration) Option {
+	return func(s *Storage) {
+		if d >= 0 {
+			s.busyTimeout = d
+		}
+	}
+}
+
+// WithWAL enables or disables write-ahead logging (default enabled). WAL
+// lets reads proceed while another process writes; disable it for databases
+// on network filesystems, where it is not supported.
+func WithWAL(enabled bool) Option {
+	return func(s *Storage) {
+		s.wal = enabled
+	}
+}
+
+// WithMigrationBackup enables or disables backing up an existing database
+// before pending schema migrations run (default enabled). The backup is
+// written next to it as <db>.bak-v<version>, for the version migrated from,
+// and restored if a migration fails.
+func WithMigrationBackup(enabled bool) Option {
+	return func(s *Storage) {
+		s.backup = enabled
+	}
+}
+
+// WithReadOnly opens an existing database read-only and immutable, for
+// browsing one on a read-only mount or a snapshot: nothing is created,
+// migrated or locked, and no -wal or -shm file is written. Writes fail with
+// ErrReadOnly. SQLite assumes the file does not change while it is open, so
+// changes made meanwhile, or still in the -wal file of a database another
+// process has open, are not seen.
+func WithReadOnly() Option {
+	return func(s *Storage) {
+		s.readOnly = true
+	}
 }
 
 // NewStorage creates a new Storage
-func NewStorage(dbPath string) (*Storage, error) {
+func NewStorage(dbPath string, opts ...Option) (*Storage, error) {
+	s := &Storage{dbPath: dbPath, busyTimeout: 5 * time.Second, wal: true, backup: true, normalizePaths: defaultNormalizePaths()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.readOnly {
+		return openReadOnly(s)
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if dir != "." && dir != "" {
@@ -28,29 +95,93 @@ func NewStorage(dbPath string) (*Storage, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	if info, err := os.Stat(dbPath); err == nil && info.Size() > 0 {
+		s.existing = true
+	}
+
+	if s.writerLock {
+		lock, err := acquireLock(dbPath + ".lock")
+		if err != nil {
+			return nil, err
+		}
+		s.lock = lock
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?"+s.dsnParams())
 	if err != nil {
+		s.lock.release()
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	s.db = db
 
-	s := &Storage{db: db, dbPath: dbPath}
 	if err := s.init(); err != nil {
 		db.Close()
+		s.lock.release()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// openReadOnly opens s.dbPath for WithReadOnly. The database must exist and
+// be at the current schema version, as it can't be migrated.
+func openReadOnly(s *Storage) (*Storage, error) {
+	if _, err := os.Stat(s.dbPath); err != nil {
 		return nil, err
 	}
 
+	// mode and immutable are only understood in a file: URI
+	uri := "file:" + (&url.URL{Path: filepath.ToSlash(s.dbPath)}).EscapedPath()
+	params := url.Values{
+		"mode":      {"ro"},
+		"immutable": {"1"},
+		"_pragma":   {fmt.Sprintf("busy_timeout(%d)", s.busyTimeout.Milliseconds())},
+	}
+	db, err := sql.Open("sqlite", uri+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	s.db = db
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version < schemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("database schema version %d is older than %d and can't be migrated read-only", version, schemaVersion)
+	}
 	return s, nil
 }
 
+// dsnParams returns the driver parameters applied to every pooled
+// connection. Transactions begin IMMEDIATE so a writer takes the lock up
+// front and waits on the busy timeout, rather than failing when upgrading
+// from a read lock.
+func (s *Storage) dsnParams() string {
+	params := url.Values{
+		"_pragma": {fmt.Sprintf("busy_timeout(%d)", s.busyTimeout.Milliseconds())},
+		"_txlock": {"immediate"},
+	}
+	if s.wal {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	return params.Encode()
+}
+
 // Current schema version
-const schemaVersion = 2
+const schemaVersion = 31
 
 // migrations defines all schema migrations
-// Each migration should be idempotent (safe to run multiple times)
+// Each migration should be idempotent (safe to run multiple times).
+// ALTER TABLE ADD COLUMN is not, so such migrations name the column they add
+// in addsColumn ("table.column") and are skipped if it already exists.
 var migrations = []struct {
 	version     int
 	description string
 	up          string
+	addsColumn  string
 }{
 	{
 		version:     1,
@@ -64,6 +195,261 @@ var migrations = []struct {
 			ALTER TABLE images ADD COLUMN file_hash TEXT DEFAULT '';
 			CREATE INDEX IF NOT EXISTS idx_images_file_hash ON images(file_hash);
 		`,
+		addsColumn: "images.file_hash",
+	},
+	{
+		version:     3,
+		description: "Add scan_progress table for resumable scans",
+		up: `
+			CREATE TABLE IF NOT EXISTS scan_progress (
+				folder TEXT NOT NULL,
+				path TEXT NOT NULL,
+				PRIMARY KEY (folder, path)
+			);
+		`,
+	},
+	{
+		version:     4,
+		description: "Add ignored_paths table",
+		up: `
+			CREATE TABLE IF NOT EXISTS ignored_paths (
+				path TEXT PRIMARY KEY,
+				ignored_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version:     5,
+		description: "Add capture_time column for EXIF capture dates",
+		up: `
+			ALTER TABLE images ADD COLUMN capture_time DATETIME;
+		`,
+		addsColumn: "images.capture_time",
+	},
+	{
+		version:     6,
+		description: "Add hash_cache table for content-keyed hash reuse",
+		up: `
+			CREATE TABLE IF NOT EXISTS hash_cache (
+				file_size INTEGER NOT NULL,
+				mod_time INTEGER NOT NULL,
+				sample TEXT NOT NULL,
+				hash INTEGER NOT NULL,
+				width INTEGER NOT NULL,
+				height INTEGER NOT NULL,
+				format TEXT NOT NULL,
+				has_exif INTEGER DEFAULT 0,
+				capture_time DATETIME,
+				PRIMARY KEY (file_size, mod_time, sample)
+			);
+		`,
+	},
+	{
+		version:     7,
+		description: "Add hash_variant column for normalized hashes",
+		up: `
+			ALTER TABLE images ADD COLUMN hash_variant TEXT DEFAULT '';
+		`,
+		addsColumn: "images.hash_variant",
+	},
+	{
+		version:     8,
+		description: "Add duplicate_groups table for match method and distance",
+		up: `
+			CREATE TABLE IF NOT EXISTS duplicate_groups (
+				id INTEGER PRIMARY KEY,
+				match_method TEXT NOT NULL DEFAULT '',
+				distance INTEGER NOT NULL DEFAULT 0
+			);
+		`,
+	},
+	{
+		version:     9,
+		description: "Add blur_hash column for web UI placeholders",
+		up: `
+			ALTER TABLE images ADD COLUMN blur_hash TEXT DEFAULT '';
+		`,
+		addsColumn: "images.blur_hash",
+	},
+	{
+		version:     10,
+		description: "Add blur_hash column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN blur_hash TEXT DEFAULT '';
+		`,
+		addsColumn: "hash_cache.blur_hash",
+	},
+	{
+		version:     11,
+		description: "Add camera_make column for EXIF camera make",
+		up: `
+			ALTER TABLE images ADD COLUMN camera_make TEXT DEFAULT '';
+		`,
+		addsColumn: "images.camera_make",
+	},
+	{
+		version:     12,
+		description: "Add camera_make column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN camera_make TEXT DEFAULT '';
+		`,
+		addsColumn: "hash_cache.camera_make",
+	},
+	{
+		version:     13,
+		description: "Add camera_model column for EXIF camera model",
+		up: `
+			ALTER TABLE images ADD COLUMN camera_model TEXT DEFAULT '';
+		`,
+		addsColumn: "images.camera_model",
+	},
+	{
+		version:     14,
+		description: "Add camera_model column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN camera_model TEXT DEFAULT '';
+		`,
+		addsColumn: "hash_cache.camera_model",
+	},
+	{
+		version:     15,
+		description: "Add software column for EXIF software",
+		up: `
+			ALTER TABLE images ADD COLUMN software TEXT DEFAULT '';
+		`,
+		addsColumn: "images.software",
+	},
+	{
+		version:     16,
+		description: "Add software column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN software TEXT DEFAULT '';
+		`,
+		addsColumn: "hash_cache.software",
+	},
+	{
+		version:     17,
+		description: "Add orientation_hashes column for rotation matching",
+		up: `
+			ALTER TABLE images ADD COLUMN orientation_hashes TEXT DEFAULT '';
+		`,
+		addsColumn: "images.orientation_hashes",
+	},
+	{
+		version:     18,
+		description: "Add orientation_hashes column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN orientation_hashes TEXT DEFAULT '';
+		`,
+		addsColumn: "hash_cache.orientation_hashes",
+	},
+	{
+		version:     19,
+		description: "Add sharpness column for the sharpest-frame keep policy",
+		up: `
+			ALTER TABLE images ADD COLUMN sharpness REAL DEFAULT 0;
+		`,
+		addsColumn: "images.sharpness",
+	},
+	{
+		version:     20,
+		description: "Add sharpness column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN sharpness REAL DEFAULT 0;
+		`,
+		addsColumn: "hash_cache.sharpness",
+	},
+	{
+		version:     21,
+		description: "Add exif_tag_count column for the richest-EXIF keep policy",
+		up: `
+			ALTER TABLE images ADD COLUMN exif_tag_count INTEGER DEFAULT 0;
+		`,
+		addsColumn: "images.exif_tag_count",
+	},
+	{
+		version:     22,
+		description: "Add exif_tag_count column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN exif_tag_count INTEGER DEFAULT 0;
+		`,
+		addsColumn: "hash_cache.exif_tag_count",
+	},
+	{
+		version:     23,
+		description: "Add reviewed_at column for marking groups reviewed",
+		up: `
+			ALTER TABLE duplicate_groups ADD COLUMN reviewed_at DATETIME;
+		`,
+		addsColumn: "duplicate_groups.reviewed_at",
+	},
+	{
+		version:     24,
+		description: "Add threshold column to scan_history",
+		up: `
+			ALTER TABLE scan_history ADD COLUMN threshold INTEGER;
+		`,
+		addsColumn: "scan_history.threshold",
+	},
+	{
+		version:     25,
+		description: "Add matcher column to scan_history",
+		up: `
+			ALTER TABLE scan_history ADD COLUMN matcher TEXT;
+		`,
+		addsColumn: "scan_history.matcher",
+	},
+	{
+		version:     26,
+		description: "Add sidecar_of column for RAW+JPEG pairs",
+		up: `
+			ALTER TABLE images ADD COLUMN sidecar_of TEXT DEFAULT '';
+		`,
+		addsColumn: "images.sidecar_of",
+	},
+	{
+		version:     27,
+		description: "Add d_hash column for pHash+dHash matching",
+		up: `
+			ALTER TABLE images ADD COLUMN d_hash INTEGER DEFAULT 0;
+		`,
+		addsColumn: "images.d_hash",
+	},
+	{
+		version:     28,
+		description: "Add d_hash column to hash_cache",
+		up: `
+			ALTER TABLE hash_cache ADD COLUMN d_hash INTEGER DEFAULT 0;
+		`,
+		addsColumn: "hash_cache.d_hash",
+	},
+	{
+		version:     29,
+		description: "Add path_key column for canonical image path lookups",
+		up: `
+			ALTER TABLE images ADD COLUMN path_key TEXT;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_images_path_key ON images(path_key);
+		`,
+		addsColumn: "images.path_key",
+	},
+	{
+		version:     30,
+		description: "Add path_key column to ignored_paths",
+		up: `
+			ALTER TABLE ignored_paths ADD COLUMN path_key TEXT;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_ignored_paths_path_key ON ignored_paths(path_key);
+		`,
+		addsColumn: "ignored_paths.path_key",
+	},
+	{
+		version:     31,
+		description: "Add settings table",
+		up: `
+			CREATE TABLE IF NOT EXISTS settings (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+		`,
 	},
 }
 
@@ -121,21 +507,35 @@ func (s *Storage) init() error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := s.rekeyPaths(); err != nil {
+		return fmt.Errorf("failed to update path keys: %w", err)
+	}
+
 	return nil
 }
 
-// migrate runs pending schema migrations
+// migrate runs pending schema migrations. An existing database is backed up
+// first (see WithMigrationBackup); if a migration fails, the backup is put
+// back, undoing the ones that had already run.
 func (s *Storage) migrate() error {
 	currentVersion := s.getSchemaVersion()
 
+	backup := ""
+	if s.backup && s.existing && s.hasPendingMigrations(currentVersion) {
+		backup = fmt.Sprintf("%s.bak-v%d", s.dbPath, currentVersion)
+		if err := s.backupTo(backup); err != nil {
+			return fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+	}
+
 	for _, m := range migrations {
 		if m.version <= currentVersion || m.up == "" {
 			continue
 		}
 
 		// Check if migration is needed (column might already exist)
-		if m.version == 2 {
-			if s.columnExists("images", "file_hash") {
+		if table, column, ok := strings.Cut(m.addsColumn, "."); ok {
+			if s.columnExists(table, column) {
 				s.setSchemaVersion(m.version)
 				continue
 			}
@@ -143,7 +543,14 @@ func (s *Storage) migrate() error {
 
 		// Execute migration
 		if _, err := s.db.Exec(m.up); err != nil {
-			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			err = fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			if backup != "" {
+				if rerr := s.restoreFrom(backup); rerr != nil {
+					return fmt.Errorf("%w; restoring the backup %s also failed: %v", err, backup, rerr)
+				}
+				return fmt.Errorf("%w (database restored from backup)", err)
+			}
+			return err
 		}
 
 		s.setSchemaVersion(m.version)
@@ -152,6 +559,43 @@ func (s *Storage) migrate() error {
 	return nil
 }
 
+// hasPendingMigrations reports whether any migration would run on a
+// database at version
+func (s *Storage) hasPendingMigrations(version int) bool {
+	for _, m := range migrations {
+		if m.version > version && m.up != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// backupTo writes a consistent copy of the database to path, replacing a
+// previous one. VACUUM INTO includes changes still in the WAL, which a plain
+// file copy would miss.
+func (s *Storage) backupTo(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// restoreFrom closes the database and moves the backup at path over it,
+// dropping the WAL and shared-memory files that belong to the replaced one.
+// The Storage can't be used afterwards.
+func (s *Storage) restoreFrom(path string) error {
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(s.dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, s.dbPath)
+}
+
 // getSchemaVersion returns the current schema version
 func (s *Storage) getSchemaVersion() int {
 	var version int
@@ -162,6 +606,41 @@ func (s *Storage) getSchemaVersion() int {
 	return version
 }
 
+// SchemaVersion returns the schema version the database is at and the one
+// this build migrates to. They differ only if the database was written by a
+// newer version, since opening applies pending migrations.
+func (s *Storage) SchemaVersion() (current, latest int) {
+	return s.getSchemaVersion(), schemaVersion
+}
+
+// IntegrityCheck runs SQLite's integrity_check and returns an error
+// listing the problems it finds
+func (s *Storage) IntegrityCheck() error {
+	rows, err := s.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return fmt.Errorf("integrity check failed: %w", err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database is corrupt: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
 // setSchemaVersion records a migration as applied
 func (s *Storage) setSchemaVersion(version int) {
 	s.db.Exec(`INSERT OR REPLACE INTO schema_version (version) VALUES (?)`, version)
@@ -179,22 +658,43 @@ func (s *Storage) columnExists(table, column string) bool {
 	return count > 0
 }
 
-// Close closes the database connection
+// Close closes the database connection and releases the writer lock
 func (s *Storage) Close() error {
-	return s.db.Close()
+	err := s.db.Close()
+	if lerr := s.lock.release(); err == nil {
+		err = lerr
+	}
+	return err
 }
 
 // SaveImages saves or updates multiple images
 func (s *Storage) SaveImages(images []*models.ImageInfo) error {
+	return s.retry(func() error { return s.saveImages(images) })
+}
+
+func (s *Storage) saveImages(images []*models.ImageInfo) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	// A re-hashed image comes without a group; it keeps its old one until
+	// UpdateGroups replaces them, so review marks can be carried over. An
+	// image saved under another spelling of a stored path replaces it.
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO images (path, hash, file_hash, width, height, format, file_size, mod_time, has_exif, score, group_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO images (path, path_key, hash, hash_variant, file_hash, width, height, format, file_size, mod_time, has_exif, score, group_id, capture_time, blur_hash, camera_make, camera_model, software, orientation_hashes, sharpness, exif_tag_count, sidecar_of, d_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path_key) DO UPDATE SET
+			path = excluded.path,
+			hash = excluded.hash, hash_variant = excluded.hash_variant, file_hash = excluded.file_hash,
+			width = excluded.width, height = excluded.height, format = excluded.format,
+			file_size = excluded.file_size, mod_time = excluded.mod_time, has_exif = excluded.has_exif,
+			score = excluded.score, capture_time = excluded.capture_time, blur_hash = excluded.blur_hash,
+			camera_make = excluded.camera_make, camera_model = excluded.camera_model, software = excluded.software,
+			orientation_hashes = excluded.orientation_hashes, sharpness = excluded.sharpness,
+			exif_tag_count = excluded.exif_tag_count, sidecar_of = excluded.sidecar_of, d_hash = excluded.d_hash,
+			group_id = CASE WHEN excluded.group_id > 0 THEN excluded.group_id ELSE images.group_id END
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -208,9 +708,15 @@ func (s *Storage) SaveImages(images []*models.ImageInfo) error {
 		if img.HasExif {
 			hasExifInt = 1
 		}
+		var captureTime interface{} // NULL when unknown
+		if !img.CaptureTime.IsZero() {
+			captureTime = img.CaptureTime
+		}
 		_, err := stmt.Exec(
 			img.Path,
+			s.canonicalPath(img.Path),
 			hashInt,
+			img.HashVariant,
 			img.FileHash,
 			img.Width,
 			img.Height,
@@ -220,6 +726,16 @@ func (s *Storage) SaveImages(images []*models.ImageInfo) error {
 			hasExifInt,
 			img.Score,
 			img.GroupID,
+			captureTime,
+			img.BlurHash,
+			img.CameraMake,
+			img.CameraModel,
+			img.Software,
+			encodeHashes(img.OrientationHashes),
+			img.Sharpness,
+			img.ExifTagCount,
+			img.SidecarOf,
+			int64(img.DHash),
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert image %s: %w", img.Path, err)
@@ -231,19 +747,23 @@ func (s *Storage) SaveImages(images []*models.ImageInfo) error {
 
 // imageColumns is the column list shared by all image queries, in the order
 // expected by scanImageRow.
-const imageColumns = "id, path, hash, file_hash, width, height, format, file_size, mod_time, has_exif, score, group_id"
+const imageColumns = "id, path, hash, hash_variant, file_hash, width, height, format, file_size, mod_time, has_exif, score, group_id, capture_time, blur_hash, camera_make, camera_model, software, orientation_hashes, sharpness, exif_tag_count, sidecar_of, d_hash"
 
 // scanImageRow scans a single row selected with imageColumns.
 func scanImageRow(rows *sql.Rows) (*models.ImageInfo, error) {
 	img := &models.ImageInfo{}
 	var modTime string
-	var hashInt int64
+	var hashInt, dHashInt int64
 	var hasExifInt int
-	var fileHash sql.NullString
+	var hashVariant, fileHash, captureTime, blurHash sql.NullString
+	var cameraMake, cameraModel, software, orientations, sidecarOf sql.NullString
+	var sharpness sql.NullFloat64
+	var tagCount sql.NullInt64
 	err := rows.Scan(
 		&img.ID,
 		&img.Path,
 		&hashInt,
+		&hashVariant,
 		&fileHash,
 		&img.Width,
 		&img.Height,
@@ -253,18 +773,41 @@ func scanImageRow(rows *sql.Rows) (*models.ImageInfo, error) {
 		&hasExifInt,
 		&img.Score,
 		&img.GroupID,
+		&captureTime,
+		&blurHash,
+		&cameraMake,
+		&cameraModel,
+		&software,
+		&orientations,
+		&sharpness,
+		&tagCount,
+		&sidecarOf,
+		&dHashInt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan row: %w", err)
 	}
 	img.Hash = uint64(hashInt)
+	img.DHash = uint64(dHashInt)
+	img.HashVariant = hashVariant.String
 	img.FileHash = fileHash.String
+	img.BlurHash = blurHash.String
+	img.CameraMake = cameraMake.String
+	img.CameraModel = cameraModel.String
+	img.Software = software.String
+	img.OrientationHashes = decodeHashes(orientations.String)
+	img.Sharpness = sharpness.Float64
+	img.ExifTagCount = int(tagCount.Int64)
+	img.SidecarOf = sidecarOf.String
 	img.HasExif = hasExifInt == 1
 	img.ModTime = parseModTime(modTime)
+	if captureTime.Valid {
+		img.CaptureTime = parseModTime(captureTime.String)
+	}
 	return img, nil
 }
 
-// parseModTime parses a stored mod_time value. The modernc.org/sqlite driver
+// parseModTime parses a stored mod_time (or capture_time) value. The modernc.org/sqlite driver
 // stores time.Time as RFC3339Nano, which must round-trip exactly: incremental
 // scans compare it against the file's current modification time to decide
 // whether re-hashing can be skipped.
@@ -276,27 +819,65 @@ func parseModTime(s string) time.Time {
 	return t
 }
 
+// encodeHashes stores hashes as comma-separated hex, "" for none
+func encodeHashes(hashes []uint64) string {
+	parts := make([]string, len(hashes))
+	for i, h := range hashes {
+		parts[i] = strconv.FormatUint(h, 16)
+	}
+	return strings.Join(parts, ",")
+}
+
+// decodeHashes parses a value written by encodeHashes, skipping anything
+// malformed
+func decodeHashes(s string) []uint64 {
+	if s == "" {
+		return nil
+	}
+	var hashes []uint64
+	for _, part := range strings.Split(s, ",") {
+		if h, err := strconv.ParseUint(part, 16, 64); err == nil {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
 // queryImages runs a query selecting imageColumns and returns the scanned images.
 func (s *Storage) queryImages(query string, args ...interface{}) ([]*models.ImageInfo, error) {
+	var images []*models.ImageInfo
+	err := s.eachImage(func(img *models.ImageInfo) error {
+		images = append(images, img)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// eachImage runs a query selecting imageColumns and calls fn with each
+// scanned image as it is read, stopping at the first error
+func (s *Storage) eachImage(fn func(*models.ImageInfo) error, query string, args ...interface{}) error {
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query images: %w", err)
+		return fmt.Errorf("failed to query images: %w", err)
 	}
 	defer rows.Close()
 
-	var images []*models.ImageInfo
 	for rows.Next() {
 		img, err := scanImageRow(rows)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(img); err != nil {
+			return err
 		}
-		images = append(images, img)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+		return fmt.Errorf("failed to iterate rows: %w", err)
 	}
-
-	return images, nil
+	return nil
 }
 
 // GetAllImages returns all stored images
@@ -304,47 +885,416 @@ func (s *Storage) GetAllImages() ([]*models.ImageInfo, error) {
 	return s.queryImages("SELECT " + imageColumns + " FROM images ORDER BY path")
 }
 
-// UpdateGroups updates group IDs for images
-func (s *Storage) UpdateGroups(groups []*models.DuplicateGroup) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
+// IterateImages calls fn with every stored image in path order, like
+// GetAllImages but one row at a time, so a large database needn't be held
+// in memory. An error from fn stops the iteration and is returned as is.
+// fn may read from the database; writes should wait until IterateImages
+// returns, as the open query holds a read lock that blocks writers without
+// WAL.
+func (s *Storage) IterateImages(fn func(*models.ImageInfo) error) error {
+	return s.eachImage(fn, "SELECT "+imageColumns+" FROM images ORDER BY path")
+}
 
-	// Reset all group IDs
-	_, err = tx.Exec("UPDATE images SET group_id = 0")
-	if err != nil {
-		return fmt.Errorf("failed to reset groups: %w", err)
-	}
+// folderRange returns the bounds of a range scan matching every path under
+// folder: path >= lo AND path < hi. Unlike LIKE, a range comparison can use
+// an index such as idx_images_path_key.
+func folderRange(folder string) (lo, hi string) {
+	const sep = string(os.PathSeparator)
+	base := strings.TrimSuffix(folder, sep)
+	return base + sep, base + string(os.PathSeparator+1)
+}
 
-	stmt, err := tx.Prepare("UPDATE images SET group_id = ? WHERE path = ?")
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
-	}
-	defer stmt.Close()
+// GetImagesByFolder returns stored images located under folder
+func (s *Storage) GetImagesByFolder(folder string) ([]*models.ImageInfo, error) {
+	lo, hi := folderRange(s.canonicalPath(folder))
+	return s.queryImages("SELECT "+imageColumns+" FROM images WHERE path_key >= ? AND path_key < ? ORDER BY path", lo, hi)
+}
 
-	for _, group := range groups {
-		for _, img := range group.Images {
-			_, err := stmt.Exec(group.ID, img.Path)
-			if err != nil {
-				return fmt.Errorf("failed to update group for %s: %w", img.Path, err)
-			}
-		}
-	}
+// pathColumns lists every stored path column: RemapPaths rewrites them and
+// PurgeByFolder deletes the rows they put under the folder. A keyed column
+// is matched by the canonical path_key stored next to it.
+var pathColumns = []pathColumn{
+	{"images", "path", true},
+	{"ignored_paths", "path", true},
+	{"scan_progress", "folder", false},
+	{"scan_progress", "path", false},
+	{"scan_history", "folder", false},
+}
 
-	return tx.Commit()
+type pathColumn struct {
+	table, column string
+	keyed         bool
 }
 
-// GetImagesByGroupID returns images in a specific group
-func (s *Storage) GetImagesByGroupID(groupID int) ([]*models.ImageInfo, error) {
-	return s.queryImages("SELECT "+imageColumns+" FROM images WHERE group_id = ? ORDER BY score DESC", groupID)
+// RemapPaths rewrites every stored path equal to or under oldPrefix to the
+// same path under newPrefix, in one transaction, so a moved library need not
+// be rescanned. Hashes, group assignments, the ignore list and scan history
+// carry over. An image already stored under the new path is replaced by the
+// remapped one. Returns the number of images remapped; the paths are not
+// checked against the disk.
+func (s *Storage) RemapPaths(oldPrefix, newPrefix string) (int, error) {
+	var n int
+	err := s.retry(func() error {
+		var err error
+		n, err = s.remapPaths(oldPrefix, newPrefix)
+		return err
+	})
+	return n, err
+}
+
+func (s *Storage) remapPaths(oldPrefix, newPrefix string) (int, error) {
+	oldPrefix = strings.TrimSuffix(oldPrefix, string(os.PathSeparator))
+	newPrefix = strings.TrimSuffix(newPrefix, string(os.PathSeparator))
+	lo, hi := folderRange(oldPrefix)
+	// substr counts characters, not bytes; keep everything after oldPrefix
+	rest := utf8.RuneCountInString(oldPrefix) + 1
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var images int64
+	for _, c := range pathColumns {
+		if c.keyed {
+			n, err := s.remapKeyed(tx, c.table, oldPrefix, newPrefix)
+			if err != nil {
+				return 0, fmt.Errorf("failed to remap %s.%s: %w", c.table, c.column, err)
+			}
+			if c.table == "images" {
+				images = n
+			}
+			continue
+		}
+		_, err := tx.Exec(fmt.Sprintf(
+			"UPDATE OR REPLACE %[1]s SET %[2]s = ? || substr(%[2]s, ?) WHERE %[2]s = ? OR (%[2]s >= ? AND %[2]s < ?)",
+			c.table, c.column), newPrefix, rest, oldPrefix, lo, hi)
+		if err != nil {
+			return 0, fmt.Errorf("failed to remap %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	// Links between RAW+JPEG pairs follow the files they point to
+	if err := s.remapSidecars(tx, oldPrefix, newPrefix); err != nil {
+		return 0, fmt.Errorf("failed to remap images.sidecar_of: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(images), nil
+}
+
+// remapKeyed moves the rows of table whose path_key is under oldPrefix to
+// newPrefix, keeping the spelling of the rest of each path, and returns the
+// number of rows moved
+func (s *Storage) remapKeyed(tx *sql.Tx, table, oldPrefix, newPrefix string) (int64, error) {
+	key := s.canonicalPath(oldPrefix)
+	lo, hi := folderRange(key)
+	moved, err := queryPaths(tx, "SELECT rowid, path FROM "+table+" WHERE path_key = ? OR (path_key >= ? AND path_key < ?)", key, lo, hi)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	depth := strings.Count(oldPrefix, string(os.PathSeparator))
+	for _, row := range moved {
+		path := rebase(row.path, depth, newPrefix)
+		res, err := tx.Exec("UPDATE OR REPLACE "+table+" SET path = ?, path_key = ? WHERE rowid = ?", path, s.canonicalPath(path), row.id)
+		if err != nil {
+			return 0, err
+		}
+		// A row replaced by one remapped before it is gone
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+// remapSidecars moves the sidecar_of links pointing under oldPrefix to
+// newPrefix, matching them in canonical form like the images they name
+func (s *Storage) remapSidecars(tx *sql.Tx, oldPrefix, newPrefix string) error {
+	linked, err := queryPaths(tx, "SELECT id, sidecar_of FROM images WHERE sidecar_of != ''")
+	if err != nil {
+		return err
+	}
+	key := s.canonicalPath(oldPrefix)
+	lo, hi := folderRange(key)
+	depth := strings.Count(oldPrefix, string(os.PathSeparator))
+	for _, row := range linked {
+		if k := s.canonicalPath(row.path); k != key && (k < lo || k >= hi) {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE images SET sidecar_of = ? WHERE id = ?", rebase(row.path, depth, newPrefix), row.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowPath is a stored path and the rowid of its row
+type rowPath struct {
+	id   int64
+	path string
+}
+
+// queryPaths runs a query selecting a rowid and a path. The rows are all
+// read before returning, so the caller can update them.
+func queryPaths(tx *sql.Tx, query string, args ...interface{}) ([]rowPath, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []rowPath
+	for rows.Next() {
+		var p rowPath
+		if err := rows.Scan(&p.id, &p.path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// rebase replaces the first depth+1 components of path, the ones matching
+// a prefix with depth separators, with newPrefix. Canonical forms keep the
+// separators of the path, so the components can be counted in either.
+func rebase(path string, depth int, newPrefix string) string {
+	const sep = os.PathSeparator
+	rest := path
+	for ; depth >= 0; depth-- {
+		i := strings.IndexByte(rest, sep)
+		if i < 0 {
+			return newPrefix // path is the prefix itself
+		}
+		if depth == 0 {
+			return newPrefix + rest[i:]
+		}
+		rest = rest[i+1:]
+	}
+	return newPrefix
+}
+
+// PurgeAll deletes every stored image, group, ignored path and scan
+// progress row in one transaction, and with history the scan history too.
+// The schema and the content-keyed hash cache are kept. Returns the number
+// of images deleted.
+func (s *Storage) PurgeAll(history bool) (int, error) {
+	var n int
+	err := s.retry(func() error {
+		var err error
+		n, err = s.purge(func(tx *sql.Tx, c pathColumn) (sql.Result, error) {
+			return tx.Exec("DELETE FROM " + c.table)
+		}, history)
+		return err
+	})
+	return n, err
+}
+
+// PurgeByFolder is like PurgeAll, but only deletes rows for paths equal to
+// or under prefix, and scan history of folders there. Groups left with no
+// images are dropped; the rest keep their members elsewhere.
+func (s *Storage) PurgeByFolder(prefix string, history bool) (int, error) {
+	prefix = strings.TrimSuffix(prefix, string(os.PathSeparator))
+	key := s.canonicalPath(prefix)
+	var n int
+	err := s.retry(func() error {
+		var err error
+		n, err = s.purge(func(tx *sql.Tx, c pathColumn) (sql.Result, error) {
+			column, p := c.column, prefix
+			if c.keyed {
+				column, p = "path_key", key
+			}
+			lo, hi := folderRange(p)
+			return tx.Exec(fmt.Sprintf("DELETE FROM %[1]s WHERE %[2]s = ? OR (%[2]s >= ? AND %[2]s < ?)", c.table, column),
+				p, lo, hi)
+		}, history)
+		return err
+	})
+	return n, err
+}
+
+// purge runs del on every path column (skipping scan history unless
+// history) and then drops groups without images, in one transaction
+func (s *Storage) purge(del func(tx *sql.Tx, c pathColumn) (sql.Result, error), history bool) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var images int64
+	for _, c := range pathColumns {
+		if c.table == "scan_history" && !history {
+			continue
+		}
+		res, err := del(tx, c)
+		if err != nil {
+			return 0, fmt.Errorf("failed to purge %s: %w", c.table, err)
+		}
+		if c.table == "images" {
+			if images, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM duplicate_groups WHERE id NOT IN (SELECT group_id FROM images)"); err != nil {
+		return 0, fmt.Errorf("failed to purge groups: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(images), nil
+}
+
+// UpdateGroups replaces the stored groups: group IDs for images, and each
+// group's match method and distance. A group made of exactly the images of a
+// group marked reviewed keeps the mark; any other group starts unreviewed.
+func (s *Storage) UpdateGroups(groups []*models.DuplicateGroup) error {
+	return s.retry(func() error { return s.updateGroups(groups) })
+}
+
+func (s *Storage) updateGroups(groups []*models.DuplicateGroup) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	marks, err := reviewMarks(tx)
+	if err != nil {
+		return err
+	}
+
+	// Reset all group IDs
+	_, err = tx.Exec("UPDATE images SET group_id = 0")
+	if err != nil {
+		return fmt.Errorf("failed to reset groups: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM duplicate_groups"); err != nil {
+		return fmt.Errorf("failed to reset groups: %w", err)
+	}
+
+	stmt, err := tx.Prepare("UPDATE images SET group_id = ? WHERE path_key = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	groupStmt, err := tx.Prepare("INSERT INTO duplicate_groups (id, match_method, distance, reviewed_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer groupStmt.Close()
+
+	for _, group := range groups {
+		if _, err := groupStmt.Exec(group.ID, group.MatchMethod, group.Distance, marks.carriedOver(group, s.canonicalPath)); err != nil {
+			return fmt.Errorf("failed to save group %d: %w", group.ID, err)
+		}
+		for _, img := range group.Images {
+			_, err := stmt.Exec(group.ID, s.canonicalPath(img.Path))
+			if err != nil {
+				return fmt.Errorf("failed to update group for %s: %w", img.Path, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// reviewedGroups records the members of the groups marked reviewed, so
+// updateGroups can carry the marks over to unchanged groups
+type reviewedGroups struct {
+	groupOf    map[string]int // path key -> ID of its reviewed group
+	size       map[int]int    // ID -> number of images
+	reviewedAt map[int]string // ID -> stored reviewed_at
+}
+
+func reviewMarks(tx *sql.Tx) (*reviewedGroups, error) {
+	rows, err := tx.Query(`SELECT i.path_key, g.id, g.reviewed_at FROM images i
+		JOIN duplicate_groups g ON g.id = i.group_id
+		WHERE i.group_id > 0 AND g.reviewed_at IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reviewed groups: %w", err)
+	}
+	defer rows.Close()
+
+	r := &reviewedGroups{groupOf: make(map[string]int), size: make(map[int]int), reviewedAt: make(map[int]string)}
+	for rows.Next() {
+		var path, at string
+		var id int
+		if err := rows.Scan(&path, &id, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan reviewed group: %w", err)
+		}
+		r.groupOf[path] = id
+		r.size[id]++
+		r.reviewedAt[id] = at
+	}
+	return r, rows.Err()
+}
+
+// carriedOver returns the reviewed_at to store for group: that of the
+// reviewed group with the same images, or NULL. Image paths are looked up
+// as canonical maps them.
+func (r *reviewedGroups) carriedOver(group *models.DuplicateGroup, canonical func(string) string) interface{} {
+	if len(group.Images) == 0 {
+		return nil
+	}
+	id, ok := r.groupOf[canonical(group.Images[0].Path)]
+	if !ok || r.size[id] != len(group.Images) {
+		return nil
+	}
+	for _, img := range group.Images[1:] {
+		if r.groupOf[canonical(img.Path)] != id {
+			return nil
+		}
+	}
+	return r.reviewedAt[id]
+}
+
+// ErrNoGroup is returned for a group ID no image belongs to
+var ErrNoGroup = errors.New("no such group")
+
+// SetGroupReviewed marks the group as reviewed now, or clears the mark if
+// reviewed is false. It fails with ErrNoGroup if no image has that group ID.
+func (s *Storage) SetGroupReviewed(id int, reviewed bool) error {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM images WHERE group_id = ? AND group_id > 0", id).Scan(&count); err != nil {
+		return fmt.Errorf("failed to look up group %d: %w", id, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: #%d", ErrNoGroup, id)
+	}
+
+	var reviewedAt interface{} // NULL clears the mark
+	if reviewed {
+		reviewedAt = time.Now()
+	}
+	// Groups saved before match methods were recorded have no row yet
+	_, err := s.exec(`INSERT INTO duplicate_groups (id, reviewed_at) VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET reviewed_at = excluded.reviewed_at`, id, reviewedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update group %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetImagesByGroupID returns images in a specific group
+func (s *Storage) GetImagesByGroupID(groupID int) ([]*models.ImageInfo, error) {
+	return s.queryImages("SELECT "+imageColumns+" FROM images WHERE group_id = ? ORDER BY score DESC", groupID)
 }
 
 // ImageExists reports whether an image with the given path is registered.
 func (s *Storage) ImageExists(path string) (bool, error) {
 	var one int
-	err := s.db.QueryRow("SELECT 1 FROM images WHERE path = ?", path).Scan(&one)
+	err := s.db.QueryRow("SELECT 1 FROM images WHERE path_key = ?", s.canonicalPath(path)).Scan(&one)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -354,21 +1304,271 @@ func (s *Storage) ImageExists(path string) (bool, error) {
 	return true, nil
 }
 
-// DeleteImage removes an image from the database
+// GetImage returns the image stored under path, or nil if there is none
+func (s *Storage) GetImage(path string) (*models.ImageInfo, error) {
+	images, err := s.queryImages("SELECT "+imageColumns+" FROM images WHERE path_key = ?", s.canonicalPath(path))
+	if err != nil || len(images) == 0 {
+		return nil, err
+	}
+	return images[0], nil
+}
+
+// DeleteImage removes an image from the database, under any spelling of
+// path that has the same canonical form
 func (s *Storage) DeleteImage(path string) error {
-	_, err := s.db.Exec("DELETE FROM images WHERE path = ?", path)
+	_, err := s.exec("DELETE FROM images WHERE path_key = ?", s.canonicalPath(path))
 	return err
 }
 
-// RecordScan records a scan in history
-func (s *Storage) RecordScan(folder string, totalImages, totalGroups, totalDuplicates int) error {
-	_, err := s.db.Exec(`
-		INSERT INTO scan_history (folder, total_images, total_groups, total_duplicates)
-		VALUES (?, ?, ?, ?)
-	`, folder, totalImages, totalGroups, totalDuplicates)
+// DeleteImages removes images from the database in one transaction, each
+// as DeleteImage would, so either all of them or none are removed
+func (s *Storage) DeleteImages(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return s.retry(func() error { return s.deleteImages(paths) })
+}
+
+func (s *Storage) deleteImages(paths []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("DELETE FROM images WHERE path_key = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, path := range paths {
+		if _, err := stmt.Exec(s.canonicalPath(path)); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RecordScan records a scan in history. A regroup covers the whole database
+// and is recorded with an empty folder. The threshold is kept for perceptual
+// scans only; ScannedAt is set by the database.
+func (s *Storage) RecordScan(rec models.ScanRecord) error {
+	var threshold interface{} // NULL unless perceptual
+	if rec.Matcher == models.MatchPerceptual {
+		threshold = rec.Threshold
+	}
+	_, err := s.exec(`
+		INSERT INTO scan_history (folder, matcher, threshold, total_images, total_groups, total_duplicates)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, rec.Folder, rec.Matcher, threshold, rec.TotalImages, rec.TotalGroups, rec.TotalDuplicates)
+	return err
+}
+
+// GetScanHistory returns the last limit entries of scan history, newest
+// first, or all of them if limit <= 0
+func (s *Storage) GetScanHistory(limit int) ([]models.ScanRecord, error) {
+	if limit <= 0 {
+		limit = -1 // no LIMIT in SQLite
+	}
+	rows, err := s.db.Query(`
+		SELECT folder, scanned_at, matcher, threshold, total_images, total_groups, total_duplicates
+		FROM scan_history ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.ScanRecord
+	for rows.Next() {
+		var rec models.ScanRecord
+		var scannedAt, matcher sql.NullString
+		var threshold sql.NullInt64
+		if err := rows.Scan(&rec.Folder, &scannedAt, &matcher, &threshold,
+			&rec.TotalImages, &rec.TotalGroups, &rec.TotalDuplicates); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rec.ScannedAt = parseModTime(scannedAt.String)
+		rec.Matcher = matcher.String
+		rec.Threshold = int(threshold.Int64)
+		history = append(history, rec)
+	}
+	return history, rows.Err()
+}
+
+// GetScannedFolders returns every folder recorded in scan history, sorted.
+func (s *Storage) GetScannedFolders() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT folder FROM scan_history WHERE folder != '' ORDER BY folder")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan history: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []string
+	for rows.Next() {
+		var folder string
+		if err := rows.Scan(&folder); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+// MarkProcessed records paths whose scan results have been saved, so an
+// interrupted scan of folder can resume without re-hashing them.
+func (s *Storage) MarkProcessed(folder string, paths []string) error {
+	return s.retry(func() error { return s.markProcessed(folder, paths) })
+}
+
+func (s *Storage) markProcessed(folder string, paths []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO scan_progress (folder, path) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, path := range paths {
+		if _, err := stmt.Exec(folder, path); err != nil {
+			return fmt.Errorf("failed to mark %s as processed: %w", path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetProcessedPaths returns the paths recorded by MarkProcessed for folder.
+func (s *Storage) GetProcessedPaths(folder string) (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT path FROM scan_progress WHERE folder = ?", folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan progress: %w", err)
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		paths[path] = true
+	}
+	return paths, rows.Err()
+}
+
+// ClearProcessed forgets the scan progress for folder, typically once its
+// scan has completed.
+func (s *Storage) ClearProcessed(folder string) error {
+	_, err := s.exec("DELETE FROM scan_progress WHERE folder = ?", folder)
 	return err
 }
 
+// IgnorePath marks a path so it is never reported as part of a duplicate group.
+func (s *Storage) IgnorePath(path string) error {
+	_, err := s.exec("INSERT OR IGNORE INTO ignored_paths (path, path_key) VALUES (?, ?)", path, s.canonicalPath(path))
+	return err
+}
+
+// UnignorePath removes a path from the ignore list, under whichever
+// spelling it was ignored.
+func (s *Storage) UnignorePath(path string) error {
+	_, err := s.exec("DELETE FROM ignored_paths WHERE path_key = ?", s.canonicalPath(path))
+	return err
+}
+
+// ClearIgnored empties the ignore list.
+func (s *Storage) ClearIgnored() error {
+	_, err := s.exec("DELETE FROM ignored_paths")
+	return err
+}
+
+// GetIgnoredPaths returns all ignored paths, sorted.
+func (s *Storage) GetIgnoredPaths() ([]string, error) {
+	rows, err := s.db.Query("SELECT path FROM ignored_paths ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ignored paths: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// GetCachedHash returns the decode results stored for key, or nil if there
+// are none. Only content-derived fields (hash, dimensions, format, EXIF,
+// BlurHash, orientation hashes, dHash, sharpness, EXIF tag count) are set.
+func (s *Storage) GetCachedHash(key models.ContentKey) (*models.ImageInfo, error) {
+	info := &models.ImageInfo{}
+	var hashInt, dHashInt int64
+	var hasExifInt int
+	var captureTime, blurHash, cameraMake, cameraModel, software, orientations sql.NullString
+	var sharpness sql.NullFloat64
+	var tagCount sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT hash, width, height, format, has_exif, capture_time, blur_hash, camera_make, camera_model, software, orientation_hashes, sharpness, exif_tag_count, d_hash FROM hash_cache
+		WHERE file_size = ? AND mod_time = ? AND sample = ?
+	`, key.Size, key.ModTime.UnixNano(), key.Sample).Scan(
+		&hashInt, &info.Width, &info.Height, &info.Format, &hasExifInt, &captureTime, &blurHash,
+		&cameraMake, &cameraModel, &software, &orientations, &sharpness, &tagCount, &dHashInt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hash cache: %w", err)
+	}
+	info.Hash = uint64(hashInt)
+	info.DHash = uint64(dHashInt)
+	info.HasExif = hasExifInt == 1
+	info.BlurHash = blurHash.String
+	info.CameraMake = cameraMake.String
+	info.CameraModel = cameraModel.String
+	info.Software = software.String
+	info.OrientationHashes = decodeHashes(orientations.String)
+	info.Sharpness = sharpness.Float64
+	info.ExifTagCount = int(tagCount.Int64)
+	if captureTime.Valid {
+		info.CaptureTime = parseModTime(captureTime.String)
+	}
+	return info, nil
+}
+
+// PutCachedHash stores the content-derived fields of info under key.
+// Mod time is stored as Unix nanoseconds so lookups match exactly.
+func (s *Storage) PutCachedHash(key models.ContentKey, info *models.ImageInfo) error {
+	hasExifInt := 0
+	if info.HasExif {
+		hasExifInt = 1
+	}
+	var captureTime interface{} // NULL when unknown
+	if !info.CaptureTime.IsZero() {
+		captureTime = info.CaptureTime
+	}
+	_, err := s.exec(`
+		INSERT OR REPLACE INTO hash_cache (file_size, mod_time, sample, hash, width, height, format, has_exif, capture_time, blur_hash, camera_make, camera_model, software, orientation_hashes, sharpness, exif_tag_count, d_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.Size, key.ModTime.UnixNano(), key.Sample, int64(info.Hash), info.Width, info.Height, info.Format, hasExifInt, captureTime, info.BlurHash,
+		info.CameraMake, info.CameraModel, info.Software, encodeHashes(info.OrientationHashes), info.Sharpness, info.ExifTagCount, int64(info.DHash))
+	if err != nil {
+		return fmt.Errorf("failed to store hash cache entry: %w", err)
+	}
+	return nil
+}
+
 // GetGroupCount returns the number of duplicate groups
 func (s *Storage) GetGroupCount() (int, error) {
 	var count int
@@ -378,8 +1578,142 @@ func (s *Storage) GetGroupCount() (int, error) {
 
 // GetDuplicateGroups returns all duplicate groups with their images.
 // A single query fetches all grouped images to avoid one query per group.
-func (s *Storage) GetDuplicateGroups() ([]*models.DuplicateGroup, error) {
-	images, err := s.queryImages("SELECT " + imageColumns + " FROM images WHERE group_id > 0 ORDER BY group_id, score DESC")
+// Ignored paths are left out; a group that drops below two images is omitted.
+// Keep is chosen by policies, falling back to quality (see SelectKeep).
+func (s *Storage) GetDuplicateGroups(policies ...models.KeepPolicy) ([]*models.DuplicateGroup, error) {
+	return s.duplicateGroups("", nil, policies)
+}
+
+// GetCanonicalImages returns one image per unique image in the library:
+// the kept image of every group GetDuplicateGroups returns, chosen by
+// policies, and every image in none of them (never matched, ignored, or
+// left alone in its group), sorted by path.
+func (s *Storage) GetCanonicalImages(policies ...models.KeepPolicy) ([]*models.ImageInfo, error) {
+	images, err := s.GetAllImages()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.GetDuplicateGroups(policies...)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[string]bool)
+	for _, group := range groups {
+		for _, img := range group.Remove {
+			removed[img.Path] = true
+		}
+	}
+
+	canonical := make([]*models.ImageInfo, 0, len(images)-len(removed))
+	for _, img := range images {
+		if !removed[img.Path] {
+			canonical = append(canonical, img)
+		}
+	}
+	return canonical, nil
+}
+
+// GetDuplicateGroupsByFolder is like GetDuplicateGroups but only returns
+// groups with at least one image under folder. Those groups are returned
+// whole, including members elsewhere.
+func (s *Storage) GetDuplicateGroupsByFolder(folder string, policies ...models.KeepPolicy) ([]*models.DuplicateGroup, error) {
+	lo, hi := folderRange(s.canonicalPath(folder))
+	return s.duplicateGroups(
+		`AND group_id IN (SELECT group_id FROM images WHERE group_id > 0 AND path_key >= ? AND path_key < ?
+			AND path_key NOT IN (SELECT path_key FROM ignored_paths))`,
+		[]interface{}{lo, hi}, policies)
+}
+
+// GetDuplicateGroupsByMethod is like GetDuplicateGroups but only returns
+// groups found by method (models.MatchExact or models.MatchPerceptual).
+// Groups saved before the method was recorded match neither.
+func (s *Storage) GetDuplicateGroupsByMethod(method string, policies ...models.KeepPolicy) ([]*models.DuplicateGroup, error) {
+	return s.duplicateGroups(
+		"AND group_id IN (SELECT id FROM duplicate_groups WHERE match_method = ?)",
+		[]interface{}{method}, policies)
+}
+
+// visibleGroupIDs selects the IDs of the groups GetDuplicateGroups returns:
+// at least two images left once ignored paths are excluded
+const visibleGroupIDs = `SELECT group_id FROM images
+	WHERE group_id > 0 AND path_key NOT IN (SELECT path_key FROM ignored_paths)
+	GROUP BY group_id HAVING COUNT(*) >= 2`
+
+// GetDuplicateGroupsPage returns the groups GetDuplicateGroups would, in ID
+// order, skipping the first offset and returning at most limit (all if
+// limit <= 0). Only the images of those groups are loaded.
+func (s *Storage) GetDuplicateGroupsPage(limit, offset int, policies ...models.KeepPolicy) ([]*models.DuplicateGroup, error) {
+	if limit <= 0 {
+		limit = -1 // no limit in SQLite
+	}
+	return s.duplicateGroups(
+		"AND group_id IN ("+visibleGroupIDs+" ORDER BY group_id LIMIT ? OFFSET ?)",
+		[]interface{}{limit, max(offset, 0)}, policies)
+}
+
+// CountDuplicateGroups returns the number of groups GetDuplicateGroups
+// would return and the number of duplicates in them (images beyond the one
+// kept in each), without loading them
+func (s *Storage) CountDuplicateGroups() (groups, duplicates int, err error) {
+	var images int
+	err = s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(n), 0) FROM (
+		SELECT COUNT(*) AS n FROM images
+		WHERE group_id > 0 AND path_key NOT IN (SELECT path_key FROM ignored_paths)
+		GROUP BY group_id HAVING n >= 2)`).Scan(&groups, &images)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count groups: %w", err)
+	}
+	return groups, images - groups, nil
+}
+
+// SumReclaimableBytes returns the total Reclaimable of the groups
+// GetDuplicateGroups would return with no keep policies, without loading
+// them. Its quality order decides which image is kept only by score, then
+// file size; the remaining tie-breakers pick between images of equal size,
+// so they don't change the sum.
+func (s *Storage) SumReclaimableBytes() (int64, error) {
+	var total int64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(file_size), 0) FROM (
+		SELECT file_size, ROW_NUMBER() OVER (PARTITION BY group_id ORDER BY score DESC, file_size DESC) AS rank
+		FROM images
+		WHERE group_id > 0 AND path_key NOT IN (SELECT path_key FROM ignored_paths))
+		WHERE rank > 1`).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum reclaimable bytes: %w", err)
+	}
+	return total, nil
+}
+
+// groupInfo returns the stored match method, distance and review mark of
+// every group, keyed by ID. Groups saved before these were recorded have no
+// entry.
+func (s *Storage) groupInfo() (map[int]models.DuplicateGroup, error) {
+	rows, err := s.db.Query("SELECT id, match_method, distance, reviewed_at FROM duplicate_groups")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	defer rows.Close()
+
+	info := make(map[int]models.DuplicateGroup)
+	for rows.Next() {
+		var g models.DuplicateGroup
+		var reviewedAt sql.NullString
+		if err := rows.Scan(&g.ID, &g.MatchMethod, &g.Distance, &reviewedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		if reviewedAt.Valid {
+			g.ReviewedAt = parseModTime(reviewedAt.String)
+		}
+		info[g.ID] = g
+	}
+	return info, rows.Err()
+}
+
+// duplicateGroups loads groups of images matching the extra WHERE clause.
+func (s *Storage) duplicateGroups(where string, args []interface{}, policies []models.KeepPolicy) ([]*models.DuplicateGroup, error) {
+	images, err := s.queryImages("SELECT "+imageColumns+` FROM images
+		WHERE group_id > 0 AND path_key NOT IN (SELECT path_key FROM ignored_paths) `+where+`
+		ORDER BY group_id, score DESC`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -394,14 +1728,21 @@ func (s *Storage) GetDuplicateGroups() ([]*models.DuplicateGroup, error) {
 		current.Images = append(current.Images, img)
 	}
 
-	// Keep only real duplicate groups and derive Keep/Remove (sorted by score DESC)
+	info, err := s.groupInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only real duplicate groups and derive Keep/Remove
 	var result []*models.DuplicateGroup
 	for _, g := range groups {
 		if len(g.Images) < 2 {
 			continue
 		}
-		g.Keep = g.Images[0]
-		g.Remove = g.Images[1:]
+		if gi, ok := info[g.ID]; ok {
+			g.MatchMethod, g.Distance, g.ReviewedAt = gi.MatchMethod, gi.Distance, gi.ReviewedAt
+		}
+		g.SelectKeep(policies...)
 		result = append(result, g)
 	}
 
@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"imagedupfinder/internal/fileutil"
 	"imagedupfinder/internal/models"
 )
 
@@ -200,6 +208,177 @@ func TestUpdateGroups(t *testing.T) {
 	}
 }
 
+func TestUpdateGroups_StoresMatchMethod(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	var images []*models.ImageInfo
+	for _, p := range []string{"/a.jpg", "/b.jpg", "/c.jpg", "/d.jpg"} {
+		images = append(images, &models.ImageInfo{Path: p, Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000})
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	groups := []*models.DuplicateGroup{
+		{ID: 1, Images: images[:2], MatchMethod: models.MatchExact},
+		{ID: 2, Images: images[2:], MatchMethod: models.MatchPerceptual, Distance: 7},
+	}
+	if err := store.UpdateGroups(groups); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+
+	got, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(got))
+	}
+	if got[0].MatchMethod != models.MatchExact || got[0].Distance != 0 {
+		t.Errorf("group 1: got %q %d, want exact 0", got[0].MatchMethod, got[0].Distance)
+	}
+	if got[1].MatchMethod != models.MatchPerceptual || got[1].Distance != 7 {
+		t.Errorf("group 2: got %q %d, want perceptual 7", got[1].MatchMethod, got[1].Distance)
+	}
+
+	// A rescan replaces the groups, including their match info
+	if err := store.UpdateGroups(groups[1:]); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+	got, err = store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != 2 || got[0].Distance != 7 {
+		t.Errorf("after replacing groups got %+v", got)
+	}
+}
+
+func TestSetGroupReviewed(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	var images []*models.ImageInfo
+	for _, p := range []string{"/a.jpg", "/b.jpg", "/c.jpg", "/d.jpg", "/e.jpg"} {
+		images = append(images, &models.ImageInfo{Path: p, Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000})
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	groups := []*models.DuplicateGroup{
+		{ID: 1, Images: images[0:2], MatchMethod: models.MatchExact},
+		{ID: 2, Images: images[2:4], MatchMethod: models.MatchPerceptual, Distance: 3},
+	}
+	if err := store.UpdateGroups(groups); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+
+	reviewed := func() []int {
+		t.Helper()
+		got, err := store.GetDuplicateGroups()
+		if err != nil {
+			t.Fatalf("GetDuplicateGroups failed: %v", err)
+		}
+		var ids []int
+		for _, g := range got {
+			if g.Reviewed() {
+				ids = append(ids, g.ID)
+			}
+		}
+		return ids
+	}
+
+	if err := store.SetGroupReviewed(2, true); err != nil {
+		t.Fatalf("SetGroupReviewed failed: %v", err)
+	}
+	if ids := reviewed(); !slices.Equal(ids, []int{2}) {
+		t.Errorf("reviewed groups = %v, want [2]", ids)
+	}
+	got, _ := store.GetDuplicateGroups()
+	if unreviewed := models.FilterUnreviewed(got); len(unreviewed) != 1 || unreviewed[0].ID != 1 {
+		t.Errorf("FilterUnreviewed kept %d groups, want group 1 only", len(unreviewed))
+	}
+	if got[1].MatchMethod != models.MatchPerceptual || got[1].Distance != 3 {
+		t.Errorf("marking reviewed changed match info to %q %d", got[1].MatchMethod, got[1].Distance)
+	}
+
+	if err := store.SetGroupReviewed(2, false); err != nil {
+		t.Fatalf("SetGroupReviewed(false) failed: %v", err)
+	}
+	if ids := reviewed(); len(ids) != 0 {
+		t.Errorf("reviewed groups after clearing = %v, want none", ids)
+	}
+
+	if err := store.SetGroupReviewed(9, true); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("SetGroupReviewed on a missing group = %v, want ErrNoGroup", err)
+	}
+}
+
+func TestUpdateGroups_KeepsReviewedMarkOfUnchangedGroups(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	var images []*models.ImageInfo
+	for _, p := range []string{"/a.jpg", "/b.jpg", "/c.jpg", "/d.jpg", "/e.jpg"} {
+		images = append(images, &models.ImageInfo{Path: p, Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000})
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.UpdateGroups([]*models.DuplicateGroup{
+		{ID: 1, Images: images[0:2]},
+		{ID: 2, Images: images[2:4]},
+	}); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		if err := store.SetGroupReviewed(id, true); err != nil {
+			t.Fatalf("SetGroupReviewed failed: %v", err)
+		}
+	}
+
+	// A full rescan saves the images again without groups, then renumbers
+	// a and b's group and adds e to c and d's
+	var rehashed []*models.ImageInfo
+	for _, img := range images {
+		copy := *img
+		copy.GroupID = 0
+		rehashed = append(rehashed, &copy)
+	}
+	if err := store.SaveImages(rehashed); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.UpdateGroups([]*models.DuplicateGroup{
+		{ID: 1, Images: rehashed[2:5]},
+		{ID: 2, Images: rehashed[0:2]},
+	}); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+	got, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(got))
+	}
+	if got[0].Reviewed() {
+		t.Error("a group that gained an image should need reviewing again")
+	}
+	if !got[1].Reviewed() {
+		t.Error("an unchanged group should stay reviewed under its new ID")
+	}
+}
+
 func TestGetDuplicateGroups(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -280,6 +459,38 @@ func TestDeleteImage(t *testing.T) {
 	}
 }
 
+func TestDeleteImages(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	var images []*models.ImageInfo
+	for _, path := range []string{"/img1.jpg", "/img2.jpg", "/img3.jpg"} {
+		images = append(images, &models.ImageInfo{Path: path, Hash: 1, Format: "jpeg", FileSize: 1000, ModTime: time.Now()})
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	// An unknown path deletes nothing and fails nothing
+	if err := store.DeleteImages([]string{"/img1.jpg", "/img3.jpg", "/missing.jpg"}); err != nil {
+		t.Fatalf("DeleteImages failed: %v", err)
+	}
+	if err := store.DeleteImages(nil); err != nil {
+		t.Fatalf("DeleteImages(nil) failed: %v", err)
+	}
+
+	remaining, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].Path != "/img2.jpg" {
+		t.Errorf("remaining = %d images, want only /img2.jpg", len(remaining))
+	}
+}
+
 func TestRecordScan(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -290,7 +501,7 @@ func TestRecordScan(t *testing.T) {
 	}
 	defer store.Close()
 
-	err = store.RecordScan("/path/to/folder", 100, 10, 25)
+	err = store.RecordScan(models.ScanRecord{Folder: "/path/to/folder", TotalImages: 100, TotalGroups: 10, TotalDuplicates: 25})
 	if err != nil {
 		t.Fatalf("RecordScan failed: %v", err)
 	}
@@ -311,6 +522,74 @@ func TestRecordScan(t *testing.T) {
 	}
 }
 
+func TestGetScanHistory(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	records := []models.ScanRecord{
+		{Folder: "/photos", Matcher: models.MatchPerceptual, Threshold: 6, TotalImages: 100, TotalGroups: 10, TotalDuplicates: 25},
+		{Folder: "/photos", Matcher: models.MatchExact, Threshold: 10, TotalImages: 100, TotalGroups: 4, TotalDuplicates: 5},
+		{Matcher: models.MatchPerceptual, Threshold: 0, TotalImages: 100, TotalGroups: 30, TotalDuplicates: 40},
+	}
+	for _, rec := range records {
+		if err := store.RecordScan(rec); err != nil {
+			t.Fatalf("RecordScan failed: %v", err)
+		}
+	}
+
+	history, err := store.GetScanHistory(0)
+	if err != nil {
+		t.Fatalf("GetScanHistory failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d entries, want 3", len(history))
+	}
+	// Newest first; an exact scan keeps no threshold
+	want := []models.ScanRecord{records[2], records[1], records[0]}
+	want[1].Threshold = 0
+	for i, got := range history {
+		if got.ScannedAt.IsZero() {
+			t.Errorf("entry %d has no scan time", i)
+		}
+		got.ScannedAt = time.Time{}
+		if got != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if history, err := store.GetScanHistory(1); err != nil || len(history) != 1 || history[0].TotalGroups != 30 {
+		t.Errorf("GetScanHistory(1) = %+v, %v; want the regroup only", history, err)
+	}
+}
+
+func TestGetScannedFolders(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	for _, folder := range []string{"/photos", "/archive", "/photos"} {
+		if err := store.RecordScan(models.ScanRecord{Folder: folder, TotalImages: 1}); err != nil {
+			t.Fatalf("RecordScan failed: %v", err)
+		}
+	}
+
+	folders, err := store.GetScannedFolders()
+	if err != nil {
+		t.Fatalf("GetScannedFolders failed: %v", err)
+	}
+	if len(folders) != 2 || folders[0] != "/archive" || folders[1] != "/photos" {
+		t.Errorf("folders = %v, want [/archive /photos]", folders)
+	}
+}
+
 func TestGetGroupCount(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -383,6 +662,14 @@ func TestImageExists(t *testing.T) {
 	if exists {
 		t.Error("expected unknown path to not exist")
 	}
+
+	img, err := store.GetImage("/img1.jpg")
+	if err != nil || img == nil || img.Format != "jpeg" {
+		t.Errorf("GetImage(/img1.jpg) = %+v, %v; want the jpeg", img, err)
+	}
+	if img, err := store.GetImage("/etc/passwd"); err != nil || img != nil {
+		t.Errorf("GetImage(unknown) = %+v, %v; want nil", img, err)
+	}
 }
 
 func TestMigrations(t *testing.T) {
@@ -420,6 +707,106 @@ func TestMigrations(t *testing.T) {
 	}
 }
 
+// injectBrokenMigration adds a migration after the last one whose first
+// statement succeeds and second fails, so it is half applied unless undone
+func injectBrokenMigration(t *testing.T) {
+	t.Helper()
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	broken := migrations[len(migrations)-1]
+	broken.version = schemaVersion + 1
+	broken.description = "Broken migration"
+	broken.addsColumn = ""
+	broken.up = `
+		ALTER TABLE images ADD COLUMN half_done TEXT DEFAULT '';
+		ALTER TABLE no_such_table ADD COLUMN x TEXT;
+	`
+	migrations = append(migrations[:len(migrations):len(migrations)], broken)
+}
+
+func TestMigrations_RestoresBackupOnFailure(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	if err := store.SaveImages([]*models.ImageInfo{{Path: "/a.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now()}}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	store.Close()
+
+	saved := migrations
+	injectBrokenMigration(t)
+	if _, err := NewStorage(dbPath); err == nil {
+		t.Fatal("NewStorage should fail when a migration fails")
+	}
+	backup := fmt.Sprintf("%s.bak-v%d", dbPath, schemaVersion)
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("backup %s should have been moved back over the database", backup)
+	}
+
+	migrations = saved
+	store, err = NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("reopening the restored database failed: %v", err)
+	}
+	defer store.Close()
+	if store.columnExists("images", "half_done") {
+		t.Error("the failed migration's first statement was not undone")
+	}
+	if v := store.getSchemaVersion(); v != schemaVersion {
+		t.Errorf("schema version = %d, want %d", v, schemaVersion)
+	}
+	if exists, err := store.ImageExists("/a.jpg"); err != nil || !exists {
+		t.Errorf("image lost in restore: exists=%v, err=%v", exists, err)
+	}
+}
+
+func TestMigrations_BackupKeptOnSuccess(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	store.Close()
+
+	// A fresh database has nothing to back up
+	if matches, _ := filepath.Glob(dbPath + ".bak-*"); len(matches) != 0 {
+		t.Errorf("new database was backed up: %v", matches)
+	}
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	next := migrations[len(migrations)-1]
+	next.version = schemaVersion + 1
+	next.addsColumn = "images.extra"
+	next.up = `ALTER TABLE images ADD COLUMN extra TEXT DEFAULT '';`
+	migrations = append(migrations[:len(migrations):len(migrations)], next)
+
+	store, err = NewStorage(dbPath, WithMigrationBackup(false))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	store.Close()
+	if matches, _ := filepath.Glob(dbPath + ".bak-*"); len(matches) != 0 {
+		t.Errorf("backup written despite WithMigrationBackup(false): %v", matches)
+	}
+
+	next.version++
+	next.addsColumn = "images.extra2"
+	next.up = `ALTER TABLE images ADD COLUMN extra2 TEXT DEFAULT '';`
+	migrations = append(migrations, next)
+	store, err = NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	store.Close()
+	backup := fmt.Sprintf("%s.bak-v%d", dbPath, schemaVersion+1)
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("expected backup %s: %v", backup, err)
+	}
+}
+
 func TestSaveImages_ModTimeRoundTrip(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -462,3 +849,1129 @@ func TestSaveImages_ModTimeRoundTrip(t *testing.T) {
 		t.Errorf("ModTime = %v, want %v", retrieved[0].ModTime, modTime)
 	}
 }
+
+func TestScanProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.MarkProcessed("/photos", []string{"/photos/a.jpg", "/photos/b.jpg"}); err != nil {
+		t.Fatalf("MarkProcessed failed: %v", err)
+	}
+	// Marking again is harmless
+	if err := store.MarkProcessed("/photos", []string{"/photos/a.jpg"}); err != nil {
+		t.Fatalf("second MarkProcessed failed: %v", err)
+	}
+	if err := store.MarkProcessed("/other", []string{"/other/c.jpg"}); err != nil {
+		t.Fatalf("MarkProcessed failed: %v", err)
+	}
+
+	processed, err := store.GetProcessedPaths("/photos")
+	if err != nil {
+		t.Fatalf("GetProcessedPaths failed: %v", err)
+	}
+	if len(processed) != 2 || !processed["/photos/a.jpg"] || !processed["/photos/b.jpg"] {
+		t.Errorf("processed = %v, want a.jpg and b.jpg", processed)
+	}
+
+	if err := store.ClearProcessed("/photos"); err != nil {
+		t.Fatalf("ClearProcessed failed: %v", err)
+	}
+	processed, err = store.GetProcessedPaths("/photos")
+	if err != nil {
+		t.Fatalf("GetProcessedPaths failed: %v", err)
+	}
+	if len(processed) != 0 {
+		t.Errorf("expected no processed paths after clear, got %d", len(processed))
+	}
+
+	// Other folders are unaffected
+	processed, err = store.GetProcessedPaths("/other")
+	if err != nil {
+		t.Fatalf("GetProcessedPaths failed: %v", err)
+	}
+	if len(processed) != 1 {
+		t.Errorf("expected 1 processed path for /other, got %d", len(processed))
+	}
+}
+
+func TestGetDuplicateGroups_ExcludesIgnored(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	images := []*models.ImageInfo{
+		{Path: "/logo1.png", Hash: 1, Width: 100, Height: 100, Format: "png", FileSize: 1000, ModTime: time.Now(), Score: 12000, GroupID: 1},
+		{Path: "/logo2.png", Hash: 1, Width: 100, Height: 100, Format: "png", FileSize: 1000, ModTime: time.Now(), Score: 11000, GroupID: 1},
+		{Path: "/logo3.png", Hash: 1, Width: 100, Height: 100, Format: "png", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 1},
+		{Path: "/pair1.jpg", Hash: 2, Width: 200, Height: 200, Format: "jpeg", FileSize: 2000, ModTime: time.Now(), Score: 40000, GroupID: 2},
+		{Path: "/pair2.jpg", Hash: 2, Width: 200, Height: 200, Format: "jpeg", FileSize: 2000, ModTime: time.Now(), Score: 30000, GroupID: 2},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	// Ignoring the best image drops it and re-derives Keep from the rest
+	if err := store.IgnorePath("/logo1.png"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+	// Ignoring one of a pair collapses the group
+	if err := store.IgnorePath("/pair1.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+	// Ignoring twice is harmless
+	if err := store.IgnorePath("/pair1.jpg"); err != nil {
+		t.Fatalf("second IgnorePath failed: %v", err)
+	}
+
+	groups, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if groups[0].ID != 1 || len(groups[0].Images) != 2 {
+		t.Errorf("group = #%d with %d images, want #1 with 2", groups[0].ID, len(groups[0].Images))
+	}
+	if groups[0].Keep.Path != "/logo2.png" {
+		t.Errorf("Keep = %s, want /logo2.png", groups[0].Keep.Path)
+	}
+
+	ignored, err := store.GetIgnoredPaths()
+	if err != nil {
+		t.Fatalf("GetIgnoredPaths failed: %v", err)
+	}
+	if len(ignored) != 2 || ignored[0] != "/logo1.png" || ignored[1] != "/pair1.jpg" {
+		t.Errorf("ignored = %v, want [/logo1.png /pair1.jpg]", ignored)
+	}
+
+	// Un-ignoring restores the group
+	if err := store.UnignorePath("/pair1.jpg"); err != nil {
+		t.Fatalf("UnignorePath failed: %v", err)
+	}
+	groups, err = store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Errorf("expected 2 groups after unignore, got %d", len(groups))
+	}
+
+	if err := store.ClearIgnored(); err != nil {
+		t.Fatalf("ClearIgnored failed: %v", err)
+	}
+	ignored, err = store.GetIgnoredPaths()
+	if err != nil {
+		t.Fatalf("GetIgnoredPaths failed: %v", err)
+	}
+	if len(ignored) != 0 {
+		t.Errorf("expected empty ignore list after clear, got %v", ignored)
+	}
+}
+
+func TestCaptureTime_RoundTripAndKeepPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	captured := time.Date(2018, 3, 4, 5, 6, 7, 0, time.Local)
+	images := []*models.ImageInfo{
+		{Path: "/best.jpg", Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 20000, GroupID: 1},
+		{Path: "/oldest.jpg", Hash: 1, Width: 50, Height: 50, Format: "jpeg", FileSize: 500, ModTime: time.Now(), Score: 2500, GroupID: 1, CaptureTime: captured},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	all, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	if !all[0].CaptureTime.IsZero() {
+		t.Errorf("/best.jpg CaptureTime = %v, want zero", all[0].CaptureTime)
+	}
+	if !all[1].CaptureTime.Equal(captured) {
+		t.Errorf("/oldest.jpg CaptureTime = %v, want %v", all[1].CaptureTime, captured)
+	}
+
+	groups, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if groups[0].Keep.Path != "/best.jpg" {
+		t.Errorf("default Keep = %s, want /best.jpg", groups[0].Keep.Path)
+	}
+
+	groups, err = store.GetDuplicateGroups(models.KeepOldestCapture)
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if groups[0].Keep.Path != "/oldest.jpg" {
+		t.Errorf("Keep with KeepOldestCapture = %s, want /oldest.jpg", groups[0].Keep.Path)
+	}
+}
+
+func TestFolderQueries(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	sep := string(filepath.Separator)
+	vacation := sep + filepath.Join("photos", "vacation2023")
+	work := sep + filepath.Join("photos", "work")
+	images := []*models.ImageInfo{
+		// Group 1: entirely under vacation2023
+		{Path: filepath.Join(vacation, "a.jpg"), Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 1},
+		{Path: filepath.Join(vacation, "b.jpg"), Hash: 1, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 1},
+		// Group 2: spans both roots
+		{Path: filepath.Join(vacation, "c.jpg"), Hash: 2, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 2},
+		{Path: filepath.Join(work, "c.jpg"), Hash: 2, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 2},
+		// Group 3: only under work
+		{Path: filepath.Join(work, "d.jpg"), Hash: 3, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 3},
+		{Path: filepath.Join(work, "e.jpg"), Hash: 3, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 3},
+		// Sibling whose name shares the prefix must not match
+		{Path: vacation + "-extra" + sep + "f.jpg", Hash: 4, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 4},
+		{Path: filepath.Join(work, "f.jpg"), Hash: 4, Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 4},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	inFolder, err := store.GetImagesByFolder(vacation)
+	if err != nil {
+		t.Fatalf("GetImagesByFolder failed: %v", err)
+	}
+	if len(inFolder) != 3 {
+		t.Errorf("GetImagesByFolder returned %d images, want 3", len(inFolder))
+	}
+
+	// A trailing separator makes no difference
+	inFolder, err = store.GetImagesByFolder(vacation + sep)
+	if err != nil {
+		t.Fatalf("GetImagesByFolder failed: %v", err)
+	}
+	if len(inFolder) != 3 {
+		t.Errorf("GetImagesByFolder with trailing separator returned %d images, want 3", len(inFolder))
+	}
+
+	groups, err := store.GetDuplicateGroupsByFolder(vacation)
+	if err != nil {
+		t.Fatalf("GetDuplicateGroupsByFolder failed: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ID != 1 || groups[1].ID != 2 {
+		t.Fatalf("expected groups 1 and 2, got %d groups", len(groups))
+	}
+	// Groups are returned whole, including members outside the folder
+	if len(groups[1].Images) != 2 || groups[1].Keep.Path != filepath.Join(work, "c.jpg") {
+		t.Errorf("group 2 should include the work copy as Keep, got %s", groups[1].Keep.Path)
+	}
+
+	groups, err = store.GetDuplicateGroupsByFolder(work)
+	if err != nil {
+		t.Fatalf("GetDuplicateGroupsByFolder failed: %v", err)
+	}
+	if len(groups) != 3 {
+		t.Errorf("expected 3 groups under work, got %d", len(groups))
+	}
+}
+
+// getDuplicateGroupsPerGroup is the former GetDuplicateGroups: one query for
+// the group IDs, then one query per group. Kept as the reference for the
+// single-query version.
+func getDuplicateGroupsPerGroup(s *Storage) ([]*models.DuplicateGroup, error) {
+	rows, err := s.db.Query("SELECT DISTINCT group_id FROM images WHERE group_id > 0 ORDER BY group_id")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var groups []*models.DuplicateGroup
+	for _, id := range ids {
+		images, err := s.GetImagesByGroupID(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(images) < 2 {
+			continue
+		}
+		groups = append(groups, &models.DuplicateGroup{
+			ID:     id,
+			Images: images,
+			Keep:   images[0],
+			Remove: images[1:],
+		})
+	}
+	return groups, nil
+}
+
+// saveGroupedImages stores numGroups groups of perGroup images with distinct
+// scores, plus one ungrouped image per group.
+func saveGroupedImages(tb testing.TB, store *Storage, numGroups, perGroup int) {
+	tb.Helper()
+	now := time.Now()
+	var images []*models.ImageInfo
+	for g := 1; g <= numGroups; g++ {
+		for i := 0; i < perGroup; i++ {
+			images = append(images, &models.ImageInfo{
+				Path: fmt.Sprintf("/photos/%04d/%d.jpg", g, i), Hash: uint64(g),
+				Width: 100, Height: 100, Format: "jpeg", FileSize: 1000,
+				ModTime: now, Score: float64(10000 - i*100), GroupID: g,
+			})
+		}
+		images = append(images, &models.ImageInfo{
+			Path: fmt.Sprintf("/photos/%04d/single.jpg", g), Hash: uint64(g) << 32,
+			Width: 100, Height: 100, Format: "jpeg", FileSize: 1000, ModTime: now,
+		})
+	}
+	if err := store.SaveImages(images); err != nil {
+		tb.Fatalf("SaveImages failed: %v", err)
+	}
+}
+
+func TestAggregates_MatchLoadedGroups(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	// Few distinct scores and sizes, so keep ties on score are common
+	r := rand.New(rand.NewSource(1))
+	var images []*models.ImageInfo
+	for g := 1; g <= 40; g++ {
+		for i := 0; i < 1+r.Intn(4); i++ {
+			images = append(images, &models.ImageInfo{
+				Path: fmt.Sprintf("/photos/%02d/%d.jpg", g, i), Hash: uint64(g), Format: "jpeg",
+				FileSize: int64(1000 * (1 + r.Intn(3))), Score: float64(r.Intn(2)),
+				ModTime: time.Unix(int64(r.Intn(1000)), 0), GroupID: g,
+			})
+		}
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	// Ignoring an image can leave its group with one member
+	for _, path := range []string{"/photos/01/0.jpg", "/photos/02/1.jpg", "/photos/03/0.jpg"} {
+		if err := store.IgnorePath(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	wantDuplicates := 0
+	var wantReclaimable int64
+	for _, g := range all {
+		wantDuplicates += len(g.Remove)
+		wantReclaimable += g.Reclaimable()
+	}
+
+	groups, duplicates, err := store.CountDuplicateGroups()
+	if err != nil || groups != len(all) || duplicates != wantDuplicates {
+		t.Errorf("CountDuplicateGroups = %d, %d, %v; want %d, %d", groups, duplicates, err, len(all), wantDuplicates)
+	}
+	if got, err := store.SumReclaimableBytes(); err != nil || got != wantReclaimable {
+		t.Errorf("SumReclaimableBytes = %d, %v; want %d", got, err, wantReclaimable)
+	}
+
+	for _, tt := range []struct{ limit, offset int }{{10, 0}, {10, 10}, {7, 25}, {10, len(all) - 3}, {0, 5}, {10, len(all) + 5}} {
+		page, err := store.GetDuplicateGroupsPage(tt.limit, tt.offset)
+		if err != nil {
+			t.Fatalf("GetDuplicateGroupsPage(%d, %d) failed: %v", tt.limit, tt.offset, err)
+		}
+		want := all[min(tt.offset, len(all)):]
+		if tt.limit > 0 && tt.limit < len(want) {
+			want = want[:tt.limit]
+		}
+		if len(page) != len(want) {
+			t.Errorf("page(%d, %d) has %d groups, want %d", tt.limit, tt.offset, len(page), len(want))
+			continue
+		}
+		for i := range want {
+			if page[i].ID != want[i].ID || len(page[i].Images) != len(want[i].Images) || page[i].Keep.Path != want[i].Keep.Path {
+				t.Errorf("page(%d, %d)[%d] = group %d, want %d", tt.limit, tt.offset, i, page[i].ID, want[i].ID)
+			}
+		}
+	}
+}
+
+func TestGetDuplicateGroups_MatchesPerGroupQueries(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	saveGroupedImages(t, store, 50, 3)
+	// A group left with one member must be dropped by both
+	if err := store.SaveImages([]*models.ImageInfo{{Path: "/lonely.jpg", Hash: 9, Format: "jpeg", ModTime: time.Now(), GroupID: 999}}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	want, err := getDuplicateGroupsPerGroup(store)
+	if err != nil {
+		t.Fatalf("per-group query failed: %v", err)
+	}
+	got, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d groups, got %d", len(want), len(got))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if g.ID != w.ID {
+			t.Fatalf("group %d: expected ID %d, got %d", i, w.ID, g.ID)
+		}
+		if g.Keep.Path != w.Keep.Path {
+			t.Errorf("group %d: expected keep %s, got %s", w.ID, w.Keep.Path, g.Keep.Path)
+		}
+		if len(g.Remove) != len(w.Remove) {
+			t.Fatalf("group %d: expected %d to remove, got %d", w.ID, len(w.Remove), len(g.Remove))
+		}
+		for j := range w.Remove {
+			if g.Remove[j].Path != w.Remove[j].Path {
+				t.Errorf("group %d: remove[%d] expected %s, got %s", w.ID, j, w.Remove[j].Path, g.Remove[j].Path)
+			}
+		}
+	}
+}
+
+func benchmarkStore(b *testing.B) *Storage {
+	b.Helper()
+	store, err := NewStorage(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("NewStorage failed: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	saveGroupedImages(b, store, 3000, 3)
+	return store
+}
+
+func BenchmarkGetDuplicateGroups(b *testing.B) {
+	store := benchmarkStore(b)
+	for b.Loop() {
+		if _, err := store.GetDuplicateGroups(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDuplicateGroups_PerGroup(b *testing.B) {
+	store := benchmarkStore(b)
+	for b.Loop() {
+		if _, err := getDuplicateGroupsPerGroup(store); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHashCache_RoundTrip(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	key := models.ContentKey{Size: 1234, ModTime: time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.Local), Sample: "abcd"}
+	if got, err := store.GetCachedHash(key); err != nil || got != nil {
+		t.Fatalf("expected a miss on an empty cache, got %v, %v", got, err)
+	}
+
+	captured := time.Date(2019, 6, 1, 8, 30, 0, 0, time.UTC)
+	want := &models.ImageInfo{Hash: 0xFFFFFFFFFFFFFFFF, Width: 640, Height: 480, Format: "jpeg", HasExif: true, CaptureTime: captured}
+	if err := store.PutCachedHash(key, want); err != nil {
+		t.Fatalf("PutCachedHash failed: %v", err)
+	}
+
+	// The same instant in another zone is the same key
+	utcKey := key
+	utcKey.ModTime = key.ModTime.UTC()
+	got, err := store.GetCachedHash(utcKey)
+	if err != nil || got == nil {
+		t.Fatalf("expected a hit, got %v, %v", got, err)
+	}
+	if got.Hash != want.Hash || got.Width != want.Width || got.Height != want.Height ||
+		got.Format != want.Format || !got.HasExif || !got.CaptureTime.Equal(captured) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, miss := range []models.ContentKey{
+		{Size: 1235, ModTime: key.ModTime, Sample: key.Sample},
+		{Size: key.Size, ModTime: key.ModTime.Add(time.Nanosecond), Sample: key.Sample},
+		{Size: key.Size, ModTime: key.ModTime, Sample: "abce"},
+	} {
+		if got, err := store.GetCachedHash(miss); err != nil || got != nil {
+			t.Errorf("key %+v: expected a miss, got %v, %v", miss, got, err)
+		}
+	}
+}
+
+func TestRemapPaths(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	images := []*models.ImageInfo{
+		{Path: "/mnt/old/a.jpg", Hash: 1, Format: "jpeg", ModTime: now, GroupID: 1},
+		{Path: "/mnt/old/sub/b.jpg", Hash: 1, Format: "jpeg", ModTime: now, GroupID: 1},
+		{Path: "/mnt/old/日本/c.jpg", Hash: 2, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/older/d.jpg", Hash: 3, Format: "jpeg", ModTime: now}, // shares the prefix, not the folder
+		{Path: "/mnt/new/a.jpg", Hash: 9, Format: "jpeg", ModTime: now},   // stale entry at a target path
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if err := store.IgnorePath("/mnt/old/日本/c.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+	if err := store.RecordScan(models.ScanRecord{Folder: "/mnt/old", TotalImages: 3, TotalGroups: 1, TotalDuplicates: 1}); err != nil {
+		t.Fatalf("RecordScan failed: %v", err)
+	}
+
+	n, err := store.RemapPaths("/mnt/old/", "/mnt/new")
+	if err != nil {
+		t.Fatalf("RemapPaths failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 images remapped, got %d", n)
+	}
+
+	all, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	got := make(map[string]*models.ImageInfo)
+	for _, img := range all {
+		got[img.Path] = img
+	}
+	if len(got) != 4 {
+		t.Errorf("expected 4 images after remap, got %v", got)
+	}
+	if img := got["/mnt/new/a.jpg"]; img == nil || img.Hash != 1 || img.GroupID != 1 {
+		t.Errorf("/mnt/new/a.jpg should be the remapped entry with its group, got %+v", img)
+	}
+	if img := got["/mnt/new/sub/b.jpg"]; img == nil || img.GroupID != 1 {
+		t.Errorf("/mnt/new/sub/b.jpg should keep its group, got %+v", img)
+	}
+	if got["/mnt/new/日本/c.jpg"] == nil {
+		t.Error("non-ASCII path should be remapped")
+	}
+	if got["/mnt/older/d.jpg"] == nil {
+		t.Error("/mnt/older/d.jpg is not under /mnt/old and should be untouched")
+	}
+
+	ignored, _ := store.GetIgnoredPaths()
+	if len(ignored) != 1 || ignored[0] != "/mnt/new/日本/c.jpg" {
+		t.Errorf("ignore list should be remapped, got %v", ignored)
+	}
+	folders, _ := store.GetScannedFolders()
+	if len(folders) != 1 || folders[0] != "/mnt/new" {
+		t.Errorf("scan history should be remapped, got %v", folders)
+	}
+
+	groups, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Errorf("expected the group to survive the remap, got %+v", groups)
+	}
+}
+
+func TestRemapPaths_KeptFileMovedToArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	photos := filepath.Join(tmpDir, "photos")
+	archive := filepath.Join(tmpDir, "archive")
+	if err := os.MkdirAll(photos, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var images []*models.ImageInfo
+	for i, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		path := filepath.Join(photos, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &models.ImageInfo{Path: path, Hash: 1, Format: "jpeg", ModTime: now, Score: float64(300 - i), GroupID: 1})
+	}
+
+	store, err := NewStorage(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	// As clean --keep-to does: b is removed, then the kept a moves into the
+	// archive and its stored path follows
+	if err := store.DeleteImage(images[1].Path); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	dest, err := fileutil.MoveFile(images[0].Path, archive)
+	if err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if dest != filepath.Join(archive, "a.jpg") {
+		t.Errorf("MoveFile returned %s, want it in the archive", dest)
+	}
+	if n, err := store.RemapPaths(images[0].Path, dest); err != nil || n != 1 {
+		t.Fatalf("RemapPaths = %d, %v; want 1 image", n, err)
+	}
+
+	if old, _ := store.GetImage(images[0].Path); old != nil {
+		t.Errorf("old path still stored: %+v", old)
+	}
+	moved, err := store.GetImage(dest)
+	if err != nil || moved == nil || moved.GroupID != 1 {
+		t.Fatalf("GetImage(%s) = %+v, %v; want it in group 1", dest, moved, err)
+	}
+	groups, err := store.GetDuplicateGroups()
+	if err != nil {
+		t.Fatalf("GetDuplicateGroups failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Keep.Path != dest {
+		t.Errorf("groups = %+v, want group 1 kept at %s", groups, dest)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("kept file is not in the archive: %v", err)
+	}
+}
+
+// purgeFixture stores group 1 split across /mnt/old and /mnt/keep, group 2
+// entirely under /mnt/old, an ignored path and scan history for both folders
+func purgeFixture(t *testing.T) *Storage {
+	t.Helper()
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	now := time.Now()
+	images := []*models.ImageInfo{
+		{Path: "/mnt/old/a.jpg", Hash: 1, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/keep/a.jpg", Hash: 1, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/keep/a2.jpg", Hash: 1, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/old/sub/b.jpg", Hash: 2, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/old/sub/b2.jpg", Hash: 2, Format: "jpeg", ModTime: now},
+		{Path: "/mnt/older/c.jpg", Hash: 3, Format: "jpeg", ModTime: now}, // shares the prefix, not the folder
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	groups := []*models.DuplicateGroup{
+		{ID: 1, MatchMethod: models.MatchExact, Images: images[:3]},
+		{ID: 2, MatchMethod: models.MatchExact, Images: images[3:5]},
+	}
+	if err := store.UpdateGroups(groups); err != nil {
+		t.Fatalf("UpdateGroups failed: %v", err)
+	}
+	if err := store.IgnorePath("/mnt/old/sub/b2.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+	for _, folder := range []string{"/mnt/old", "/mnt/keep"} {
+		if err := store.RecordScan(models.ScanRecord{Folder: folder, TotalImages: 3, TotalGroups: 1, TotalDuplicates: 1}); err != nil {
+			t.Fatalf("RecordScan failed: %v", err)
+		}
+	}
+	return store
+}
+
+func TestPurgeByFolder(t *testing.T) {
+	store := purgeFixture(t)
+
+	n, err := store.PurgeByFolder("/mnt/old/", false)
+	if err != nil {
+		t.Fatalf("PurgeByFolder failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("purged %d images, want 3", n)
+	}
+
+	all, _ := store.GetAllImages()
+	var paths []string
+	for _, img := range all {
+		paths = append(paths, img.Path)
+	}
+	slices.Sort(paths)
+	if want := []string{"/mnt/keep/a.jpg", "/mnt/keep/a2.jpg", "/mnt/older/c.jpg"}; !slices.Equal(paths, want) {
+		t.Errorf("remaining images %v, want %v", paths, want)
+	}
+
+	groups, _ := store.GetDuplicateGroups()
+	if len(groups) != 1 || groups[0].ID != 1 || len(groups[0].Images) != 2 {
+		t.Errorf("group 1 should survive with its /mnt/keep images, got %+v", groups)
+	}
+	var orphans int
+	store.db.QueryRow("SELECT COUNT(*) FROM duplicate_groups WHERE id = 2").Scan(&orphans)
+	if orphans != 0 {
+		t.Error("group 2 lost all its images and should be dropped")
+	}
+	if ignored, _ := store.GetIgnoredPaths(); len(ignored) != 0 {
+		t.Errorf("ignored paths under the folder should be purged, got %v", ignored)
+	}
+	if folders, _ := store.GetScannedFolders(); len(folders) != 2 {
+		t.Errorf("scan history should be kept without history, got %v", folders)
+	}
+
+	if _, err := store.PurgeByFolder("/mnt/old", true); err != nil {
+		t.Fatalf("PurgeByFolder failed: %v", err)
+	}
+	if folders, _ := store.GetScannedFolders(); len(folders) != 1 || folders[0] != "/mnt/keep" {
+		t.Errorf("with history, only /mnt/keep should stay in scan history, got %v", folders)
+	}
+}
+
+func TestPurgeAll(t *testing.T) {
+	store := purgeFixture(t)
+
+	n, err := store.PurgeAll(false)
+	if err != nil {
+		t.Fatalf("PurgeAll failed: %v", err)
+	}
+	if n != 6 {
+		t.Errorf("purged %d images, want 6", n)
+	}
+	if all, _ := store.GetAllImages(); len(all) != 0 {
+		t.Errorf("expected no images left, got %d", len(all))
+	}
+	if groups, dups, _ := store.CountDuplicateGroups(); groups != 0 || dups != 0 {
+		t.Errorf("expected no groups left, got %d (%d duplicates)", groups, dups)
+	}
+	if ignored, _ := store.GetIgnoredPaths(); len(ignored) != 0 {
+		t.Errorf("expected the ignore list cleared, got %v", ignored)
+	}
+	if folders, _ := store.GetScannedFolders(); len(folders) != 2 {
+		t.Errorf("scan history should be kept without history, got %v", folders)
+	}
+
+	if _, err := store.PurgeAll(true); err != nil {
+		t.Fatalf("PurgeAll failed: %v", err)
+	}
+	if folders, _ := store.GetScannedFolders(); len(folders) != 0 {
+		t.Errorf("with history, scan history should be cleared, got %v", folders)
+	}
+	if current, latest := store.SchemaVersion(); current != latest {
+		t.Errorf("schema version %d after purge, want %d", current, latest)
+	}
+}
+
+func TestHashVariant_RoundTrip(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	images := []*models.ImageInfo{
+		{Path: "/a.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now()},
+		{Path: "/b.jpg", Hash: 2, HashVariant: "luma", Format: "jpeg", ModTime: time.Now()},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	got, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	variants := make(map[string]string)
+	for _, img := range got {
+		variants[img.Path] = img.HashVariant
+	}
+	if variants["/a.jpg"] != "" || variants["/b.jpg"] != "luma" {
+		t.Errorf("unexpected variants after round trip: %v", variants)
+	}
+}
+
+func TestBlurHash_RoundTrip(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	const blur = "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+	images := []*models.ImageInfo{
+		{Path: "/a.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now()},
+		{Path: "/b.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now(), BlurHash: blur},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	got, err := store.GetAllImages()
+	if err != nil {
+		t.Fatalf("GetAllImages failed: %v", err)
+	}
+	hashes := make(map[string]string)
+	for _, img := range got {
+		hashes[img.Path] = img.BlurHash
+	}
+	if hashes["/a.jpg"] != "" || hashes["/b.jpg"] != blur {
+		t.Errorf("unexpected blurhashes after round trip: %v", hashes)
+	}
+
+	key := models.ContentKey{Size: 1, ModTime: time.Now(), Sample: "ab"}
+	if err := store.PutCachedHash(key, images[1]); err != nil {
+		t.Fatalf("PutCachedHash failed: %v", err)
+	}
+	if cached, err := store.GetCachedHash(key); err != nil || cached == nil || cached.BlurHash != blur {
+		t.Errorf("GetCachedHash = %+v, %v; want BlurHash %q", cached, err, blur)
+	}
+}
+
+func TestCameraTags_RoundTrip(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	img := &models.ImageInfo{
+		Path: "/a.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now(), HasExif: true,
+		CameraMake: "NIKON CORPORATION", CameraModel: "NIKON Z 6", Software: "Ver.01.00",
+	}
+	if err := store.SaveImages([]*models.ImageInfo{img}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	got, err := store.GetAllImages()
+	if err != nil || len(got) != 1 {
+		t.Fatalf("GetAllImages = %v, %v", got, err)
+	}
+	if got[0].CameraMake != img.CameraMake || got[0].CameraModel != img.CameraModel || got[0].Software != img.Software {
+		t.Errorf("camera tags after round trip = %q/%q/%q", got[0].CameraMake, got[0].CameraModel, got[0].Software)
+	}
+
+	key := models.ContentKey{Size: 1, ModTime: time.Now(), Sample: "ab"}
+	if err := store.PutCachedHash(key, img); err != nil {
+		t.Fatalf("PutCachedHash failed: %v", err)
+	}
+	cached, err := store.GetCachedHash(key)
+	if err != nil || cached == nil || cached.CameraModel != img.CameraModel || cached.Software != img.Software {
+		t.Errorf("GetCachedHash = %+v, %v; want camera tags", cached, err)
+	}
+}
+
+// TestDerivedFields_RoundTrip covers the columns computed while hashing that
+// the policies and matcher read back: orientation hashes, the dHash,
+// sharpness and the EXIF tag count, in images and in hash_cache
+func TestDerivedFields_RoundTrip(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	turned := []uint64{0xFFFF0000FFFF0000, ^uint64(0), 1, 0}
+	images := []*models.ImageInfo{
+		{Path: "/a.jpg", Hash: 1, Format: "jpeg", ModTime: time.Now(), OrientationHashes: turned, DHash: 1 << 63, Sharpness: 812.25, ExifTagCount: 23},
+		{Path: "/b.jpg", Hash: 2, Format: "jpeg", ModTime: time.Now()},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	got, err := store.GetAllImages()
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetAllImages = %v, %v", got, err)
+	}
+	if !slices.Equal(got[0].OrientationHashes, turned) || got[1].OrientationHashes != nil {
+		t.Errorf("orientation hashes after round trip = %x, %x", got[0].OrientationHashes, got[1].OrientationHashes)
+	}
+	if got[0].DHash != 1<<63 || got[1].DHash != 0 {
+		t.Errorf("dHash after round trip = %x, %x", got[0].DHash, got[1].DHash)
+	}
+	if got[0].Sharpness != 812.25 || got[1].Sharpness != 0 {
+		t.Errorf("sharpness after round trip = %v, %v", got[0].Sharpness, got[1].Sharpness)
+	}
+	if got[0].ExifTagCount != 23 || got[1].ExifTagCount != 0 {
+		t.Errorf("EXIF tag count after round trip = %d, %d", got[0].ExifTagCount, got[1].ExifTagCount)
+	}
+
+	key := models.ContentKey{Size: 1, ModTime: time.Now(), Sample: "ab"}
+	if err := store.PutCachedHash(key, images[0]); err != nil {
+		t.Fatalf("PutCachedHash failed: %v", err)
+	}
+	cached, err := store.GetCachedHash(key)
+	if err != nil || cached == nil || !slices.Equal(cached.OrientationHashes, turned) || cached.Sharpness != 812.25 ||
+		cached.ExifTagCount != 23 || cached.DHash != 1<<63 {
+		t.Errorf("GetCachedHash = %+v, %v; want orientation hashes, dHash, sharpness and EXIF tag count", cached, err)
+	}
+}
+
+func TestReadOnly_ReadsButRejectsWrites(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	saveGroupedImages(t, store, 3, 2)
+	store.Close()
+	before, _ := os.ReadDir(dir)
+
+	ro, err := NewStorage(dbPath, WithReadOnly())
+	if err != nil {
+		t.Fatalf("read-only open failed: %v", err)
+	}
+	defer ro.Close()
+
+	images, err := ro.GetAllImages()
+	if err != nil || len(images) != 9 {
+		t.Fatalf("GetAllImages = %d images, %v; want 9", len(images), err)
+	}
+	if groups, err := ro.GetDuplicateGroups(); err != nil || len(groups) != 3 {
+		t.Errorf("GetDuplicateGroups = %d groups, %v; want 3", len(groups), err)
+	}
+
+	err = ro.SaveImages([]*models.ImageInfo{{Path: "/new.jpg", Format: "jpeg", ModTime: time.Now()}})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SaveImages = %v, want ErrReadOnly", err)
+	}
+	if err := ro.IgnorePath("/a.jpg"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("IgnorePath = %v, want ErrReadOnly", err)
+	}
+
+	// No -wal, -shm or lock files next to the database
+	after, _ := os.ReadDir(dir)
+	if len(after) != len(before) {
+		t.Errorf("read-only open created files: %v -> %v", before, after)
+	}
+}
+
+func TestReadOnly_MissingOrOutdatedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.db")
+	if _, err := NewStorage(missing, WithReadOnly()); err == nil {
+		t.Error("opening a missing database read-only should fail")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("read-only open created the database")
+	}
+
+	dbPath := filepath.Join(dir, "old.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	if _, err := store.db.Exec("DELETE FROM schema_version WHERE version > 5"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if _, err := NewStorage(dbPath, WithReadOnly()); err == nil {
+		t.Error("opening an outdated database read-only should fail")
+	}
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	saveGroupedImages(t, store, 200, 5)
+	if err := store.IntegrityCheck(); err != nil {
+		t.Fatalf("healthy database: %v", err)
+	}
+	if current, latest := store.SchemaVersion(); current != latest {
+		t.Errorf("schema version = %d, want %d", current, latest)
+	}
+	store.Close()
+
+	// Overwrite a page in the middle of the file, leaving the header and
+	// schema page intact so the database still opens
+	f, err := os.OpenFile(dbPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := bytes.Repeat([]byte{0xA5}, 4096)
+	if _, err := f.WriteAt(garbage, stat.Size()/2/4096*4096); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store, err = NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage on corrupted file: %v", err)
+	}
+	defer store.Close()
+	if err := store.IntegrityCheck(); err == nil {
+		t.Error("expected an error for a corrupted database")
+	}
+}
+
+func TestRemapPaths_FollowsSidecarLinks(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	raw := &models.ImageInfo{Path: "/photos/IMG_1234.CR2", Format: "cr2", ModTime: time.Now(), SidecarOf: "/photos/IMG_1234.JPG"}
+	jpg := &models.ImageInfo{Path: "/photos/IMG_1234.JPG", Format: "jpeg", ModTime: time.Now(), SidecarOf: "/photos/IMG_1234.CR2"}
+	if err := store.SaveImages([]*models.ImageInfo{raw, jpg}); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	if got, err := store.GetImage(raw.Path); err != nil || got == nil || got.SidecarOf != jpg.Path {
+		t.Fatalf("GetImage(%s) = %+v, %v; want SidecarOf %s", raw.Path, got, err, jpg.Path)
+	}
+
+	if _, err := store.RemapPaths(raw.Path, "/archive/IMG_1234.CR2"); err != nil {
+		t.Fatalf("RemapPaths failed: %v", err)
+	}
+	got, err := store.GetImage(jpg.Path)
+	if err != nil || got == nil {
+		t.Fatalf("GetImage(%s) = %v, %v", jpg.Path, got, err)
+	}
+	if got.SidecarOf != "/archive/IMG_1234.CR2" {
+		t.Errorf("SidecarOf = %q after moving the RAW, want its new path", got.SidecarOf)
+	}
+}
+
+func TestGetCanonicalImages_OnePerUniqueImage(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	images := []*models.ImageInfo{
+		{Path: "/a1.jpg", Hash: 1, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 1},
+		{Path: "/a2.jpg", Hash: 1, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 1},
+		{Path: "/a3.jpg", Hash: 1, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 8000, GroupID: 1},
+		{Path: "/b1.png", Hash: 2, Format: "png", FileSize: 2000, ModTime: time.Now(), Score: 40000, GroupID: 2},
+		{Path: "/b2.png", Hash: 2, Format: "png", FileSize: 2000, ModTime: time.Now(), Score: 48000, GroupID: 2},
+		{Path: "/c.jpg", Hash: 3, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000},
+		{Path: "/d1.jpg", Hash: 4, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 10000, GroupID: 3},
+		{Path: "/d2.jpg", Hash: 4, Format: "jpeg", FileSize: 1000, ModTime: time.Now(), Score: 9000, GroupID: 3},
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+	// Ignoring one of a pair leaves both as images of their own
+	if err := store.IgnorePath("/d1.jpg"); err != nil {
+		t.Fatalf("IgnorePath failed: %v", err)
+	}
+
+	canonical, err := store.GetCanonicalImages()
+	if err != nil {
+		t.Fatalf("GetCanonicalImages failed: %v", err)
+	}
+	var got []string
+	for _, img := range canonical {
+		got = append(got, img.Path)
+	}
+	want := []string{"/a1.jpg", "/b2.png", "/c.jpg", "/d1.jpg", "/d2.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("canonical = %v, want %v: each group's kept image and every ungrouped one", got, want)
+	}
+
+	// The keep policy decides which member represents a group
+	lowest := func(a, b *models.ImageInfo) int { return cmp.Compare(a.Score, b.Score) }
+	canonical, err = store.GetCanonicalImages(lowest)
+	if err != nil {
+		t.Fatalf("GetCanonicalImages failed: %v", err)
+	}
+	if len(canonical) != len(want) || canonical[0].Path != "/a3.jpg" {
+		t.Errorf("with a lowest-score policy, canonical = %v, want /a3.jpg first", canonical)
+	}
+}
+
+func TestIterateImages(t *testing.T) {
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+
+	var images []*models.ImageInfo
+	for i := range 50 {
+		images = append(images, &models.ImageInfo{
+			Path: fmt.Sprintf("/photos/%03d.jpg", i), Hash: uint64(i), Format: "jpeg", FileSize: 1000, ModTime: time.Now(),
+		})
+	}
+	if err := store.SaveImages(images); err != nil {
+		t.Fatalf("SaveImages failed: %v", err)
+	}
+
+	seen := make(map[string]int)
+	var order []string
+	err = store.IterateImages(func(img *models.ImageInfo) error {
+		seen[img.Path]++
+		order = append(order, img.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("IterateImages failed: %v", err)
+	}
+	if len(seen) != len(images) {
+		t.Errorf("visited %d distinct images, want %d", len(seen), len(images))
+	}
+	for path, n := range seen {
+		if n != 1 {
+			t.Errorf("%s visited %d times, want once", path, n)
+		}
+	}
+	if !slices.IsSorted(order) {
+		t.Error("images not visited in path order")
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err = store.IterateImages(func(img *models.ImageInfo) error {
+		visited++
+		if visited == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("IterateImages returned %v, want the callback's error", err)
+	}
+	if visited != 10 {
+		t.Errorf("callback ran %d times, want it to stop after the error at 10", visited)
+	}
+}
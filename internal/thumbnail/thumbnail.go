@@ -0,0 +1,72 @@
+// Package thumbnail renders downscaled previews of images, for the web UI
+// and the HTML report.
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"imagedupfinder/internal/hash"
+)
+
+// JPEGQuality is the quality of lossy thumbnails
+const JPEGQuality = 80
+
+// Render decodes the image at path and re-encodes it scaled down to fit
+// within maxDim×maxDim, returning the encoded bytes and their content type.
+// With webp, the thumbnail is lossless WebP, which keeps line art and text
+// sharp. Otherwise formats that may carry transparency are encoded as PNG
+// and the rest as JPEG. Re-encoding also makes formats browsers cannot
+// display natively (e.g. TIFF, RAW previews) viewable.
+func Render(path string, maxDim int, webp bool) ([]byte, string, error) {
+	f, err := hash.OpenFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	src, format, err := hash.DecodeImage(path, f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > maxDim || h > maxDim {
+		scale := float64(maxDim) / float64(max(w, h))
+		w = max(int(float64(w)*scale+0.5), 1)
+		h = max(int(float64(h)*scale+0.5), 1)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if webp {
+		if err := nativewebp.Encode(&buf, dst, nil); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/webp", nil
+	}
+	switch format {
+	case "png", "gif", "webp":
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	default:
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+}
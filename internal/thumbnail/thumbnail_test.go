@@ -0,0 +1,56 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+
+	tests := []struct {
+		name   string
+		encode func(*os.File) error
+		webp   bool
+		want   string
+	}{
+		{"photo.jpg", func(f *os.File) error { return jpeg.Encode(f, src, nil) }, false, "image/jpeg"},
+		{"art.png", func(f *os.File) error { return png.Encode(f, src) }, false, "image/png"},
+		{"art.png", func(f *os.File) error { return png.Encode(f, src) }, true, "image/webp"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.encode(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		data, contentType, err := Render(path, 64, tt.webp)
+		if err != nil {
+			t.Fatalf("%s (webp=%v): Render failed: %v", tt.name, tt.webp, err)
+		}
+		if contentType != tt.want {
+			t.Errorf("%s (webp=%v): content type %q, want %q", tt.name, tt.webp, contentType, tt.want)
+		}
+		if tt.webp {
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: thumbnail does not decode: %v", tt.name, err)
+		}
+		if cfg.Width != 64 || cfg.Height != 32 {
+			t.Errorf("%s: thumbnail is %dx%d, want 64x32", tt.name, cfg.Width, cfg.Height)
+		}
+	}
+}